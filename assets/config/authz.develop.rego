@@ -11,3 +11,11 @@ allow = response {
         "ok": true
     }
 }
+
+default admin := false
+
+admin = response {
+    response := {
+        "ok": true
+    }
+}
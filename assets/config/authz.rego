@@ -13,3 +13,62 @@ allow = response {
         "ok": true
     }
 }
+
+allow = response {
+    input.method == "POST"
+    input.path == ["ngsi-ld", "v1", "entityOperations", "query"]
+
+    response := {
+        "ok": true
+    }
+}
+
+#
+# The admin rule guards the administrative endpoints, such as the dead letters of the
+# notifier. Access is only granted to tokens that have been signed by the issuer in the
+# ADMIN_TOKEN_ISSUER environment variable, that have not expired and that hold the
+# context-broker-admin realm role. The keys of the issuer are looked up through its
+# OpenID configuration.
+#
+
+default admin := false
+
+admin = response {
+    input.path[0] == "admin"
+
+    [valid, _, payload] := io.jwt.decode_verify(input.token, {
+        "cert": admin_token_keys,
+        "iss": admin_token_issuer,
+    })
+    valid == true
+
+    payload.realm_access.roles[_] == "context-broker-admin"
+
+    response := {
+        "ok": true
+    }
+}
+
+admin_token_issuer := opa.runtime().env.ADMIN_TOKEN_ISSUER
+
+admin_token_keys = keys {
+    openid_configuration := http.send({
+        "method": "GET",
+        "url": concat("", [trim_right(admin_token_issuer, "/"), "/.well-known/openid-configuration"]),
+        "force_cache": true,
+        "force_cache_duration_seconds": 3600,
+        "raise_error": false,
+    })
+    openid_configuration.status_code == 200
+
+    jwks := http.send({
+        "method": "GET",
+        "url": openid_configuration.body.jwks_uri,
+        "force_cache": true,
+        "force_cache_duration_seconds": 3600,
+        "raise_error": false,
+    })
+    jwks.status_code == 200
+
+    keys := jwks.raw_body
+}
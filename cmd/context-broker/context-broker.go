@@ -7,12 +7,14 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/diwise/context-broker/internal/pkg/application/cim"
 	"github.com/diwise/context-broker/internal/pkg/application/config"
 	contextbroker "github.com/diwise/context-broker/internal/pkg/application/context-broker"
 	"github.com/diwise/context-broker/internal/pkg/infrastructure/router"
 	ngsild "github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
 	"github.com/diwise/service-chassis/pkg/infrastructure/buildinfo"
 	"github.com/diwise/service-chassis/pkg/infrastructure/env"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
@@ -47,10 +49,17 @@ func main() {
 	}
 	defer policyFile.Close()
 
-	app, r := initialize(ctx, configFile, policyFile)
+	app, authenticator, limiter, r := initialize(ctx, configFile, policyFile)
 	app.Start()
 	defer app.Stop()
 
+	reloadInterval, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "CONFIG_RELOAD_INTERVAL", "30s"))
+	if err != nil {
+		fatal(ctx, "invalid config reload interval", err)
+	}
+
+	watchForChanges(ctx, reloadInterval, []cim.ConfigurationReloader{app, limiter}, authenticator)
+
 	port := env.GetVariableOrDefault(ctx, "SERVICE_PORT", "8080")
 
 	logger.Info("starting to listen for connections", "port", port)
@@ -61,7 +70,7 @@ func main() {
 	}
 }
 
-func initialize(ctx context.Context, brokerConfig io.Reader, authPolices io.Reader) (cim.ContextInformationManager, *chi.Mux) {
+func initialize(ctx context.Context, brokerConfig io.Reader, authPolices io.Reader) (cim.ContextInformationManager, auth.Enticator, *ngsild.RateLimiter, *chi.Mux) {
 	cfg, err := config.Load(brokerConfig)
 	if err != nil {
 		fatal(ctx, "failed to load configuration", err)
@@ -72,10 +81,15 @@ func initialize(ctx context.Context, brokerConfig io.Reader, authPolices io.Read
 		fatal(ctx, "failed to configure the context broker", err)
 	}
 
+	limiter := ngsild.NewRateLimiter(*cfg)
+
 	r := router.New(serviceName)
-	ngsild.RegisterHandlers(ctx, r, authPolices, app)
+	authenticator, err := ngsild.RegisterHandlers(ctx, r, authPolices, app, limiter)
+	if err != nil {
+		fatal(ctx, "failed to register handlers", err)
+	}
 
-	return app, r
+	return app, authenticator, limiter, r
 }
 
 func fatal(ctx context.Context, msg string, err error) {
@@ -40,7 +40,7 @@ func TestIntegrateRetriveTemporalEvolutionOfEntity(t *testing.T) {
 		),
 	)
 
-	app, r := initialize(ctx, newTestConfig(ms.URL()), newAuthConfig())
+	app, _, _, r := initialize(ctx, newTestConfig(ms.URL()), newAuthConfig())
 	app.Start()
 	defer app.Stop()
 
@@ -75,7 +75,7 @@ func TestIntegrateQueryTemporalEvolutionOfEntities(t *testing.T) {
 		),
 	)
 
-	app, r := initialize(ctx, newTestConfig(ms.URL()), newAuthConfig())
+	app, _, _, r := initialize(ctx, newTestConfig(ms.URL()), newAuthConfig())
 	app.Start()
 	defer app.Stop()
 
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// watchedFile is a file that is reloaded when its size or modification time changes
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	reload  func(ctx context.Context, contents io.Reader) error
+}
+
+func newWatchedFile(path string, reload func(context.Context, io.Reader) error) *watchedFile {
+	f := &watchedFile{path: path, reload: reload}
+	f.changed()
+	return f
+}
+
+// changed reports if the file has changed since the last call
+func (f *watchedFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false
+	}
+
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return true
+}
+
+func (f *watchedFile) load(ctx context.Context) {
+	logger := logging.GetFromContext(ctx).With("file", f.path)
+
+	contents, err := os.Open(f.path)
+	if err != nil {
+		logger.Error("failed to open file for reload, keeping current version", "err", err.Error())
+		return
+	}
+	defer contents.Close()
+
+	err = f.reload(ctx, contents)
+	if err != nil {
+		logger.Error("failed to reload file, keeping current version", "err", err.Error())
+		return
+	}
+
+	logger.Info("reloaded file")
+}
+
+// reload validates the configuration with every reloader, and only then reloads them all with it
+func reload(ctx context.Context, cfg config.Config, reloaders []cim.ConfigurationReloader) error {
+	for _, r := range reloaders {
+		if err := r.Validate(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+
+	for _, r := range reloaders {
+		if err := r.Reload(ctx, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// watchForChanges reloads the broker configuration and the authorization policies when their files
+// change on disk, polling for changes at the given interval, or when the process receives a SIGHUP.
+// Polling is disabled if the interval is zero. The configuration is validated by all of the reloaders
+// before any of them is reloaded, so that a configuration that one of them rejects is not applied
+// by the others either.
+func watchForChanges(ctx context.Context, interval time.Duration, reloaders []cim.ConfigurationReloader, authenticator auth.Enticator) {
+	files := []*watchedFile{
+		newWatchedFile(configFilePath, func(ctx context.Context, contents io.Reader) error {
+			cfg, err := config.Load(contents)
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			return reload(ctx, *cfg, reloaders)
+		}),
+		newWatchedFile(opaFilePath, authenticator.Reload),
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hangup)
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				for _, f := range files {
+					f.changed()
+					f.load(ctx)
+				}
+			case <-tick:
+				for _, f := range files {
+					if f.changed() {
+						f.load(ctx)
+					}
+				}
+			}
+		}
+	}()
+}
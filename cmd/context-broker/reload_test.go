@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsild "github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld"
+	"github.com/matryer/is"
+)
+
+func TestThatNothingIsReloadedIfAnyReloaderRejectsTheConfiguration(t *testing.T) {
+	is := is.New(t)
+
+	app := &cim.ContextInformationManagerMock{
+		ValidateFunc: func(ctx context.Context, cfg config.Config) error { return nil },
+		ReloadFunc:   func(ctx context.Context, cfg config.Config) error { return nil },
+	}
+
+	limiter := ngsild.NewRateLimiter(config.Config{})
+
+	invalid := config.Config{Tenants: []config.Tenant{{
+		ID:         "default",
+		RateLimits: config.RateLimitConfig{Tenant: config.RateLimitBudgets{Read: config.RateLimit{Rate: -1}}},
+	}}}
+
+	err := reload(context.Background(), invalid, []cim.ConfigurationReloader{app, limiter})
+	is.True(err != nil)
+	is.Equal(len(app.ReloadCalls()), 0) // the app should not be reloaded when the limiter rejects the configuration
+
+	err = reload(context.Background(), config.Config{}, []cim.ConfigurationReloader{app, limiter})
+	is.NoErr(err)
+	is.Equal(len(app.ReloadCalls()), 1)
+}
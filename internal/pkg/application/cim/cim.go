@@ -4,14 +4,32 @@ import (
 	"context"
 	"time"
 
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	subs "github.com/diwise/context-broker/internal/pkg/application/subscriptions"
 	"github.com/diwise/context-broker/pkg/ngsild"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
 )
 
 type EntityAttributesUpdater interface {
 	UpdateEntityAttributes(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error)
 }
 
+type EntityAttributesAppender interface {
+	AppendEntityAttributes(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error)
+}
+
+type EntityAttributePatcher interface {
+	PatchAttribute(ctx context.Context, tenant, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error)
+}
+
+// EntityAttributeDeleter deletes an attribute of an entity. Only the instance with the dataset id
+// is deleted if one is given, or all instances of the attribute if deleteAll is true.
+type EntityAttributeDeleter interface {
+	DeleteAttribute(ctx context.Context, tenant, entityID, attributeName, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error)
+}
+
 type EntityCreator interface {
 	CreateEntity(ctx context.Context, tenant string, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error)
 }
@@ -20,6 +38,14 @@ type EntityMerger interface {
 	MergeEntity(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error)
 }
 
+type EntityReplacer interface {
+	ReplaceEntity(ctx context.Context, tenant, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error)
+}
+
+type EntityAttributeReplacer interface {
+	ReplaceAttribute(ctx context.Context, tenant, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error)
+}
+
 type EntityQuerier interface {
 	QueryEntities(ctx context.Context, tenant string, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error)
 }
@@ -54,21 +80,126 @@ type EntityDeleter interface {
 	DeleteEntity(ctx context.Context, tenant, entityID string) (*ngsild.DeleteEntityResult, error)
 }
 
+type EntityBatchCreator interface {
+	CreateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+}
+
+type EntityBatchUpserter interface {
+	UpsertEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+}
+
+type EntityBatchUpdater interface {
+	UpdateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+}
+
+type EntityBatchDeleter interface {
+	DeleteEntities(ctx context.Context, tenant string, entityIDs []string) (*ngsild.BatchOperationResult, error)
+}
+
+type ContextSourceRegistrar interface {
+	RegisterContextSource(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error)
+}
+
+type ContextSourceRegistrationRetriever interface {
+	RetrieveContextSourceRegistration(ctx context.Context, tenant, registrationID string) (*registrations.ContextSourceRegistration, error)
+}
+
+type ContextSourceRegistrationQuerier interface {
+	QueryContextSourceRegistrations(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error)
+}
+
+type ContextSourceRegistrationUpdater interface {
+	UpdateContextSourceRegistration(ctx context.Context, tenant, registrationID string, fragment registrations.ContextSourceRegistration) error
+}
+
+type ContextSourceRegistrationDeleter interface {
+	DeleteContextSourceRegistration(ctx context.Context, tenant, registrationID string) error
+}
+
+type SubscriptionCreator interface {
+	CreateSubscription(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error)
+}
+
+type SubscriptionRetriever interface {
+	RetrieveSubscription(ctx context.Context, tenant, subscriptionID string) (*subscriptions.Subscription, error)
+}
+
+type SubscriptionQuerier interface {
+	QuerySubscriptions(ctx context.Context, tenant string) ([]subscriptions.Subscription, error)
+}
+
+type SubscriptionUpdater interface {
+	UpdateSubscription(ctx context.Context, tenant, subscriptionID string, fragment subscriptions.Subscription) error
+}
+
+type SubscriptionDeleter interface {
+	DeleteSubscription(ctx context.Context, tenant, subscriptionID string) error
+}
+
+type DeadLetterQuerier interface {
+	QueryDeadLetters(ctx context.Context, tenant string) ([]subs.DeadLetter, error)
+}
+
+// DeadLetterReplayer attempts to deliver dead letters once more. All of the dead letters of the
+// tenant are replayed if no ids are given.
+type DeadLetterReplayer interface {
+	ReplayDeadLetters(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error)
+}
+
+type DeadLetterDeleter interface {
+	DeleteDeadLetter(ctx context.Context, tenant, letterID string) error
+}
+
+// ConfigurationReloader replaces the configuration of a running component. Validate lets a new
+// configuration be checked by every component before any of them is reloaded with it.
+type ConfigurationReloader interface {
+	Validate(ctx context.Context, cfg config.Config) error
+	Reload(ctx context.Context, cfg config.Config) error
+}
+
 //go:generate moq -rm -out cim_mock.go . ContextInformationManager
 
 type ContextInformationManager interface {
 	EntityAttributesUpdater
+	EntityAttributesAppender
+	EntityAttributePatcher
+	EntityAttributeDeleter
 	EntityCreator
 	EntityMerger
+	EntityReplacer
+	EntityAttributeReplacer
 	EntityQuerier
 	EntityRetriever
 	EntityDeleter
 
+	EntityBatchCreator
+	EntityBatchUpserter
+	EntityBatchUpdater
+	EntityBatchDeleter
+
 	EntityTemporalQuerier
 	EntityTemporalRetriever
 
 	TypesRetriever
 
+	ContextSourceRegistrar
+	ContextSourceRegistrationRetriever
+	ContextSourceRegistrationQuerier
+	ContextSourceRegistrationUpdater
+	ContextSourceRegistrationDeleter
+
+	SubscriptionCreator
+	SubscriptionRetriever
+	SubscriptionQuerier
+	SubscriptionUpdater
+	SubscriptionDeleter
+
+	DeadLetterQuerier
+	DeadLetterReplayer
+	DeadLetterDeleter
+
+	ConfigurationReloader
+
 	Start() error
 	Stop() error
 }
@@ -5,8 +5,12 @@ package cim
 
 import (
 	"context"
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	subs "github.com/diwise/context-broker/internal/pkg/application/subscriptions"
 	"github.com/diwise/context-broker/pkg/ngsild"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
 	"sync"
 )
 
@@ -20,24 +24,81 @@ var _ ContextInformationManager = &ContextInformationManagerMock{}
 //
 // 		// make and configure a mocked ContextInformationManager
 // 		mockedContextInformationManager := &ContextInformationManagerMock{
+// 			AppendEntityAttributesFunc: func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+// 				panic("mock out the AppendEntityAttributes method")
+// 			},
+// 			CreateEntitiesFunc: func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the CreateEntities method")
+// 			},
 // 			CreateEntityFunc: func(ctx context.Context, tenant string, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
 // 				panic("mock out the CreateEntity method")
 // 			},
+// 			CreateSubscriptionFunc: func(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error) {
+// 				panic("mock out the CreateSubscription method")
+// 			},
+// 			DeleteAttributeFunc: func(ctx context.Context, tenant string, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+// 				panic("mock out the DeleteAttribute method")
+// 			},
+// 			DeleteContextSourceRegistrationFunc: func(ctx context.Context, tenant string, registrationID string) error {
+// 				panic("mock out the DeleteContextSourceRegistration method")
+// 			},
+// 			DeleteDeadLetterFunc: func(ctx context.Context, tenant string, letterID string) error {
+// 				panic("mock out the DeleteDeadLetter method")
+// 			},
+// 			DeleteEntitiesFunc: func(ctx context.Context, tenant string, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the DeleteEntities method")
+// 			},
 // 			DeleteEntityFunc: func(ctx context.Context, tenant string, entityID string) (*ngsild.DeleteEntityResult, error) {
 // 				panic("mock out the DeleteEntity method")
 // 			},
+// 			DeleteSubscriptionFunc: func(ctx context.Context, tenant string, subscriptionID string) error {
+// 				panic("mock out the DeleteSubscription method")
+// 			},
 // 			MergeEntityFunc: func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
 // 				panic("mock out the MergeEntity method")
 // 			},
+// 			PatchAttributeFunc: func(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+// 				panic("mock out the PatchAttribute method")
+// 			},
+// 			QueryContextSourceRegistrationsFunc: func(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error) {
+// 				panic("mock out the QueryContextSourceRegistrations method")
+// 			},
+// 			QueryDeadLettersFunc: func(ctx context.Context, tenant string) ([]subs.DeadLetter, error) {
+// 				panic("mock out the QueryDeadLetters method")
+// 			},
 // 			QueryEntitiesFunc: func(ctx context.Context, tenant string, entityTypes []string, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
 // 				panic("mock out the QueryEntities method")
 // 			},
+// 			QuerySubscriptionsFunc: func(ctx context.Context, tenant string) ([]subscriptions.Subscription, error) {
+// 				panic("mock out the QuerySubscriptions method")
+// 			},
 // 			QueryTemporalEvolutionOfEntitiesFunc: func(ctx context.Context, tenant string, entityIDs []string, entityTypes []string, params TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error) {
 // 				panic("mock out the QueryTemporalEvolutionOfEntities method")
 // 			},
+// 			RegisterContextSourceFunc: func(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error) {
+// 				panic("mock out the RegisterContextSource method")
+// 			},
+// 			ReloadFunc: func(ctx context.Context, cfg config.Config) error {
+// 				panic("mock out the Reload method")
+// 			},
+// 			ReplaceAttributeFunc: func(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+// 				panic("mock out the ReplaceAttribute method")
+// 			},
+// 			ReplaceEntityFunc: func(ctx context.Context, tenant string, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+// 				panic("mock out the ReplaceEntity method")
+// 			},
+// 			ReplayDeadLettersFunc: func(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error) {
+// 				panic("mock out the ReplayDeadLetters method")
+// 			},
+// 			RetrieveContextSourceRegistrationFunc: func(ctx context.Context, tenant string, registrationID string) (*registrations.ContextSourceRegistration, error) {
+// 				panic("mock out the RetrieveContextSourceRegistration method")
+// 			},
 // 			RetrieveEntityFunc: func(ctx context.Context, tenant string, entityID string, headers map[string][]string) (types.Entity, error) {
 // 				panic("mock out the RetrieveEntity method")
 // 			},
+// 			RetrieveSubscriptionFunc: func(ctx context.Context, tenant string, subscriptionID string) (*subscriptions.Subscription, error) {
+// 				panic("mock out the RetrieveSubscription method")
+// 			},
 // 			RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, tenant string, entityID string, params TemporalQueryParams, headers map[string][]string) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
 // 				panic("mock out the RetrieveTemporalEvolutionOfEntity method")
 // 			},
@@ -50,9 +111,24 @@ var _ ContextInformationManager = &ContextInformationManagerMock{}
 // 			StopFunc: func() error {
 // 				panic("mock out the Stop method")
 // 			},
+// 			UpdateContextSourceRegistrationFunc: func(ctx context.Context, tenant string, registrationID string, fragment registrations.ContextSourceRegistration) error {
+// 				panic("mock out the UpdateContextSourceRegistration method")
+// 			},
+// 			UpdateEntitiesFunc: func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the UpdateEntities method")
+// 			},
 // 			UpdateEntityAttributesFunc: func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
 // 				panic("mock out the UpdateEntityAttributes method")
 // 			},
+// 			UpdateSubscriptionFunc: func(ctx context.Context, tenant string, subscriptionID string, fragment subscriptions.Subscription) error {
+// 				panic("mock out the UpdateSubscription method")
+// 			},
+// 			UpsertEntitiesFunc: func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the UpsertEntities method")
+// 			},
+// 			ValidateFunc: func(ctx context.Context, cfg config.Config) error {
+// 				panic("mock out the Validate method")
+// 			},
 // 		}
 //
 // 		// use mockedContextInformationManager in code that requires ContextInformationManager
@@ -60,24 +136,81 @@ var _ ContextInformationManager = &ContextInformationManagerMock{}
 //
 // 	}
 type ContextInformationManagerMock struct {
+	// AppendEntityAttributesFunc mocks the AppendEntityAttributes method.
+	AppendEntityAttributesFunc func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error)
+
+	// CreateEntitiesFunc mocks the CreateEntities method.
+	CreateEntitiesFunc func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
 	// CreateEntityFunc mocks the CreateEntity method.
 	CreateEntityFunc func(ctx context.Context, tenant string, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error)
 
+	// CreateSubscriptionFunc mocks the CreateSubscription method.
+	CreateSubscriptionFunc func(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error)
+
+	// DeleteAttributeFunc mocks the DeleteAttribute method.
+	DeleteAttributeFunc func(ctx context.Context, tenant string, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error)
+
+	// DeleteContextSourceRegistrationFunc mocks the DeleteContextSourceRegistration method.
+	DeleteContextSourceRegistrationFunc func(ctx context.Context, tenant string, registrationID string) error
+
+	// DeleteDeadLetterFunc mocks the DeleteDeadLetter method.
+	DeleteDeadLetterFunc func(ctx context.Context, tenant string, letterID string) error
+
+	// DeleteEntitiesFunc mocks the DeleteEntities method.
+	DeleteEntitiesFunc func(ctx context.Context, tenant string, entityIDs []string) (*ngsild.BatchOperationResult, error)
+
 	// DeleteEntityFunc mocks the DeleteEntity method.
 	DeleteEntityFunc func(ctx context.Context, tenant string, entityID string) (*ngsild.DeleteEntityResult, error)
 
+	// DeleteSubscriptionFunc mocks the DeleteSubscription method.
+	DeleteSubscriptionFunc func(ctx context.Context, tenant string, subscriptionID string) error
+
 	// MergeEntityFunc mocks the MergeEntity method.
 	MergeEntityFunc func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error)
 
+	// PatchAttributeFunc mocks the PatchAttribute method.
+	PatchAttributeFunc func(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error)
+
+	// QueryContextSourceRegistrationsFunc mocks the QueryContextSourceRegistrations method.
+	QueryContextSourceRegistrationsFunc func(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error)
+
+	// QueryDeadLettersFunc mocks the QueryDeadLetters method.
+	QueryDeadLettersFunc func(ctx context.Context, tenant string) ([]subs.DeadLetter, error)
+
 	// QueryEntitiesFunc mocks the QueryEntities method.
 	QueryEntitiesFunc func(ctx context.Context, tenant string, entityTypes []string, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error)
 
+	// QuerySubscriptionsFunc mocks the QuerySubscriptions method.
+	QuerySubscriptionsFunc func(ctx context.Context, tenant string) ([]subscriptions.Subscription, error)
+
 	// QueryTemporalEvolutionOfEntitiesFunc mocks the QueryTemporalEvolutionOfEntities method.
 	QueryTemporalEvolutionOfEntitiesFunc func(ctx context.Context, tenant string, entityIDs []string, entityTypes []string, params TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error)
 
+	// RegisterContextSourceFunc mocks the RegisterContextSource method.
+	RegisterContextSourceFunc func(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error)
+
+	// ReloadFunc mocks the Reload method.
+	ReloadFunc func(ctx context.Context, cfg config.Config) error
+
+	// ReplaceAttributeFunc mocks the ReplaceAttribute method.
+	ReplaceAttributeFunc func(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error)
+
+	// ReplaceEntityFunc mocks the ReplaceEntity method.
+	ReplaceEntityFunc func(ctx context.Context, tenant string, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error)
+
+	// ReplayDeadLettersFunc mocks the ReplayDeadLetters method.
+	ReplayDeadLettersFunc func(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error)
+
+	// RetrieveContextSourceRegistrationFunc mocks the RetrieveContextSourceRegistration method.
+	RetrieveContextSourceRegistrationFunc func(ctx context.Context, tenant string, registrationID string) (*registrations.ContextSourceRegistration, error)
+
 	// RetrieveEntityFunc mocks the RetrieveEntity method.
 	RetrieveEntityFunc func(ctx context.Context, tenant string, entityID string, headers map[string][]string) (types.Entity, error)
 
+	// RetrieveSubscriptionFunc mocks the RetrieveSubscription method.
+	RetrieveSubscriptionFunc func(ctx context.Context, tenant string, subscriptionID string) (*subscriptions.Subscription, error)
+
 	// RetrieveTemporalEvolutionOfEntityFunc mocks the RetrieveTemporalEvolutionOfEntity method.
 	RetrieveTemporalEvolutionOfEntityFunc func(ctx context.Context, tenant string, entityID string, params TemporalQueryParams, headers map[string][]string) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error)
 
@@ -90,11 +223,50 @@ type ContextInformationManagerMock struct {
 	// StopFunc mocks the Stop method.
 	StopFunc func() error
 
+	// UpdateContextSourceRegistrationFunc mocks the UpdateContextSourceRegistration method.
+	UpdateContextSourceRegistrationFunc func(ctx context.Context, tenant string, registrationID string, fragment registrations.ContextSourceRegistration) error
+
+	// UpdateEntitiesFunc mocks the UpdateEntities method.
+	UpdateEntitiesFunc func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
 	// UpdateEntityAttributesFunc mocks the UpdateEntityAttributes method.
 	UpdateEntityAttributesFunc func(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error)
 
+	// UpdateSubscriptionFunc mocks the UpdateSubscription method.
+	UpdateSubscriptionFunc func(ctx context.Context, tenant string, subscriptionID string, fragment subscriptions.Subscription) error
+
+	// UpsertEntitiesFunc mocks the UpsertEntities method.
+	UpsertEntitiesFunc func(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
+	// ValidateFunc mocks the Validate method.
+	ValidateFunc func(ctx context.Context, cfg config.Config) error
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// AppendEntityAttributes holds details about calls to the AppendEntityAttributes method.
+		AppendEntityAttributes []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityID is the entityID argument value.
+			EntityID string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// CreateEntities holds details about calls to the CreateEntities method.
+		CreateEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// CreateEntity holds details about calls to the CreateEntity method.
 		CreateEntity []struct {
 			// Ctx is the ctx argument value.
@@ -106,6 +278,57 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// CreateSubscription holds details about calls to the CreateSubscription method.
+		CreateSubscription []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// Subscription is the subscription argument value.
+			Subscription subscriptions.Subscription
+		}
+		// DeleteAttribute holds details about calls to the DeleteAttribute method.
+		DeleteAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// DatasetID is the datasetID argument value.
+			DatasetID string
+			// DeleteAll is the deleteAll argument value.
+			DeleteAll bool
+		}
+		// DeleteContextSourceRegistration holds details about calls to the DeleteContextSourceRegistration method.
+		DeleteContextSourceRegistration []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// RegistrationID is the registrationID argument value.
+			RegistrationID string
+		}
+		// DeleteDeadLetter holds details about calls to the DeleteDeadLetter method.
+		DeleteDeadLetter []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// LetterID is the letterID argument value.
+			LetterID string
+		}
+		// DeleteEntities holds details about calls to the DeleteEntities method.
+		DeleteEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityIDs is the entityIDs argument value.
+			EntityIDs []string
+		}
 		// DeleteEntity holds details about calls to the DeleteEntity method.
 		DeleteEntity []struct {
 			// Ctx is the ctx argument value.
@@ -115,6 +338,15 @@ type ContextInformationManagerMock struct {
 			// EntityID is the entityID argument value.
 			EntityID string
 		}
+		// DeleteSubscription holds details about calls to the DeleteSubscription method.
+		DeleteSubscription []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// SubscriptionID is the subscriptionID argument value.
+			SubscriptionID string
+		}
 		// MergeEntity holds details about calls to the MergeEntity method.
 		MergeEntity []struct {
 			// Ctx is the ctx argument value.
@@ -128,6 +360,37 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// PatchAttribute holds details about calls to the PatchAttribute method.
+		PatchAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// QueryContextSourceRegistrations holds details about calls to the QueryContextSourceRegistrations method.
+		QueryContextSourceRegistrations []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityTypes is the entityTypes argument value.
+			EntityTypes []string
+		}
+		// QueryDeadLetters holds details about calls to the QueryDeadLetters method.
+		QueryDeadLetters []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+		}
 		// QueryEntities holds details about calls to the QueryEntities method.
 		QueryEntities []struct {
 			// Ctx is the ctx argument value.
@@ -143,6 +406,13 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// QuerySubscriptions holds details about calls to the QuerySubscriptions method.
+		QuerySubscriptions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+		}
 		// QueryTemporalEvolutionOfEntities holds details about calls to the QueryTemporalEvolutionOfEntities method.
 		QueryTemporalEvolutionOfEntities []struct {
 			// Ctx is the ctx argument value.
@@ -158,6 +428,68 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// RegisterContextSource holds details about calls to the RegisterContextSource method.
+		RegisterContextSource []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// Registration is the registration argument value.
+			Registration registrations.ContextSourceRegistration
+		}
+		// Reload holds details about calls to the Reload method.
+		Reload []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Cfg is the cfg argument value.
+			Cfg config.Config
+		}
+		// ReplaceAttribute holds details about calls to the ReplaceAttribute method.
+		ReplaceAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// ReplaceEntity holds details about calls to the ReplaceEntity method.
+		ReplaceEntity []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// EntityID is the entityID argument value.
+			EntityID string
+			// Entity is the entity argument value.
+			Entity types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// ReplayDeadLetters holds details about calls to the ReplayDeadLetters method.
+		ReplayDeadLetters []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// LetterIDs is the letterIDs argument value.
+			LetterIDs []string
+		}
+		// RetrieveContextSourceRegistration holds details about calls to the RetrieveContextSourceRegistration method.
+		RetrieveContextSourceRegistration []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// RegistrationID is the registrationID argument value.
+			RegistrationID string
+		}
 		// RetrieveEntity holds details about calls to the RetrieveEntity method.
 		RetrieveEntity []struct {
 			// Ctx is the ctx argument value.
@@ -169,6 +501,15 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// RetrieveSubscription holds details about calls to the RetrieveSubscription method.
+		RetrieveSubscription []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// SubscriptionID is the subscriptionID argument value.
+			SubscriptionID string
+		}
 		// RetrieveTemporalEvolutionOfEntity holds details about calls to the RetrieveTemporalEvolutionOfEntity method.
 		RetrieveTemporalEvolutionOfEntity []struct {
 			// Ctx is the ctx argument value.
@@ -197,6 +538,28 @@ type ContextInformationManagerMock struct {
 		// Stop holds details about calls to the Stop method.
 		Stop []struct {
 		}
+		// UpdateContextSourceRegistration holds details about calls to the UpdateContextSourceRegistration method.
+		UpdateContextSourceRegistration []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// RegistrationID is the registrationID argument value.
+			RegistrationID string
+			// Fragment is the fragment argument value.
+			Fragment registrations.ContextSourceRegistration
+		}
+		// UpdateEntities holds details about calls to the UpdateEntities method.
+		UpdateEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// UpdateEntityAttributes holds details about calls to the UpdateEntityAttributes method.
 		UpdateEntityAttributes []struct {
 			// Ctx is the ctx argument value.
@@ -210,18 +573,161 @@ type ContextInformationManagerMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// UpdateSubscription holds details about calls to the UpdateSubscription method.
+		UpdateSubscription []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// SubscriptionID is the subscriptionID argument value.
+			SubscriptionID string
+			// Fragment is the fragment argument value.
+			Fragment subscriptions.Subscription
+		}
+		// UpsertEntities holds details about calls to the UpsertEntities method.
+		UpsertEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Tenant is the tenant argument value.
+			Tenant string
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// Validate holds details about calls to the Validate method.
+		Validate []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Cfg is the cfg argument value.
+			Cfg config.Config
+		}
 	}
+	lockAppendEntityAttributes            sync.RWMutex
+	lockCreateEntities                    sync.RWMutex
 	lockCreateEntity                      sync.RWMutex
+	lockCreateSubscription                sync.RWMutex
+	lockDeleteAttribute                   sync.RWMutex
+	lockDeleteContextSourceRegistration   sync.RWMutex
+	lockDeleteDeadLetter                  sync.RWMutex
+	lockDeleteEntities                    sync.RWMutex
 	lockDeleteEntity                      sync.RWMutex
+	lockDeleteSubscription                sync.RWMutex
 	lockMergeEntity                       sync.RWMutex
+	lockPatchAttribute                    sync.RWMutex
+	lockQueryContextSourceRegistrations   sync.RWMutex
+	lockQueryDeadLetters                  sync.RWMutex
 	lockQueryEntities                     sync.RWMutex
+	lockQuerySubscriptions                sync.RWMutex
 	lockQueryTemporalEvolutionOfEntities  sync.RWMutex
+	lockRegisterContextSource             sync.RWMutex
+	lockReload                            sync.RWMutex
+	lockReplaceAttribute                  sync.RWMutex
+	lockReplaceEntity                     sync.RWMutex
+	lockReplayDeadLetters                 sync.RWMutex
+	lockRetrieveContextSourceRegistration sync.RWMutex
 	lockRetrieveEntity                    sync.RWMutex
+	lockRetrieveSubscription              sync.RWMutex
 	lockRetrieveTemporalEvolutionOfEntity sync.RWMutex
 	lockRetrieveTypes                     sync.RWMutex
 	lockStart                             sync.RWMutex
 	lockStop                              sync.RWMutex
+	lockUpdateContextSourceRegistration   sync.RWMutex
+	lockUpdateEntities                    sync.RWMutex
 	lockUpdateEntityAttributes            sync.RWMutex
+	lockUpdateSubscription                sync.RWMutex
+	lockUpsertEntities                    sync.RWMutex
+	lockValidate                          sync.RWMutex
+}
+
+// AppendEntityAttributes calls AppendEntityAttributesFunc.
+func (mock *ContextInformationManagerMock) AppendEntityAttributes(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+	if mock.AppendEntityAttributesFunc == nil {
+		panic("ContextInformationManagerMock.AppendEntityAttributesFunc: method is nil but ContextInformationManager.AppendEntityAttributes was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		EntityID: entityID,
+		Fragment: fragment,
+		Headers:  headers,
+	}
+	mock.lockAppendEntityAttributes.Lock()
+	mock.calls.AppendEntityAttributes = append(mock.calls.AppendEntityAttributes, callInfo)
+	mock.lockAppendEntityAttributes.Unlock()
+	return mock.AppendEntityAttributesFunc(ctx, tenant, entityID, fragment, headers)
+}
+
+// AppendEntityAttributesCalls gets all the calls that were made to AppendEntityAttributes.
+// Check the length with:
+//     len(mockedContextInformationManager.AppendEntityAttributesCalls())
+func (mock *ContextInformationManagerMock) AppendEntityAttributesCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	EntityID string
+	Fragment types.EntityFragment
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}
+	mock.lockAppendEntityAttributes.RLock()
+	calls = mock.calls.AppendEntityAttributes
+	mock.lockAppendEntityAttributes.RUnlock()
+	return calls
+}
+
+// CreateEntities calls CreateEntitiesFunc.
+func (mock *ContextInformationManagerMock) CreateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.CreateEntitiesFunc == nil {
+		panic("ContextInformationManagerMock.CreateEntitiesFunc: method is nil but ContextInformationManager.CreateEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockCreateEntities.Lock()
+	mock.calls.CreateEntities = append(mock.calls.CreateEntities, callInfo)
+	mock.lockCreateEntities.Unlock()
+	return mock.CreateEntitiesFunc(ctx, tenant, entities, headers)
+}
+
+// CreateEntitiesCalls gets all the calls that were made to CreateEntities.
+// Check the length with:
+//     len(mockedContextInformationManager.CreateEntitiesCalls())
+func (mock *ContextInformationManagerMock) CreateEntitiesCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockCreateEntities.RLock()
+	calls = mock.calls.CreateEntities
+	mock.lockCreateEntities.RUnlock()
+	return calls
 }
 
 // CreateEntity calls CreateEntityFunc.
@@ -267,6 +773,213 @@ func (mock *ContextInformationManagerMock) CreateEntityCalls() []struct {
 	return calls
 }
 
+// CreateSubscription calls CreateSubscriptionFunc.
+func (mock *ContextInformationManagerMock) CreateSubscription(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error) {
+	if mock.CreateSubscriptionFunc == nil {
+		panic("ContextInformationManagerMock.CreateSubscriptionFunc: method is nil but ContextInformationManager.CreateSubscription was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		Tenant       string
+		Subscription subscriptions.Subscription
+	}{
+		Ctx:          ctx,
+		Tenant:       tenant,
+		Subscription: subscription,
+	}
+	mock.lockCreateSubscription.Lock()
+	mock.calls.CreateSubscription = append(mock.calls.CreateSubscription, callInfo)
+	mock.lockCreateSubscription.Unlock()
+	return mock.CreateSubscriptionFunc(ctx, tenant, subscription)
+}
+
+// CreateSubscriptionCalls gets all the calls that were made to CreateSubscription.
+// Check the length with:
+//     len(mockedContextInformationManager.CreateSubscriptionCalls())
+func (mock *ContextInformationManagerMock) CreateSubscriptionCalls() []struct {
+	Ctx          context.Context
+	Tenant       string
+	Subscription subscriptions.Subscription
+} {
+	var calls []struct {
+		Ctx          context.Context
+		Tenant       string
+		Subscription subscriptions.Subscription
+	}
+	mock.lockCreateSubscription.RLock()
+	calls = mock.calls.CreateSubscription
+	mock.lockCreateSubscription.RUnlock()
+	return calls
+}
+
+// DeleteAttribute calls DeleteAttributeFunc.
+func (mock *ContextInformationManagerMock) DeleteAttribute(ctx context.Context, tenant string, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+	if mock.DeleteAttributeFunc == nil {
+		panic("ContextInformationManagerMock.DeleteAttributeFunc: method is nil but ContextInformationManager.DeleteAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		DatasetID     string
+		DeleteAll     bool
+	}{
+		Ctx:           ctx,
+		Tenant:        tenant,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		DatasetID:     datasetID,
+		DeleteAll:     deleteAll,
+	}
+	mock.lockDeleteAttribute.Lock()
+	mock.calls.DeleteAttribute = append(mock.calls.DeleteAttribute, callInfo)
+	mock.lockDeleteAttribute.Unlock()
+	return mock.DeleteAttributeFunc(ctx, tenant, entityID, attributeName, datasetID, deleteAll)
+}
+
+// DeleteAttributeCalls gets all the calls that were made to DeleteAttribute.
+// Check the length with:
+//     len(mockedContextInformationManager.DeleteAttributeCalls())
+func (mock *ContextInformationManagerMock) DeleteAttributeCalls() []struct {
+	Ctx           context.Context
+	Tenant        string
+	EntityID      string
+	AttributeName string
+	DatasetID     string
+	DeleteAll     bool
+} {
+	var calls []struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		DatasetID     string
+		DeleteAll     bool
+	}
+	mock.lockDeleteAttribute.RLock()
+	calls = mock.calls.DeleteAttribute
+	mock.lockDeleteAttribute.RUnlock()
+	return calls
+}
+
+// DeleteContextSourceRegistration calls DeleteContextSourceRegistrationFunc.
+func (mock *ContextInformationManagerMock) DeleteContextSourceRegistration(ctx context.Context, tenant string, registrationID string) error {
+	if mock.DeleteContextSourceRegistrationFunc == nil {
+		panic("ContextInformationManagerMock.DeleteContextSourceRegistrationFunc: method is nil but ContextInformationManager.DeleteContextSourceRegistration was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		RegistrationID: registrationID,
+	}
+	mock.lockDeleteContextSourceRegistration.Lock()
+	mock.calls.DeleteContextSourceRegistration = append(mock.calls.DeleteContextSourceRegistration, callInfo)
+	mock.lockDeleteContextSourceRegistration.Unlock()
+	return mock.DeleteContextSourceRegistrationFunc(ctx, tenant, registrationID)
+}
+
+// DeleteContextSourceRegistrationCalls gets all the calls that were made to DeleteContextSourceRegistration.
+// Check the length with:
+//     len(mockedContextInformationManager.DeleteContextSourceRegistrationCalls())
+func (mock *ContextInformationManagerMock) DeleteContextSourceRegistrationCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	RegistrationID string
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+	}
+	mock.lockDeleteContextSourceRegistration.RLock()
+	calls = mock.calls.DeleteContextSourceRegistration
+	mock.lockDeleteContextSourceRegistration.RUnlock()
+	return calls
+}
+
+// DeleteDeadLetter calls DeleteDeadLetterFunc.
+func (mock *ContextInformationManagerMock) DeleteDeadLetter(ctx context.Context, tenant string, letterID string) error {
+	if mock.DeleteDeadLetterFunc == nil {
+		panic("ContextInformationManagerMock.DeleteDeadLetterFunc: method is nil but ContextInformationManager.DeleteDeadLetter was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		LetterID string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		LetterID: letterID,
+	}
+	mock.lockDeleteDeadLetter.Lock()
+	mock.calls.DeleteDeadLetter = append(mock.calls.DeleteDeadLetter, callInfo)
+	mock.lockDeleteDeadLetter.Unlock()
+	return mock.DeleteDeadLetterFunc(ctx, tenant, letterID)
+}
+
+// DeleteDeadLetterCalls gets all the calls that were made to DeleteDeadLetter.
+// Check the length with:
+//     len(mockedContextInformationManager.DeleteDeadLetterCalls())
+func (mock *ContextInformationManagerMock) DeleteDeadLetterCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	LetterID string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		LetterID string
+	}
+	mock.lockDeleteDeadLetter.RLock()
+	calls = mock.calls.DeleteDeadLetter
+	mock.lockDeleteDeadLetter.RUnlock()
+	return calls
+}
+
+// DeleteEntities calls DeleteEntitiesFunc.
+func (mock *ContextInformationManagerMock) DeleteEntities(ctx context.Context, tenant string, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+	if mock.DeleteEntitiesFunc == nil {
+		panic("ContextInformationManagerMock.DeleteEntitiesFunc: method is nil but ContextInformationManager.DeleteEntities was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		Tenant    string
+		EntityIDs []string
+	}{
+		Ctx:       ctx,
+		Tenant:    tenant,
+		EntityIDs: entityIDs,
+	}
+	mock.lockDeleteEntities.Lock()
+	mock.calls.DeleteEntities = append(mock.calls.DeleteEntities, callInfo)
+	mock.lockDeleteEntities.Unlock()
+	return mock.DeleteEntitiesFunc(ctx, tenant, entityIDs)
+}
+
+// DeleteEntitiesCalls gets all the calls that were made to DeleteEntities.
+// Check the length with:
+//     len(mockedContextInformationManager.DeleteEntitiesCalls())
+func (mock *ContextInformationManagerMock) DeleteEntitiesCalls() []struct {
+	Ctx       context.Context
+	Tenant    string
+	EntityIDs []string
+} {
+	var calls []struct {
+		Ctx       context.Context
+		Tenant    string
+		EntityIDs []string
+	}
+	mock.lockDeleteEntities.RLock()
+	calls = mock.calls.DeleteEntities
+	mock.lockDeleteEntities.RUnlock()
+	return calls
+}
+
 // DeleteEntity calls DeleteEntityFunc.
 func (mock *ContextInformationManagerMock) DeleteEntity(ctx context.Context, tenant string, entityID string) (*ngsild.DeleteEntityResult, error) {
 	if mock.DeleteEntityFunc == nil {
@@ -296,60 +1009,224 @@ func (mock *ContextInformationManagerMock) DeleteEntityCalls() []struct {
 	EntityID string
 } {
 	var calls []struct {
-		Ctx      context.Context
-		Tenant   string
-		EntityID string
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+	}
+	mock.lockDeleteEntity.RLock()
+	calls = mock.calls.DeleteEntity
+	mock.lockDeleteEntity.RUnlock()
+	return calls
+}
+
+// DeleteSubscription calls DeleteSubscriptionFunc.
+func (mock *ContextInformationManagerMock) DeleteSubscription(ctx context.Context, tenant string, subscriptionID string) error {
+	if mock.DeleteSubscriptionFunc == nil {
+		panic("ContextInformationManagerMock.DeleteSubscriptionFunc: method is nil but ContextInformationManager.DeleteSubscription was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		SubscriptionID: subscriptionID,
+	}
+	mock.lockDeleteSubscription.Lock()
+	mock.calls.DeleteSubscription = append(mock.calls.DeleteSubscription, callInfo)
+	mock.lockDeleteSubscription.Unlock()
+	return mock.DeleteSubscriptionFunc(ctx, tenant, subscriptionID)
+}
+
+// DeleteSubscriptionCalls gets all the calls that were made to DeleteSubscription.
+// Check the length with:
+//     len(mockedContextInformationManager.DeleteSubscriptionCalls())
+func (mock *ContextInformationManagerMock) DeleteSubscriptionCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	SubscriptionID string
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+	}
+	mock.lockDeleteSubscription.RLock()
+	calls = mock.calls.DeleteSubscription
+	mock.lockDeleteSubscription.RUnlock()
+	return calls
+}
+
+// MergeEntity calls MergeEntityFunc.
+func (mock *ContextInformationManagerMock) MergeEntity(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+	if mock.MergeEntityFunc == nil {
+		panic("ContextInformationManagerMock.MergeEntityFunc: method is nil but ContextInformationManager.MergeEntity was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		EntityID: entityID,
+		Fragment: fragment,
+		Headers:  headers,
+	}
+	mock.lockMergeEntity.Lock()
+	mock.calls.MergeEntity = append(mock.calls.MergeEntity, callInfo)
+	mock.lockMergeEntity.Unlock()
+	return mock.MergeEntityFunc(ctx, tenant, entityID, fragment, headers)
+}
+
+// MergeEntityCalls gets all the calls that were made to MergeEntity.
+// Check the length with:
+//     len(mockedContextInformationManager.MergeEntityCalls())
+func (mock *ContextInformationManagerMock) MergeEntityCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	EntityID string
+	Fragment types.EntityFragment
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}
+	mock.lockMergeEntity.RLock()
+	calls = mock.calls.MergeEntity
+	mock.lockMergeEntity.RUnlock()
+	return calls
+}
+
+// PatchAttribute calls PatchAttributeFunc.
+func (mock *ContextInformationManagerMock) PatchAttribute(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+	if mock.PatchAttributeFunc == nil {
+		panic("ContextInformationManagerMock.PatchAttributeFunc: method is nil but ContextInformationManager.PatchAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}{
+		Ctx:           ctx,
+		Tenant:        tenant,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		Fragment:      fragment,
+		Headers:       headers,
+	}
+	mock.lockPatchAttribute.Lock()
+	mock.calls.PatchAttribute = append(mock.calls.PatchAttribute, callInfo)
+	mock.lockPatchAttribute.Unlock()
+	return mock.PatchAttributeFunc(ctx, tenant, entityID, attributeName, fragment, headers)
+}
+
+// PatchAttributeCalls gets all the calls that were made to PatchAttribute.
+// Check the length with:
+//     len(mockedContextInformationManager.PatchAttributeCalls())
+func (mock *ContextInformationManagerMock) PatchAttributeCalls() []struct {
+	Ctx           context.Context
+	Tenant        string
+	EntityID      string
+	AttributeName string
+	Fragment      types.EntityFragment
+	Headers       map[string][]string
+} {
+	var calls []struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}
+	mock.lockPatchAttribute.RLock()
+	calls = mock.calls.PatchAttribute
+	mock.lockPatchAttribute.RUnlock()
+	return calls
+}
+
+// QueryContextSourceRegistrations calls QueryContextSourceRegistrationsFunc.
+func (mock *ContextInformationManagerMock) QueryContextSourceRegistrations(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error) {
+	if mock.QueryContextSourceRegistrationsFunc == nil {
+		panic("ContextInformationManagerMock.QueryContextSourceRegistrationsFunc: method is nil but ContextInformationManager.QueryContextSourceRegistrations was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		Tenant      string
+		EntityTypes []string
+	}{
+		Ctx:         ctx,
+		Tenant:      tenant,
+		EntityTypes: entityTypes,
+	}
+	mock.lockQueryContextSourceRegistrations.Lock()
+	mock.calls.QueryContextSourceRegistrations = append(mock.calls.QueryContextSourceRegistrations, callInfo)
+	mock.lockQueryContextSourceRegistrations.Unlock()
+	return mock.QueryContextSourceRegistrationsFunc(ctx, tenant, entityTypes)
+}
+
+// QueryContextSourceRegistrationsCalls gets all the calls that were made to QueryContextSourceRegistrations.
+// Check the length with:
+//     len(mockedContextInformationManager.QueryContextSourceRegistrationsCalls())
+func (mock *ContextInformationManagerMock) QueryContextSourceRegistrationsCalls() []struct {
+	Ctx         context.Context
+	Tenant      string
+	EntityTypes []string
+} {
+	var calls []struct {
+		Ctx         context.Context
+		Tenant      string
+		EntityTypes []string
 	}
-	mock.lockDeleteEntity.RLock()
-	calls = mock.calls.DeleteEntity
-	mock.lockDeleteEntity.RUnlock()
+	mock.lockQueryContextSourceRegistrations.RLock()
+	calls = mock.calls.QueryContextSourceRegistrations
+	mock.lockQueryContextSourceRegistrations.RUnlock()
 	return calls
 }
 
-// MergeEntity calls MergeEntityFunc.
-func (mock *ContextInformationManagerMock) MergeEntity(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
-	if mock.MergeEntityFunc == nil {
-		panic("ContextInformationManagerMock.MergeEntityFunc: method is nil but ContextInformationManager.MergeEntity was just called")
+// QueryDeadLetters calls QueryDeadLettersFunc.
+func (mock *ContextInformationManagerMock) QueryDeadLetters(ctx context.Context, tenant string) ([]subs.DeadLetter, error) {
+	if mock.QueryDeadLettersFunc == nil {
+		panic("ContextInformationManagerMock.QueryDeadLettersFunc: method is nil but ContextInformationManager.QueryDeadLetters was just called")
 	}
 	callInfo := struct {
-		Ctx      context.Context
-		Tenant   string
-		EntityID string
-		Fragment types.EntityFragment
-		Headers  map[string][]string
+		Ctx    context.Context
+		Tenant string
 	}{
-		Ctx:      ctx,
-		Tenant:   tenant,
-		EntityID: entityID,
-		Fragment: fragment,
-		Headers:  headers,
+		Ctx:    ctx,
+		Tenant: tenant,
 	}
-	mock.lockMergeEntity.Lock()
-	mock.calls.MergeEntity = append(mock.calls.MergeEntity, callInfo)
-	mock.lockMergeEntity.Unlock()
-	return mock.MergeEntityFunc(ctx, tenant, entityID, fragment, headers)
+	mock.lockQueryDeadLetters.Lock()
+	mock.calls.QueryDeadLetters = append(mock.calls.QueryDeadLetters, callInfo)
+	mock.lockQueryDeadLetters.Unlock()
+	return mock.QueryDeadLettersFunc(ctx, tenant)
 }
 
-// MergeEntityCalls gets all the calls that were made to MergeEntity.
+// QueryDeadLettersCalls gets all the calls that were made to QueryDeadLetters.
 // Check the length with:
-//     len(mockedContextInformationManager.MergeEntityCalls())
-func (mock *ContextInformationManagerMock) MergeEntityCalls() []struct {
-	Ctx      context.Context
-	Tenant   string
-	EntityID string
-	Fragment types.EntityFragment
-	Headers  map[string][]string
+//     len(mockedContextInformationManager.QueryDeadLettersCalls())
+func (mock *ContextInformationManagerMock) QueryDeadLettersCalls() []struct {
+	Ctx    context.Context
+	Tenant string
 } {
 	var calls []struct {
-		Ctx      context.Context
-		Tenant   string
-		EntityID string
-		Fragment types.EntityFragment
-		Headers  map[string][]string
+		Ctx    context.Context
+		Tenant string
 	}
-	mock.lockMergeEntity.RLock()
-	calls = mock.calls.MergeEntity
-	mock.lockMergeEntity.RUnlock()
+	mock.lockQueryDeadLetters.RLock()
+	calls = mock.calls.QueryDeadLetters
+	mock.lockQueryDeadLetters.RUnlock()
 	return calls
 }
 
@@ -404,6 +1281,41 @@ func (mock *ContextInformationManagerMock) QueryEntitiesCalls() []struct {
 	return calls
 }
 
+// QuerySubscriptions calls QuerySubscriptionsFunc.
+func (mock *ContextInformationManagerMock) QuerySubscriptions(ctx context.Context, tenant string) ([]subscriptions.Subscription, error) {
+	if mock.QuerySubscriptionsFunc == nil {
+		panic("ContextInformationManagerMock.QuerySubscriptionsFunc: method is nil but ContextInformationManager.QuerySubscriptions was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Tenant string
+	}{
+		Ctx:    ctx,
+		Tenant: tenant,
+	}
+	mock.lockQuerySubscriptions.Lock()
+	mock.calls.QuerySubscriptions = append(mock.calls.QuerySubscriptions, callInfo)
+	mock.lockQuerySubscriptions.Unlock()
+	return mock.QuerySubscriptionsFunc(ctx, tenant)
+}
+
+// QuerySubscriptionsCalls gets all the calls that were made to QuerySubscriptions.
+// Check the length with:
+//     len(mockedContextInformationManager.QuerySubscriptionsCalls())
+func (mock *ContextInformationManagerMock) QuerySubscriptionsCalls() []struct {
+	Ctx    context.Context
+	Tenant string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Tenant string
+	}
+	mock.lockQuerySubscriptions.RLock()
+	calls = mock.calls.QuerySubscriptions
+	mock.lockQuerySubscriptions.RUnlock()
+	return calls
+}
+
 // QueryTemporalEvolutionOfEntities calls QueryTemporalEvolutionOfEntitiesFunc.
 func (mock *ContextInformationManagerMock) QueryTemporalEvolutionOfEntities(ctx context.Context, tenant string, entityIDs []string, entityTypes []string, params TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error) {
 	if mock.QueryTemporalEvolutionOfEntitiesFunc == nil {
@@ -455,6 +1367,256 @@ func (mock *ContextInformationManagerMock) QueryTemporalEvolutionOfEntitiesCalls
 	return calls
 }
 
+// RegisterContextSource calls RegisterContextSourceFunc.
+func (mock *ContextInformationManagerMock) RegisterContextSource(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error) {
+	if mock.RegisterContextSourceFunc == nil {
+		panic("ContextInformationManagerMock.RegisterContextSourceFunc: method is nil but ContextInformationManager.RegisterContextSource was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		Tenant       string
+		Registration registrations.ContextSourceRegistration
+	}{
+		Ctx:          ctx,
+		Tenant:       tenant,
+		Registration: registration,
+	}
+	mock.lockRegisterContextSource.Lock()
+	mock.calls.RegisterContextSource = append(mock.calls.RegisterContextSource, callInfo)
+	mock.lockRegisterContextSource.Unlock()
+	return mock.RegisterContextSourceFunc(ctx, tenant, registration)
+}
+
+// RegisterContextSourceCalls gets all the calls that were made to RegisterContextSource.
+// Check the length with:
+//     len(mockedContextInformationManager.RegisterContextSourceCalls())
+func (mock *ContextInformationManagerMock) RegisterContextSourceCalls() []struct {
+	Ctx          context.Context
+	Tenant       string
+	Registration registrations.ContextSourceRegistration
+} {
+	var calls []struct {
+		Ctx          context.Context
+		Tenant       string
+		Registration registrations.ContextSourceRegistration
+	}
+	mock.lockRegisterContextSource.RLock()
+	calls = mock.calls.RegisterContextSource
+	mock.lockRegisterContextSource.RUnlock()
+	return calls
+}
+
+// Reload calls ReloadFunc.
+func (mock *ContextInformationManagerMock) Reload(ctx context.Context, cfg config.Config) error {
+	if mock.ReloadFunc == nil {
+		panic("ContextInformationManagerMock.ReloadFunc: method is nil but ContextInformationManager.Reload was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		Cfg config.Config
+	}{
+		Ctx: ctx,
+		Cfg: cfg,
+	}
+	mock.lockReload.Lock()
+	mock.calls.Reload = append(mock.calls.Reload, callInfo)
+	mock.lockReload.Unlock()
+	return mock.ReloadFunc(ctx, cfg)
+}
+
+// ReloadCalls gets all the calls that were made to Reload.
+// Check the length with:
+//     len(mockedContextInformationManager.ReloadCalls())
+func (mock *ContextInformationManagerMock) ReloadCalls() []struct {
+	Ctx context.Context
+	Cfg config.Config
+} {
+	var calls []struct {
+		Ctx context.Context
+		Cfg config.Config
+	}
+	mock.lockReload.RLock()
+	calls = mock.calls.Reload
+	mock.lockReload.RUnlock()
+	return calls
+}
+
+// ReplaceAttribute calls ReplaceAttributeFunc.
+func (mock *ContextInformationManagerMock) ReplaceAttribute(ctx context.Context, tenant string, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+	if mock.ReplaceAttributeFunc == nil {
+		panic("ContextInformationManagerMock.ReplaceAttributeFunc: method is nil but ContextInformationManager.ReplaceAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}{
+		Ctx:           ctx,
+		Tenant:        tenant,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		Fragment:      fragment,
+		Headers:       headers,
+	}
+	mock.lockReplaceAttribute.Lock()
+	mock.calls.ReplaceAttribute = append(mock.calls.ReplaceAttribute, callInfo)
+	mock.lockReplaceAttribute.Unlock()
+	return mock.ReplaceAttributeFunc(ctx, tenant, entityID, attributeName, fragment, headers)
+}
+
+// ReplaceAttributeCalls gets all the calls that were made to ReplaceAttribute.
+// Check the length with:
+//     len(mockedContextInformationManager.ReplaceAttributeCalls())
+func (mock *ContextInformationManagerMock) ReplaceAttributeCalls() []struct {
+	Ctx           context.Context
+	Tenant        string
+	EntityID      string
+	AttributeName string
+	Fragment      types.EntityFragment
+	Headers       map[string][]string
+} {
+	var calls []struct {
+		Ctx           context.Context
+		Tenant        string
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}
+	mock.lockReplaceAttribute.RLock()
+	calls = mock.calls.ReplaceAttribute
+	mock.lockReplaceAttribute.RUnlock()
+	return calls
+}
+
+// ReplaceEntity calls ReplaceEntityFunc.
+func (mock *ContextInformationManagerMock) ReplaceEntity(ctx context.Context, tenant string, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+	if mock.ReplaceEntityFunc == nil {
+		panic("ContextInformationManagerMock.ReplaceEntityFunc: method is nil but ContextInformationManager.ReplaceEntity was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Entity   types.EntityFragment
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		EntityID: entityID,
+		Entity:   entity,
+		Headers:  headers,
+	}
+	mock.lockReplaceEntity.Lock()
+	mock.calls.ReplaceEntity = append(mock.calls.ReplaceEntity, callInfo)
+	mock.lockReplaceEntity.Unlock()
+	return mock.ReplaceEntityFunc(ctx, tenant, entityID, entity, headers)
+}
+
+// ReplaceEntityCalls gets all the calls that were made to ReplaceEntity.
+// Check the length with:
+//     len(mockedContextInformationManager.ReplaceEntityCalls())
+func (mock *ContextInformationManagerMock) ReplaceEntityCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	EntityID string
+	Entity   types.EntityFragment
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		EntityID string
+		Entity   types.EntityFragment
+		Headers  map[string][]string
+	}
+	mock.lockReplaceEntity.RLock()
+	calls = mock.calls.ReplaceEntity
+	mock.lockReplaceEntity.RUnlock()
+	return calls
+}
+
+// ReplayDeadLetters calls ReplayDeadLettersFunc.
+func (mock *ContextInformationManagerMock) ReplayDeadLetters(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error) {
+	if mock.ReplayDeadLettersFunc == nil {
+		panic("ContextInformationManagerMock.ReplayDeadLettersFunc: method is nil but ContextInformationManager.ReplayDeadLetters was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		Tenant    string
+		LetterIDs []string
+	}{
+		Ctx:       ctx,
+		Tenant:    tenant,
+		LetterIDs: letterIDs,
+	}
+	mock.lockReplayDeadLetters.Lock()
+	mock.calls.ReplayDeadLetters = append(mock.calls.ReplayDeadLetters, callInfo)
+	mock.lockReplayDeadLetters.Unlock()
+	return mock.ReplayDeadLettersFunc(ctx, tenant, letterIDs)
+}
+
+// ReplayDeadLettersCalls gets all the calls that were made to ReplayDeadLetters.
+// Check the length with:
+//     len(mockedContextInformationManager.ReplayDeadLettersCalls())
+func (mock *ContextInformationManagerMock) ReplayDeadLettersCalls() []struct {
+	Ctx       context.Context
+	Tenant    string
+	LetterIDs []string
+} {
+	var calls []struct {
+		Ctx       context.Context
+		Tenant    string
+		LetterIDs []string
+	}
+	mock.lockReplayDeadLetters.RLock()
+	calls = mock.calls.ReplayDeadLetters
+	mock.lockReplayDeadLetters.RUnlock()
+	return calls
+}
+
+// RetrieveContextSourceRegistration calls RetrieveContextSourceRegistrationFunc.
+func (mock *ContextInformationManagerMock) RetrieveContextSourceRegistration(ctx context.Context, tenant string, registrationID string) (*registrations.ContextSourceRegistration, error) {
+	if mock.RetrieveContextSourceRegistrationFunc == nil {
+		panic("ContextInformationManagerMock.RetrieveContextSourceRegistrationFunc: method is nil but ContextInformationManager.RetrieveContextSourceRegistration was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		RegistrationID: registrationID,
+	}
+	mock.lockRetrieveContextSourceRegistration.Lock()
+	mock.calls.RetrieveContextSourceRegistration = append(mock.calls.RetrieveContextSourceRegistration, callInfo)
+	mock.lockRetrieveContextSourceRegistration.Unlock()
+	return mock.RetrieveContextSourceRegistrationFunc(ctx, tenant, registrationID)
+}
+
+// RetrieveContextSourceRegistrationCalls gets all the calls that were made to RetrieveContextSourceRegistration.
+// Check the length with:
+//     len(mockedContextInformationManager.RetrieveContextSourceRegistrationCalls())
+func (mock *ContextInformationManagerMock) RetrieveContextSourceRegistrationCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	RegistrationID string
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+	}
+	mock.lockRetrieveContextSourceRegistration.RLock()
+	calls = mock.calls.RetrieveContextSourceRegistration
+	mock.lockRetrieveContextSourceRegistration.RUnlock()
+	return calls
+}
+
 // RetrieveEntity calls RetrieveEntityFunc.
 func (mock *ContextInformationManagerMock) RetrieveEntity(ctx context.Context, tenant string, entityID string, headers map[string][]string) (types.Entity, error) {
 	if mock.RetrieveEntityFunc == nil {
@@ -498,6 +1660,45 @@ func (mock *ContextInformationManagerMock) RetrieveEntityCalls() []struct {
 	return calls
 }
 
+// RetrieveSubscription calls RetrieveSubscriptionFunc.
+func (mock *ContextInformationManagerMock) RetrieveSubscription(ctx context.Context, tenant string, subscriptionID string) (*subscriptions.Subscription, error) {
+	if mock.RetrieveSubscriptionFunc == nil {
+		panic("ContextInformationManagerMock.RetrieveSubscriptionFunc: method is nil but ContextInformationManager.RetrieveSubscription was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		SubscriptionID: subscriptionID,
+	}
+	mock.lockRetrieveSubscription.Lock()
+	mock.calls.RetrieveSubscription = append(mock.calls.RetrieveSubscription, callInfo)
+	mock.lockRetrieveSubscription.Unlock()
+	return mock.RetrieveSubscriptionFunc(ctx, tenant, subscriptionID)
+}
+
+// RetrieveSubscriptionCalls gets all the calls that were made to RetrieveSubscription.
+// Check the length with:
+//     len(mockedContextInformationManager.RetrieveSubscriptionCalls())
+func (mock *ContextInformationManagerMock) RetrieveSubscriptionCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	SubscriptionID string
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+	}
+	mock.lockRetrieveSubscription.RLock()
+	calls = mock.calls.RetrieveSubscription
+	mock.lockRetrieveSubscription.RUnlock()
+	return calls
+}
+
 // RetrieveTemporalEvolutionOfEntity calls RetrieveTemporalEvolutionOfEntityFunc.
 func (mock *ContextInformationManagerMock) RetrieveTemporalEvolutionOfEntity(ctx context.Context, tenant string, entityID string, params TemporalQueryParams, headers map[string][]string) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
 	if mock.RetrieveTemporalEvolutionOfEntityFunc == nil {
@@ -636,6 +1837,92 @@ func (mock *ContextInformationManagerMock) StopCalls() []struct {
 	return calls
 }
 
+// UpdateContextSourceRegistration calls UpdateContextSourceRegistrationFunc.
+func (mock *ContextInformationManagerMock) UpdateContextSourceRegistration(ctx context.Context, tenant string, registrationID string, fragment registrations.ContextSourceRegistration) error {
+	if mock.UpdateContextSourceRegistrationFunc == nil {
+		panic("ContextInformationManagerMock.UpdateContextSourceRegistrationFunc: method is nil but ContextInformationManager.UpdateContextSourceRegistration was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+		Fragment       registrations.ContextSourceRegistration
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		RegistrationID: registrationID,
+		Fragment:       fragment,
+	}
+	mock.lockUpdateContextSourceRegistration.Lock()
+	mock.calls.UpdateContextSourceRegistration = append(mock.calls.UpdateContextSourceRegistration, callInfo)
+	mock.lockUpdateContextSourceRegistration.Unlock()
+	return mock.UpdateContextSourceRegistrationFunc(ctx, tenant, registrationID, fragment)
+}
+
+// UpdateContextSourceRegistrationCalls gets all the calls that were made to UpdateContextSourceRegistration.
+// Check the length with:
+//     len(mockedContextInformationManager.UpdateContextSourceRegistrationCalls())
+func (mock *ContextInformationManagerMock) UpdateContextSourceRegistrationCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	RegistrationID string
+	Fragment       registrations.ContextSourceRegistration
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		RegistrationID string
+		Fragment       registrations.ContextSourceRegistration
+	}
+	mock.lockUpdateContextSourceRegistration.RLock()
+	calls = mock.calls.UpdateContextSourceRegistration
+	mock.lockUpdateContextSourceRegistration.RUnlock()
+	return calls
+}
+
+// UpdateEntities calls UpdateEntitiesFunc.
+func (mock *ContextInformationManagerMock) UpdateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.UpdateEntitiesFunc == nil {
+		panic("ContextInformationManagerMock.UpdateEntitiesFunc: method is nil but ContextInformationManager.UpdateEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockUpdateEntities.Lock()
+	mock.calls.UpdateEntities = append(mock.calls.UpdateEntities, callInfo)
+	mock.lockUpdateEntities.Unlock()
+	return mock.UpdateEntitiesFunc(ctx, tenant, entities, headers)
+}
+
+// UpdateEntitiesCalls gets all the calls that were made to UpdateEntities.
+// Check the length with:
+//     len(mockedContextInformationManager.UpdateEntitiesCalls())
+func (mock *ContextInformationManagerMock) UpdateEntitiesCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockUpdateEntities.RLock()
+	calls = mock.calls.UpdateEntities
+	mock.lockUpdateEntities.RUnlock()
+	return calls
+}
+
 // UpdateEntityAttributes calls UpdateEntityAttributesFunc.
 func (mock *ContextInformationManagerMock) UpdateEntityAttributes(ctx context.Context, tenant string, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
 	if mock.UpdateEntityAttributesFunc == nil {
@@ -682,3 +1969,124 @@ func (mock *ContextInformationManagerMock) UpdateEntityAttributesCalls() []struc
 	mock.lockUpdateEntityAttributes.RUnlock()
 	return calls
 }
+
+// UpdateSubscription calls UpdateSubscriptionFunc.
+func (mock *ContextInformationManagerMock) UpdateSubscription(ctx context.Context, tenant string, subscriptionID string, fragment subscriptions.Subscription) error {
+	if mock.UpdateSubscriptionFunc == nil {
+		panic("ContextInformationManagerMock.UpdateSubscriptionFunc: method is nil but ContextInformationManager.UpdateSubscription was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+		Fragment       subscriptions.Subscription
+	}{
+		Ctx:            ctx,
+		Tenant:         tenant,
+		SubscriptionID: subscriptionID,
+		Fragment:       fragment,
+	}
+	mock.lockUpdateSubscription.Lock()
+	mock.calls.UpdateSubscription = append(mock.calls.UpdateSubscription, callInfo)
+	mock.lockUpdateSubscription.Unlock()
+	return mock.UpdateSubscriptionFunc(ctx, tenant, subscriptionID, fragment)
+}
+
+// UpdateSubscriptionCalls gets all the calls that were made to UpdateSubscription.
+// Check the length with:
+//     len(mockedContextInformationManager.UpdateSubscriptionCalls())
+func (mock *ContextInformationManagerMock) UpdateSubscriptionCalls() []struct {
+	Ctx            context.Context
+	Tenant         string
+	SubscriptionID string
+	Fragment       subscriptions.Subscription
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Tenant         string
+		SubscriptionID string
+		Fragment       subscriptions.Subscription
+	}
+	mock.lockUpdateSubscription.RLock()
+	calls = mock.calls.UpdateSubscription
+	mock.lockUpdateSubscription.RUnlock()
+	return calls
+}
+
+// UpsertEntities calls UpsertEntitiesFunc.
+func (mock *ContextInformationManagerMock) UpsertEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.UpsertEntitiesFunc == nil {
+		panic("ContextInformationManagerMock.UpsertEntitiesFunc: method is nil but ContextInformationManager.UpsertEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Tenant:   tenant,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockUpsertEntities.Lock()
+	mock.calls.UpsertEntities = append(mock.calls.UpsertEntities, callInfo)
+	mock.lockUpsertEntities.Unlock()
+	return mock.UpsertEntitiesFunc(ctx, tenant, entities, headers)
+}
+
+// UpsertEntitiesCalls gets all the calls that were made to UpsertEntities.
+// Check the length with:
+//     len(mockedContextInformationManager.UpsertEntitiesCalls())
+func (mock *ContextInformationManagerMock) UpsertEntitiesCalls() []struct {
+	Ctx      context.Context
+	Tenant   string
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Tenant   string
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockUpsertEntities.RLock()
+	calls = mock.calls.UpsertEntities
+	mock.lockUpsertEntities.RUnlock()
+	return calls
+}
+
+// Validate calls ValidateFunc.
+func (mock *ContextInformationManagerMock) Validate(ctx context.Context, cfg config.Config) error {
+	if mock.ValidateFunc == nil {
+		panic("ContextInformationManagerMock.ValidateFunc: method is nil but ContextInformationManager.Validate was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		Cfg config.Config
+	}{
+		Ctx: ctx,
+		Cfg: cfg,
+	}
+	mock.lockValidate.Lock()
+	mock.calls.Validate = append(mock.calls.Validate, callInfo)
+	mock.lockValidate.Unlock()
+	return mock.ValidateFunc(ctx, cfg)
+}
+
+// ValidateCalls gets all the calls that were made to Validate.
+// Check the length with:
+//     len(mockedContextInformationManager.ValidateCalls())
+func (mock *ContextInformationManagerMock) ValidateCalls() []struct {
+	Ctx context.Context
+	Cfg config.Config
+} {
+	var calls []struct {
+		Ctx context.Context
+		Cfg config.Config
+	}
+	mock.lockValidate.RLock()
+	calls = mock.calls.Validate
+	mock.lockValidate.RUnlock()
+	return calls
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"io"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -11,14 +12,40 @@ type EntityInfo struct {
 	Type      string `yaml:"type"`
 }
 
+// RegistrationInfo describes the entities that a context source provides. A context source
+// that is only able to provide some of the attributes of the entities lists them in
+// PropertyNames and RelationshipNames, otherwise it is expected to provide all of them.
+// Location optionally limits the entities to a geographic area, so that geo-queries are
+// only sent to the context sources that cover the queried area.
 type RegistrationInfo struct {
-	Entities []EntityInfo `yaml:"entities"`
+	Entities          []EntityInfo `yaml:"entities"`
+	PropertyNames     []string     `yaml:"propertyNames"`
+	RelationshipNames []string     `yaml:"relationshipNames"`
+	Location          *Geometry    `yaml:"location"`
+}
+
+// Geometry is a GeoJSON geometry, such as a Polygon or MultiPolygon
+type Geometry struct {
+	Type        string `yaml:"type"`
+	Coordinates any    `yaml:"coordinates"`
 }
 
 type ContextSourceConfig struct {
-	Endpoint    string             `yaml:"endpoint"`
-	Temporal    TemporalInfo       `yaml:"temporal"`
-	Information []RegistrationInfo `yaml:"information"`
+	Endpoint       string               `yaml:"endpoint"`
+	Tenant         string               `yaml:"tenant"`
+	Temporal       TemporalInfo         `yaml:"temporal"`
+	Information    []RegistrationInfo   `yaml:"information"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+	Retry          RetryConfig          `yaml:"retry"`
+	HTTP           HTTPConfig           `yaml:"http"`
+	Auth           AuthConfig           `yaml:"auth"`
+}
+
+// CircuitBreakerConfig controls when requests to a failing context source should
+// fail fast instead of being sent, and how often it should be probed for recovery
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	ProbeInterval    time.Duration `yaml:"probeInterval"`
 }
 
 func (cs *ContextSourceConfig) TemporalEndpoint() string {
@@ -34,6 +61,76 @@ func (cs *ContextSourceConfig) TemporalEndpoint() string {
 	return cs.Endpoint
 }
 
+// NoTenant can be configured as the tenant of a context source to make it explicit that
+// requests should be sent to the default tenant of the context source
+const NoTenant string = "none"
+
+// DownstreamTenant returns the NGSILD-Tenant that should be used in requests to the context
+// source, or an empty string if requests should be sent without a tenant header
+func (cs *ContextSourceConfig) DownstreamTenant() string {
+	if cs.Tenant == NoTenant {
+		return ""
+	}
+
+	return cs.Tenant
+}
+
+// RetryConfig controls how failed GET and DELETE requests to a context source are retried.
+// PATCH requests are only retried if RetryPatch is set, as merging the same fragment twice
+// is only safe if the context source does not derive any values from the current state.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	RetryPatch     bool          `yaml:"retryPatch"`
+}
+
+// HTTPConfig tunes the connection pool and timeouts of the client that is used to
+// talk to a context source. Zero values are replaced by the broker's defaults.
+type HTTPConfig struct {
+	MaxIdleConns          int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout"`
+	KeepAlive             time.Duration `yaml:"keepAlive"`
+	DialTimeout           time.Duration `yaml:"dialTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout"`
+	RequestTimeout        time.Duration `yaml:"requestTimeout"`
+}
+
+const (
+	AuthTypeBearer string = "bearer"
+	AuthTypeAPIKey string = "apikey"
+	AuthTypeOAuth2 string = "oauth2"
+)
+
+// AuthConfig holds the credentials that the broker should present to a context source.
+// Type selects between a static bearer token, a static API key sent in Header, or an access
+// token fetched from TokenURL using the OAuth2 client credentials grant. Secret holds the
+// token, the key or the client secret respectively. A client certificate for mutual TLS
+// can be configured on its own or in combination with any of the other types.
+type AuthConfig struct {
+	Type     string       `yaml:"type"`
+	Header   string       `yaml:"header"`
+	Secret   SecretConfig `yaml:"secret"`
+	TokenURL string       `yaml:"tokenUrl"`
+	ClientID string       `yaml:"clientId"`
+	Scope    string       `yaml:"scope"`
+	TLS      TLSConfig    `yaml:"tls"`
+}
+
+// SecretConfig points out where a secret can be read from, either an environment
+// variable or a file, so that secrets need not be part of the configuration file
+type SecretConfig struct {
+	Env  string `yaml:"env"`
+	File string `yaml:"file"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	CAFile   string `yaml:"caFile"`
+}
+
 type Notification struct {
 	Endpoint string `yaml:"endpoint"`
 }
@@ -48,10 +145,88 @@ type Tenant struct {
 	Name           string                `yaml:"name"`
 	ContextSources []ContextSourceConfig `yaml:"contextSources"`
 	Notifications  []Notification        `yaml:"notifications"`
+	Cache          []CacheConfig         `yaml:"cache"`
+	RateLimits     RateLimitConfig       `yaml:"rateLimits"`
+}
+
+// RateLimitConfig limits the rate of requests to a tenant, both in total and per client. Clients
+// are identified by the azp or client_id claim of their token, or by their address if they send
+// no token.
+type RateLimitConfig struct {
+	Tenant RateLimitBudgets `yaml:"tenant"`
+	Client RateLimitBudgets `yaml:"client"`
+}
+
+// RateLimitBudgets holds separate limits for reads (GET and HEAD requests, and queries that are
+// posted to /entityOperations/query) and writes
+type RateLimitBudgets struct {
+	Read  RateLimit `yaml:"read"`
+	Write RateLimit `yaml:"write"`
+}
+
+// RateLimit is a token bucket that is refilled with Rate tokens per second and holds at most
+// Burst tokens. Requests are not limited if Rate is zero, and Burst defaults to the rate.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// CacheConfig enables caching of retrieved entities, and of queries for them, of an entity
+// type. Entries are kept for at most TTL and no more than MaxSize entries are kept per type.
+// Zero values are replaced by the broker's defaults.
+type CacheConfig struct {
+	Type    string        `yaml:"type"`
+	TTL     time.Duration `yaml:"ttl"`
+	MaxSize int           `yaml:"maxSize"`
+}
+
+// StorageConfig points out a local directory where the broker can persist state, such as
+// context source registrations, that is created at runtime. State is kept in memory only
+// if no path is configured.
+type StorageConfig struct {
+	Path string `yaml:"path"`
+}
+
+// ServerConfig controls how the broker treats the requests that it serves. TrustedProxies lists
+// the addresses, or CIDR ranges, of the reverse proxies in front of the broker. The address of a
+// client is only taken from the X-Forwarded-For header of requests that come from them.
+type ServerConfig struct {
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+// NotifierConfig controls how notifications are delivered to subscribers
+type NotifierConfig struct {
+	Retry NotificationRetryConfig `yaml:"retry"`
+	Queue NotificationQueueConfig `yaml:"queue"`
+}
+
+// NotificationRetryConfig controls how notifications that could not be delivered are retried,
+// with an exponentially increasing backoff between attempts. Notifications that have not been
+// delivered after MaxAttempts are kept as dead letters that can be replayed later on. Zero
+// values are replaced by the broker's defaults.
+type NotificationRetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// NotificationQueueConfig controls the queue that each notification endpoint gets, and how many
+// workers that deliver notifications from it. Overflow decides what happens when a queue is full:
+// "dropOldest" drops the oldest notification in the queue, "block" holds notifications back, with
+// their events left in the outbox, until there is room in the queue, and "spill" writes
+// notifications to disk until there is. Spilling requires a storage path, and is the default when there is one. Zero values are
+// replaced by the broker's defaults.
+type NotificationQueueConfig struct {
+	Size     int    `yaml:"size"`
+	Workers  int    `yaml:"workers"`
+	Overflow string `yaml:"overflow"`
 }
 
 type Config struct {
-	Tenants []Tenant `yaml:"tenants"`
+	Tenants  []Tenant       `yaml:"tenants"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Notifier NotifierConfig `yaml:"notifier"`
+	Server   ServerConfig   `yaml:"server"`
 }
 
 func Load(data io.Reader) (*Config, error) {
@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -29,6 +30,7 @@ func TestLoadContextSource(t *testing.T) {
 
 	csource := tenant.ContextSources[0]
 	is.Equal(csource.Endpoint, "http://lolcathost:1234")
+	is.Equal(csource.DownstreamTenant(), "kommunen")
 	is.Equal(len(csource.Information), 1) // should find a single registration info
 }
 
@@ -43,6 +45,73 @@ func TestLoadTemporalEndpoint(t *testing.T) {
 	is.Equal(csource.Temporal.Endpoint, "http://tempz:1337")
 }
 
+func TestLoadCircuitBreaker(t *testing.T) {
+	is, config := setupConfigTest(t)
+	csource := config.Tenants[0].ContextSources[0]
+
+	is.Equal(csource.CircuitBreaker.FailureThreshold, 3)
+	is.Equal(csource.CircuitBreaker.ProbeInterval, 10*time.Second)
+}
+
+func TestLoadRetry(t *testing.T) {
+	is, config := setupConfigTest(t)
+	csource := config.Tenants[0].ContextSources[0]
+
+	is.Equal(csource.Retry.MaxAttempts, 4)
+	is.Equal(csource.Retry.InitialBackoff, 200*time.Millisecond)
+	is.True(!csource.Retry.RetryPatch)
+}
+
+func TestLoadAuth(t *testing.T) {
+	is, config := setupConfigTest(t)
+	csource := config.Tenants[0].ContextSources[0]
+
+	is.Equal(csource.Auth.Type, AuthTypeOAuth2)
+	is.Equal(csource.Auth.TokenURL, "http://keycloak/token")
+	is.Equal(csource.Auth.ClientID, "context-broker")
+	is.Equal(csource.Auth.Secret.Env, "CSOURCE_CLIENT_SECRET")
+	is.Equal(csource.Auth.TLS.CAFile, "/certs/ca.pem")
+}
+
+func TestLoadCache(t *testing.T) {
+	is, config := setupConfigTest(t)
+	cache := config.Tenants[0].Cache
+
+	is.Equal(len(cache), 1) // should find a single cache config
+	is.Equal(cache[0].Type, "Beach")
+	is.Equal(cache[0].TTL, 30*time.Second)
+	is.Equal(cache[0].MaxSize, 500)
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	is, config := setupConfigTest(t)
+	limits := config.Tenants[0].RateLimits
+
+	is.Equal(limits.Tenant.Read.Rate, 100.0)
+	is.Equal(limits.Tenant.Read.Burst, 200)
+	is.Equal(limits.Client.Write.Rate, 0.5)
+}
+
+func TestLoadNotifier(t *testing.T) {
+	is, config := setupConfigTest(t)
+	retry := config.Notifier.Retry
+
+	is.Equal(retry.MaxAttempts, 6)
+	is.Equal(retry.InitialBackoff, time.Second)
+	is.Equal(retry.MaxBackoff, time.Minute)
+
+	queue := config.Notifier.Queue
+	is.Equal(queue.Size, 500)
+	is.Equal(queue.Workers, 4)
+	is.Equal(queue.Overflow, "dropOldest")
+}
+
+func TestLoadServer(t *testing.T) {
+	is, config := setupConfigTest(t)
+
+	is.Equal(config.Server.TrustedProxies, []string{"10.0.0.0/8", "192.168.1.10"})
+}
+
 func TestLoadRegistrationInfo(t *testing.T) {
 	is, config := setupConfigTest(t)
 	csource := config.Tenants[0].ContextSources[0]
@@ -51,6 +120,8 @@ func TestLoadRegistrationInfo(t *testing.T) {
 	is.Equal(len(reginfo.Entities), 2) // should find two entity infos
 	is.Equal(reginfo.Entities[0].Type, "Device")
 	is.Equal(reginfo.Entities[1].Type, "DeviceModel")
+	is.Equal(reginfo.Location.Type, "Polygon")
+	is.Equal(len(reginfo.Location.Coordinates.([]any)), 1) // should contain the exterior ring
 }
 
 func setupConfigTest(t *testing.T) (*is.I, *Config) {
@@ -63,21 +134,64 @@ func setupConfigTest(t *testing.T) (*is.I, *Config) {
 }
 
 var configFile string = `
+server:
+  trustedProxies:
+    - 10.0.0.0/8
+    - 192.168.1.10
+notifier:
+  retry:
+    maxAttempts: 6
+    initialBackoff: 1s
+    maxBackoff: 1m
+  queue:
+    size: 500
+    workers: 4
+    overflow: dropOldest
 tenants:
   - id: default
     name: Kommunen
     notifications:      
       - endpoint: http://endpoint-01/v2/notify
       - endpoint: http://endpoint-02/v2/notify	
+    cache:
+      - type: Beach
+        ttl: 30s
+        maxSize: 500
+    rateLimits:
+      tenant:
+        read:
+          rate: 100
+          burst: 200
+      client:
+        write:
+          rate: 0.5
     contextSources:
     - endpoint: http://lolcathost:1234
+      tenant: kommunen
       temporal:
         enabled: true
         endpoint: http://tempz:1337
+      circuitBreaker:
+        failureThreshold: 3
+        probeInterval: 10s
+      retry:
+        maxAttempts: 4
+        initialBackoff: 200ms
+      auth:
+        type: oauth2
+        tokenUrl: http://keycloak/token
+        clientId: context-broker
+        secret:
+          env: CSOURCE_CLIENT_SECRET
+        tls:
+          caFile: /certs/ca.pem
       information:
       - entities:
         - idPattern: ^urn:ngsi-ld:Device:.+
           type: Device
         - idPattern: ^urn:ngsi-ld:DeviceModel:.+
           type: DeviceModel
+        location:
+          type: Polygon
+          coordinates: [[[17.2, 62.3], [17.4, 62.3], [17.4, 62.5], [17.2, 62.5], [17.2, 62.3]]]
 `
@@ -0,0 +1,413 @@
+package contextbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/subscriptions"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+)
+
+// sourceBatch is the part of a batch operation that is forwarded to a single context source
+type sourceBatch struct {
+	source    *contextSource
+	entityIDs []string
+	entities  []types.Entity // nil for batches of entity ids only, such as deletes
+}
+
+// batchesPerSource groups the parts of a batch operation per context source, in the order
+// that the sources were first routed to
+type batchesPerSource []*sourceBatch
+
+func (bps batchesPerSource) add(src *contextSource, entityID string, entity types.Entity) batchesPerSource {
+	idx := slices.IndexFunc(bps, func(b *sourceBatch) bool { return b.source == src })
+	if idx < 0 {
+		bps = append(bps, &sourceBatch{source: src})
+		idx = len(bps) - 1
+	}
+
+	batch := bps[idx]
+	batch.entityIDs = append(batch.entityIDs, entityID)
+	if entity != nil {
+		batch.entities = append(batch.entities, entity)
+	}
+
+	return bps
+}
+
+const notFoundProblemType string = "https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound"
+
+// batchUnsupportedTTL is how long a context source that did not support a batch operation is
+// sent single requests, before the batch endpoint is tried again
+const batchUnsupportedTTL time.Duration = 10 * time.Minute
+
+// batchFunc forwards a batch to a context source as a single request
+type batchFunc func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch) (*ngsild.BatchOperationResult, error)
+
+// singleFunc forwards the entity at the index of a batch to a context source on its own
+type singleFunc func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch, idx int) error
+
+func (app *contextBrokerApp) CreateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ngsild.NewBatchOperationResult()
+	batches := batchesPerSource{}
+
+	entities, changes := app.prepareBatch(result, entities, func(e types.Entity) (subscriptions.Change, error) {
+		return app.entityCreated(ctx, tenant, e)
+	})
+
+	for _, e := range entities {
+		src, ok := routes.sourceForNewEntity(e.ID(), e.Type())
+		if !ok {
+			result.Failed(ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could create type %s with id %s", e.Type(), e.ID())), e.ID())
+			continue
+		}
+
+		batches = batches.add(src, e.ID(), e)
+	}
+
+	result.Append(app.runBatches(ctx, batches,
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch) (*ngsild.BatchOperationResult, error) {
+			return cbClient.CreateEntities(ctx, batch.entities, headers)
+		},
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch, idx int) error {
+			_, err := cbClient.CreateEntity(ctx, batch.entities[idx], headers)
+			return err
+		},
+	))
+
+	app.afterBatch(routes, tenant, entities, result)
+	changes.settle(result)
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) UpsertEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ngsild.NewBatchOperationResult()
+	batches := batchesPerSource{}
+
+	entities, changes := app.prepareBatchUpdated(ctx, tenant, result, entities)
+
+	for _, e := range entities {
+		// attributes that are provided by other sources than the one that creates the entity are
+		// written to those sources, the same way as they are when the entity is updated
+		fragments, err := routes.fragmentsPerSource(e.ID(), e)
+		if err == nil && len(fragments) > 1 {
+			for _, sf := range fragments {
+				batches = batches.add(sf.source, e.ID(), entityWithAttributesOf(e, sf, len(fragments)))
+			}
+			continue
+		}
+
+		src, ok := routes.sourceForNewEntity(e.ID(), e.Type())
+		if !ok {
+			result.Failed(ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could upsert type %s with id %s", e.Type(), e.ID())), e.ID())
+			continue
+		}
+
+		batches = batches.add(src, e.ID(), e)
+	}
+
+	result.Append(app.runBatches(ctx, batches,
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch) (*ngsild.BatchOperationResult, error) {
+			return cbClient.UpsertEntities(ctx, batch.entities, headers)
+		},
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch, idx int) error {
+			entity := batch.entities[idx]
+
+			// an upsert replaces existing entities, the same way as the batch endpoint does
+			_, err := cbClient.CreateEntity(ctx, entity, headers)
+			if errors.Is(err, ngsierrors.ErrAlreadyExists) {
+				_, err = cbClient.ReplaceEntity(ctx, entity.ID(), entity, headers)
+			}
+
+			return err
+		},
+	))
+
+	app.afterBatch(routes, tenant, entities, result)
+	changes.settle(result)
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) UpdateEntities(ctx context.Context, tenant string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ngsild.NewBatchOperationResult()
+	batches := batchesPerSource{}
+
+	entities, changes := app.prepareBatchUpdated(ctx, tenant, result, entities)
+
+	for _, e := range entities {
+		fragments, err := routes.fragmentsPerSource(e.ID(), e)
+		if err != nil {
+			result.Failed(err, e.ID())
+			continue
+		}
+
+		for _, sf := range fragments {
+			batches = batches.add(sf.source, e.ID(), entityWithAttributesOf(e, sf, len(fragments)))
+		}
+	}
+
+	result.Append(app.runBatches(ctx, batches,
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch) (*ngsild.BatchOperationResult, error) {
+			return cbClient.UpdateEntities(ctx, batch.entities, headers)
+		},
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch, idx int) error {
+			_, err := cbClient.UpdateEntityAttributes(ctx, batch.entityIDs[idx], batch.entities[idx], headers)
+			return err
+		},
+	))
+
+	app.afterBatch(routes, tenant, entities, result)
+	changes.settle(result)
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) DeleteEntities(ctx context.Context, tenant string, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ngsild.NewBatchOperationResult()
+	batches := batchesPerSource{}
+
+	for _, id := range entityIDs {
+		sources := routes.sourcesForEntity(id)
+		if len(sources) == 0 {
+			result.Failed(ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could delete entity with id %s", id)), id)
+			continue
+		}
+
+		// the entity is deleted from every source that provides any of its attributes, so that
+		// none of them are left behind to show up in later reads
+		for _, es := range sources {
+			batches = batches.add(es.source, id, nil)
+		}
+	}
+
+	result.Append(app.runBatches(ctx, batches,
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch) (*ngsild.BatchOperationResult, error) {
+			return cbClient.DeleteEntities(ctx, batch.entityIDs)
+		},
+		func(ctx context.Context, cbClient client.ContextBrokerClient, batch *sourceBatch, idx int) error {
+			_, err := cbClient.DeleteEntity(ctx, batch.entityIDs[idx])
+			return err
+		},
+	))
+
+	for _, id := range entityIDs {
+		app.invalidateCache(routes, tenant, id)
+	}
+
+	return consolidated(deletedFromAnySource(result)), nil
+}
+
+// deletedFromAnySource drops the not found errors of entities that were deleted from at least one
+// of their context sources, as a source that provides some of the attributes of an entity need not
+// hold anything for it. Entities that were not found anywhere are reported as not found once.
+func deletedFromAnySource(result *ngsild.BatchOperationResult) *ngsild.BatchOperationResult {
+	reported := map[string]bool{}
+
+	result.Errors = slices.DeleteFunc(result.Errors, func(e ngsild.BatchEntityError) bool {
+		if e.Error.Type != notFoundProblemType {
+			return false
+		}
+
+		drop := slices.Contains(result.Success, e.EntityID) || reported[e.EntityID]
+		reported[e.EntityID] = true
+
+		return drop
+	})
+
+	return result
+}
+
+// runBatches forwards the batches to their context sources in parallel. Sources that do not
+// implement the batch endpoint are sent one request per entity instead, and are remembered for
+// a while so that later batches go straight to the single requests.
+func (app *contextBrokerApp) runBatches(ctx context.Context, batches batchesPerSource, runBatch batchFunc, runSingle singleFunc) *ngsild.BatchOperationResult {
+	results := make([]*ngsild.BatchOperationResult, len(batches))
+
+	var wg sync.WaitGroup
+
+	for i, batch := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cbClient := app.client(batch.source)
+			endpoint := batch.source.Endpoint
+
+			if !app.batchIsUnsupported(endpoint) {
+				r, err := runBatch(ctx, cbClient, batch)
+				if err == nil {
+					results[i] = r
+					return
+				}
+
+				if !errors.Is(err, client.ErrBatchNotSupported) {
+					results[i] = ngsild.NewBatchOperationResult()
+					results[i].Failed(err, batch.entityIDs...)
+					return
+				}
+
+				app.batchUnsupported.Store(endpoint, time.Now())
+			}
+
+			results[i] = ngsild.NewBatchOperationResult()
+
+			for idx, id := range batch.entityIDs {
+				if err := runSingle(ctx, cbClient, batch, idx); err != nil {
+					results[i].Failed(err, id)
+				} else {
+					results[i].Succeeded(id)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	result := ngsild.NewBatchOperationResult()
+	for _, r := range results {
+		result.Append(r)
+	}
+
+	return result
+}
+
+// batchIsUnsupported reports if the context source at the endpoint did not support a batch
+// operation recently enough for it not to be worth trying again
+func (app *contextBrokerApp) batchIsUnsupported(endpoint string) bool {
+	since, ok := app.batchUnsupported.Load(endpoint)
+	if !ok {
+		return false
+	}
+
+	if time.Since(since.(time.Time)) >= batchUnsupportedTTL {
+		app.batchUnsupported.CompareAndDelete(endpoint, since)
+		return false
+	}
+
+	return true
+}
+
+// afterBatch invalidates cached copies of the entities of a batch and consolidates its result
+func (app *contextBrokerApp) afterBatch(routes *tenantRoutes, tenant string, entities []types.Entity, result *ngsild.BatchOperationResult) {
+	for _, e := range entities {
+		app.invalidateCache(routes, tenant, e.ID(), e.Type())
+	}
+
+	consolidated(result)
+}
+
+func (app *contextBrokerApp) prepareBatchUpdated(ctx context.Context, tenant string, result *ngsild.BatchOperationResult, entities []types.Entity) ([]types.Entity, batchChanges) {
+	return app.prepareBatch(result, entities, func(e types.Entity) (subscriptions.Change, error) {
+		return app.entityUpdated(ctx, tenant, e.ID(), attributeNames(e))
+	})
+}
+
+// prepareBatch writes an event to the outbox about each of the entities of a batch operation
+// before the batch is forwarded to the context sources. Entities whose events could not be
+// written are reported as failed and left out of the batch, so that the subscribers are not left
+// unaware of changes to them.
+func (app *contextBrokerApp) prepareBatch(result *ngsild.BatchOperationResult, entities []types.Entity, prepare func(types.Entity) (subscriptions.Change, error)) ([]types.Entity, batchChanges) {
+	if app.notifier == nil {
+		return entities, nil
+	}
+
+	prepared := make([]types.Entity, 0, len(entities))
+	changes := make(batchChanges, 0, len(entities))
+
+	for _, e := range entities {
+		change, err := prepare(e)
+		if err != nil {
+			result.Failed(err, e.ID())
+			continue
+		}
+
+		prepared = append(prepared, e)
+		changes = append(changes, batchChange{entityID: e.ID(), change: change})
+	}
+
+	return prepared, changes
+}
+
+// batchChange is the change to an entity of a batch operation that has been written to the outbox
+type batchChange struct {
+	entityID string
+	change   subscriptions.Change
+}
+
+type batchChanges []batchChange
+
+// settle commits the changes to the entities that the batch operation succeeded for, and
+// discards the rest
+func (bc batchChanges) settle(result *ngsild.BatchOperationResult) {
+	for _, c := range bc {
+		if slices.Contains(result.Success, c.entityID) {
+			c.change.Commit()
+		} else {
+			c.change.Discard()
+		}
+	}
+}
+
+// consolidated lists each entity once in the result. Entities whose attributes are spread
+// over several context sources are only reported as successful if all of the sources were.
+func consolidated(result *ngsild.BatchOperationResult) *ngsild.BatchOperationResult {
+	failed := map[string]bool{}
+	for _, e := range result.Errors {
+		failed[e.EntityID] = true
+	}
+
+	success := make([]string, 0, len(result.Success))
+	for _, id := range result.Success {
+		if !failed[id] && !slices.Contains(success, id) {
+			success = append(success, id)
+		}
+	}
+
+	result.Success = success
+
+	return result
+}
+
+// entityWithAttributesOf returns the part of the entity that is written to the source of the
+// fragment, which is the entity itself unless its attributes are spread over several sources
+func entityWithAttributesOf(entity types.Entity, sf sourceFragment, sources int) types.Entity {
+	if sources <= 1 {
+		return entity
+	}
+
+	attributes := attributeNames(sf.fragment)
+
+	return entities.SelectAttributes(entity, func(attributeName string) bool {
+		return slices.Contains(attributes, attributeName)
+	})
+}
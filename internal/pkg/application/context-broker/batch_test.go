@@ -0,0 +1,194 @@
+package contextbroker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+	"github.com/matryer/is"
+)
+
+func TestThatBatchesAreGroupedPerSourceAndFallBackToSingleCalls(t *testing.T) {
+	is := is.New(t)
+
+	var mu sync.Mutex
+	requests := map[string][]string{}
+
+	record := func(name string, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[name] = append(requests[name], r.Method+" "+r.URL.Path)
+	}
+
+	devices := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("devices", r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`["urn:ngsi-ld:Device:01","urn:ngsi-ld:Device:02"]`))
+	}))
+	defer devices.Close()
+
+	// a context source that does not implement the batch endpoints
+	consumption := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("consumption", r)
+		if r.URL.Path == "/ngsi-ld/v1/entityOperations/create" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer consumption.Close()
+
+	broker, err := New(context.Background(), withTwoSourcesTestConfig(devices.URL, consumption.URL))
+	is.NoErr(err)
+
+	batch := []types.Entity{
+		testEntity("Device", "urn:ngsi-ld:Device:01"),
+		testEntity("WaterConsumptionObserved", "urn:ngsi-ld:WaterConsumptionObserved:01"),
+		testEntity("Device", "urn:ngsi-ld:Device:02"),
+		testEntity("Beach", "urn:ngsi-ld:Beach:01"),
+	}
+
+	result, err := broker.CreateEntities(context.Background(), "testtenant", batch, map[string][]string{})
+	is.NoErr(err)
+
+	is.Equal(len(result.Success), 3)
+	is.Equal(len(result.Errors), 1) // the beach should have nowhere to go
+	is.Equal(result.Errors[0].EntityID, "urn:ngsi-ld:Beach:01")
+
+	is.Equal(requests["devices"], []string{"POST /ngsi-ld/v1/entityOperations/create"}) // both devices in a single batch
+	is.Equal(requests["consumption"], []string{"POST /ngsi-ld/v1/entityOperations/create", "POST /ngsi-ld/v1/entities"})
+
+	_, err = broker.CreateEntities(context.Background(), "testtenant", batch[1:2], map[string][]string{})
+	is.NoErr(err)
+
+	is.Equal(len(requests["consumption"]), 3) // should go straight to single calls once batches are known to be unsupported
+}
+
+func TestThatOnlyMissingBatchEndpointsAreRememberedForAWhile(t *testing.T) {
+	is := is.New(t)
+
+	var mu sync.Mutex
+	requests := map[string][]string{}
+
+	record := func(name string, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[name] = append(requests[name], r.Method+" "+r.URL.Path)
+	}
+
+	// a context source that implements the batch endpoints, but does not know the entities
+	devices := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("devices", r)
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"type":"https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound","title":"not found"}`))
+	}))
+	defer devices.Close()
+
+	// a context source that does not implement the batch endpoints, and already has the entity
+	consumption := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("consumption", r)
+		switch {
+		case r.URL.Path == "/ngsi-ld/v1/entityOperations/upsert":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"type":"https://uri.etsi.org/ngsi-ld/errors/AlreadyExists","title":"already exists"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer consumption.Close()
+
+	broker, err := New(context.Background(), withTwoSourcesTestConfig(devices.URL, consumption.URL))
+	is.NoErr(err)
+
+	batch := []types.Entity{
+		testEntity("Device", "urn:ngsi-ld:Device:01"),
+		testEntity("WaterConsumptionObserved", "urn:ngsi-ld:WaterConsumptionObserved:01"),
+	}
+
+	for range 2 {
+		_, err = broker.UpsertEntities(context.Background(), "testtenant", batch, map[string][]string{})
+		is.NoErr(err)
+	}
+
+	is.Equal(requests["devices"], []string{
+		"POST /ngsi-ld/v1/entityOperations/upsert",
+		"POST /ngsi-ld/v1/entityOperations/upsert",
+	}) // a not found with a problem report should not make the batch endpoint count as missing
+
+	is.Equal(requests["consumption"], []string{
+		"POST /ngsi-ld/v1/entityOperations/upsert",
+		"POST /ngsi-ld/v1/entities",
+		"PUT /ngsi-ld/v1/entities/urn:ngsi-ld:WaterConsumptionObserved:01",
+		"POST /ngsi-ld/v1/entities",
+		"PUT /ngsi-ld/v1/entities/urn:ngsi-ld:WaterConsumptionObserved:01",
+	}) // existing entities should be replaced
+
+	app := broker.(*contextBrokerApp)
+	app.batchUnsupported.Store(consumption.URL, time.Now().Add(-batchUnsupportedTTL))
+
+	_, err = broker.UpsertEntities(context.Background(), "testtenant", batch[1:], map[string][]string{})
+	is.NoErr(err)
+
+	is.Equal(requests["consumption"][5], "POST /ngsi-ld/v1/entityOperations/upsert") // should try the batch endpoint again once the ttl has passed
+}
+
+func TestThatBatchUpsertsAndDeletesAreSplitPerSourceOfTheAttributes(t *testing.T) {
+	is := is.New(t)
+
+	var mu sync.Mutex
+	received := map[string][]string{}
+
+	newSource := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			received[name] = append(received[name], r.URL.Path+" "+string(body))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+
+	static, observed := newSource("static"), newSource("observed")
+	defer static.Close()
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL, observed.URL))
+	is.NoErr(err)
+
+	beach, _ := entities.New("urn:ngsi-ld:Beach:01", "Beach",
+		entities.P("name", properties.NewTextProperty("Hartungviken")),
+		entities.P("temperature", properties.NewNumberProperty(17.2)),
+	)
+
+	result, err := broker.UpsertEntities(context.Background(), "testtenant", []types.Entity{beach}, map[string][]string{})
+	is.NoErr(err)
+	is.Equal(result.Success, []string{"urn:ngsi-ld:Beach:01"})
+
+	is.Equal(len(received["static"]), 1)
+	is.True(strings.Contains(received["static"][0], "name"))
+	is.True(!strings.Contains(received["static"][0], "temperature"))
+	is.Equal(len(received["observed"]), 1)
+	is.True(strings.Contains(received["observed"][0], "temperature"))
+	is.True(!strings.Contains(received["observed"][0], "name"))
+
+	result, err = broker.DeleteEntities(context.Background(), "testtenant", []string{"urn:ngsi-ld:Beach:01"})
+	is.NoErr(err)
+	is.Equal(result.Success, []string{"urn:ngsi-ld:Beach:01"})
+
+	is.True(strings.HasPrefix(received["static"][1], "/ngsi-ld/v1/entityOperations/delete"))
+	is.True(strings.HasPrefix(received["observed"][1], "/ngsi-ld/v1/entityOperations/delete"))
+}
@@ -0,0 +1,325 @@
+package contextbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultFailureThreshold int           = 5
+	defaultProbeInterval    time.Duration = 30 * time.Second
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker tracks the health of a single context source endpoint. It is used as
+// the transport of the clients that talk to the endpoint, so that requests fail fast
+// while the endpoint is known to be failing.
+//
+// After failureThreshold consecutive failures the breaker opens. Once probeInterval has
+// passed, a single request is let through to probe the endpoint. The breaker closes if
+// the probe succeeds and stays open for another interval if it fails.
+type circuitBreaker struct {
+	endpoint         string
+	failureThreshold int
+	probeInterval    time.Duration
+
+	next    http.RoundTripper
+	logger  *slog.Logger
+	metrics *breakerMetrics
+	now     func() time.Time
+
+	mu                  sync.Mutex
+	state               breakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	successes           int64
+	failures            int64
+}
+
+func newCircuitBreaker(endpoint string, cfg config.CircuitBreakerConfig, next http.RoundTripper, logger *slog.Logger, metrics *breakerMetrics) *circuitBreaker {
+	b := &circuitBreaker{
+		endpoint:         endpoint,
+		failureThreshold: cfg.FailureThreshold,
+		probeInterval:    cfg.ProbeInterval,
+		next:             next,
+		logger:           logger.With(slog.String("endpoint", endpoint)),
+		metrics:          metrics,
+		now:              time.Now,
+	}
+
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultFailureThreshold
+	}
+
+	if b.probeInterval <= 0 {
+		b.probeInterval = defaultProbeInterval
+	}
+
+	return b
+}
+
+func (b *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !b.allow() {
+		b.metrics.recordRequest(req.Context(), b.endpoint, "rejected")
+		return nil, ngsierrors.NewServiceUnavailableError(
+			fmt.Sprintf("context source %s is unavailable", b.endpoint),
+		)
+	}
+
+	resp, err := b.next.RoundTrip(req)
+
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		// the caller gave up, which says nothing about the health of the context source
+		b.release()
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		b.metrics.recordRequest(req.Context(), b.endpoint, "failure")
+		b.onFailure()
+	default:
+		b.metrics.recordRequest(req.Context(), b.endpoint, "success")
+		b.onSuccess()
+	}
+
+	return resp, err
+}
+
+// allow reports if a request may be sent to the endpoint, turning an open breaker
+// half-open and letting the request through as a probe when the probe interval has passed
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.probeInterval {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	default:
+		// a probe is already in flight
+		return false
+	}
+}
+
+func (b *circuitBreaker) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.successes++
+	b.consecutiveFailures = 0
+
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+func (b *circuitBreaker) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.consecutiveFailures++
+
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.consecutiveFailures >= b.failureThreshold) {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// release makes a breaker that let a probe through ready to probe again
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	previous := b.state
+	b.state = state
+
+	total := b.successes + b.failures
+	errorRate := 0.0
+	if total > 0 {
+		errorRate = float64(b.failures) / float64(total)
+	}
+
+	log := b.logger.With(
+		slog.String("from", previous.String()), slog.String("to", state.String()),
+		slog.Int64("successes", b.successes), slog.Int64("failures", b.failures),
+		slog.Float64("errorRate", errorRate),
+	)
+
+	if state == breakerOpen {
+		log.Warn("context source circuit breaker opened", slog.Int("consecutiveFailures", b.consecutiveFailures))
+	} else {
+		log.Info("context source circuit breaker changed state")
+	}
+}
+
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// breakerRegistry keeps track of the circuit breakers of all context source endpoints,
+// so that their state can be reported as metrics
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers []*circuitBreaker
+
+	logger  *slog.Logger
+	metrics *breakerMetrics
+}
+
+func newBreakerRegistry(logger *slog.Logger) *breakerRegistry {
+	r := &breakerRegistry{
+		breakers: []*circuitBreaker{},
+		logger:   logger,
+	}
+
+	r.metrics = newBreakerMetrics(r)
+
+	return r
+}
+
+// add creates a breaker for an endpoint in front of the next transport
+func (r *breakerRegistry) add(endpoint string, cfg config.CircuitBreakerConfig, next http.RoundTripper) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := newCircuitBreaker(endpoint, cfg, next, r.logger, r.metrics)
+	r.breakers = append(r.breakers, b)
+
+	return b
+}
+
+func (r *breakerRegistry) remove(b *circuitBreaker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.breakers = slices.DeleteFunc(r.breakers, func(other *circuitBreaker) bool { return other == b })
+}
+
+// close stops reporting the state of the breakers in the registry
+func (r *breakerRegistry) close() {
+	if r != nil {
+		r.metrics.unregister()
+	}
+}
+
+func (r *breakerRegistry) forEach(fn func(*circuitBreaker)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, b := range r.breakers {
+		fn(b)
+	}
+}
+
+// statesPerEndpoint combines the states of the breakers of each endpoint, since an endpoint may be
+// shared by several tenants or sources that have a breaker each. An endpoint is reported as open
+// if any of its breakers is, and as half-open if any of them is probing it.
+func (r *breakerRegistry) statesPerEndpoint() map[string]breakerState {
+	states := map[string]breakerState{}
+
+	r.forEach(func(b *circuitBreaker) {
+		current, combined := b.currentState(), states[b.endpoint]
+		if current == breakerOpen || (current == breakerHalfOpen && combined != breakerOpen) {
+			combined = current
+		}
+		states[b.endpoint] = combined
+	})
+
+	return states
+}
+
+var meter = otel.Meter("context-broker/context-sources")
+
+type breakerMetrics struct {
+	requests metric.Int64Counter
+	state    metric.Registration
+}
+
+func newBreakerMetrics(registry *breakerRegistry) *breakerMetrics {
+	m := &breakerMetrics{}
+
+	// instruments are only used if they could be created, failing to do so should not stop the broker
+	m.requests, _ = meter.Int64Counter(
+		"context_source.requests",
+		metric.WithDescription("number of requests sent to, or rejected before reaching, a context source"),
+	)
+
+	state, err := meter.Int64ObservableGauge(
+		"context_source.breaker.state",
+		metric.WithDescription("state of the context source circuit breaker (0 = closed, 1 = open, 2 = half-open)"),
+	)
+	if err != nil {
+		return m
+	}
+
+	// the callback is registered separately from the gauge, so that it can be unregistered when
+	// the broker is stopped and does not keep reporting breakers that are no longer in use
+	m.state, _ = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for endpoint, s := range registry.statesPerEndpoint() {
+			o.ObserveInt64(state, int64(s), metric.WithAttributes(attribute.String("endpoint", endpoint)))
+		}
+		return nil
+	}, state)
+
+	return m
+}
+
+func (m *breakerMetrics) unregister() {
+	if m != nil && m.state != nil {
+		m.state.Unregister()
+	}
+}
+
+func (m *breakerMetrics) recordRequest(ctx context.Context, endpoint, outcome string) {
+	if m == nil || m.requests == nil {
+		return
+	}
+
+	m.requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", endpoint),
+		attribute.String("outcome", outcome),
+	))
+}
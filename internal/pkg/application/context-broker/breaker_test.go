@@ -0,0 +1,134 @@
+package contextbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/matryer/is"
+)
+
+func TestThatCircuitBreakerOpensAfterRepeatedFailures(t *testing.T) {
+	is := is.New(t)
+
+	transport := &fakeTransport{err: fmt.Errorf("connection refused")}
+	breaker, clock := testBreaker(transport)
+
+	for range 3 {
+		_, err := breaker.RoundTrip(testRequest())
+		is.True(err != nil)
+	}
+
+	is.Equal(breaker.currentState(), breakerOpen)
+
+	_, err := breaker.RoundTrip(testRequest())
+	is.True(errors.Is(err, ngsierrors.ErrServiceUnavailable)) // should fail fast while open
+	is.Equal(transport.calls, 3)                              // should not have reached the transport
+
+	*clock = clock.Add(time.Minute)
+
+	_, err = breaker.RoundTrip(testRequest())
+	is.True(err != nil)
+	is.Equal(transport.calls, 4) // should have let a probe through
+	is.Equal(breaker.currentState(), breakerOpen)
+
+	transport.err = nil
+	*clock = clock.Add(time.Minute)
+
+	_, err = breaker.RoundTrip(testRequest())
+	is.NoErr(err)
+	is.Equal(breaker.currentState(), breakerClosed) // should close after a successful probe
+}
+
+func TestThatCircuitBreakerCountsServerErrorsAsFailures(t *testing.T) {
+	is := is.New(t)
+
+	transport := &fakeTransport{status: http.StatusBadGateway}
+	breaker, _ := testBreaker(transport)
+
+	for range 3 {
+		_, err := breaker.RoundTrip(testRequest())
+		is.NoErr(err)
+	}
+
+	is.Equal(breaker.currentState(), breakerOpen)
+}
+
+func TestThatCircuitBreakerIgnoresCanceledRequests(t *testing.T) {
+	is := is.New(t)
+
+	transport := &fakeTransport{err: context.Canceled}
+	breaker, _ := testBreaker(transport)
+
+	for range 5 {
+		breaker.RoundTrip(testRequest())
+	}
+
+	is.Equal(breaker.currentState(), breakerClosed)
+}
+
+func TestThatTheBreakersOfAnEndpointAreReportedAsOne(t *testing.T) {
+	is := is.New(t)
+
+	registry := newBreakerRegistry(slog.New(slog.DiscardHandler))
+	defer registry.close()
+
+	cfg := config.CircuitBreakerConfig{FailureThreshold: 1, ProbeInterval: time.Minute}
+	registry.add("http://source", cfg, &fakeTransport{})
+	failing := registry.add("http://source", cfg, &fakeTransport{err: fmt.Errorf("connection refused")})
+	registry.add("http://other", cfg, &fakeTransport{})
+
+	failing.RoundTrip(testRequest())
+
+	states := registry.statesPerEndpoint()
+	is.Equal(len(states), 2)                       // should report each endpoint once
+	is.Equal(states["http://source"], breakerOpen) // should be open if any of its breakers is
+	is.Equal(states["http://other"], breakerClosed)
+}
+
+func testBreaker(transport http.RoundTripper) (*circuitBreaker, *time.Time) {
+	clock := time.Now()
+
+	breaker := newCircuitBreaker(
+		"http://source",
+		config.CircuitBreakerConfig{FailureThreshold: 3, ProbeInterval: 30 * time.Second},
+		transport, slog.New(slog.DiscardHandler), nil,
+	)
+	breaker.now = func() time.Time { return clock }
+
+	return breaker, &clock
+}
+
+func testRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://source/ngsi-ld/v1/entities", nil)
+	return req
+}
+
+type fakeTransport struct {
+	err    error
+	status int
+	calls  int
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	status := f.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
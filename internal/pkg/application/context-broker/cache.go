@@ -0,0 +1,367 @@
+package contextbroker
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultCacheTTL     time.Duration = 10 * time.Second
+	defaultCacheMaxSize int           = 1000
+)
+
+// tenantCaches holds the entity caches of the tenants that have configured caching
+type tenantCaches map[string]*entityCache
+
+func newTenantCaches(cfg config.Config, metrics *cacheMetrics) tenantCaches {
+	caches := tenantCaches{}
+
+	for _, tenant := range cfg.Tenants {
+		if len(tenant.Cache) > 0 {
+			caches[tenant.ID] = newEntityCache(tenant.ID, tenant.Cache, metrics)
+		}
+	}
+
+	return caches
+}
+
+// tenant returns the cache of the tenant, or nil if the tenant does not cache anything.
+// All methods of the cache are safe to call on a nil cache.
+func (tc tenantCaches) tenant(tenant string) *entityCache {
+	return tc[tenant]
+}
+
+type cacheSettings struct {
+	ttl     time.Duration
+	maxSize int
+}
+
+// entityCache keeps retrieved entities, and the results of queries for them, of the entity
+// types that a tenant has configured caching for. Entries are keyed on the entity id, or the
+// query, along with the headers that affect the representation of the entities.
+//
+// An entry is dropped when it has been kept for longer than the TTL of its type, when it is
+// the least recently used entry of a type that has reached its max size, or when an entity
+// that it may contain is written to through the broker.
+type entityCache struct {
+	tenant   string
+	settings map[string]cacheSettings
+	metrics  *cacheMetrics
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	byID    map[string][]*cacheEntry
+	lru     map[string]*list.List // per entity type, most recently used first
+
+	// fills holds the reads that are in progress, so that a read that was started before a
+	// write to an entity that it may contain does not put the previous state in the cache
+	fills map[*cacheFill]struct{}
+}
+
+// cacheFill is a read whose result is to be added to the cache, unless it has become stale
+type cacheFill struct {
+	entityID   string // of reads of an entity
+	entityType string // of queries for entities of a type
+	stale      bool
+}
+
+type cacheEntry struct {
+	key        string
+	entityType string
+	entityID   string // empty for query results
+
+	// entities are kept in their serialized form, so that a reader that changes the entity it was
+	// handed does not change it for every other reader
+	entity storedEntity
+	query  *queryEntitiesSnapshot
+
+	expires time.Time
+	element *list.Element
+}
+
+func newEntityCache(tenant string, cfg []config.CacheConfig, metrics *cacheMetrics) *entityCache {
+	c := &entityCache{
+		tenant:   tenant,
+		settings: map[string]cacheSettings{},
+		metrics:  metrics,
+		now:      time.Now,
+		entries:  map[string]*cacheEntry{},
+		byID:     map[string][]*cacheEntry{},
+		lru:      map[string]*list.List{},
+		fills:    map[*cacheFill]struct{}{},
+	}
+
+	for _, cc := range cfg {
+		s := cacheSettings{ttl: cc.TTL, maxSize: cc.MaxSize}
+
+		if s.ttl <= 0 {
+			s.ttl = defaultCacheTTL
+		}
+
+		if s.maxSize <= 0 {
+			s.maxSize = defaultCacheMaxSize
+		}
+
+		c.settings[cc.Type] = s
+		c.lru[cc.Type] = list.New()
+	}
+
+	return c
+}
+
+// caches reports if entities of the type are cached
+func (c *entityCache) caches(entityType string) bool {
+	if c == nil {
+		return false
+	}
+
+	_, ok := c.settings[entityType]
+	return ok
+}
+
+// retrieveEntity returns the cached entity, or retrieves it and caches it if it is of a type
+// that should be cached
+func (c *entityCache) retrieveEntity(ctx context.Context, entityID string, headers map[string][]string, retrieve func() (types.Entity, error)) (types.Entity, error) {
+	if c == nil {
+		return retrieve()
+	}
+
+	key := readKey("entity", entityID, headers)
+
+	entry, fill, ok := c.lookup(key, &cacheFill{entityID: entityID})
+	if ok {
+		c.metrics.hit(ctx, c.tenant, entry.entityType, "entity")
+		return entry.entity.entity()
+	}
+	defer c.finish(fill)
+
+	entity, err := retrieve()
+	if err != nil || !c.caches(entity.Type()) {
+		return entity, err
+	}
+
+	// the type of an entity is not known until it has been retrieved, so only
+	// misses for entities of cached types are counted
+	c.metrics.miss(ctx, c.tenant, entity.Type(), "entity")
+
+	stored, err := storeEntity(entity, nil)
+	if err != nil {
+		return entity, nil
+	}
+
+	c.add(fill, &cacheEntry{
+		key:        key,
+		entityType: entity.Type(),
+		entityID:   entityID,
+		entity:     stored,
+	})
+
+	return entity, nil
+}
+
+// queryEntities returns the cached result of a query for entities of a single type, or
+// runs the query and caches its result
+func (c *entityCache) queryEntities(ctx context.Context, entityType string, entityAttributes []string, query string, headers map[string][]string, run func() (*ngsild.QueryEntitiesResult, error)) (*ngsild.QueryEntitiesResult, error) {
+	key := readKey("query", query+"\n"+strings.Join(entityAttributes, ","), headers)
+
+	entry, fill, ok := c.lookup(key, &cacheFill{entityType: entityType})
+	if ok {
+		c.metrics.hit(ctx, c.tenant, entityType, "query")
+		return entry.query.replay(), nil
+	}
+	defer c.finish(fill)
+
+	c.metrics.miss(ctx, c.tenant, entityType, "query")
+
+	snapshot, err := snapshotQueryEntitiesResult(run())
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(fill, &cacheEntry{
+		key:        key,
+		entityType: entityType,
+		query:      snapshot,
+	})
+
+	return snapshot.replay(), nil
+}
+
+// invalidate drops the cached representations of an entity, along with any cached query
+// results that may contain it, i.e. the results of queries for the types of the entity
+func (c *entityCache) invalidate(entityID string, entityTypes []string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range slices.Clone(c.byID[entityID]) {
+		entityTypes = append(entityTypes, entry.entityType)
+		c.remove(entry)
+	}
+
+	for fill := range c.fills {
+		if fill.entityID == entityID || (fill.entityType != "" && slices.Contains(entityTypes, fill.entityType)) {
+			fill.stale = true
+		}
+	}
+
+	for _, entityType := range entityTypes {
+		l, ok := c.lru[entityType]
+		if !ok {
+			continue
+		}
+
+		for elem := l.Front(); elem != nil; {
+			entry := elem.Value.(*cacheEntry)
+			elem = elem.Next()
+
+			if entry.entityID == "" {
+				c.remove(entry)
+			}
+		}
+	}
+}
+
+// lookup returns the entry with the key if it has not expired. If it has, the fill that any
+// entry that is added in its place should be based on is started, and has to be finished.
+func (c *entityCache) lookup(key string, fill *cacheFill) (*cacheEntry, *cacheFill, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && !c.now().Before(entry.expires) {
+		c.remove(entry)
+		ok = false
+	}
+
+	if !ok {
+		c.fills[fill] = struct{}{}
+		return nil, fill, false
+	}
+
+	c.lru[entry.entityType].MoveToFront(entry.element)
+
+	return entry, nil, true
+}
+
+func (c *entityCache) finish(fill *cacheFill) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.fills, fill)
+}
+
+// add puts the entry in the cache, unless an entity that it may contain has been written to
+// since the fill was started, evicting the least recently used entry of its type if needed
+func (c *entityCache) add(fill *cacheFill, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if fill.stale {
+		return
+	}
+
+	if existing, ok := c.entries[entry.key]; ok {
+		c.remove(existing)
+	}
+
+	settings := c.settings[entry.entityType]
+	l := c.lru[entry.entityType]
+
+	for l.Len() >= settings.maxSize {
+		c.remove(l.Back().Value.(*cacheEntry))
+	}
+
+	entry.expires = c.now().Add(settings.ttl)
+	entry.element = l.PushFront(entry)
+	c.entries[entry.key] = entry
+
+	if entry.entityID != "" {
+		c.byID[entry.entityID] = append(c.byID[entry.entityID], entry)
+	}
+}
+
+func (c *entityCache) remove(entry *cacheEntry) {
+	delete(c.entries, entry.key)
+	c.lru[entry.entityType].Remove(entry.element)
+
+	if entry.entityID == "" {
+		return
+	}
+
+	others := c.byID[entry.entityID]
+	for idx, other := range others {
+		if other == entry {
+			others = append(others[:idx], others[idx+1:]...)
+			break
+		}
+	}
+
+	if len(others) == 0 {
+		delete(c.byID, entry.entityID)
+	} else {
+		c.byID[entry.entityID] = others
+	}
+}
+
+var cacheMeter = otel.Meter("context-broker/cache")
+
+type cacheMetrics struct {
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+}
+
+func newCacheMetrics() *cacheMetrics {
+	m := &cacheMetrics{}
+
+	m.hits, _ = cacheMeter.Int64Counter(
+		"context_broker.cache.hits",
+		metric.WithDescription("number of entities and query results that were served from the cache"),
+	)
+
+	m.misses, _ = cacheMeter.Int64Counter(
+		"context_broker.cache.misses",
+		metric.WithDescription("number of entities and query results of cached types that had to be fetched from context sources"),
+	)
+
+	return m
+}
+
+func (m *cacheMetrics) hit(ctx context.Context, tenant, entityType, kind string) {
+	if m != nil {
+		recordCacheAccess(ctx, m.hits, tenant, entityType, kind)
+	}
+}
+
+func (m *cacheMetrics) miss(ctx context.Context, tenant, entityType, kind string) {
+	if m != nil {
+		recordCacheAccess(ctx, m.misses, tenant, entityType, kind)
+	}
+}
+
+func recordCacheAccess(ctx context.Context, counter metric.Int64Counter, tenant, entityType, kind string) {
+	if counter == nil {
+		return
+	}
+
+	counter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("tenant", tenant),
+		attribute.String("type", entityType),
+		attribute.String("kind", kind),
+	))
+}
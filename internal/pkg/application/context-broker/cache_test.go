@@ -0,0 +1,178 @@
+package contextbroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/matryer/is"
+)
+
+func TestThatCachedEntitiesExpire(t *testing.T) {
+	is := is.New(t)
+	cache, clock := testCache(config.CacheConfig{Type: "Beach", TTL: time.Minute})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.Equal(*retrievals, 1) // should have served the second request from the cache
+
+	*clock = clock.Add(2 * time.Minute)
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.Equal(*retrievals, 2) // should have retrieved the entity again once it expired
+}
+
+func TestThatCacheKeysIncludeRepresentationHeaders(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", map[string][]string{"Accept": {"application/ld+json"}}, retrieve)
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", map[string][]string{"Accept": {"application/json"}}, retrieve)
+
+	is.Equal(*retrievals, 2) // should cache each representation separately
+}
+
+func TestThatOnlyConfiguredTypesAreCached(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"})
+	retrieve, retrievals := countingRetriever("ExerciseTrail")
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:ExerciseTrail:01", nil, retrieve)
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:ExerciseTrail:01", nil, retrieve)
+
+	is.Equal(*retrievals, 2)
+}
+
+func TestThatLeastRecentlyUsedEntitiesAreEvicted(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach", MaxSize: 2})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	for _, id := range []string{"01", "02", "01", "03", "01", "02"} {
+		cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:"+id, nil, retrieve)
+	}
+
+	is.Equal(*retrievals, 4) // 02 should have been evicted when 03 was added
+	is.Equal(cache.lru["Beach"].Len(), 2)
+}
+
+func TestThatInvalidateDropsEntityAndQueryResultsOfItsType(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	queries := 0
+	query := func() (*ngsild.QueryEntitiesResult, error) {
+		queries++
+		return mergeQueryEntitiesResults([]*sourceQueryResult{{entities: []types.Entity{testEntity("Beach", "urn:ngsi-ld:Beach:01")}}}, 0, 20)
+	}
+
+	ctx := context.Background()
+
+	cache.retrieveEntity(ctx, "urn:ngsi-ld:Beach:01", nil, retrieve)
+	result, err := cache.queryEntities(ctx, "Beach", nil, "/ngsi-ld/v1/entities?type=Beach", nil, query)
+	is.NoErr(err)
+	is.Equal(collectQueryEntitiesResult(result, nil).entities[0].ID(), "urn:ngsi-ld:Beach:01")
+
+	result, _ = cache.queryEntities(ctx, "Beach", nil, "/ngsi-ld/v1/entities?type=Beach", nil, query)
+	is.Equal(len(collectQueryEntitiesResult(result, nil).entities), 1) // should replay the cached result
+	is.Equal(queries, 1)
+
+	cache.invalidate("urn:ngsi-ld:Beach:01", nil)
+
+	cache.retrieveEntity(ctx, "urn:ngsi-ld:Beach:01", nil, retrieve)
+	cache.queryEntities(ctx, "Beach", nil, "/ngsi-ld/v1/entities?type=Beach", nil, query)
+
+	is.Equal(*retrievals, 2)
+	is.Equal(queries, 2)
+}
+
+func TestThatEntitiesRetrievedBeforeAnInvalidationAreNotCached(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, func() (types.Entity, error) {
+		// the entity is updated while the previous state is on its way back
+		cache.invalidate("urn:ngsi-ld:Beach:01", nil)
+		return retrieve()
+	})
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.Equal(*retrievals, 2) // should not have cached the previous state
+}
+
+func TestThatWritesToOtherEntitiesDoNotKeepReadsFromBeingCached(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"}, config.CacheConfig{Type: "Lifebuoy"})
+	retrieve, retrievals := countingRetriever("Beach")
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, func() (types.Entity, error) {
+		// another entity, of another type, is updated while the entity is on its way back
+		cache.invalidate("urn:ngsi-ld:Lifebuoy:01", []string{"Lifebuoy"})
+		return retrieve()
+	})
+
+	cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.Equal(*retrievals, 1) // should have cached the entity
+
+	queries := 0
+	run := func() (*ngsild.QueryEntitiesResult, error) {
+		queries++
+		return mergeQueryEntitiesResults([]*sourceQueryResult{{entities: []types.Entity{testEntity("Beach", "urn:ngsi-ld:Beach:01")}}}, 0, 20)
+	}
+
+	cache.queryEntities(context.Background(), "Beach", nil, "type=Beach", nil, func() (*ngsild.QueryEntitiesResult, error) {
+		cache.invalidate("urn:ngsi-ld:Lifebuoy:01", []string{"Lifebuoy"})
+		return run()
+	})
+	cache.queryEntities(context.Background(), "Beach", nil, "type=Beach", nil, run)
+	is.Equal(queries, 1) // should have cached the result of the query
+
+	cache.queryEntities(context.Background(), "Lifebuoy", nil, "type=Lifebuoy", nil, func() (*ngsild.QueryEntitiesResult, error) {
+		cache.invalidate("urn:ngsi-ld:Lifebuoy:01", []string{"Lifebuoy"})
+		return run()
+	})
+	cache.queryEntities(context.Background(), "Lifebuoy", nil, "type=Lifebuoy", nil, run)
+	is.Equal(queries, 3) // should not have cached a query for the type that was written to
+}
+
+func TestThatEachReaderGetsACopyOfItsOwn(t *testing.T) {
+	is := is.New(t)
+	cache, _ := testCache(config.CacheConfig{Type: "Beach"})
+	retrieve, _ := countingRetriever("Beach")
+
+	first, err := cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.NoErr(err)
+	second, err := cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.NoErr(err)
+	third, err := cache.retrieveEntity(context.Background(), "urn:ngsi-ld:Beach:01", nil, retrieve)
+	is.NoErr(err)
+
+	is.Equal(second.ID(), first.ID())
+	is.True(second != first)
+	is.True(third != second) // should not hand the same cached entity to several readers
+}
+
+func testCache(cfg ...config.CacheConfig) (*entityCache, *time.Time) {
+	clock := time.Now()
+
+	cache := newEntityCache("default", cfg, nil)
+	cache.now = func() time.Time { return clock }
+
+	return cache, &clock
+}
+
+func countingRetriever(entityType string) (func() (types.Entity, error), *int) {
+	retrievals := 0
+
+	return func() (types.Entity, error) {
+		retrievals++
+		return testEntity(entityType, "urn:ngsi-ld:"+entityType+":01"), nil
+	}, &retrievals
+}
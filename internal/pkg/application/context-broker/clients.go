@@ -0,0 +1,169 @@
+package contextbroker
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+)
+
+const (
+	defaultMaxIdleConns          int           = 100
+	defaultMaxIdleConnsPerHost   int           = 32
+	defaultIdleConnTimeout       time.Duration = 90 * time.Second
+	defaultKeepAlive             time.Duration = 30 * time.Second
+	defaultDialTimeout           time.Duration = 5 * time.Second
+	defaultResponseHeaderTimeout time.Duration = 30 * time.Second
+)
+
+// clientPool holds one long-lived client per context source endpoint, so that connections
+// to a context source are kept alive and reused across requests. Clients are keyed by the
+// endpoint along with the downstream tenant and the settings they were created with, so that
+// a reloaded configuration with changed settings results in a new client.
+type clientPool struct {
+	mu      sync.Mutex
+	clients map[clientKey]*pooledClient
+
+	breakers    *breakerRegistry
+	debugClient string
+}
+
+type clientKey struct {
+	endpoint       string
+	tenant         string
+	circuitBreaker config.CircuitBreakerConfig
+	retry          config.RetryConfig
+	http           config.HTTPConfig
+	auth           config.AuthConfig
+}
+
+type pooledClient struct {
+	client    client.ContextBrokerClient
+	breaker   *circuitBreaker
+	transport *http.Transport
+}
+
+func newClientPool(breakers *breakerRegistry, debugClient string) *clientPool {
+	return &clientPool{
+		clients:     map[clientKey]*pooledClient{},
+		breakers:    breakers,
+		debugClient: debugClient,
+	}
+}
+
+func keyFor(src *contextSource, endpoint string) clientKey {
+	return clientKey{
+		endpoint:       endpoint,
+		tenant:         src.DownstreamTenant(),
+		circuitBreaker: src.CircuitBreaker,
+		retry:          src.Retry,
+		http:           src.HTTP,
+		auth:           src.Auth,
+	}
+}
+
+// get returns the client of an endpoint, creating it using the configuration of the
+// context source if it does not exist yet
+func (p *clientPool) get(src *contextSource, endpoint string) client.ContextBrokerClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := keyFor(src, endpoint)
+
+	pc, ok := p.clients[key]
+	if !ok {
+		pc = &pooledClient{transport: newTransport(src.HTTP)}
+
+		// the auth configuration has already been validated when the routes were built, but
+		// secrets may have been removed since then and should not be silently left out
+		credentials, err := newCredentials(src.Auth)
+		if err == nil {
+			pc.transport.TLSClientConfig, err = newTLSConfig(src.Auth.TLS)
+		}
+		if err != nil {
+			credentials = failingCredentials{err: err}
+		}
+
+		pc.breaker = p.breakers.add(endpoint, src.CircuitBreaker, pc.transport)
+		pc.client = client.NewContextBrokerClient(
+			endpoint,
+			client.Debug(p.debugClient),
+			client.Tenant(src.DownstreamTenant()),
+			client.Transport(pc.breaker),
+			client.Retry(retryPolicy(src.Retry)),
+			client.Timeout(src.HTTP.RequestTimeout),
+			client.Credentials(credentials),
+		)
+
+		p.clients[key] = pc
+	}
+
+	return pc.client
+}
+
+// retain drops the clients of any endpoints, or settings, that are no longer used by
+// the routing table, closing their idle connections
+func (p *clientPool) retain(routes routingTable) {
+	inUse := map[clientKey]bool{}
+
+	for _, tr := range routes {
+		for _, src := range tr.sources {
+			inUse[keyFor(src, src.Endpoint)] = true
+			if src.Temporal.Enabled {
+				inUse[keyFor(src, src.TemporalEndpoint())] = true
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pc := range p.clients {
+		if !inUse[key] {
+			delete(p.clients, key)
+			p.breakers.remove(pc.breaker)
+			pc.transport.CloseIdleConnections()
+		}
+	}
+}
+
+func newTransport(cfg config.HTTPConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   valueOrDefault(cfg.DialTimeout, defaultDialTimeout),
+		KeepAlive: valueOrDefault(cfg.KeepAlive, defaultKeepAlive),
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConns = valueOrDefault(cfg.MaxIdleConns, defaultMaxIdleConns)
+	transport.MaxIdleConnsPerHost = valueOrDefault(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	transport.IdleConnTimeout = valueOrDefault(cfg.IdleConnTimeout, defaultIdleConnTimeout)
+	transport.ResponseHeaderTimeout = valueOrDefault(cfg.ResponseHeaderTimeout, defaultResponseHeaderTimeout)
+
+	return transport
+}
+
+func valueOrDefault[T int | time.Duration](value, defaultValue T) T {
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+func retryPolicy(cfg config.RetryConfig) client.RetryPolicy {
+	methods := []string{http.MethodGet, http.MethodDelete}
+	if cfg.RetryPatch {
+		methods = append(methods, http.MethodPatch)
+	}
+
+	return client.RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Methods:        methods,
+	}
+}
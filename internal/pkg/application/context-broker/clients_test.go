@@ -0,0 +1,38 @@
+package contextbroker
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/matryer/is"
+)
+
+func TestThatClientsAreReusedPerEndpoint(t *testing.T) {
+	is := is.New(t)
+
+	pool := newClientPool(newBreakerRegistry(slog.New(slog.DiscardHandler)), "false")
+	src := &contextSource{ContextSourceConfig: config.ContextSourceConfig{
+		Endpoint: "http://source",
+		Temporal: config.TemporalInfo{Enabled: true, Endpoint: "http://temporal"},
+	}}
+
+	first := pool.get(src, src.Endpoint)
+	is.True(first == pool.get(src, src.Endpoint))           // should reuse the client of an endpoint
+	is.True(first != pool.get(src, src.TemporalEndpoint())) // should not share clients between endpoints
+}
+
+func TestThatTransportIsConfiguredFromHTTPConfig(t *testing.T) {
+	is := is.New(t)
+
+	transport := newTransport(config.HTTPConfig{
+		MaxIdleConnsPerHost:   8,
+		ResponseHeaderTimeout: 2 * time.Second,
+	})
+
+	is.Equal(transport.MaxIdleConnsPerHost, 8)
+	is.Equal(transport.ResponseHeaderTimeout, 2*time.Second)
+	is.Equal(transport.MaxIdleConns, defaultMaxIdleConns)
+	is.Equal(transport.IdleConnTimeout, defaultIdleConnTimeout)
+}
@@ -0,0 +1,358 @@
+package contextbroker
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"golang.org/x/sync/singleflight"
+)
+
+// readGroup coalesces identical reads that are in flight at the same time, so that they
+// share a single round of requests to the context sources. Reads are identical if they are
+// made for the same tenant, with the same normalized query and the same propagated headers.
+//
+// The shared read is not cancelled if the caller that started it gives up, as others may
+// still be waiting for it. Each caller stops waiting as soon as its own context is done.
+type readGroup struct {
+	group singleflight.Group
+}
+
+func coalesce[T any](ctx context.Context, g *singleflight.Group, key string, read func(context.Context) (T, error)) (T, error) {
+	ch := g.DoChan(key, func() (any, error) {
+		return read(context.WithoutCancel(ctx))
+	})
+
+	var zero T
+
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return zero, r.Err
+		}
+		return r.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// queryEntities runs the query, or waits for an identical query that is already running,
+// and hands each caller a result with a channel of its own
+func (rg *readGroup) queryEntities(ctx context.Context, key string, run func(context.Context) (*ngsild.QueryEntitiesResult, error)) (*ngsild.QueryEntitiesResult, error) {
+	snapshot, err := coalesce(ctx, &rg.group, key, func(ctx context.Context) (*queryEntitiesSnapshot, error) {
+		return snapshotQueryEntitiesResult(run(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.replay(), nil
+}
+
+func (rg *readGroup) retrieveEntity(ctx context.Context, key string, retrieve func(context.Context) (types.Entity, error)) (types.Entity, error) {
+	stored, err := coalesce(ctx, &rg.group, key, func(ctx context.Context) (storedEntity, error) {
+		return storeEntity(retrieve(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stored.entity()
+}
+
+func (rg *readGroup) queryTemporalEvolutionOfEntities(ctx context.Context, key string, run func(context.Context) (*ngsild.QueryTemporalEntitiesResult, error)) (*ngsild.QueryTemporalEntitiesResult, error) {
+	snapshot, err := coalesce(ctx, &rg.group, key, func(ctx context.Context) (*temporalEntitiesSnapshot, error) {
+		return snapshotQueryTemporalEntitiesResult(run(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.replay(), nil
+}
+
+func (rg *readGroup) retrieveTemporalEvolutionOfEntity(ctx context.Context, key string, retrieve func(context.Context) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error)) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+	snapshot, err := coalesce(ctx, &rg.group, key, func(ctx context.Context) (*temporalEntitySnapshot, error) {
+		return snapshotRetrieveTemporalEvolutionOfEntityResult(retrieve(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.replay()
+}
+
+// readKey identifies a read by what is read, along with the headers that decide how the
+// entities are represented
+func readKey(kind, subject string, headers map[string][]string) string {
+	return strings.Join([]string{
+		kind,
+		subject,
+		strings.Join(headers["Accept"], ","),
+		strings.Join(headers["Link"], ","),
+	}, "\n")
+}
+
+// normalizedQuery orders the query parameters so that queries that only differ in the
+// order of their parameters are considered identical
+func normalizedQuery(query string) string {
+	path, rawQuery, _ := strings.Cut(query, "?")
+
+	queryValues, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return query
+	}
+
+	return path + "?" + queryValues.Encode()
+}
+
+// temporalQuery describes a temporal query in the same normalized form as other queries
+func temporalQuery(entityIDs, entityTypes []string, params cim.TemporalQueryParams) string {
+	queryValues := url.Values{}
+
+	if ids, ok := params.IDs(); ok {
+		entityIDs = slices.Concat(entityIDs, ids)
+	}
+
+	if types, ok := params.Types(); ok {
+		entityTypes = slices.Concat(entityTypes, types)
+	}
+
+	if len(entityIDs) > 0 {
+		queryValues.Set("id", strings.Join(entityIDs, ","))
+	}
+
+	if len(entityTypes) > 0 {
+		queryValues.Set("type", strings.Join(entityTypes, ","))
+	}
+
+	if attrs, ok := params.Attributes(); ok {
+		queryValues.Set("attrs", strings.Join(attrs, ","))
+	}
+
+	if timerel, ok := params.TemporalRelation(); ok {
+		queryValues.Set("timerel", timerel)
+	}
+
+	if timeAt, ok := params.TimeAt(); ok {
+		queryValues.Set("timeAt", timeAt.Format(time.RFC3339Nano))
+	}
+
+	if endTimeAt, ok := params.EndTimeAt(); ok {
+		queryValues.Set("endTimeAt", endTimeAt.Format(time.RFC3339Nano))
+	}
+
+	if lastN, ok := params.LastN(); ok {
+		queryValues.Set("lastN", strconv.FormatUint(lastN, 10))
+	}
+
+	return queryValues.Encode()
+}
+
+// storedEntity is the serialized form of an entity that is shared between several readers, so
+// that each of them can be handed a copy of its own that it is free to change
+type storedEntity []byte
+
+func storeEntity(e types.Entity, err error) (storedEntity, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(e)
+}
+
+func (s storedEntity) entity() (types.Entity, error) {
+	return entities.NewFromJSON(s)
+}
+
+// queryEntitiesSnapshot is a query result that has been read in its entirety, so that it
+// can be replayed to any number of consumers
+type queryEntitiesSnapshot struct {
+	entities []storedEntity
+	counts   ngsild.QueryEntitiesResult // the counts of the result, without its channel
+}
+
+func snapshotQueryEntitiesResult(result *ngsild.QueryEntitiesResult, err error) (*queryEntitiesSnapshot, error) {
+	sqr := collectQueryEntitiesResult(result, err)
+	if sqr.err != nil {
+		return nil, sqr.err
+	}
+
+	stored := make([]storedEntity, 0, len(sqr.entities))
+	for _, e := range sqr.entities {
+		se, err := storeEntity(e, nil)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, se)
+	}
+
+	return &queryEntitiesSnapshot{
+		entities: stored,
+		counts: ngsild.QueryEntitiesResult{
+			TotalCount:    result.TotalCount,
+			Count:         result.Count,
+			Offset:        result.Offset,
+			Limit:         result.Limit,
+			PartialResult: result.PartialResult,
+		},
+	}, nil
+}
+
+// replay returns the result on a channel of its own
+func (s *queryEntitiesSnapshot) replay() *ngsild.QueryEntitiesResult {
+	qer := ngsild.NewQueryEntitiesResult()
+	qer.TotalCount = s.counts.TotalCount
+	qer.Count = s.counts.Count
+	qer.Offset = s.counts.Offset
+	qer.Limit = s.counts.Limit
+	qer.PartialResult = s.counts.PartialResult
+
+	go func() {
+		for _, se := range s.entities {
+			// the entities were serialized from valid entities, so they can not fail to decode
+			if e, err := se.entity(); err == nil {
+				qer.Found <- e
+			}
+		}
+		qer.Found <- nil
+	}()
+
+	return qer
+}
+
+// storedTemporalEntity is the serialized form of the temporal evolution of an entity, so that
+// every reader can be handed a copy of its own
+type storedTemporalEntity []byte
+
+func storeTemporalEntity(e types.EntityTemporal) (storedTemporalEntity, error) {
+	return json.Marshal(e)
+}
+
+func (s storedTemporalEntity) entity() (types.EntityTemporal, error) {
+	return entities.NewTemporalFromJSON(s)
+}
+
+type temporalEntitiesSnapshot struct {
+	entities   []storedTemporalEntity
+	totalCount int64
+}
+
+func snapshotQueryTemporalEntitiesResult(result *ngsild.QueryTemporalEntitiesResult, err error) (*temporalEntitiesSnapshot, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	s := &temporalEntitiesSnapshot{
+		entities:   []storedTemporalEntity{},
+		totalCount: result.TotalCount,
+	}
+
+	for e := range result.Found {
+		if e == nil {
+			break
+		}
+
+		stored, err := storeTemporalEntity(e)
+		if err != nil {
+			// drain the rest of the result, so that its producer is not left blocked
+			for e := range result.Found {
+				if e == nil {
+					break
+				}
+			}
+			return nil, err
+		}
+
+		s.entities = append(s.entities, stored)
+	}
+
+	return s, nil
+}
+
+// replay returns the result on a channel of its own
+func (s *temporalEntitiesSnapshot) replay() *ngsild.QueryTemporalEntitiesResult {
+	qer := ngsild.NewQueryTemporalEntitiesResult()
+	qer.TotalCount = s.totalCount
+
+	go func() {
+		for _, se := range s.entities {
+			// the entities were serialized from valid entities, so they can not fail to decode
+			if e, err := se.entity(); err == nil {
+				qer.Found <- e
+			}
+		}
+		qer.Found <- nil
+	}()
+
+	return qer
+}
+
+// temporalEntitySnapshot is the temporal evolution of a single entity, that is replayed as
+// a copy of its own to each reader
+type temporalEntitySnapshot struct {
+	entity        storedTemporalEntity
+	contentRange  *ngsild.ContentRange
+	partialResult bool
+}
+
+func snapshotRetrieveTemporalEvolutionOfEntityResult(result *ngsild.RetrieveTemporalEvolutionOfEntityResult, err error) (*temporalEntitySnapshot, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	s := &temporalEntitySnapshot{partialResult: result.PartialResult}
+
+	if result.Found != nil {
+		s.entity, err = storeTemporalEntity(result.Found)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.contentRange = copyContentRange(result.ContentRange)
+
+	return s, nil
+}
+
+func (s *temporalEntitySnapshot) replay() (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+	result := &ngsild.RetrieveTemporalEvolutionOfEntityResult{PartialResult: s.partialResult}
+
+	if s.entity != nil {
+		e, err := s.entity.entity()
+		if err != nil {
+			return nil, err
+		}
+		result.Found = e
+	}
+
+	result.ContentRange = copyContentRange(s.contentRange)
+
+	return result, nil
+}
+
+func copyContentRange(cr *ngsild.ContentRange) *ngsild.ContentRange {
+	if cr == nil {
+		return nil
+	}
+
+	copied := &ngsild.ContentRange{}
+	if cr.StartTime != nil {
+		startTime := *cr.StartTime
+		copied.StartTime = &startTime
+	}
+	if cr.EndTime != nil {
+		endTime := *cr.EndTime
+		copied.EndTime = &endTime
+	}
+
+	return copied
+}
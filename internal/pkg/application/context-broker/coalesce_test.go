@@ -0,0 +1,174 @@
+package contextbroker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/matryer/is"
+)
+
+func TestThatConcurrentIdenticalQueriesShareASingleRequest(t *testing.T) {
+	is := is.New(t)
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/ld+json")
+		w.Write([]byte(`[` + deviceJSON("01") + `,` + deviceJSON("02") + `]`))
+	}))
+	defer source.Close()
+
+	broker, err := New(context.Background(), withDefaultTestConfig(source.URL, ""))
+	is.NoErr(err)
+
+	const waiters = 5
+	found := make([]int, waiters)
+
+	var wg sync.WaitGroup
+
+	for idx := range waiters {
+		// the same query with the parameters in a different order
+		query := "/ngsi-ld/v1/entities?type=Device&limit=10"
+		if idx%2 == 1 {
+			query = "/ngsi-ld/v1/entities?limit=10&type=Device"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := broker.QueryEntities(context.Background(), "testtenant", []string{"Device"}, nil, query, nil)
+			if err == nil {
+				found[idx] = countFound(result)
+			}
+		}()
+	}
+
+	// give all of the queries a chance to join the one that is in flight
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	is.Equal(requests.Load(), int32(1)) // should only have sent a single request to the context source
+
+	for _, n := range found {
+		is.Equal(n, 2) // each waiter should get every entity of the result
+	}
+}
+
+func TestThatAWaiterThatGivesUpDoesNotCancelTheSharedRead(t *testing.T) {
+	is := is.New(t)
+
+	rg := &readGroup{}
+	release := make(chan struct{})
+
+	read := func(ctx context.Context) (string, error) {
+		<-release
+		return "done", ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	var first, second string
+	var firstErr, secondErr error
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		first, firstErr = coalesce(ctx, &rg.group, "key", read)
+	}()
+	go func() {
+		defer wg.Done()
+		second, secondErr = coalesce(context.Background(), &rg.group, "key", read)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	is.Equal(firstErr, context.Canceled) // the caller that gave up should stop waiting
+	is.Equal(first, "")
+	is.NoErr(secondErr) // the other caller should still get the result
+	is.Equal(second, "done")
+}
+
+func TestThatEachWaiterGetsATemporalResultOfItsOwn(t *testing.T) {
+	is := is.New(t)
+
+	rg := &readGroup{}
+	release := make(chan struct{})
+
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	retrieve := func(ctx context.Context) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+		<-release
+
+		e, err := entities.NewTemporalFromJSON([]byte(`{
+			"id": "urn:ngsi-ld:Device:01", "type": "Device", "@context": ["https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"],
+			"temperature": [
+				{"type": "Property", "value": 1.0, "observedAt": "2024-01-01T00:00:00Z"},
+				{"type": "Property", "value": 2.0, "observedAt": "2024-01-01T01:00:00Z"}
+			]
+		}`))
+		if err != nil {
+			return nil, err
+		}
+
+		result := ngsild.NewRetrieveTemporalEvolutionOfEntityResult(e)
+		result.ContentRange = &ngsild.ContentRange{StartTime: &startTime}
+
+		return result, nil
+	}
+
+	results := make([]*ngsild.RetrieveTemporalEvolutionOfEntityResult, 2)
+
+	var wg sync.WaitGroup
+	for idx := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[idx], _ = rg.retrieveTemporalEvolutionOfEntity(context.Background(), "key", retrieve)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	is.True(results[0] != nil && results[1] != nil)
+
+	// one of the waiters changes its result
+	temperatures := results[0].Found.Property("temperature")
+	temperatures[0] = temperatures[1]
+	*results[0].ContentRange.StartTime = startTime.Add(time.Hour)
+
+	is.Equal(results[1].Found.Property("temperature")[0].Value(), 1.0) // should not be changed by the other waiter
+	is.Equal(*results[1].ContentRange.StartTime, startTime)            // should not be changed by the other waiter
+}
+
+func countFound(result *ngsild.QueryEntitiesResult) int {
+	n := 0
+
+	for e := range result.Found {
+		if e == nil {
+			break
+		}
+		n++
+	}
+
+	return n
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"regexp"
+	"net/url"
+	"path/filepath"
 	"slices"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/diwise/context-broker/internal/pkg/application/cim"
 	"github.com/diwise/context-broker/internal/pkg/application/config"
+	regstore "github.com/diwise/context-broker/internal/pkg/application/registrations"
 	"github.com/diwise/context-broker/internal/pkg/application/subscriptions"
 	"github.com/diwise/context-broker/pkg/ngsild"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
@@ -20,470 +24,1048 @@ import (
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
 	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 )
 
 type contextBrokerApp struct {
-	tenants     map[string][]config.ContextSourceConfig
-	notifier    subscriptions.Notifier
-	debugClient string
+	cfg           config.Config
+	registrations regstore.Store
+	subscriptions subscriptions.Store
+
+	// mu serializes changes to the registrations and the rebuilds of the routing table
+	// that follow them, while requests keep reading whatever table was last stored
+	mu     sync.Mutex
+	routes atomic.Pointer[routingTable]
+
+	clients  *clientPool
+	breakers *breakerRegistry
+	notifier subscriptions.Notifier
+
+	caches       atomic.Pointer[tenantCaches]
+	cacheMetrics *cacheMetrics
+
+	reads readGroup
+
+	// batchUnsupported holds the endpoints of context sources that have responded that they
+	// do not support batch operations, along with the time that they did
+	batchUnsupported sync.Map
 }
 
 func New(ctx context.Context, cfg config.Config) (cim.ContextInformationManager, error) {
 
-	notifier, _ := subscriptions.NewNotifier(ctx, cfg)
+	registrationsFile, subscriptionsFile, deadLettersFile, outboxFile, spillDir := "", "", "", "", ""
+	if cfg.Storage.Path != "" {
+		registrationsFile = filepath.Join(cfg.Storage.Path, "registrations.json")
+		subscriptionsFile = filepath.Join(cfg.Storage.Path, "subscriptions.json")
+		deadLettersFile = filepath.Join(cfg.Storage.Path, "deadletters.json")
+		outboxFile = filepath.Join(cfg.Storage.Path, "outbox.jsonl")
+		spillDir = filepath.Join(cfg.Storage.Path, "spill")
+	}
+
+	store, err := regstore.NewStore(registrationsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := newRoutingTable(cfg, store.All())
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionStore, err := subscriptions.NewStore(subscriptionsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters, err := subscriptions.NewDeadLetterStore(deadLettersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	outbox, err := subscriptions.NewOutbox(outboxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	breakers := newBreakerRegistry(logging.GetFromContext(ctx))
+	debugClient := env.GetVariableOrDefault(ctx, "CONTEXT_BROKER_CLIENT_DEBUG", "false")
 
 	app := &contextBrokerApp{
-		tenants:     make(map[string][]config.ContextSourceConfig),
-		notifier:    notifier,
-		debugClient: env.GetVariableOrDefault(ctx, "CONTEXT_BROKER_CLIENT_DEBUG", "false"),
+		cfg:           cfg,
+		registrations: store,
+		subscriptions: subscriptionStore,
+		clients:       newClientPool(breakers, debugClient),
+		breakers:      breakers,
+		cacheMetrics:  newCacheMetrics(),
 	}
 
-	for _, tenant := range cfg.Tenants {
-		app.tenants[tenant.ID] = tenant.ContextSources
+	app.storeRoutes(routes)
+
+	app.notifier, err = subscriptions.NewNotifier(ctx, cfg, subscriptionStore,
+		subscriptions.Durable(outbox),
+		subscriptions.DeadLetters(deadLetters),
+		subscriptions.Resolver(app.resolveEntity),
+		subscriptions.Spill(spillDir),
+	)
+	if err != nil {
+		return nil, err
 	}
 
 	return app, nil
 }
 
+// Validate reports whether the tenants and context sources in cfg can be routed to, along with
+// the context sources that have been registered at runtime
+func (app *contextBrokerApp) Validate(ctx context.Context, cfg config.Config) error {
+	_, err := newRoutingTable(cfg, app.registrations.All())
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return nil
+}
+
+// Reload replaces the tenants and context sources of the broker with the ones in cfg. The
+// configuration is validated before anything is replaced, so that the broker keeps running
+// with its current configuration if the new one is invalid. Requests that are already in
+// flight complete using the routes they started out with.
+//
+// Notification endpoints are only read on startup and are not affected by a reload.
+func (app *contextBrokerApp) Reload(ctx context.Context, cfg config.Config) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	routes, err := newRoutingTable(cfg, app.registrations.All())
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	app.cfg = cfg
+	app.storeRoutes(routes)
+
+	return nil
+}
+
+// storeRoutes replaces the routing table and lets go of clients that are no longer needed.
+// The caches are replaced as well, since a changed route may change what entities look like,
+// and context sources get another chance to show that they support batch operations.
+func (app *contextBrokerApp) storeRoutes(routes routingTable) {
+	caches := newTenantCaches(app.cfg, app.cacheMetrics)
+
+	app.routes.Store(&routes)
+	app.caches.Store(&caches)
+	app.clients.retain(routes)
+	app.batchUnsupported.Clear()
+}
+
+// cache returns the entity cache of the tenant, or nil if the tenant does not cache anything
+func (app *contextBrokerApp) cache(tenant string) *entityCache {
+	return app.caches.Load().tenant(tenant)
+}
+
+// invalidateCache drops any cached copies of the entity, and cached query results that may include it
+func (app *contextBrokerApp) invalidateCache(routes *tenantRoutes, tenant, entityID string, entityTypes ...string) {
+	cache := app.cache(tenant)
+	if cache == nil {
+		return
+	}
+
+	for _, reg := range routes.registrationsForID(entityID) {
+		entityTypes = append(entityTypes, reg.entityType)
+	}
+
+	cache.invalidate(entityID, entityTypes)
+}
+
+// client returns the long-lived client of the context source
+func (app *contextBrokerApp) client(src *contextSource) client.ContextBrokerClient {
+	return app.clients.get(src, src.Endpoint)
+}
+
+// temporalClient returns the client of the temporal endpoint of the context source, which has its own connection pool and circuit breaker
+func (app *contextBrokerApp) temporalClient(src *contextSource) client.ContextBrokerClient {
+	return app.clients.get(src, src.TemporalEndpoint())
+}
+
 func (app *contextBrokerApp) CreateEntity(ctx context.Context, tenant string, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
 	}
 
 	entityID := entity.ID()
 	entityType := entity.Type()
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
-				if entityInfo.Type != entityType {
-					continue
-				}
+	defer app.invalidateCache(routes, tenant, entityID, entityType)
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+	src, ok := routes.sourceForNewEntity(entityID, entityType)
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could create type %s with id %s", entityType, entityID))
+	}
 
-				if !regexpForID.MatchString(entityID) {
-					continue
-				}
+	change, err := app.entityCreated(ctx, tenant, entity)
+	if err != nil {
+		return nil, err
+	}
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
-				result, err := cbClient.CreateEntity(ctx, entity, headers)
-				if err != nil {
-					return nil, err
-				}
+	cbClient := app.client(src)
+	result, err := cbClient.CreateEntity(ctx, entity, headers)
+	if err != nil {
+		change.Discard()
+		return nil, err
+	}
 
-				if app.notifier != nil {
-					app.notifier.EntityCreated(ctx, entity, tenant)
-				}
+	change.Commit()
 
-				return result, nil
-			}
-		}
+	return result, nil
+}
+
+// entityCreated writes an event about a new entity to the outbox of the notifier before the
+// entity is created, so that the subscribers are notified even if the broker stops right after
+func (app *contextBrokerApp) entityCreated(ctx context.Context, tenant string, entity types.Entity) (subscriptions.Change, error) {
+	if app.notifier == nil {
+		return subscriptions.NoChange, nil
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could create type %s with id %s", entityType, entityID))
+	return app.notifier.EntityCreated(ctx, entity, tenant)
 }
 
-func notInSlice(find string, slice []string) bool {
-	return !slices.Contains(slice, find)
+// entityUpdated writes an event about an update of an entity to the outbox of the notifier before
+// the entity is updated
+func (app *contextBrokerApp) entityUpdated(ctx context.Context, tenant, entityID string, attributeNames []string) (subscriptions.Change, error) {
+	if app.notifier == nil {
+		return subscriptions.NoChange, nil
+	}
+
+	return app.notifier.EntityUpdated(ctx, tenant, entityID, attributeNames)
+}
+
+// settle commits the change to an entity whose attributes are spread over several context
+// sources if any of them were written to, and discards it otherwise
+func settle(change subscriptions.Change, written int) {
+	if written > 0 {
+		change.Commit()
+		return
+	}
+
+	change.Discard()
 }
 
 func (app *contextBrokerApp) QueryEntities(ctx context.Context, tenant string, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
-				if notInSlice(entityInfo.Type, entityTypes) {
-					continue
-				}
+	_, rawQuery, _ := strings.Cut(query, "?")
+	queryValues, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, errors.NewBadRequestDataError("invalid query parameter")
+	}
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
-				return cbClient.QueryEntities(ctx, entityTypes, entityAttributes, query, headers)
-			}
+	geo, err := newGeoQuery(queryValues)
+	if err != nil {
+		return nil, err
+	}
+
+	entityTypes = slices.DeleteFunc(slices.Clone(entityTypes), func(t string) bool { return t == "" })
+
+	run := func(ctx context.Context) (*ngsild.QueryEntitiesResult, error) {
+		if len(entityTypes) == 0 {
+			return app.queryEntitiesByID(ctx, routes, entityAttributes, query, queryValues, geo, headers)
+		}
+
+		result, err := app.queryEntities(ctx, routes, entityTypes, entityAttributes, query, queryValues, geo, headers)
+		if err != nil || !routes.hasAttributeSourcesForTypes(entityTypes) {
+			return result, err
 		}
+
+		return app.addAttributesFromOtherSources(ctx, routes, result, headers)
+	}
+
+	key := readKey("query", tenant+"\n"+normalizedQuery(query)+"\n"+strings.Join(entityAttributes, ","), headers)
+	queryEntities := func() (*ngsild.QueryEntitiesResult, error) {
+		return app.reads.queryEntities(ctx, key, run)
+	}
+
+	// only queries for a single type are cached, so that a write to an entity only
+	// needs to invalidate the cached results of queries for the type of that entity
+	if cache := app.cache(tenant); len(entityTypes) == 1 && cache.caches(entityTypes[0]) {
+		return cache.queryEntities(ctx, entityTypes[0], entityAttributes, query, headers, queryEntities)
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could handle query %s", query))
+	return queryEntities()
 }
 
-func (app *contextBrokerApp) RetrieveEntity(ctx context.Context, tenant, entityID string, headers map[string][]string) (types.Entity, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+func (app *contextBrokerApp) queryEntities(ctx context.Context, routes *tenantRoutes, entityTypes, entityAttributes []string, query string, queryValues url.Values, geo *geoQuery, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	matchingSources, typesPerSource := routes.sourcesForTypes(entityTypes, geo)
+
+	if len(matchingSources) == 0 {
+		if anySources, _ := routes.sourcesForTypes(entityTypes, nil); geo != nil && len(anySources) > 0 {
+			return emptyQueryEntitiesResult(queryValues)
+		}
+
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could handle query %s", query))
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
+	if len(matchingSources) == 1 {
+		cbClient := app.client(matchingSources[0])
+		return cbClient.QueryEntities(ctx, entityTypes, entityAttributes, query, headers)
+	}
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+	queries := make([]*sourceQuery, 0, len(matchingSources))
+	for idx, src := range matchingSources {
+		queries = append(queries, &sourceQuery{source: src, types: typesPerSource[idx]})
+	}
 
-				if !regexpForID.MatchString(entityID) {
-					continue
-				}
+	return app.querySources(ctx, queries, entityAttributes, query, headers)
+}
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
-				return cbClient.RetrieveEntity(ctx, entityID, headers)
-			}
+// queryEntitiesByID routes a query that lacks entity types by its id or idPattern parameters,
+// so that each context source is only asked for the entities that it has registered
+func (app *contextBrokerApp) queryEntitiesByID(ctx context.Context, routes *tenantRoutes, entityAttributes []string, query string, queryValues url.Values, geo *geoQuery, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	var queries []*sourceQuery
+
+	if ids := queryValues.Get("id"); ids != "" {
+		queries = routes.sourcesForIDs(strings.Split(ids, ","))
+	} else if idPattern := queryValues.Get("idPattern"); idPattern != "" {
+		queries = routes.sourcesForIDPattern(idPattern, geo)
+
+		if len(queries) == 0 && geo != nil && len(routes.sourcesForIDPattern(idPattern, nil)) > 0 {
+			return emptyQueryEntitiesResult(queryValues)
 		}
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could provide entity %s", entityID))
+	if len(queries) == 0 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could handle query %s", query))
+	}
+
+	result, err := app.querySources(ctx, queries, entityAttributes, query, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	entityTypes := []string{}
+	for _, sq := range queries {
+		entityTypes = append(entityTypes, sq.types...)
+	}
+
+	if !routes.hasAttributeSourcesForTypes(entityTypes) {
+		return result, nil
+	}
+
+	return app.addAttributesFromOtherSources(ctx, routes, result, headers)
 }
 
-func (app *contextBrokerApp) QueryTemporalEvolutionOfEntities(ctx context.Context, tenant string, entityIDs, entityTypes []string, params cim.TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+// emptyQueryEntitiesResult is the result of a geo-query that is outside the areas of all context sources
+func emptyQueryEntitiesResult(queryValues url.Values) (*ngsild.QueryEntitiesResult, error) {
+	offset, limit, err := paginationFromQuery(queryValues)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeQueryEntitiesResults(nil, offset, limit)
+}
+
+// querySources sends a query to each of the context sources, restricted to the types and
+// ids that the source has been registered for, and combines the results
+func (app *contextBrokerApp) querySources(ctx context.Context, queries []*sourceQuery, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	path, rawQuery, _ := strings.Cut(query, "?")
+	queryValues, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, errors.NewBadRequestDataError("invalid query parameter")
+	}
+
+	if len(queries) == 1 {
+		sq := queries[0]
+		cbClient := app.client(sq.source)
+		return cbClient.QueryEntities(ctx, sq.types, entityAttributes, path+"?"+sq.restrict(queryValues).Encode(), headers)
+	}
+
+	offset, limit, err := paginationFromQuery(queryValues)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sources can not know how many entities the others will contribute to the
+	// merged result, so each source is asked for enough entities to fill the requested
+	// page on its own. The page is then cut from the merged result set.
+	queryValues.Set("offset", "0")
+	queryValues.Set("limit", strconv.Itoa(offset+limit))
+
+	results := make([]*sourceQueryResult, len(queries))
+
+	var wg sync.WaitGroup
+
+	for idx, sq := range queries {
+		sourceQuery := path + "?" + sq.restrict(queryValues).Encode()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cbClient := app.client(sq.source)
+			results[idx] = collectQueryEntitiesResult(
+				cbClient.QueryEntities(ctx, sq.types, entityAttributes, sourceQuery, headers),
+			)
+		}()
+	}
+
+	wg.Wait()
+
+	return mergeQueryEntitiesResults(results, offset, limit)
+}
+
+// sourceQueryResult holds the materialized result of a query against a single context source
+type sourceQueryResult struct {
+	entities   []types.Entity
+	totalCount int64
+	err        error
+}
+
+func collectQueryEntitiesResult(result *ngsild.QueryEntitiesResult, err error) *sourceQueryResult {
+	if err != nil {
+		return &sourceQueryResult{err: err}
+	}
+
+	sqr := &sourceQueryResult{
+		entities:   make([]types.Entity, 0, result.Count),
+		totalCount: result.TotalCount,
 	}
 
-	matchesIDPattern := func(ids []string, reg *regexp.Regexp) bool {
-		if slices.ContainsFunc(ids, reg.MatchString) {
-			return true
+	for e := range result.Found {
+		if e == nil {
+			break
 		}
 
-		return (len(ids) == 0) // true if there were no ids to match, false otherwise
+		sqr.entities = append(sqr.entities, e)
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
+	return sqr
+}
 
-				if !src.Temporal.Enabled {
-					continue
-				}
+func mergeQueryEntitiesResults(results []*sourceQueryResult, offset, limit int) (*ngsild.QueryEntitiesResult, error) {
+	merged := []types.Entity{}
+	var totalCount int64 = 0
 
-				if len(entityTypes) > 0 && notInSlice(entityInfo.Type, entityTypes) {
-					continue
-				}
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+		merged = append(merged, r.entities...)
 
-				// TODO: This might be a partial match and require dispatching the
-				// query to more than one context source. This implementation will
-				// only query the first match though, so do not mix ids from different
-				// entity types!
-				if !matchesIDPattern(entityIDs, regexpForID) {
-					continue
-				}
+		if totalCount >= 0 && r.totalCount >= 0 {
+			totalCount += r.totalCount
+		} else {
+			// if any source fails to report a count, the total is unknown
+			totalCount = -1
+		}
+	}
 
-				cbClient := client.NewContextBrokerClient(src.TemporalEndpoint(), client.Debug(app.debugClient))
-				queryParams := make([]client.RequestDecoratorFunc, 0, 10)
+	page := merged[min(offset, len(merged)):min(offset+limit, len(merged))]
 
-				if len(entityIDs) > 0 {
-					queryParams = append(queryParams, client.IDs(entityIDs))
-				}
+	qer := ngsild.NewQueryEntitiesResult()
+	qer.TotalCount = totalCount
+	qer.Count = len(page)
+	qer.Offset = offset
+	qer.Limit = limit
+	qer.PartialResult = qer.Count == qer.Limit || qer.Offset != 0
 
-				if len(entityTypes) > 0 {
-					queryParams = append(queryParams, client.Types(entityTypes))
-				}
+	go func() {
+		for _, e := range page {
+			qer.Found <- e
+		}
+		qer.Found <- nil
+	}()
 
-				attrs, ok := params.Attributes()
-				if ok {
-					queryParams = append(queryParams, client.Attributes(attrs))
-				}
+	return qer, nil
+}
 
-				temprel, ok := params.TemporalRelation()
-				if ok {
-					if temprel == "after" {
-						t, _ := params.TimeAt()
-						queryParams = append(queryParams, client.After(t))
-					} else if temprel == "between" {
-						st, _ := params.TimeAt()
-						et, _ := params.EndTimeAt()
-						queryParams = append(queryParams, client.Between(st, et))
-					} else if temprel == "before" {
-						t, _ := params.TimeAt()
-						queryParams = append(queryParams, client.Before(t))
-					}
-				}
+func paginationFromQuery(queryValues url.Values) (offset, limit int, err error) {
+	offset, limit = 0, 20 // default limit according to the NGSI-LD specification
 
-				count, ok := params.LastN()
-				if ok {
-					queryParams = append(queryParams, client.LastN(count))
-				}
+	if queryValues.Has("offset") {
+		offset, err = strconv.Atoi(queryValues.Get("offset"))
+		if err != nil || offset < 0 {
+			return 0, 0, errors.NewBadRequestDataError("offset must be a non negative integer")
+		}
+	}
 
-				return cbClient.QueryTemporalEvolutionOfEntities(ctx, headers, queryParams...)
-			}
+	if queryValues.Has("limit") {
+		limit, err = strconv.Atoi(queryValues.Get("limit"))
+		if err != nil || limit < 0 {
+			return 0, 0, errors.NewBadRequestDataError("limit must be a non negative integer")
 		}
 	}
 
-	return nil, errors.NewNotFoundError("no context source found that could provide temporal evolution of entities")
+	return offset, limit, nil
 }
 
-func (app *contextBrokerApp) RetrieveTemporalEvolutionOfEntity(ctx context.Context, tenant, entityID string, params cim.TemporalQueryParams, headers map[string][]string) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+func (app *contextBrokerApp) RetrieveEntity(ctx context.Context, tenant, entityID string, headers map[string][]string) (types.Entity, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
+	key := readKey("entity", tenant+"\n"+entityID, headers)
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+	return app.cache(tenant).retrieveEntity(ctx, entityID, headers, func() (types.Entity, error) {
+		return app.reads.retrieveEntity(ctx, key, func(ctx context.Context) (types.Entity, error) {
+			return app.retrieveEntity(ctx, routes, entityID, headers)
+		})
+	})
+}
+
+func (app *contextBrokerApp) QueryTemporalEvolutionOfEntities(ctx context.Context, tenant string, entityIDs, entityTypes []string, params cim.TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	key := readKey("temporal-query", tenant+"\n"+temporalQuery(entityIDs, entityTypes, params), headers)
+
+	return app.reads.queryTemporalEvolutionOfEntities(ctx, key, func(ctx context.Context) (*ngsild.QueryTemporalEntitiesResult, error) {
+		return app.queryTemporalEvolutionOfEntities(ctx, routes, entityIDs, entityTypes, params, headers)
+	})
+}
+
+func (app *contextBrokerApp) queryTemporalEvolutionOfEntities(ctx context.Context, routes *tenantRoutes, entityIDs, entityTypes []string, params cim.TemporalQueryParams, headers map[string][]string) (*ngsild.QueryTemporalEntitiesResult, error) {
+	type temporalSubQuery struct {
+		source *contextSource
+		ids    []string
+		types  []string
+	}
+
+	subQueries := []*temporalSubQuery{}
+
+	subQueryForSource := func(src *contextSource) *temporalSubQuery {
+		for _, sq := range subQueries {
+			if sq.source == src {
+				return sq
+			}
+		}
+
+		sq := &temporalSubQuery{source: src}
+		subQueries = append(subQueries, sq)
+		return sq
+	}
+
+	isCandidate := func(reg *registration) bool {
+		if !reg.source.Temporal.Enabled {
+			return false
+		}
+
+		return len(entityTypes) == 0 || slices.Contains(entityTypes, reg.entityType)
+	}
+
+	var candidates []*registration
 
-				if !regexpForID.MatchString(entityID) {
+	if len(entityIDs) > 0 {
+		for _, id := range entityIDs {
+			for _, reg := range routes.registrationsForID(id) {
+				if !isCandidate(reg) {
 					continue
 				}
 
-				if !src.Temporal.Enabled {
-					return nil, errors.NewNotFoundError("matching context source does not support temporal evolution")
+				sq := subQueryForSource(reg.source)
+				if !slices.Contains(sq.ids, id) {
+					sq.ids = append(sq.ids, id)
 				}
 
-				cbClient := client.NewContextBrokerClient(src.TemporalEndpoint(), client.Debug(app.debugClient))
-				queryParams := make([]client.RequestDecoratorFunc, 0, 10)
+				candidates = append(candidates, reg)
+			}
+		}
+	} else {
+		candidates = slices.DeleteFunc(slices.Clone(routes.registrations), func(reg *registration) bool { return !isCandidate(reg) })
+	}
 
-				attrs, ok := params.Attributes()
-				if ok {
-					queryParams = append(queryParams, client.Attributes(attrs))
-				}
+	for _, reg := range candidates {
+		sq := subQueryForSource(reg.source)
+		if len(entityTypes) > 0 && !slices.Contains(sq.types, reg.entityType) {
+			sq.types = append(sq.types, reg.entityType)
+		}
+	}
 
-				temprel, ok := params.TemporalRelation()
-				if ok {
-					if temprel == "after" {
-						t, _ := params.TimeAt()
-						queryParams = append(queryParams, client.After(t))
-					} else if temprel == "between" {
-						st, _ := params.TimeAt()
-						et, _ := params.EndTimeAt()
-						queryParams = append(queryParams, client.Between(st, et))
-					} else if temprel == "before" {
-						t, _ := params.TimeAt()
-						queryParams = append(queryParams, client.Before(t))
-					}
+	if len(subQueries) == 0 {
+		return nil, errors.NewNotFoundError("no context source found that could provide temporal evolution of entities")
+	}
+
+	// keep the sub queries in the same order as the context sources are configured
+	slices.SortFunc(subQueries, func(a, b *temporalSubQuery) int {
+		return slices.Index(routes.sources, a.source) - slices.Index(routes.sources, b.source)
+	})
+
+	results := make([]*ngsild.QueryTemporalEntitiesResult, len(subQueries))
+	errs := make([]error, len(subQueries))
+
+	var wg sync.WaitGroup
+
+	for idx, sq := range subQueries {
+		queryParams := make([]client.RequestDecoratorFunc, 0, 10)
+
+		if len(sq.ids) > 0 {
+			queryParams = append(queryParams, client.IDs(sq.ids))
+		}
+
+		if len(sq.types) > 0 {
+			queryParams = append(queryParams, client.Types(sq.types))
+		}
+
+		queryParams = append(queryParams, temporalQueryParameters(params)...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cbClient := app.temporalClient(sq.source)
+			results[idx], errs[idx] = cbClient.QueryTemporalEvolutionOfEntities(ctx, headers, queryParams...)
+		}()
+	}
+
+	wg.Wait()
+
+	for idx, err := range errs {
+		if err != nil {
+			// make sure that the producers of any successful results are not left hanging
+			for _, r := range results {
+				if r != nil {
+					go drainTemporalResult(r)
 				}
+			}
+
+			return nil, errs[idx]
+		}
+	}
+
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	return mergeQueryTemporalEntitiesResults(results), nil
+}
 
-				count, ok := params.LastN()
-				if ok {
-					queryParams = append(queryParams, client.LastN(count))
+func mergeQueryTemporalEntitiesResults(results []*ngsild.QueryTemporalEntitiesResult) *ngsild.QueryTemporalEntitiesResult {
+	merged := ngsild.NewQueryTemporalEntitiesResult()
+	merged.TotalCount = 0
+
+	for _, r := range results {
+		if merged.TotalCount >= 0 && r.TotalCount >= 0 {
+			merged.TotalCount += r.TotalCount
+		} else {
+			merged.TotalCount = -1
+		}
+	}
+
+	go func() {
+		for _, r := range results {
+			for e := range r.Found {
+				if e == nil {
+					break
 				}
 
-				return cbClient.RetrieveTemporalEvolutionOfEntity(ctx, entityID, headers, queryParams...)
+				merged.Found <- e
 			}
 		}
+		merged.Found <- nil
+	}()
+
+	return merged
+}
+
+func drainTemporalResult(result *ngsild.QueryTemporalEntitiesResult) {
+	for e := range result.Found {
+		if e == nil {
+			return
+		}
+	}
+}
+
+func temporalQueryParameters(params cim.TemporalQueryParams) []client.RequestDecoratorFunc {
+	queryParams := make([]client.RequestDecoratorFunc, 0, 5)
+
+	attrs, ok := params.Attributes()
+	if ok {
+		queryParams = append(queryParams, client.Attributes(attrs))
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could provide temporal evolution of entity %s", entityID))
+	temprel, ok := params.TemporalRelation()
+	if ok {
+		if temprel == "after" {
+			t, _ := params.TimeAt()
+			queryParams = append(queryParams, client.After(t))
+		} else if temprel == "between" {
+			st, _ := params.TimeAt()
+			et, _ := params.EndTimeAt()
+			queryParams = append(queryParams, client.Between(st, et))
+		} else if temprel == "before" {
+			t, _ := params.TimeAt()
+			queryParams = append(queryParams, client.Before(t))
+		}
+	}
+
+	count, ok := params.LastN()
+	if ok {
+		queryParams = append(queryParams, client.LastN(count))
+	}
+
+	return queryParams
 }
 
-func (app *contextBrokerApp) RetrieveTypes(ctx context.Context, tenant string, headers map[string][]string) ([]string, error) {
-	sources, ok := app.tenants[tenant]
+func (app *contextBrokerApp) RetrieveTemporalEvolutionOfEntity(ctx context.Context, tenant, entityID string, params cim.TemporalQueryParams, headers map[string][]string) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	src, ok := routes.sourceForID(entityID)
 	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could provide temporal evolution of entity %s", entityID))
+	}
+
+	if !src.Temporal.Enabled {
+		return nil, errors.NewNotFoundError("matching context source does not support temporal evolution")
 	}
 
-	availableTypes := map[string]struct{}{}
+	key := readKey("temporal-entity", tenant+"\n"+entityID+"\n"+temporalQuery(nil, nil, params), headers)
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
-				availableTypes[entityInfo.Type] = struct{}{}
-			}
+	return app.reads.retrieveTemporalEvolutionOfEntity(ctx, key, func(ctx context.Context) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
+		cbClient := app.temporalClient(src)
+		return cbClient.RetrieveTemporalEvolutionOfEntity(ctx, entityID, headers, temporalQueryParameters(params)...)
+	})
+}
+
+func (app *contextBrokerApp) RetrieveTypes(ctx context.Context, tenant string, headers map[string][]string) ([]string, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return routes.types(), nil
+}
+
+func (app *contextBrokerApp) MergeEntity(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	fragments, err := routes.fragmentsPerSource(entityID, fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	defer app.invalidateCache(routes, tenant, entityID)
+
+	merged := []string{}
+
+	for _, sf := range fragments {
+		err = app.removeUnchangedAttributes(ctx, app.client(sf.source), entityID, sf.fragment)
+		if err != nil {
+			return nil, err
 		}
+
+		merged = append(merged, attributeNames(sf.fragment)...)
+	}
+
+	change, err := app.entityUpdated(ctx, tenant, entityID, merged)
+	if err != nil {
+		return nil, err
 	}
 
-	typeList := make([]string, 0, len(availableTypes))
+	var result *ngsild.MergeEntityResult
 
-	for k := range availableTypes {
-		typeList = append(typeList, k)
+	for idx, sf := range fragments {
+		result, err = app.client(sf.source).MergeEntity(ctx, entityID, sf.fragment, headers)
+		if err != nil {
+			settle(change, idx)
+			return result, err
+		}
 	}
 
-	sort.Strings(typeList)
+	change.Commit()
 
-	return typeList, nil
+	return result, err
 }
 
-func (app *contextBrokerApp) MergeEntity(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+// ReplaceEntity replaces the attributes of an entity in the context sources that provide them.
+// Sources that provide some of the attributes of the entity, but none of those in the new
+// version of it, are left as they are.
+func (app *contextBrokerApp) ReplaceEntity(ctx context.Context, tenant, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
+	fragments, err := routes.fragmentsPerSource(entityID, entity)
+	if err != nil {
+		return nil, err
+	}
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+	defer app.invalidateCache(routes, tenant, entityID)
 
-				if !regexpForID.MatchString(entityID) {
-					continue
-				}
+	change, err := app.entityUpdated(ctx, tenant, entityID, attributeNames(entity))
+	if err != nil {
+		return nil, err
+	}
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
+	var result *ngsild.ReplaceEntityResult
 
-				current, err := cbClient.RetrieveEntity(ctx, entityID, map[string][]string{
-					"Accept": {"application/ld+json"},
-					"Link":   {entities.LinkHeader},
-				})
-				if err != nil {
-					return nil, err
-				}
+	for idx, sf := range fragments {
+		result, err = app.client(sf.source).ReplaceEntity(ctx, entityID, sf.fragment, headers)
+		if err != nil {
+			settle(change, idx)
+			return result, err
+		}
+	}
 
-				fragmentImpl, ok := fragment.(*entities.EntityImpl)
-				if ok {
-					eqFloat64 := func(a, b float64) bool {
-						return math.Abs(a-b) <= 0.0001
-					}
-					eqTime := func(a, b string) bool {
-						atime, err := time.Parse(time.RFC3339, a)
-						if err != nil {
-							return false
-						}
-						btime, err := time.Parse(time.RFC3339, b)
-						if err != nil {
-							return false
-						}
-						return atime.Equal(btime)
-					}
+	change.Commit()
 
-					current.ForEachAttribute(func(ct, cn string, cc any) {
-						fragmentImpl.RemoveAttribute(func(ft, fn string, fc any) bool {
-							if ct == ft && cn == fn {
-								switch cc.(type) {
-								case *properties.NumberProperty:
-									c, cok := cc.(*properties.NumberProperty)
-									f, fok := fc.(*properties.NumberProperty)
-									return cok && fok && eqFloat64(c.Val, f.Val) && eqTime(c.ObservedAt(), f.ObservedAt())
-								case *properties.TextProperty:
-									c, cok := cc.(*properties.TextProperty)
-									f, fok := fc.(*properties.TextProperty)
-									return cok && fok && strings.EqualFold(c.Val, f.Val) && eqTime(c.ObservedAt(), f.ObservedAt())
-								case *properties.TextListProperty:
-									//TODO: impl support for TextListProperty?
-									return false
-								default:
-									return false
-								}
-							}
-							return false
-						})
-					})
-				}
+	return result, nil
+}
 
-				result, err := cbClient.MergeEntity(ctx, entityID, fragment, headers)
-				if err != nil {
-					return result, err
-				}
+func (app *contextBrokerApp) ReplaceAttribute(ctx context.Context, tenant, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
 
-				if app.notifier != nil {
-					// Spawn a go routine to fetch the updated entity in its entirety
-					go func() {
-						delete(headers, "Content-Type")
-						headers["Accept"] = []string{"application/ld+json"}
-						headers["Link"] = []string{entities.LinkHeader}
+	fragments, err := routes.fragmentsPerSource(entityID, fragment)
+	if err != nil {
+		return nil, err
+	}
 
-						ctx := context.WithoutCancel(ctx)
+	defer app.invalidateCache(routes, tenant, entityID)
 
-						entity, err := cbClient.RetrieveEntity(ctx, entityID, headers)
-						if err == nil {
-							app.notifier.EntityUpdated(ctx, entity, tenant)
-						}
-					}()
-				}
+	change, err := app.entityUpdated(ctx, tenant, entityID, []string{attributeName})
+	if err != nil {
+		return nil, err
+	}
 
-				return result, err
-			}
+	var result *ngsild.ReplaceAttributeResult
+
+	for idx, sf := range fragments {
+		result, err = app.client(sf.source).ReplaceAttribute(ctx, entityID, attributeName, sf.fragment, headers)
+		if err != nil {
+			settle(change, idx)
+			return result, err
 		}
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could update attributes for entity %s", entityID))
+	change.Commit()
+
+	return result, nil
 }
 
-func (app *contextBrokerApp) UpdateEntityAttributes(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+// removeUnchangedAttributes removes the attributes from the fragment that do not differ from the
+// current state of the entity, so that only the attributes that differ are merged
+func (app *contextBrokerApp) removeUnchangedAttributes(ctx context.Context, cbClient client.ContextBrokerClient, entityID string, fragment types.EntityFragment) error {
+	current, err := cbClient.RetrieveEntity(ctx, entityID, map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	})
+	if err != nil {
+		return err
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
+	fragmentImpl, ok := fragment.(*entities.EntityImpl)
+	if ok {
+		eqFloat64 := func(a, b float64) bool {
+			return math.Abs(a-b) <= 0.0001
+		}
+		eqTime := func(a, b string) bool {
+			atime, err := time.Parse(time.RFC3339, a)
+			if err != nil {
+				return false
+			}
+			btime, err := time.Parse(time.RFC3339, b)
+			if err != nil {
+				return false
+			}
+			return atime.Equal(btime)
+		}
 
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
+		current.ForEachAttribute(func(ct, cn string, cc any) {
+			fragmentImpl.RemoveAttribute(func(ft, fn string, fc any) bool {
+				if ct == ft && cn == fn {
+					switch cc.(type) {
+					case *properties.NumberProperty:
+						c, cok := cc.(*properties.NumberProperty)
+						f, fok := fc.(*properties.NumberProperty)
+						return cok && fok && eqFloat64(c.Val, f.Val) && eqTime(c.ObservedAt(), f.ObservedAt())
+					case *properties.TextProperty:
+						c, cok := cc.(*properties.TextProperty)
+						f, fok := fc.(*properties.TextProperty)
+						return cok && fok && strings.EqualFold(c.Val, f.Val) && eqTime(c.ObservedAt(), f.ObservedAt())
+					case *properties.TextListProperty:
+						//TODO: impl support for TextListProperty?
+						return false
+					default:
+						return false
+					}
 				}
+				return false
+			})
+		})
+	}
 
-				if !regexpForID.MatchString(entityID) {
-					continue
-				}
+	return nil
+}
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
-				result, err := cbClient.UpdateEntityAttributes(ctx, entityID, fragment, headers)
-				if err != nil {
-					return result, err
-				}
+func (app *contextBrokerApp) UpdateEntityAttributes(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
 
-				if app.notifier != nil {
-					// Spawn a go routine to fetch the updated entity in its entirety
-					go func() {
-						delete(headers, "Content-Type")
-						headers["Accept"] = []string{"application/ld+json"}
-						headers["Link"] = []string{entities.LinkHeader}
+	fragments, err := routes.fragmentsPerSource(entityID, fragment)
+	if err != nil {
+		return nil, err
+	}
 
-						ctx := context.WithoutCancel(ctx)
+	defer app.invalidateCache(routes, tenant, entityID)
 
-						entity, err := cbClient.RetrieveEntity(ctx, entityID, headers)
-						if err == nil {
-							app.notifier.EntityUpdated(ctx, entity, tenant)
-						}
-					}()
-				}
+	change, err := app.entityUpdated(ctx, tenant, entityID, attributeNames(fragment))
+	if err != nil {
+		return nil, err
+	}
 
-				return result, err
-			}
+	var result *ngsild.UpdateEntityAttributesResult
+
+	for idx, sf := range fragments {
+		cbClient := app.client(sf.source)
+
+		r, err := cbClient.UpdateEntityAttributes(ctx, entityID, sf.fragment, headers)
+		if err != nil {
+			settle(change, idx)
+			return r, err
+		}
+
+		if result == nil {
+			result = r
+		} else {
+			result.Updated = append(result.Updated, r.Updated...)
+			result.NotUpdated = append(result.NotUpdated, r.NotUpdated...)
 		}
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could update attributes for entity %s", entityID))
+	change.Commit()
+
+	return result, nil
 }
 
-func (app *contextBrokerApp) DeleteEntity(ctx context.Context, tenant, entityID string) (*ngsild.DeleteEntityResult, error) {
-	sources, ok := app.tenants[tenant]
-	if !ok {
-		return nil, errors.NewUnknownTenantError(tenant)
+func (app *contextBrokerApp) AppendEntityAttributes(ctx context.Context, tenant, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, src := range sources {
-		for _, reginfo := range src.Information {
-			for _, entityInfo := range reginfo.Entities {
-				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
-				if err != nil {
-					continue
-				}
+	fragments, err := routes.fragmentsPerSource(entityID, fragment)
+	if err != nil {
+		return nil, err
+	}
 
-				if !regexpForID.MatchString(entityID) {
-					continue
-				}
+	defer app.invalidateCache(routes, tenant, entityID)
 
-				cbClient := client.NewContextBrokerClient(src.Endpoint, client.Debug(app.debugClient))
-				return cbClient.DeleteEntity(ctx, entityID)
-			}
+	change, err := app.entityUpdated(ctx, tenant, entityID, attributeNames(fragment))
+	if err != nil {
+		return nil, err
+	}
+
+	var result *ngsild.AppendEntityAttributesResult
+
+	for idx, sf := range fragments {
+		r, err := app.client(sf.source).AppendEntityAttributes(ctx, entityID, sf.fragment, headers)
+		if err != nil {
+			settle(change, idx)
+			return r, err
+		}
+
+		if result == nil {
+			result = r
+		} else {
+			result.Updated = append(result.Updated, r.Updated...)
+			result.NotUpdated = append(result.NotUpdated, r.NotUpdated...)
 		}
 	}
 
-	return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could delete entity with id %s", entityID))
+	change.Commit()
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) PatchAttribute(ctx context.Context, tenant, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := routes.sourceForEntityAttribute(entityID, attributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer app.invalidateCache(routes, tenant, entityID)
+
+	change, err := app.entityUpdated(ctx, tenant, entityID, []string{attributeName})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := app.client(src).PatchAttribute(ctx, entityID, attributeName, fragment, headers)
+	if err != nil {
+		change.Discard()
+		return nil, err
+	}
+
+	change.Commit()
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) DeleteAttribute(ctx context.Context, tenant, entityID, attributeName, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := routes.sourceForEntityAttribute(entityID, attributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer app.invalidateCache(routes, tenant, entityID)
+
+	change, err := app.entityUpdated(ctx, tenant, entityID, []string{attributeName})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := app.client(src).DeleteAttribute(ctx, entityID, attributeName, datasetID, deleteAll)
+	if err != nil {
+		change.Discard()
+		return nil, err
+	}
+
+	change.Commit()
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) DeleteEntity(ctx context.Context, tenant, entityID string) (*ngsild.DeleteEntityResult, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := routes.sourcesForEntity(entityID)
+	if len(sources) == 0 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no context source found that could delete entity with id %s", entityID))
+	}
+
+	defer app.invalidateCache(routes, tenant, entityID)
+
+	return app.deleteEntityFromSources(ctx, sources, entityID)
 }
 
 func (app *contextBrokerApp) Start() error {
@@ -494,7 +1076,11 @@ func (app *contextBrokerApp) Start() error {
 	return nil
 }
 
+// Stop stops the notifier and the reporting of metrics, and should be called before the app is
+// replaced by another one
 func (app *contextBrokerApp) Stop() error {
+	app.breakers.close()
+
 	if app.notifier != nil {
 		return app.notifier.Stop()
 	}
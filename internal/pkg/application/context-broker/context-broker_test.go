@@ -2,12 +2,22 @@ package contextbroker
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	cfg "github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/internal/pkg/application/subscriptions"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
 	"github.com/diwise/service-chassis/pkg/test/http/response"
@@ -72,6 +82,30 @@ func TestThatRetrieveTypesWorks(t *testing.T) {
 	is.Equal(availableTypes, []string{"Device", "DeviceModel"})
 }
 
+func TestThatReloadReplacesTheContextSources(t *testing.T) {
+	is := is.New(t)
+
+	broker, err := New(context.Background(), withDefaultTestConfig("", ""))
+	is.NoErr(err)
+
+	invalid := withDefaultTestConfig("", "")
+	invalid.Tenants[0].ContextSources[0].Information[0].Entities[0].IDPattern = "^urn:ngsi-ld:Device:(.+"
+
+	err = broker.Reload(context.Background(), invalid)
+	is.True(err != nil) // should reject the invalid configuration
+
+	availableTypes, err := broker.RetrieveTypes(context.Background(), "testtenant", nil)
+	is.NoErr(err)
+	is.Equal(availableTypes, []string{"Device", "DeviceModel"}) // should keep the current configuration
+
+	err = broker.Reload(context.Background(), withTwoSourcesTestConfig("", ""))
+	is.NoErr(err)
+
+	availableTypes, err = broker.RetrieveTypes(context.Background(), "testtenant", nil)
+	is.NoErr(err)
+	is.Equal(availableTypes, []string{"Device", "WaterConsumptionObserved"})
+}
+
 var Expects = testutils.Expects
 var Returns = testutils.Returns
 var anyInput = expects.AnyInput
@@ -125,6 +159,559 @@ func TestThatNotificationsAreSent_ThisTestShouldBeBrokenUp(t *testing.T) {
 	is.Equal(ns.RequestCount(), 1)
 }
 
+func TestThatNoNotificationsAreSentAboutFailedWrites(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is, anyInput()),
+		Returns(response.Code(http.StatusBadRequest)),
+	)
+	defer s.Close()
+
+	ns := testutils.NewMockServiceThat(Expects(is, anyInput()), Returns(response.Code(http.StatusOK)))
+	defer ns.Close()
+
+	config := withDefaultTestConfig(s.URL(), ns.URL())
+	config.Storage.Path = t.TempDir()
+
+	broker, err := New(context.Background(), config)
+	is.NoErr(err)
+
+	broker.Start()
+
+	_, err = broker.CreateEntity(context.Background(), "testtenant", testEntity("Device", "urn:ngsi-ld:Device:testid"), nil)
+	is.True(err != nil) // should fail when the context source rejects the entity
+
+	broker.Stop()
+
+	is.Equal(ns.RequestCount(), 0) // should not notify about an entity that was not created
+
+	outbox, err := subscriptions.NewOutbox(filepath.Join(config.Storage.Path, "outbox.jsonl"))
+	is.NoErr(err)
+	is.Equal(len(outbox.Pending()), 0) // should have discarded the event
+}
+
+func TestThatQueryEntitiesIsSentToAllMatchingSourcesAndMerged(t *testing.T) {
+	is := is.New(t)
+
+	devices := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.QueryParamEquals("type", "Device"),
+			expects.QueryParamEquals("offset", "0"),
+			expects.QueryParamEquals("limit", "3"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Header("NGSILD-Results-Count", "2"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+deviceJSON("01")+`,`+deviceJSON("02")+`]`)),
+		),
+	)
+	defer devices.Close()
+
+	consumptions := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.QueryParamEquals("type", "WaterConsumptionObserved"),
+			expects.QueryParamEquals("offset", "0"),
+			expects.QueryParamEquals("limit", "3"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Header("NGSILD-Results-Count", "5"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+consumptionJSON("01")+`,`+consumptionJSON("02")+`]`)),
+		),
+	)
+	defer consumptions.Close()
+
+	broker, err := New(context.Background(), withTwoSourcesTestConfig(devices.URL(), consumptions.URL()))
+	is.NoErr(err)
+
+	result, err := broker.QueryEntities(
+		context.Background(), "testtenant",
+		[]string{"Device", "WaterConsumptionObserved"}, nil,
+		"/ngsi-ld/v1/entities?type=Device,WaterConsumptionObserved&offset=1&limit=2&count=true",
+		nil,
+	)
+	is.NoErr(err)
+
+	ids := []string{}
+	for e := range result.Found {
+		if e == nil {
+			break
+		}
+		ids = append(ids, e.ID())
+	}
+
+	is.Equal(devices.RequestCount(), 1)
+	is.Equal(consumptions.RequestCount(), 1)
+	is.Equal(result.TotalCount, int64(7)) // results count should be the sum from both sources
+	is.Equal(result.Offset, 1)            // offset should be preserved
+	is.Equal(result.Limit, 2)             // limit should be preserved
+	is.Equal(result.Count, 2)             // should return a full page
+	is.Equal(ids, []string{"urn:ngsi-ld:Device:02", "urn:ngsi-ld:WaterConsumptionObserved:01"})
+}
+
+func TestThatQueryEntitiesByIDIsSplitPerContextSource(t *testing.T) {
+	is := is.New(t)
+
+	devices := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.QueryParamEquals("type", "Device"),
+			expects.QueryParamEquals("id", "urn:ngsi-ld:Device:01"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+deviceJSON("01")+`]`)),
+		),
+	)
+	defer devices.Close()
+
+	consumptions := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.QueryParamEquals("type", "WaterConsumptionObserved"),
+			expects.QueryParamEquals("id", "urn:ngsi-ld:WaterConsumptionObserved:01,urn:ngsi-ld:WaterConsumptionObserved:02"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+consumptionJSON("01")+`,`+consumptionJSON("02")+`]`)),
+		),
+	)
+	defer consumptions.Close()
+
+	broker, err := New(context.Background(), withTwoSourcesTestConfig(devices.URL(), consumptions.URL()))
+	is.NoErr(err)
+
+	result, err := broker.QueryEntities(
+		context.Background(), "testtenant", nil, nil,
+		"/ngsi-ld/v1/entities?id=urn:ngsi-ld:WaterConsumptionObserved:01,urn:ngsi-ld:Device:01,urn:ngsi-ld:WaterConsumptionObserved:02",
+		nil,
+	)
+	is.NoErr(err)
+
+	count := 0
+	for e := range result.Found {
+		if e == nil {
+			break
+		}
+		count++
+	}
+
+	is.Equal(devices.RequestCount(), 1)
+	is.Equal(consumptions.RequestCount(), 1)
+	is.Equal(count, 3)
+}
+
+func TestThatQueryEntitiesByIDPatternSkipsSourcesWithOtherPrefixes(t *testing.T) {
+	is := is.New(t)
+
+	devices := testutils.NewMockServiceThat(
+		Expects(is, expects.QueryParamEquals("type", "Device")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+deviceJSON("01")+`]`)),
+		),
+	)
+	defer devices.Close()
+
+	broker, err := New(context.Background(), withTwoSourcesTestConfig(devices.URL(), "http://consumptions.invalid"))
+	is.NoErr(err)
+
+	_, err = broker.QueryEntities(context.Background(), "testtenant", []string{""}, nil, "/ngsi-ld/v1/entities?idPattern=%5Eurn:ngsi-ld:Device:0.%2A", nil)
+	is.NoErr(err)
+	is.Equal(devices.RequestCount(), 1)
+}
+
+func TestThatGeoQueriesAreOnlySentToSourcesCoveringTheArea(t *testing.T) {
+	is := is.New(t)
+
+	sundsvallSource := testutils.NewMockServiceThat(
+		Expects(is, expects.QueryParamEquals("georel", "near;maxDistance==2000")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+deviceJSON("01")+`]`)),
+		),
+	)
+	defer sundsvallSource.Close()
+
+	testConfig := withTwoSourcesTestConfig(sundsvallSource.URL(), "http://timra.invalid")
+	sources := testConfig.Tenants[0].ContextSources
+	sources[1].Information[0].Entities[0] = sources[0].Information[0].Entities[0]
+	sources[0].Information[0].Location = &cfg.Geometry{Type: "Polygon", Coordinates: sundsvall}
+	sources[1].Information[0].Location = &cfg.Geometry{Type: "Polygon", Coordinates: timra}
+
+	broker, err := New(context.Background(), testConfig)
+	is.NoErr(err)
+
+	result, err := broker.QueryEntities(
+		context.Background(), "testtenant", []string{"Device"}, nil,
+		"/ngsi-ld/v1/entities?type=Device&georel=near%3BmaxDistance%3D%3D2000&geometry=Point&coordinates=%5B17.3%2C62.39%5D",
+		nil,
+	)
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+	is.Equal(sundsvallSource.RequestCount(), 1)
+
+	result, err = broker.QueryEntities(
+		context.Background(), "testtenant", []string{"Device"}, nil,
+		"/ngsi-ld/v1/entities?type=Device&georel=within&geometry=Point&coordinates=%5B10.0%2C59.9%5D",
+		nil,
+	)
+	is.NoErr(err)
+	is.Equal(result.Count, 0)                   // should return an empty result outside of all areas
+	is.Equal(sundsvallSource.RequestCount(), 1) // should not have asked any source
+}
+
+func TestThatTemporalQueriesAreSplitPerContextSource(t *testing.T) {
+	is := is.New(t)
+
+	devices := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.RequestPath("/ngsi-ld/v1/temporal/entities"),
+			expects.QueryParamEquals("id", "urn:ngsi-ld:Device:01"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+deviceJSON("01")+`]`)),
+		),
+	)
+	defer devices.Close()
+
+	consumptions := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.RequestPath("/ngsi-ld/v1/temporal/entities"),
+			expects.QueryParamEquals("id", "urn:ngsi-ld:WaterConsumptionObserved:01,urn:ngsi-ld:WaterConsumptionObserved:02"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+consumptionJSON("01")+`,`+consumptionJSON("02")+`]`)),
+		),
+	)
+	defer consumptions.Close()
+
+	testConfig := withTwoSourcesTestConfig(devices.URL(), consumptions.URL())
+	for idx := range testConfig.Tenants[0].ContextSources {
+		testConfig.Tenants[0].ContextSources[idx].Temporal.Enabled = true
+	}
+
+	broker, err := New(context.Background(), testConfig)
+	is.NoErr(err)
+
+	entityIDs := []string{
+		"urn:ngsi-ld:WaterConsumptionObserved:01",
+		"urn:ngsi-ld:Device:01",
+		"urn:ngsi-ld:WaterConsumptionObserved:02",
+	}
+
+	result, err := broker.QueryTemporalEvolutionOfEntities(context.Background(), "testtenant", entityIDs, nil, &temporalParams{}, nil)
+	is.NoErr(err)
+
+	ids := []string{}
+	for e := range result.Found {
+		if e == nil {
+			break
+		}
+		ids = append(ids, e.ID())
+	}
+
+	is.Equal(devices.RequestCount(), 1)
+	is.Equal(consumptions.RequestCount(), 1)
+	is.Equal(ids, []string{"urn:ngsi-ld:Device:01", "urn:ngsi-ld:WaterConsumptionObserved:01", "urn:ngsi-ld:WaterConsumptionObserved:02"})
+}
+
+func TestThatRequestsAreSentToTheMappedDownstreamTenant(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is, expects.RequestHeaderContains("NGSILD-Tenant", "municipality")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(deviceJSON("01"))),
+		),
+	)
+	defer s.Close()
+
+	testConfig := withDefaultTestConfig(s.URL(), "")
+	testConfig.Tenants[0].ContextSources[0].Tenant = "municipality"
+	testConfig.Tenants[0].ContextSources[0].Temporal.Enabled = true
+
+	broker, err := New(context.Background(), testConfig)
+	is.NoErr(err)
+
+	_, err = broker.RetrieveEntity(context.Background(), "testtenant", "urn:ngsi-ld:Device:01", nil)
+	is.NoErr(err)
+
+	_, err = broker.RetrieveTemporalEvolutionOfEntity(context.Background(), "testtenant", "urn:ngsi-ld:Device:01", &temporalParams{}, nil)
+	is.NoErr(err)
+
+	is.Equal(s.RequestCount(), 2)
+}
+
+func TestThatNoTenantHeaderIsSentWhenMappedToNone(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is, requestHeaderMissing("NGSILD-Tenant")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(deviceJSON("01"))),
+		),
+	)
+	defer s.Close()
+
+	testConfig := withDefaultTestConfig(s.URL(), "")
+	testConfig.Tenants[0].ContextSources[0].Tenant = cfg.NoTenant
+
+	broker, err := New(context.Background(), testConfig)
+	is.NoErr(err)
+
+	_, err = broker.RetrieveEntity(context.Background(), "testtenant", "urn:ngsi-ld:Device:01", nil)
+	is.NoErr(err)
+}
+
+func TestThatRetrieveEntityMergesAttributesFromSeveralSources(t *testing.T) {
+	is := is.New(t)
+
+	static := testutils.NewMockServiceThat(
+		Expects(is, expects.RequestPath("/ngsi-ld/v1/entities/urn:ngsi-ld:Beach:01")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(beachJSON(`"name":{"type":"Property","value":"Hartungviken"},"temperature":{"type":"Property","value":4.0}`))),
+		),
+	)
+	defer static.Close()
+
+	observed := testutils.NewMockServiceThat(
+		Expects(is, expects.RequestPath("/ngsi-ld/v1/entities/urn:ngsi-ld:Beach:01")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(beachJSON(`"temperature":{"type":"Property","value":17.2},"status":{"type":"Property","value":"ignored"}`))),
+		),
+	)
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL(), observed.URL()))
+	is.NoErr(err)
+
+	beach, err := broker.RetrieveEntity(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", nil)
+	is.NoErr(err)
+
+	attributes := map[string]any{}
+	beach.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		attributes[attributeName] = contents.(types.Property).Value()
+	})
+
+	is.Equal(len(attributes), 2)                 // should only contain the registered attribute of the observed source
+	is.Equal(attributes["name"], "Hartungviken") // should contain the attributes of the static source
+	is.Equal(attributes["temperature"], 17.2)    // should prefer the source that is registered for the attribute
+}
+
+func TestThatQueryEntitiesAddsAttributesFromOtherSources(t *testing.T) {
+	is := is.New(t)
+
+	static := testutils.NewMockServiceThat(
+		Expects(is, expects.QueryParamEquals("type", "Beach")),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+beachJSON(`"name":{"type":"Property","value":"Hartungviken"}`)+`]`)),
+		),
+	)
+	defer static.Close()
+
+	observed := testutils.NewMockServiceThat(
+		Expects(is,
+			expects.QueryParamEquals("id", "urn:ngsi-ld:Beach:01"),
+			expects.QueryParamEquals("attrs", "temperature"),
+		),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Code(http.StatusOK),
+			response.Body([]byte(`[`+beachJSON(`"temperature":{"type":"Property","value":17.2}`)+`]`)),
+		),
+	)
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL(), observed.URL()))
+	is.NoErr(err)
+
+	result, err := broker.QueryEntities(context.Background(), "testtenant", []string{"Beach"}, nil, "/ngsi-ld/v1/entities?type=Beach", nil)
+	is.NoErr(err)
+
+	beach := <-result.Found
+	is.True(beach != nil)
+	is.True(<-result.Found == nil) // should only find a single beach
+
+	attributes := []string{}
+	beach.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		attributes = append(attributes, attributeName)
+	})
+	slices.Sort(attributes)
+
+	is.Equal(attributes, []string{"name", "temperature"})
+}
+
+func TestThatUpdateEntityAttributesIsSplitPerSource(t *testing.T) {
+	is := is.New(t)
+
+	received := map[string]string{}
+	var mu sync.Mutex
+
+	newSource := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			received[name] = string(body)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+
+	static, observed := newSource("static"), newSource("observed")
+	defer static.Close()
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL, observed.URL))
+	is.NoErr(err)
+
+	fragment, _ := entities.NewFragment(
+		entities.P("name", properties.NewTextProperty("Hartungviken")),
+		entities.P("temperature", properties.NewNumberProperty(17.2)),
+	)
+
+	_, err = broker.UpdateEntityAttributes(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", fragment, map[string][]string{})
+	is.NoErr(err)
+
+	is.True(strings.Contains(received["static"], "name"))
+	is.True(!strings.Contains(received["static"], "temperature"))
+	is.True(strings.Contains(received["observed"], "temperature"))
+	is.True(!strings.Contains(received["observed"], "name"))
+}
+
+func TestThatDeleteEntityIsSentToEverySourceOfTheEntity(t *testing.T) {
+	is := is.New(t)
+
+	requests := map[string]string{}
+	var mu sync.Mutex
+
+	newSource := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[name] = r.Method + " " + r.URL.Path
+			mu.Unlock()
+			if status == http.StatusNotFound {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"type":"https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound","title":"not found"}`))
+				return
+			}
+			w.WriteHeader(status)
+		}))
+	}
+
+	static, observed := newSource("static", http.StatusNoContent), newSource("observed", http.StatusNotFound)
+	defer static.Close()
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL, observed.URL))
+	is.NoErr(err)
+
+	_, err = broker.DeleteEntity(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01")
+	is.NoErr(err) // a source that only provides some attributes need not hold the entity
+
+	is.Equal(requests["static"], "DELETE /ngsi-ld/v1/entities/urn:ngsi-ld:Beach:01")
+	is.Equal(requests["observed"], "DELETE /ngsi-ld/v1/entities/urn:ngsi-ld:Beach:01")
+}
+
+func TestThatReplaceAttributeIsRoutedToTheSourceOfTheAttribute(t *testing.T) {
+	is := is.New(t)
+
+	requests := map[string]string{}
+	var mu sync.Mutex
+
+	newSource := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[name] = r.Method + " " + r.URL.Path
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+
+	static, observed := newSource("static"), newSource("observed")
+	defer static.Close()
+	defer observed.Close()
+
+	broker, err := New(context.Background(), withBeachSources(static.URL, observed.URL))
+	is.NoErr(err)
+
+	fragment, _ := entities.NewFragment(entities.P("temperature", properties.NewNumberProperty(17.2)))
+
+	_, err = broker.ReplaceAttribute(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", "temperature", fragment, map[string][]string{})
+	is.NoErr(err)
+
+	is.Equal(requests["observed"], "PUT /ngsi-ld/v1/entities/urn:ngsi-ld:Beach:01/attrs/temperature")
+	is.Equal(requests["static"], "") // should not have touched the source that does not provide the attribute
+}
+
+func TestThatRetrievedEntitiesAreCachedUntilUpdated(t *testing.T) {
+	is := is.New(t)
+
+	var retrievals atomic.Int32
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		retrievals.Add(1)
+		w.Header().Set("Content-Type", "application/ld+json")
+		w.Write([]byte(beachJSON(`"temperature":{"type":"Property","value":17.2}`)))
+	}))
+	defer source.Close()
+
+	config := withBeachSources(source.URL, source.URL)
+	config.Tenants[0].ContextSources = config.Tenants[0].ContextSources[:1]
+	config.Tenants[0].Cache = []cfg.CacheConfig{{Type: "Beach", TTL: time.Minute}}
+
+	broker, err := New(context.Background(), config)
+	is.NoErr(err)
+
+	for range 3 {
+		_, err = broker.RetrieveEntity(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", nil)
+		is.NoErr(err)
+	}
+
+	is.Equal(retrievals.Load(), int32(1)) // should have served the entity from the cache
+
+	fragment, _ := entities.NewFragment(entities.P("temperature", properties.NewNumberProperty(18.0)))
+	_, err = broker.UpdateEntityAttributes(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", fragment, map[string][]string{})
+	is.NoErr(err)
+
+	_, err = broker.RetrieveEntity(context.Background(), "testtenant", "urn:ngsi-ld:Beach:01", nil)
+	is.NoErr(err)
+
+	is.Equal(retrievals.Load(), int32(2)) // should have retrieved the entity again after the update
+}
+
+func requestHeaderMissing(header string) func(*is.I, *http.Request) {
+	return func(is *is.I, r *http.Request) {
+		_, ok := r.Header[http.CanonicalHeaderKey(header)]
+		is.True(!ok) // request should not contain the header
+	}
+}
+
 func withDefaultTestConfig(brokerEndpoint, notificationEndpoint string) cfg.Config {
 	cfg := cfg.Config{
 		Tenants: []cfg.Tenant{
@@ -165,6 +752,70 @@ func withDefaultTestConfig(brokerEndpoint, notificationEndpoint string) cfg.Conf
 	return cfg
 }
 
+func withTwoSourcesTestConfig(deviceEndpoint, consumptionEndpoint string) cfg.Config {
+	cfg := cfg.Config{
+		Tenants: []cfg.Tenant{
+			{
+				ID: "testtenant",
+				ContextSources: []cfg.ContextSourceConfig{
+					{
+						Endpoint: deviceEndpoint,
+						Information: []cfg.RegistrationInfo{
+							{
+								Entities: []cfg.EntityInfo{
+									{
+										IDPattern: "^urn:ngsi-ld:Device:.+",
+										Type:      "Device",
+									},
+								},
+							},
+						},
+					},
+					{
+						Endpoint: consumptionEndpoint,
+						Information: []cfg.RegistrationInfo{
+							{
+								Entities: []cfg.EntityInfo{
+									{
+										IDPattern: "^urn:ngsi-ld:WaterConsumptionObserved:.+",
+										Type:      "WaterConsumptionObserved",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return cfg
+}
+
+// withBeachSources configures one source that provides all attributes of beaches
+// and another one that only provides their temperature
+func withBeachSources(staticEndpoint, observedEndpoint string) cfg.Config {
+	beaches := []cfg.EntityInfo{{IDPattern: "^urn:ngsi-ld:Beach:.+", Type: "Beach"}}
+
+	return cfg.Config{
+		Tenants: []cfg.Tenant{
+			{
+				ID: "testtenant",
+				ContextSources: []cfg.ContextSourceConfig{
+					{
+						Endpoint:    staticEndpoint,
+						Information: []cfg.RegistrationInfo{{Entities: beaches}},
+					},
+					{
+						Endpoint:    observedEndpoint,
+						Information: []cfg.RegistrationInfo{{Entities: beaches, PropertyNames: []string{"temperature"}}},
+					},
+				},
+			},
+		},
+	}
+}
+
 func withEmptyConfig() cfg.Config {
 	return cfg.Config{}
 }
@@ -173,3 +824,25 @@ func testEntity(entityType, entityID string) types.Entity {
 	e, _ := entities.New(entityID, entityType)
 	return e
 }
+
+func deviceJSON(id string) string {
+	return `{"@context":["` + entities.DefaultContextURL + `"],"id":"urn:ngsi-ld:Device:` + id + `","type":"Device"}`
+}
+
+func beachJSON(attributes string) string {
+	return `{"id":"urn:ngsi-ld:Beach:01","type":"Beach",` + attributes + `,"@context":["https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonld"]}`
+}
+
+func consumptionJSON(id string) string {
+	return `{"@context":["` + entities.DefaultContextURL + `"],"id":"urn:ngsi-ld:WaterConsumptionObserved:` + id + `","type":"WaterConsumptionObserved"}`
+}
+
+type temporalParams struct{}
+
+func (temporalParams) IDs() ([]string, bool)            { return nil, false }
+func (temporalParams) Types() ([]string, bool)          { return nil, false }
+func (temporalParams) Attributes() ([]string, bool)     { return nil, false }
+func (temporalParams) TemporalRelation() (string, bool) { return "", false }
+func (temporalParams) TimeAt() (time.Time, bool)        { return time.Time{}, false }
+func (temporalParams) EndTimeAt() (time.Time, bool)     { return time.Time{}, false }
+func (temporalParams) LastN() (uint64, bool)            { return 0, false }
@@ -0,0 +1,125 @@
+package contextbroker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+)
+
+// newCredentials creates the provider of the credentials that should be presented to a
+// context source, or nil if the context source does not require any
+func newCredentials(cfg config.AuthConfig) (client.CredentialsProvider, error) {
+	if cfg.Type == "" {
+		return nil, nil
+	}
+
+	secret, err := readSecret(cfg.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Type {
+	case config.AuthTypeBearer:
+		return client.BearerToken(secret), nil
+	case config.AuthTypeAPIKey:
+		header := cfg.Header
+		if header == "" {
+			header = "X-API-Key"
+		}
+		return client.APIKey(header, secret), nil
+	case config.AuthTypeOAuth2:
+		if cfg.TokenURL == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("oauth2 requires both a token url and a client id")
+		}
+		return client.OAuth2ClientCredentials(cfg.TokenURL, cfg.ClientID, secret, cfg.Scope), nil
+	}
+
+	return nil, fmt.Errorf("unknown auth type %q", cfg.Type)
+}
+
+func readSecret(cfg config.SecretConfig) (string, error) {
+	if cfg.Env != "" {
+		secret, ok := os.LookupEnv(cfg.Env)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", cfg.Env)
+		}
+		return secret, nil
+	}
+
+	if cfg.File != "" {
+		contents, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %w", err)
+		}
+		return strings.TrimSpace(string(contents)), nil
+	}
+
+	return "", fmt.Errorf("no secret configured")
+}
+
+// newTLSConfig creates the TLS configuration for mutual TLS with a context source, or nil
+// if no client certificate or custom CA has been configured. The client certificate is read
+// from disk whenever a new connection is made, so that renewed certificates are picked up.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" && cfg.KeyFile == "" && cfg.CAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		_, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %s", cfg.CAFile)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// validateAuth makes sure that the credentials and certificates of a context source can be
+// loaded, so that a configuration with missing secrets is rejected up front
+func validateAuth(cfg config.AuthConfig) error {
+	_, err := newCredentials(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = newTLSConfig(cfg.TLS)
+	return err
+}
+
+// failingCredentials fails every request to a context source whose credentials could not be loaded
+type failingCredentials struct {
+	err error
+}
+
+func (f failingCredentials) Apply(context.Context, *http.Request) error { return f.err }
+func (f failingCredentials) Invalidate()                                {}
@@ -0,0 +1,62 @@
+package contextbroker
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/matryer/is"
+)
+
+func TestThatBearerTokenIsReadFromEnvironment(t *testing.T) {
+	is := is.New(t)
+	t.Setenv("CSOURCE_TOKEN", "s3cr3t")
+
+	credentials, err := newCredentials(config.AuthConfig{
+		Type:   config.AuthTypeBearer,
+		Secret: config.SecretConfig{Env: "CSOURCE_TOKEN"},
+	})
+	is.NoErr(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://source/ngsi-ld/v1/entities", nil)
+	is.NoErr(credentials.Apply(context.Background(), req))
+	is.Equal(req.Header.Get("Authorization"), "Bearer s3cr3t")
+}
+
+func TestThatAPIKeyIsReadFromFile(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "apikey")
+	is.NoErr(os.WriteFile(path, []byte("s3cr3t\n"), 0600))
+
+	credentials, err := newCredentials(config.AuthConfig{
+		Type:   config.AuthTypeAPIKey,
+		Secret: config.SecretConfig{File: path},
+	})
+	is.NoErr(err)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://source/ngsi-ld/v1/entities", nil)
+	is.NoErr(credentials.Apply(context.Background(), req))
+	is.Equal(req.Header.Get("X-API-Key"), "s3cr3t")
+}
+
+func TestThatRoutesWithMissingSecretsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	cfg := config.Config{Tenants: []config.Tenant{{
+		ID: "default",
+		ContextSources: []config.ContextSourceConfig{{
+			Endpoint: "http://source",
+			Auth: config.AuthConfig{
+				Type:   config.AuthTypeBearer,
+				Secret: config.SecretConfig{Env: "CSOURCE_TOKEN_THAT_IS_NOT_SET"},
+			},
+		}},
+	}}}
+
+	_, err := newRoutingTable(cfg, nil)
+	is.True(err != nil)
+}
@@ -0,0 +1,52 @@
+package contextbroker
+
+import (
+	"context"
+	"fmt"
+
+	subs "github.com/diwise/context-broker/internal/pkg/application/subscriptions"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+func (app *contextBrokerApp) QueryDeadLetters(ctx context.Context, tenant string) ([]subs.DeadLetter, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.notifier == nil {
+		return []subs.DeadLetter{}, nil
+	}
+
+	return app.notifier.DeadLetters(tenant), nil
+}
+
+func (app *contextBrokerApp) ReplayDeadLetters(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.notifier == nil {
+		if len(letterIDs) > 0 {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("no dead letter with id %s found", letterIDs[0]))
+		}
+
+		return &subs.ReplayResult{Replayed: []string{}, Failed: []string{}}, nil
+	}
+
+	return app.notifier.ReplayDeadLetters(ctx, tenant, letterIDs)
+}
+
+func (app *contextBrokerApp) DeleteDeadLetter(ctx context.Context, tenant, letterID string) error {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	if app.notifier == nil {
+		return errors.NewNotFoundError(fmt.Sprintf("no dead letter with id %s found", letterID))
+	}
+
+	return app.notifier.DiscardDeadLetter(tenant, letterID)
+}
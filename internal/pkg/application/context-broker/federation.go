@@ -0,0 +1,313 @@
+package contextbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+)
+
+// retrieveEntity retrieves an entity from the context source that provides it, or assembles
+// it from the attributes provided by several context sources
+func (app *contextBrokerApp) retrieveEntity(ctx context.Context, routes *tenantRoutes, entityID string, headers map[string][]string) (types.Entity, error) {
+	sources := routes.sourcesForEntity(entityID)
+
+	if len(sources) == 0 {
+		return nil, ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could provide entity %s", entityID))
+	}
+
+	if len(sources) == 1 && sources[0].attributes == nil {
+		cbClient := app.client(sources[0].source)
+		return cbClient.RetrieveEntity(ctx, entityID, headers)
+	}
+
+	found := make([]types.Entity, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+
+	for idx, es := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cbClient := app.client(es.source)
+			found[idx], errs[idx] = cbClient.RetrieveEntity(ctx, entityID, headers)
+
+			if errs[idx] == nil && es.attributes != nil {
+				found[idx] = entities.SelectAttributes(found[idx], es.provides)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// a source that does not know about the entity is not an error as long as
+	// any of the other sources are able to provide it
+	var notFound error
+
+	for idx, err := range errs {
+		if errors.Is(err, ngsierrors.ErrNotFound) {
+			notFound = err
+			continue
+		}
+
+		if err != nil {
+			return nil, errs[idx]
+		}
+	}
+
+	found = slices.DeleteFunc(found, func(e types.Entity) bool { return e == nil })
+	if len(found) == 0 {
+		return nil, notFound
+	}
+
+	return entities.Merge(found[0], found[1:]...), nil
+}
+
+// addAttributesFromOtherSources completes the entities of a query result with the attributes
+// that are provided by context sources that are registered for specific attributes only
+func (app *contextBrokerApp) addAttributesFromOtherSources(ctx context.Context, routes *tenantRoutes, result *ngsild.QueryEntitiesResult, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	sqr := collectQueryEntitiesResult(result, nil)
+
+	type attributeQuery struct {
+		source     *contextSource
+		ids        []string
+		types      []string
+		attributes []string
+		found      map[string]types.Entity
+		err        error
+	}
+
+	queries := []*attributeQuery{}
+	sourcesPerEntity := make([][]*entitySource, len(sqr.entities))
+
+	for idx, e := range sqr.entities {
+		sourcesPerEntity[idx] = routes.sourcesForEntity(e.ID())
+
+		for _, es := range sourcesPerEntity[idx] {
+			if es.attributes == nil {
+				continue
+			}
+
+			qidx := slices.IndexFunc(queries, func(q *attributeQuery) bool { return q.source == es.source })
+			if qidx == -1 {
+				queries = append(queries, &attributeQuery{source: es.source, found: map[string]types.Entity{}})
+				qidx = len(queries) - 1
+			}
+
+			q := queries[qidx]
+			q.ids = append(q.ids, e.ID())
+
+			if !slices.Contains(q.types, e.Type()) {
+				q.types = append(q.types, e.Type())
+			}
+
+			for _, attr := range es.attributes {
+				if !slices.Contains(q.attributes, attr) {
+					q.attributes = append(q.attributes, attr)
+				}
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, q := range queries {
+		queryValues := url.Values{}
+		queryValues.Set("type", strings.Join(q.types, ","))
+		queryValues.Set("id", strings.Join(q.ids, ","))
+		queryValues.Set("attrs", strings.Join(q.attributes, ","))
+		queryValues.Set("limit", strconv.Itoa(len(q.ids)))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cbClient := app.client(q.source)
+			r := collectQueryEntitiesResult(
+				cbClient.QueryEntities(ctx, q.types, q.attributes, "/ngsi-ld/v1/entities?"+queryValues.Encode(), headers),
+			)
+
+			q.err = r.err
+			for _, e := range r.entities {
+				q.found[e.ID()] = e
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, q := range queries {
+		if q.err != nil {
+			return nil, q.err
+		}
+	}
+
+	for idx, e := range sqr.entities {
+		parts := []types.Entity{}
+
+		for _, es := range sourcesPerEntity[idx] {
+			if es.attributes == nil {
+				continue
+			}
+
+			qidx := slices.IndexFunc(queries, func(q *attributeQuery) bool { return q.source == es.source })
+			if other, ok := queries[qidx].found[e.ID()]; ok {
+				parts = append(parts, entities.SelectAttributes(other, es.provides))
+			}
+		}
+
+		if len(parts) > 0 {
+			sqr.entities[idx] = entities.Merge(parts[0], append(parts[1:], e)...)
+		}
+	}
+
+	qer := ngsild.NewQueryEntitiesResult()
+	qer.TotalCount = result.TotalCount
+	qer.Count = result.Count
+	qer.Offset = result.Offset
+	qer.Limit = result.Limit
+	qer.PartialResult = result.PartialResult
+
+	go func() {
+		for _, e := range sqr.entities {
+			qer.Found <- e
+		}
+		qer.Found <- nil
+	}()
+
+	return qer, nil
+}
+
+// sourceFragment is the part of a fragment that should be written to a context source
+type sourceFragment struct {
+	source   *contextSource
+	fragment types.EntityFragment
+}
+
+// fragmentsPerSource splits a fragment so that each attribute is written to the context source
+// that provides it. The fragment is left as is if all of its attributes belong to one source.
+func (tr *tenantRoutes) fragmentsPerSource(entityID string, fragment types.EntityFragment) ([]sourceFragment, error) {
+	sources := tr.sourcesForEntity(entityID)
+	if len(sources) == 0 {
+		return nil, ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could update attributes for entity %s", entityID))
+	}
+
+	attributesPerSource := map[*contextSource][]string{}
+	var err error
+
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		src, ok := sourceForAttribute(sources, attributeName)
+		if !ok {
+			err = ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that could update attribute %s for entity %s", attributeName, entityID))
+			return
+		}
+
+		attributesPerSource[src] = append(attributesPerSource[src], attributeName)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attributesPerSource) <= 1 {
+		src, _ := tr.sourceForID(entityID)
+		for owner := range attributesPerSource {
+			src = owner
+		}
+
+		return []sourceFragment{{source: src, fragment: fragment}}, nil
+	}
+
+	fragments := []sourceFragment{}
+
+	for _, es := range sources {
+		attributes, ok := attributesPerSource[es.source]
+		if !ok {
+			continue
+		}
+
+		fragments = append(fragments, sourceFragment{
+			source: es.source,
+			fragment: entities.SelectFragmentAttributes(fragment, func(attributeName string) bool {
+				return slices.Contains(attributes, attributeName)
+			}),
+		})
+	}
+
+	return fragments, nil
+}
+
+// deleteEntityFromSources deletes an entity from every context source that provides any of its
+// attributes, so that none of them are left behind to show up in later reads. A source that only
+// provides some of the attributes need not hold anything for the entity, so the entity is only
+// reported as not found if none of the sources had it.
+func (app *contextBrokerApp) deleteEntityFromSources(ctx context.Context, sources []*entitySource, entityID string) (*ngsild.DeleteEntityResult, error) {
+	var result *ngsild.DeleteEntityResult
+	var notFound error
+
+	for _, es := range sources {
+		r, err := app.client(es.source).DeleteEntity(ctx, entityID)
+		if errors.Is(err, ngsierrors.ErrNotFound) {
+			notFound = err
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = r
+	}
+
+	if result == nil {
+		return nil, notFound
+	}
+
+	return result, nil
+}
+
+// sourceForEntityAttribute returns the context source that provides an attribute of an entity
+func (tr *tenantRoutes) sourceForEntityAttribute(entityID, attributeName string) (*contextSource, error) {
+	src, ok := sourceForAttribute(tr.sourcesForEntity(entityID), attributeName)
+	if !ok {
+		return nil, ngsierrors.NewNotFoundError(fmt.Sprintf("no context source found that provides attribute %s for entity %s", attributeName, entityID))
+	}
+
+	return src, nil
+}
+
+// attributeNames returns the names of the attributes of an entity or fragment
+func attributeNames(fragment types.EntityFragment) []string {
+	names := []string{}
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		names = append(names, attributeName)
+	})
+	return names
+}
+
+// resolveEntity retrieves an entity on behalf of the notifier. There is no request to forward
+// any headers from at that point, so the entity is retrieved using the credentials of the broker.
+func (app *contextBrokerApp) resolveEntity(ctx context.Context, tenant, entityID string) (types.Entity, error) {
+	routes, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	}
+
+	return app.retrieveEntity(ctx, routes, entityID, headers)
+}
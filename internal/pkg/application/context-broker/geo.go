@@ -0,0 +1,57 @@
+package contextbroker
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/diwise/context-broker/internal/pkg/application/spatial"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+// geoQuery is the area of interest of a geo-query, used to rule out context sources
+// whose registered area can not contain any matching entities
+type geoQuery struct {
+	geometry    *spatial.Geometry
+	maxDistance float64
+}
+
+// newGeoQuery parses the georel, geometry and coordinates query parameters. It returns nil
+// if there is no geo-query, or if it is a query that can match entities anywhere, such as
+// disjoint or near;minDistance.
+func newGeoQuery(queryValues url.Values) (*geoQuery, error) {
+	georel := queryValues.Get("georel")
+	if georel == "" {
+		return nil, nil
+	}
+
+	relation, _, err := spatial.ParseGeoRel(georel)
+	if err != nil {
+		return nil, errors.NewBadRequestDataError(err.Error())
+	}
+
+	if relation == spatial.GeoRelMinDistance || relation == spatial.GeoRelDisjoint {
+		return nil, nil
+	}
+
+	query, err := spatial.NewGeoQuery(georel, queryValues.Get("geometry"), json.RawMessage(queryValues.Get("coordinates")))
+	if err != nil {
+		return nil, errors.NewBadRequestDataError(err.Error())
+	}
+
+	gq := &geoQuery{geometry: query.Geometry}
+	if relation == spatial.GeoRelMaxDistance {
+		gq.maxDistance = query.Distance
+	}
+
+	return gq, nil
+}
+
+// mayMatch reports if entities in the area could match the query. Entities of context
+// sources without a registered area may be anywhere.
+func (gq *geoQuery) mayMatch(area *spatial.Geometry) bool {
+	if gq == nil || area == nil {
+		return true
+	}
+
+	return spatial.Distance(gq.geometry, area) <= gq.maxDistance
+}
@@ -0,0 +1,30 @@
+package contextbroker
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestNewGeoQuery(t *testing.T) {
+	is := is.New(t)
+
+	gq, err := newGeoQuery(url.Values{
+		"georel":      {"near;maxDistance==2000"},
+		"geometry":    {"Point"},
+		"coordinates": {"[17.3,62.39]"},
+	})
+	is.NoErr(err)
+	is.Equal(gq.maxDistance, 2000.0)
+
+	gq, err = newGeoQuery(url.Values{"georel": {"near;minDistance==2000"}})
+	is.NoErr(err)
+	is.True(gq == nil) // entities far away from a point may be anywhere
+
+	_, err = newGeoQuery(url.Values{"georel": {"within"}, "geometry": {"Polygon"}, "coordinates": {"[1,2]"}})
+	is.True(err != nil) // should reject invalid coordinates
+}
+
+var sundsvall = [][][]float64{{{17.2, 62.3}, {17.4, 62.3}, {17.4, 62.5}, {17.2, 62.5}, {17.2, 62.3}}}
+var timra = [][][]float64{{{17.2, 62.55}, {17.4, 62.55}, {17.4, 62.7}, {17.2, 62.7}, {17.2, 62.55}}}
@@ -0,0 +1,207 @@
+package contextbroker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	"github.com/google/uuid"
+)
+
+func (app *contextBrokerApp) RegisterContextSource(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if registration.ID == "" {
+		registration.ID = fmt.Sprintf("urn:ngsi-ld:%s:%s", registrations.RegistrationType, uuid.New().String())
+	}
+
+	if registration.Type == "" {
+		registration.Type = registrations.RegistrationType
+	}
+
+	err = validateRegistration(registration)
+	if err != nil {
+		return nil, err
+	}
+
+	all := app.registrations.All()
+	all[tenant] = append(all[tenant], registration)
+
+	routes, err := newRoutingTable(app.cfg, all)
+	if err != nil {
+		return nil, errors.NewBadRequestDataError(err.Error())
+	}
+
+	err = app.registrations.Create(tenant, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	app.storeRoutes(routes)
+
+	return ngsild.NewRegisterContextSourceResult("/ngsi-ld/v1/csourceRegistrations/" + url.PathEscape(registration.ID)), nil
+}
+
+func (app *contextBrokerApp) RetrieveContextSourceRegistration(ctx context.Context, tenant, registrationID string) (*registrations.ContextSourceRegistration, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.registrations.Get(tenant, registrationID)
+}
+
+// QueryContextSourceRegistrations returns the registrations that have been made at runtime and that
+// cover any of the entity types, or all of the tenant's registrations if no entity types are given.
+// Statically configured context sources are not part of the result.
+func (app *contextBrokerApp) QueryContextSourceRegistrations(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	result := app.registrations.List(tenant)
+
+	if len(entityTypes) > 0 {
+		result = slices.DeleteFunc(result, func(csr registrations.ContextSourceRegistration) bool {
+			return !slices.ContainsFunc(csr.EntityTypes(), func(t string) bool {
+				return slices.Contains(entityTypes, t)
+			})
+		})
+	}
+
+	return result, nil
+}
+
+func (app *contextBrokerApp) UpdateContextSourceRegistration(ctx context.Context, tenant, registrationID string, fragment registrations.ContextSourceRegistration) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	if fragment.ID != "" && fragment.ID != registrationID {
+		return errors.NewBadRequestDataError("the id of a registration can not be changed")
+	}
+
+	current, err := app.registrations.Get(tenant, registrationID)
+	if err != nil {
+		return err
+	}
+
+	updated := *current
+
+	if fragment.Endpoint != "" {
+		updated.Endpoint = fragment.Endpoint
+	}
+
+	if fragment.Tenant != "" {
+		updated.Tenant = fragment.Tenant
+	}
+
+	if len(fragment.Information) > 0 {
+		updated.Information = fragment.Information
+	}
+
+	if fragment.Location != nil {
+		updated.Location = fragment.Location
+	}
+
+	if len(fragment.Context) > 0 {
+		updated.Context = fragment.Context
+	}
+
+	err = validateRegistration(updated)
+	if err != nil {
+		return err
+	}
+
+	all := app.registrations.All()
+	idx := slices.IndexFunc(all[tenant], func(csr registrations.ContextSourceRegistration) bool {
+		return csr.ID == registrationID
+	})
+	all[tenant][idx] = updated
+
+	routes, err := newRoutingTable(app.cfg, all)
+	if err != nil {
+		return errors.NewBadRequestDataError(err.Error())
+	}
+
+	err = app.registrations.Update(tenant, updated)
+	if err != nil {
+		return err
+	}
+
+	app.storeRoutes(routes)
+
+	return nil
+}
+
+func (app *contextBrokerApp) DeleteContextSourceRegistration(ctx context.Context, tenant, registrationID string) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	err = app.registrations.Delete(tenant, registrationID)
+	if err != nil {
+		return err
+	}
+
+	routes, err := newRoutingTable(app.cfg, app.registrations.All())
+	if err != nil {
+		return err
+	}
+
+	app.storeRoutes(routes)
+
+	return nil
+}
+
+func validateRegistration(csr registrations.ContextSourceRegistration) error {
+	if csr.Type != registrations.RegistrationType {
+		return errors.NewBadRequestDataError(fmt.Sprintf("registration type must be %s", registrations.RegistrationType))
+	}
+
+	endpoint, err := url.Parse(csr.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return errors.NewBadRequestDataError(fmt.Sprintf("invalid endpoint %q", csr.Endpoint))
+	}
+
+	if len(csr.Information) == 0 {
+		return errors.NewBadRequestDataError("a registration must contain at least one information entry")
+	}
+
+	for _, info := range csr.Information {
+		if len(info.Entities) == 0 {
+			return errors.NewBadRequestDataError("information entries must contain at least one entity")
+		}
+
+		for _, e := range info.Entities {
+			if e.Type == "" {
+				return errors.NewBadRequestDataError("registered entities must have a type")
+			}
+
+			if e.ID != "" && e.IDPattern != "" {
+				return errors.NewBadRequestDataError("registered entities can not have both an id and an idPattern")
+			}
+		}
+	}
+
+	return nil
+}
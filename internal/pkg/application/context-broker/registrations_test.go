@@ -0,0 +1,120 @@
+package contextbroker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	testutils "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestThatRegisteredContextSourcesAreRoutedTo(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is, anyInput()),
+		Returns(
+			response.ContentType("application/ld+json"),
+			response.Location("testlocation"),
+			response.Code(http.StatusCreated),
+		),
+	)
+	defer s.Close()
+
+	config := withDefaultTestConfig("", "")
+	config.Storage.Path = t.TempDir()
+
+	broker, err := New(context.Background(), config)
+	is.NoErr(err)
+
+	_, err = broker.CreateEntity(context.Background(), "testtenant", testEntity("Sensor", "urn:ngsi-ld:Sensor:01"), nil)
+	is.True(err != nil) // should fail before the sensor source is registered
+
+	result, err := broker.RegisterContextSource(context.Background(), "testtenant", sensorRegistration(s.URL()))
+	is.NoErr(err)
+	is.True(result.Location() != "")
+
+	availableTypes, err := broker.RetrieveTypes(context.Background(), "testtenant", nil)
+	is.NoErr(err)
+	is.Equal(availableTypes, []string{"Device", "DeviceModel", "Sensor"})
+
+	_, err = broker.CreateEntity(context.Background(), "testtenant", testEntity("Sensor", "urn:ngsi-ld:Sensor:01"), nil)
+	is.NoErr(err)
+
+	// a new broker using the same storage should pick up the persisted registration
+	broker, err = New(context.Background(), config)
+	is.NoErr(err)
+
+	regs, err := broker.QueryContextSourceRegistrations(context.Background(), "testtenant", []string{"Sensor"})
+	is.NoErr(err)
+	is.Equal(len(regs), 1)
+	is.Equal(regs[0].Endpoint, s.URL())
+
+	err = broker.DeleteContextSourceRegistration(context.Background(), "testtenant", regs[0].ID)
+	is.NoErr(err)
+
+	_, err = broker.CreateEntity(context.Background(), "testtenant", testEntity("Sensor", "urn:ngsi-ld:Sensor:01"), nil)
+	is.True(err != nil) // should fail after the sensor source has been deleted
+}
+
+func TestThatInvalidRegistrationsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	broker, err := New(context.Background(), withDefaultTestConfig("", ""))
+	is.NoErr(err)
+
+	reg := sensorRegistration("not a url")
+	_, err = broker.RegisterContextSource(context.Background(), "testtenant", reg)
+	is.True(err != nil) // should reject an invalid endpoint
+
+	reg = sensorRegistration("http://sensors:8080")
+	reg.Information[0].Entities[0].IDPattern = "^urn:ngsi-ld:Sensor:(.+"
+	_, err = broker.RegisterContextSource(context.Background(), "testtenant", reg)
+	is.True(err != nil) // should reject an invalid id pattern
+
+	_, err = broker.RegisterContextSource(context.Background(), "unknown", sensorRegistration("http://sensors:8080"))
+	is.True(err != nil) // should reject an unknown tenant
+
+	regs, err := broker.QueryContextSourceRegistrations(context.Background(), "testtenant", nil)
+	is.NoErr(err)
+	is.Equal(len(regs), 0)
+}
+
+func TestThatTheLocationOfARegistrationCanBeUpdated(t *testing.T) {
+	is := is.New(t)
+
+	broker, err := New(context.Background(), withDefaultTestConfig("", ""))
+	is.NoErr(err)
+
+	result, err := broker.RegisterContextSource(context.Background(), "testtenant", sensorRegistration("http://sensors:8080"))
+	is.NoErr(err)
+
+	registrationID := result.Location()[strings.LastIndex(result.Location(), "/")+1:]
+
+	location := &registrations.Geometry{
+		Type:        "Polygon",
+		Coordinates: json.RawMessage(`[[[17.0,62.0],[18.0,62.0],[18.0,63.0],[17.0,63.0],[17.0,62.0]]]`),
+	}
+
+	err = broker.UpdateContextSourceRegistration(context.Background(), "testtenant", registrationID, registrations.ContextSourceRegistration{Location: location})
+	is.NoErr(err)
+
+	updated, err := broker.RetrieveContextSourceRegistration(context.Background(), "testtenant", registrationID)
+	is.NoErr(err)
+	is.Equal(updated.Location, location)
+	is.Equal(updated.Endpoint, "http://sensors:8080") // should leave the attributes that were not patched as they were
+}
+
+func sensorRegistration(endpoint string) registrations.ContextSourceRegistration {
+	return registrations.ContextSourceRegistration{
+		Information: []registrations.RegistrationInfo{
+			{Entities: []registrations.EntityInfo{{IDPattern: "^urn:ngsi-ld:Sensor:.+", Type: "Sensor"}}},
+		},
+		Endpoint: endpoint,
+	}
+}
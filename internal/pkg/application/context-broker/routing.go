@@ -0,0 +1,518 @@
+package contextbroker
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/diwise/context-broker/internal/pkg/application/spatial"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+)
+
+// contextSource wraps a configured context source so that registrations can refer back to it
+type contextSource struct {
+	config.ContextSourceConfig
+}
+
+// registration is a single entity registration of a context source with a precompiled id pattern
+type registration struct {
+	index      int
+	source     *contextSource
+	entityType string
+	idPattern  *regexp.Regexp
+
+	// attributes holds the names of the attributes that the context source provides, or
+	// nil if the context source provides all attributes of the registered entities
+	attributes []string
+	// area is the area that the registered entities are located in, or nil if unknown
+	area *spatial.Geometry
+}
+
+func (r *registration) matchesID(entityID string) bool {
+	return r.idPattern.MatchString(entityID)
+}
+
+func (r *registration) providesAllAttributes() bool {
+	return r.attributes == nil
+}
+
+// routingTable holds the compiled routes of all configured tenants
+type routingTable map[string]*tenantRoutes
+
+// tenantRoutes is an index over the registrations of a single tenant, built once so that
+// requests do not have to walk and compile the configured registrations over and over again
+type tenantRoutes struct {
+	sources       []*contextSource
+	registrations []*registration
+	byType        map[string][]*registration
+
+	// registrations with an anchored literal prefix, such as ^urn:ngsi-ld:Device:.+, are
+	// indexed in a trie so that only a handful of candidates need to be matched by regexp
+	prefixes   *prefixTrie
+	unprefixed []*registration
+}
+
+// newRoutingTable compiles the routes of all configured tenants. Context sources that have
+// been registered at runtime are routed to after the ones that are statically configured.
+func newRoutingTable(cfg config.Config, registered map[string][]registrations.ContextSourceRegistration) (routingTable, error) {
+	rt := routingTable{}
+
+	for _, tenant := range cfg.Tenants {
+		sources := slices.Clone(tenant.ContextSources)
+		for _, csr := range registered[tenant.ID] {
+			sources = append(sources, sourceConfigFromRegistration(csr))
+		}
+
+		tr, err := newTenantRoutes(sources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create routes for tenant %s: %w", tenant.ID, err)
+		}
+
+		rt[tenant.ID] = tr
+	}
+
+	return rt, nil
+}
+
+// sourceConfigFromRegistration converts a context source registration to the same form as
+// a configured context source. Registrations of a specific entity id are turned into an
+// id pattern that only matches that id, and the location of the registration applies to all
+// of its information entries.
+func sourceConfigFromRegistration(csr registrations.ContextSourceRegistration) config.ContextSourceConfig {
+	srcCfg := config.ContextSourceConfig{
+		Endpoint:    csr.Endpoint,
+		Tenant:      csr.Tenant,
+		Information: make([]config.RegistrationInfo, 0, len(csr.Information)),
+	}
+
+	for _, info := range csr.Information {
+		regInfo := config.RegistrationInfo{
+			Entities:          make([]config.EntityInfo, 0, len(info.Entities)),
+			PropertyNames:     info.PropertyNames,
+			RelationshipNames: info.RelationshipNames,
+		}
+
+		if csr.Location != nil {
+			regInfo.Location = &config.Geometry{Type: csr.Location.Type, Coordinates: csr.Location.Coordinates}
+		}
+
+		for _, e := range info.Entities {
+			idPattern := e.IDPattern
+			if e.ID != "" {
+				idPattern = "^" + regexp.QuoteMeta(e.ID) + "$"
+			}
+
+			regInfo.Entities = append(regInfo.Entities, config.EntityInfo{IDPattern: idPattern, Type: e.Type})
+		}
+
+		srcCfg.Information = append(srcCfg.Information, regInfo)
+	}
+
+	return srcCfg
+}
+
+func newTenantRoutes(sources []config.ContextSourceConfig) (*tenantRoutes, error) {
+	tr := &tenantRoutes{
+		sources:       make([]*contextSource, 0, len(sources)),
+		registrations: []*registration{},
+		byType:        map[string][]*registration{},
+		prefixes:      newPrefixTrie(),
+		unprefixed:    []*registration{},
+	}
+
+	for _, srcCfg := range sources {
+		src := &contextSource{ContextSourceConfig: srcCfg}
+		tr.sources = append(tr.sources, src)
+
+		err := validateAuth(src.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth configuration for %s: %w", src.Endpoint, err)
+		}
+
+		for _, reginfo := range src.Information {
+			var attributes []string
+			if len(reginfo.PropertyNames) > 0 || len(reginfo.RelationshipNames) > 0 {
+				attributes = slices.Concat(reginfo.PropertyNames, reginfo.RelationshipNames)
+			}
+
+			area, err := areaOf(reginfo.Location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid location at %s: %w", src.Endpoint, err)
+			}
+
+			for _, entityInfo := range reginfo.Entities {
+				regexpForID, err := regexp.CompilePOSIX(entityInfo.IDPattern)
+				if err != nil {
+					return nil, fmt.Errorf("invalid idPattern %q for type %s at %s: %w", entityInfo.IDPattern, entityInfo.Type, src.Endpoint, err)
+				}
+
+				reg := &registration{
+					index:      len(tr.registrations),
+					source:     src,
+					entityType: entityInfo.Type,
+					idPattern:  regexpForID,
+					attributes: attributes,
+					area:       area,
+				}
+
+				tr.registrations = append(tr.registrations, reg)
+				tr.byType[reg.entityType] = append(tr.byType[reg.entityType], reg)
+
+				if prefix := anchoredLiteralPrefix(entityInfo.IDPattern); prefix != "" {
+					tr.prefixes.insert(prefix, reg)
+				} else {
+					tr.unprefixed = append(tr.unprefixed, reg)
+				}
+			}
+		}
+	}
+
+	return tr, nil
+}
+
+func areaOf(location *config.Geometry) (*spatial.Geometry, error) {
+	if location == nil {
+		return nil, nil
+	}
+
+	if location.Type != "Polygon" && location.Type != "MultiPolygon" {
+		return nil, fmt.Errorf("location must be a Polygon or a MultiPolygon")
+	}
+
+	return spatial.NewGeometry(location.Type, location.Coordinates)
+}
+
+func (rt routingTable) tenant(tenant string) (*tenantRoutes, error) {
+	tr, ok := rt[tenant]
+	if !ok {
+		return nil, errors.NewUnknownTenantError(tenant)
+	}
+
+	return tr, nil
+}
+
+// registrationsForID returns all registrations whose id pattern matches the entity id, in configuration order
+func (tr *tenantRoutes) registrationsForID(entityID string) []*registration {
+	candidates := tr.prefixes.collect(entityID, slices.Clone(tr.unprefixed))
+	slices.SortFunc(candidates, func(a, b *registration) int { return a.index - b.index })
+
+	return slices.DeleteFunc(candidates, func(r *registration) bool {
+		return !r.matchesID(entityID)
+	})
+}
+
+// sourceForID returns the first context source with a registration that matches the entity
+// id and provides all of its attributes. If there is no such registration, the source of the
+// first registration that provides some of the attributes is returned instead.
+func (tr *tenantRoutes) sourceForID(entityID string) (*contextSource, bool) {
+	regs := tr.registrationsForID(entityID)
+	if len(regs) == 0 {
+		return nil, false
+	}
+
+	idx := slices.IndexFunc(regs, (*registration).providesAllAttributes)
+
+	return regs[max(idx, 0)].source, true
+}
+
+// sourceForNewEntity returns the context source that new entities with the id and type are
+// created in, which is the first one that provides all of the attributes of such entities
+func (tr *tenantRoutes) sourceForNewEntity(entityID, entityType string) (*contextSource, bool) {
+	for _, reg := range tr.registrationsForID(entityID) {
+		if reg.entityType == entityType && reg.providesAllAttributes() {
+			return reg.source, true
+		}
+	}
+
+	return nil, false
+}
+
+// entitySource is a context source that provides some, or all, of the attributes of an entity
+type entitySource struct {
+	source *contextSource
+	// attributes is nil if the source provides all attributes of the entity
+	attributes []string
+}
+
+func (es *entitySource) provides(attributeName string) bool {
+	return es.attributes == nil || slices.Contains(es.attributes, attributeName)
+}
+
+// sourcesForEntity returns the context sources that together provide the attributes of an
+// entity. Sources that are registered for specific attributes come first, in configuration
+// order, followed by the first source that provides all of the attributes, if there is one.
+func (tr *tenantRoutes) sourcesForEntity(entityID string) []*entitySource {
+	sources := []*entitySource{}
+	var owner *contextSource
+
+	for _, reg := range tr.registrationsForID(entityID) {
+		if reg.providesAllAttributes() {
+			if owner == nil {
+				owner = reg.source
+			}
+			continue
+		}
+
+		idx := slices.IndexFunc(sources, func(es *entitySource) bool { return es.source == reg.source })
+		if idx == -1 {
+			sources = append(sources, &entitySource{source: reg.source, attributes: []string{}})
+			idx = len(sources) - 1
+		}
+
+		for _, attr := range reg.attributes {
+			if !slices.Contains(sources[idx].attributes, attr) {
+				sources[idx].attributes = append(sources[idx].attributes, attr)
+			}
+		}
+	}
+
+	if owner != nil {
+		// the owner provides all attributes anyway, so there is no need to ask it twice
+		sources = slices.DeleteFunc(sources, func(es *entitySource) bool { return es.source == owner })
+		sources = append(sources, &entitySource{source: owner})
+	}
+
+	return sources
+}
+
+// sourceForAttribute returns the source that should receive writes to an attribute of an
+// entity, i.e. the first source that is registered for the attribute, or the source that
+// provides all attributes of the entity
+func sourceForAttribute(sources []*entitySource, attributeName string) (*contextSource, bool) {
+	for _, es := range sources {
+		if es.provides(attributeName) {
+			return es.source, true
+		}
+	}
+
+	return nil, false
+}
+
+// sourcesForTypes returns the context sources that have registrations for any of the
+// entity types, along with the subset of the types that each source is registered for.
+// Registrations of specific attributes are only included for types that lack a registration
+// that provides all attributes, and registrations outside the area of a geo-query are skipped.
+func (tr *tenantRoutes) sourcesForTypes(entityTypes []string, geo *geoQuery) ([]*contextSource, [][]string) {
+	matchingRegistrations := []*registration{}
+
+	for _, entityType := range entityTypes {
+		regs := tr.byType[entityType]
+		if slices.ContainsFunc(regs, (*registration).providesAllAttributes) {
+			regs = slices.DeleteFunc(slices.Clone(regs), func(r *registration) bool { return !r.providesAllAttributes() })
+		}
+
+		for _, reg := range regs {
+			if geo.mayMatch(reg.area) {
+				matchingRegistrations = append(matchingRegistrations, reg)
+			}
+		}
+	}
+
+	slices.SortFunc(matchingRegistrations, func(a, b *registration) int { return a.index - b.index })
+
+	sources := []*contextSource{}
+	typesPerSource := [][]string{}
+
+	for _, reg := range matchingRegistrations {
+		idx := slices.Index(sources, reg.source)
+		if idx == -1 {
+			sources = append(sources, reg.source)
+			typesPerSource = append(typesPerSource, []string{})
+			idx = len(sources) - 1
+		}
+
+		if !slices.Contains(typesPerSource[idx], reg.entityType) {
+			typesPerSource[idx] = append(typesPerSource[idx], reg.entityType)
+		}
+	}
+
+	return sources, typesPerSource
+}
+
+// sourceQuery is the part of a query that should be sent to a single context source
+type sourceQuery struct {
+	source *contextSource
+	types  []string
+	ids    []string
+}
+
+// restrict returns a copy of the query parameters that only asks for the types and ids of the source query
+func (sq *sourceQuery) restrict(queryValues url.Values) url.Values {
+	restricted := maps.Clone(queryValues)
+
+	if len(sq.types) > 0 {
+		restricted.Set("type", strings.Join(sq.types, ","))
+	}
+
+	if len(sq.ids) > 0 {
+		restricted.Set("id", strings.Join(sq.ids, ","))
+	}
+
+	return restricted
+}
+
+// addSourceQuery adds the type of the registration to the query of its source, adding
+// a query for the source if there is none yet
+func addSourceQuery(queries []*sourceQuery, reg *registration) ([]*sourceQuery, *sourceQuery) {
+	idx := slices.IndexFunc(queries, func(sq *sourceQuery) bool { return sq.source == reg.source })
+	if idx == -1 {
+		queries = append(queries, &sourceQuery{source: reg.source})
+		idx = len(queries) - 1
+	}
+
+	sq := queries[idx]
+	if !slices.Contains(sq.types, reg.entityType) {
+		sq.types = append(sq.types, reg.entityType)
+	}
+
+	return queries, sq
+}
+
+// sourcesForIDs groups the entity ids per context source that provides them, preferring
+// registrations that provide all attributes just like sourceForID
+func (tr *tenantRoutes) sourcesForIDs(entityIDs []string) []*sourceQuery {
+	queries := []*sourceQuery{}
+
+	for _, entityID := range entityIDs {
+		regs := tr.registrationsForID(entityID)
+		if len(regs) == 0 {
+			continue
+		}
+
+		reg := regs[max(slices.IndexFunc(regs, (*registration).providesAllAttributes), 0)]
+
+		var sq *sourceQuery
+		queries, sq = addSourceQuery(queries, reg)
+
+		if !slices.Contains(sq.ids, entityID) {
+			sq.ids = append(sq.ids, entityID)
+		}
+	}
+
+	return queries
+}
+
+// sourcesForIDPattern returns the context sources with registrations that could match the
+// same ids as the pattern. As patterns can not be compared in general, registrations are
+// only ruled out if their ids and the pattern must start with different literal prefixes,
+// or if they are outside the area of a geo-query.
+func (tr *tenantRoutes) sourcesForIDPattern(idPattern string, geo *geoQuery) []*sourceQuery {
+	queries := []*sourceQuery{}
+	prefix := anchoredLiteralPrefix(idPattern)
+
+	for _, reg := range tr.registrations {
+		if !reg.providesAllAttributes() || !geo.mayMatch(reg.area) {
+			continue
+		}
+
+		regPrefix := anchoredLiteralPrefix(reg.idPattern.String())
+		if !strings.HasPrefix(prefix, regPrefix) && !strings.HasPrefix(regPrefix, prefix) {
+			continue
+		}
+
+		queries, _ = addSourceQuery(queries, reg)
+	}
+
+	return queries
+}
+
+// hasAttributeSourcesForTypes reports if any of the entity types have registrations for
+// specific attributes, besides a registration that provides all of their attributes
+func (tr *tenantRoutes) hasAttributeSourcesForTypes(entityTypes []string) bool {
+	for _, entityType := range entityTypes {
+		regs := tr.byType[entityType]
+		if slices.ContainsFunc(regs, (*registration).providesAllAttributes) &&
+			slices.ContainsFunc(regs, func(r *registration) bool { return !r.providesAllAttributes() }) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// types returns a sorted list of all entity types registered for the tenant
+func (tr *tenantRoutes) types() []string {
+	typeList := make([]string, 0, len(tr.byType))
+
+	for k := range tr.byType {
+		typeList = append(typeList, k)
+	}
+
+	sort.Strings(typeList)
+
+	return typeList
+}
+
+// anchoredLiteralPrefix returns the literal string that any id matching the pattern
+// must start with, or an empty string if the pattern is not anchored by such a literal
+func anchoredLiteralPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.POSIX)
+	if err != nil {
+		return ""
+	}
+
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return ""
+	}
+
+	if re.Sub[0].Op != syntax.OpBeginLine && re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+
+	literal := re.Sub[1]
+	if literal.Op != syntax.OpLiteral || literal.Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+
+	return string(literal.Rune)
+}
+
+type prefixTrie struct {
+	children      map[byte]*prefixTrie
+	registrations []*registration
+}
+
+func newPrefixTrie() *prefixTrie {
+	return &prefixTrie{children: map[byte]*prefixTrie{}}
+}
+
+func (t *prefixTrie) insert(prefix string, reg *registration) {
+	node := t
+
+	for i := 0; i < len(prefix); i++ {
+		child, ok := node.children[prefix[i]]
+		if !ok {
+			child = newPrefixTrie()
+			node.children[prefix[i]] = child
+		}
+		node = child
+	}
+
+	node.registrations = append(node.registrations, reg)
+}
+
+// collect appends the registrations of every prefix in the trie that the key starts with
+func (t *prefixTrie) collect(key string, found []*registration) []*registration {
+	node := t
+
+	for i := 0; i < len(key); i++ {
+		found = append(found, node.registrations...)
+
+		child, ok := node.children[key[i]]
+		if !ok {
+			return found
+		}
+		node = child
+	}
+
+	return append(found, node.registrations...)
+}
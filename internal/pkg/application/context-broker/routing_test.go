@@ -0,0 +1,86 @@
+package contextbroker
+
+import (
+	"context"
+	"testing"
+
+	cfg "github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/matryer/is"
+)
+
+func TestThatNewFailsOnInvalidIDPattern(t *testing.T) {
+	is := is.New(t)
+
+	config := withDefaultTestConfig("", "")
+	config.Tenants[0].ContextSources[0].Information[0].Entities[0].IDPattern = "^urn:ngsi-ld:Device:(.+"
+
+	_, err := New(context.Background(), config)
+	is.True(err != nil) // should have rejected the invalid pattern
+}
+
+func TestAnchoredLiteralPrefix(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(anchoredLiteralPrefix("^urn:ngsi-ld:Device:.+"), "urn:ngsi-ld:Device:")
+	is.Equal(anchoredLiteralPrefix("^urn:ngsi-ld:(Device|Sensor):.+"), "urn:ngsi-ld:")
+	is.Equal(anchoredLiteralPrefix("urn:ngsi-ld:Device:.+"), "")
+	is.Equal(anchoredLiteralPrefix("^a|b"), "")
+	is.Equal(anchoredLiteralPrefix(".*"), "")
+}
+
+func TestThatRegistrationsForIDAreReturnedInConfigurationOrder(t *testing.T) {
+	is := is.New(t)
+
+	routes, err := newTenantRoutes([]cfg.ContextSourceConfig{
+		{
+			Endpoint: "first",
+			Information: []cfg.RegistrationInfo{{Entities: []cfg.EntityInfo{
+				{IDPattern: "^urn:ngsi-ld:DeviceModel:.+", Type: "DeviceModel"},
+				{IDPattern: "Device", Type: "Anything"},
+			}}},
+		},
+		{
+			Endpoint: "second",
+			Information: []cfg.RegistrationInfo{{Entities: []cfg.EntityInfo{
+				{IDPattern: "^urn:ngsi-ld:Device:.+", Type: "Device"},
+				{IDPattern: "^urn:ngsi-ld:.+", Type: "Any"},
+			}}},
+		},
+	})
+	is.NoErr(err)
+
+	regs := routes.registrationsForID("urn:ngsi-ld:Device:01")
+	is.Equal(len(regs), 3)
+	is.Equal(regs[0].entityType, "Anything")
+	is.Equal(regs[1].entityType, "Device")
+	is.Equal(regs[2].entityType, "Any")
+
+	regs = routes.registrationsForID("urn:ngsi-ld:DeviceModel:01")
+	is.Equal(len(regs), 3)
+	is.Equal(regs[0].entityType, "DeviceModel")
+
+	regs = routes.registrationsForID("urn:x:Sensor:01")
+	is.Equal(len(regs), 0)
+}
+
+func TestThatSourcesForEntityPutsAttributeSourcesFirst(t *testing.T) {
+	is := is.New(t)
+
+	routes, err := newTenantRoutes(withBeachSources("static", "observed").Tenants[0].ContextSources)
+	is.NoErr(err)
+
+	sources := routes.sourcesForEntity("urn:ngsi-ld:Beach:01")
+	is.Equal(len(sources), 2)
+	is.Equal(sources[0].source.Endpoint, "observed")
+	is.Equal(sources[0].attributes, []string{"temperature"})
+	is.Equal(sources[1].source.Endpoint, "static")
+	is.True(sources[1].attributes == nil) // should provide all attributes
+
+	src, _ := sourceForAttribute(sources, "temperature")
+	is.Equal(src.Endpoint, "observed")
+	src, _ = sourceForAttribute(sources, "name")
+	is.Equal(src.Endpoint, "static")
+
+	src, _ = routes.sourceForID("urn:ngsi-ld:Beach:01")
+	is.Equal(src.Endpoint, "static") // should prefer the source that provides all attributes
+}
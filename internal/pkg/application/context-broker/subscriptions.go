@@ -0,0 +1,177 @@
+package contextbroker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+	"github.com/google/uuid"
+)
+
+func (app *contextBrokerApp) CreateSubscription(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.ID == "" {
+		subscription.ID = fmt.Sprintf("urn:ngsi-ld:%s:%s", subscriptions.SubscriptionType, uuid.New().String())
+	}
+
+	if subscription.Type == "" {
+		subscription.Type = subscriptions.SubscriptionType
+	}
+
+	err = validateSubscription(subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.subscriptions.Create(tenant, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	return ngsild.NewCreateSubscriptionResult("/ngsi-ld/v1/subscriptions/" + url.PathEscape(subscription.ID)), nil
+}
+
+func (app *contextBrokerApp) RetrieveSubscription(ctx context.Context, tenant, subscriptionID string) (*subscriptions.Subscription, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.subscriptions.Get(tenant, subscriptionID)
+}
+
+// QuerySubscriptions returns the subscriptions that have been made at runtime. Notification
+// endpoints from the configuration are not part of the result.
+func (app *contextBrokerApp) QuerySubscriptions(ctx context.Context, tenant string) ([]subscriptions.Subscription, error) {
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.subscriptions.List(tenant), nil
+}
+
+func (app *contextBrokerApp) UpdateSubscription(ctx context.Context, tenant, subscriptionID string, fragment subscriptions.Subscription) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	if fragment.ID != "" && fragment.ID != subscriptionID {
+		return errors.NewBadRequestDataError("the id of a subscription can not be changed")
+	}
+
+	current, err := app.subscriptions.Get(tenant, subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	updated := *current
+
+	if fragment.Description != "" {
+		updated.Description = fragment.Description
+	}
+
+	if len(fragment.Entities) > 0 {
+		updated.Entities = fragment.Entities
+	}
+
+	if len(fragment.WatchedAttributes) > 0 {
+		updated.WatchedAttributes = fragment.WatchedAttributes
+	}
+
+	if fragment.Q != "" {
+		updated.Q = fragment.Q
+	}
+
+	if fragment.GeoQ != nil {
+		updated.GeoQ = fragment.GeoQ
+	}
+
+	if len(fragment.Notification.Attributes) > 0 {
+		updated.Notification.Attributes = fragment.Notification.Attributes
+	}
+
+	if fragment.Notification.Format != "" {
+		updated.Notification.Format = fragment.Notification.Format
+	}
+
+	if fragment.Notification.Endpoint.URI != "" {
+		updated.Notification.Endpoint = fragment.Notification.Endpoint
+	}
+
+	if fragment.IsActive != nil {
+		updated.IsActive = fragment.IsActive
+	}
+
+	if len(fragment.Context) > 0 {
+		updated.Context = fragment.Context
+	}
+
+	err = validateSubscription(updated)
+	if err != nil {
+		return err
+	}
+
+	return app.subscriptions.Update(tenant, updated)
+}
+
+func (app *contextBrokerApp) DeleteSubscription(ctx context.Context, tenant, subscriptionID string) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	_, err := app.routes.Load().tenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	return app.subscriptions.Delete(tenant, subscriptionID)
+}
+
+func validateSubscription(s subscriptions.Subscription) error {
+	if s.Type != subscriptions.SubscriptionType {
+		return errors.NewBadRequestDataError(fmt.Sprintf("subscription type must be %s", subscriptions.SubscriptionType))
+	}
+
+	endpoint, err := url.Parse(s.Notification.Endpoint.URI)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return errors.NewBadRequestDataError(fmt.Sprintf("invalid notification endpoint %q", s.Notification.Endpoint.URI))
+	}
+
+	if f := s.Notification.Format; f != "" && f != subscriptions.FormatNormalized && f != subscriptions.FormatKeyValues {
+		return errors.NewBadRequestDataError(fmt.Sprintf("unsupported notification format %q", f))
+	}
+
+	if a := s.Notification.Endpoint.Accept; a != "" && a != "application/json" && a != "application/ld+json" {
+		return errors.NewBadRequestDataError(fmt.Sprintf("unsupported notification endpoint accept %q", a))
+	}
+
+	if len(s.Entities) == 0 && len(s.WatchedAttributes) == 0 {
+		return errors.NewBadRequestDataError("a subscription must contain at least one entity or watched attribute")
+	}
+
+	for _, e := range s.Entities {
+		if e.Type == "" {
+			return errors.NewBadRequestDataError("subscribed entities must have a type")
+		}
+
+		if e.ID != "" && e.IDPattern != "" {
+			return errors.NewBadRequestDataError("subscribed entities can not have both an id and an idPattern")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package contextbroker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+	"github.com/matryer/is"
+)
+
+func TestThatSubscriptionsArePersisted(t *testing.T) {
+	is := is.New(t)
+
+	config := withDefaultTestConfig("", "")
+	config.Storage.Path = t.TempDir()
+
+	broker, err := New(context.Background(), config)
+	is.NoErr(err)
+
+	result, err := broker.CreateSubscription(context.Background(), "testtenant", deviceSubscription("http://receiver:8080"))
+	is.NoErr(err)
+	is.True(result.Location() != "")
+
+	// a new broker using the same storage should pick up the persisted subscription
+	broker, err = New(context.Background(), config)
+	is.NoErr(err)
+
+	subs, err := broker.QuerySubscriptions(context.Background(), "testtenant")
+	is.NoErr(err)
+	is.Equal(len(subs), 1)
+	is.Equal(subs[0].Type, subscriptions.SubscriptionType)
+
+	inactive := false
+	err = broker.UpdateSubscription(context.Background(), "testtenant", subs[0].ID, subscriptions.Subscription{IsActive: &inactive})
+	is.NoErr(err)
+
+	sub, err := broker.RetrieveSubscription(context.Background(), "testtenant", subs[0].ID)
+	is.NoErr(err)
+	is.True(!sub.Active())
+	is.Equal(sub.Notification.Endpoint.URI, "http://receiver:8080") // should be left as it was
+
+	err = broker.DeleteSubscription(context.Background(), "testtenant", subs[0].ID)
+	is.NoErr(err)
+
+	_, err = broker.RetrieveSubscription(context.Background(), "testtenant", subs[0].ID)
+	is.True(err != nil)
+}
+
+func TestThatInvalidSubscriptionsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	broker, err := New(context.Background(), withDefaultTestConfig("", ""))
+	is.NoErr(err)
+
+	_, err = broker.CreateSubscription(context.Background(), "testtenant", deviceSubscription("not a url"))
+	is.True(err != nil) // should reject an invalid endpoint
+
+	sub := deviceSubscription("http://receiver:8080")
+	sub.Entities = nil
+	_, err = broker.CreateSubscription(context.Background(), "testtenant", sub)
+	is.True(err != nil) // should reject a subscription without entities or watched attributes
+
+	sub = deviceSubscription("http://receiver:8080")
+	sub.Q = "temperature>"
+	_, err = broker.CreateSubscription(context.Background(), "testtenant", sub)
+	is.True(err != nil) // should reject an invalid q expression
+
+	sub = deviceSubscription("http://receiver:8080")
+	sub.Notification.Endpoint.Accept = "application/geo+json"
+	_, err = broker.CreateSubscription(context.Background(), "testtenant", sub)
+	is.True(err != nil) // should reject a content type that notifications are not sent as
+
+	_, err = broker.CreateSubscription(context.Background(), "unknown", deviceSubscription("http://receiver:8080"))
+	is.True(err != nil) // should reject an unknown tenant
+
+	subs, err := broker.QuerySubscriptions(context.Background(), "testtenant")
+	is.NoErr(err)
+	is.Equal(len(subs), 0)
+}
+
+func deviceSubscription(endpoint string) subscriptions.Subscription {
+	return subscriptions.Subscription{
+		Entities: []subscriptions.EntityInfo{{Type: "Device"}},
+		Notification: subscriptions.NotificationParams{
+			Endpoint: subscriptions.Endpoint{URI: endpoint},
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package registrations
+
+import (
+	"github.com/diwise/context-broker/internal/pkg/application/store"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+)
+
+// Store keeps track of the context source registrations of each tenant
+type Store interface {
+	All() map[string][]registrations.ContextSourceRegistration
+	List(tenant string) []registrations.ContextSourceRegistration
+	Get(tenant, registrationID string) (*registrations.ContextSourceRegistration, error)
+
+	Create(tenant string, registration registrations.ContextSourceRegistration) error
+	Update(tenant string, registration registrations.ContextSourceRegistration) error
+	Delete(tenant, registrationID string) error
+}
+
+// NewStore creates a registration store that is persisted to the file at filePath. Any
+// registrations already present in the file are loaded. If filePath is empty, the store
+// will only be kept in memory.
+func NewStore(filePath string) (Store, error) {
+	return store.New(filePath, "registration", func(r registrations.ContextSourceRegistration) string {
+		return r.ID
+	})
+}
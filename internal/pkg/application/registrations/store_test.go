@@ -0,0 +1,43 @@
+package registrations
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	"github.com/matryer/is"
+)
+
+func TestThatRegistrationsArePersisted(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "registrations.json")
+
+	s, err := NewStore(filePath)
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", registrations.ContextSourceRegistration{ID: "first", Endpoint: "http://first"}))
+	is.NoErr(s.Create("default", registrations.ContextSourceRegistration{ID: "second", Endpoint: "http://second"}))
+	is.NoErr(s.Update("default", registrations.ContextSourceRegistration{ID: "first", Endpoint: "http://updated"}))
+	is.NoErr(s.Delete("default", "second"))
+
+	s, err = NewStore(filePath)
+	is.NoErr(err)
+
+	regs := s.List("default")
+	is.Equal(len(regs), 1)
+	is.Equal(regs[0].Endpoint, "http://updated")
+}
+
+func TestThatDuplicateRegistrationsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	s, err := NewStore("")
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", registrations.ContextSourceRegistration{ID: "first"}))
+	is.True(s.Create("default", registrations.ContextSourceRegistration{ID: "first"}) != nil)
+
+	_, err = s.Get("other", "first")
+	is.True(err != nil) // registrations should not leak between tenants
+}
@@ -0,0 +1,314 @@
+package spatial
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Geometry is a parsed GeoJSON geometry with its coordinates kept as longitude and latitude
+type Geometry struct {
+	points   []point
+	lines    [][]point
+	polygons [][][]point
+}
+
+type point struct {
+	lon, lat float64
+}
+
+// NewGeometry parses the coordinates of a GeoJSON geometry of the given type. The coordinates
+// may be given either as JSON or as the generic value that JSON or YAML is decoded into.
+func NewGeometry(geometryType string, coordinates any) (*Geometry, error) {
+	raw, ok := coordinates.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(coordinates); err != nil {
+			return nil, fmt.Errorf("invalid coordinates: %w", err)
+		}
+	}
+
+	g := &Geometry{}
+	var err error
+
+	switch geometryType {
+	case "Point":
+		var c []float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.points, err = toPoints([][]float64{c})
+		}
+	case "MultiPoint":
+		var c [][]float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.points, err = toPoints(c)
+		}
+	case "LineString":
+		var c [][]float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.lines, err = toLines([][][]float64{c})
+		}
+	case "MultiLineString":
+		var c [][][]float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.lines, err = toLines(c)
+		}
+	case "Polygon":
+		var c [][][]float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.polygons, err = toPolygons([][][][]float64{c})
+		}
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err = json.Unmarshal(raw, &c); err == nil {
+			g.polygons, err = toPolygons(c)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", geometryType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid coordinates for %s: %w", geometryType, err)
+	}
+
+	return g, nil
+}
+
+func toPoints(coordinates [][]float64) ([]point, error) {
+	points := make([]point, 0, len(coordinates))
+
+	for _, c := range coordinates {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("positions must have at least two elements")
+		}
+		points = append(points, point{lon: c[0], lat: c[1]})
+	}
+
+	return points, nil
+}
+
+func toLines(coordinates [][][]float64) ([][]point, error) {
+	lines := make([][]point, 0, len(coordinates))
+
+	for _, c := range coordinates {
+		line, err := toPoints(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 {
+			return nil, fmt.Errorf("lines must have at least two positions")
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func toPolygons(coordinates [][][][]float64) ([][][]point, error) {
+	polygons := make([][][]point, 0, len(coordinates))
+
+	for _, c := range coordinates {
+		rings, err := toLines(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(rings) == 0 || len(rings[0]) < 4 {
+			return nil, fmt.Errorf("polygons must have an exterior ring of at least four positions")
+		}
+		polygons = append(polygons, rings)
+	}
+
+	return polygons, nil
+}
+
+func (g *Geometry) anyPoint() point {
+	switch {
+	case len(g.points) > 0:
+		return g.points[0]
+	case len(g.lines) > 0:
+		return g.lines[0][0]
+	default:
+		return g.polygons[0][0][0]
+	}
+}
+
+// vertices returns all positions of the geometry
+func (g *Geometry) vertices() []point {
+	vertices := append([]point{}, g.points...)
+
+	for _, line := range g.lines {
+		vertices = append(vertices, line...)
+	}
+
+	for _, polygon := range g.polygons {
+		for _, ring := range polygon {
+			vertices = append(vertices, ring...)
+		}
+	}
+
+	return vertices
+}
+
+type segment struct {
+	a, b point
+}
+
+// segments returns the edges of the geometry, with single points as zero length segments
+func (g *Geometry) segments() []segment {
+	segments := []segment{}
+
+	for _, p := range g.points {
+		segments = append(segments, segment{p, p})
+	}
+
+	addPath := func(path []point) {
+		for i := 1; i < len(path); i++ {
+			segments = append(segments, segment{path[i-1], path[i]})
+		}
+	}
+
+	for _, line := range g.lines {
+		addPath(line)
+	}
+
+	for _, polygon := range g.polygons {
+		for _, ring := range polygon {
+			addPath(ring)
+		}
+	}
+
+	return segments
+}
+
+// contains reports if the position is inside any of the polygons of the geometry
+func (g *Geometry) contains(p point) bool {
+	for _, polygon := range g.polygons {
+		if !ringContains(polygon[0], p) {
+			continue
+		}
+
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, p) {
+				inHole = true
+				break
+			}
+		}
+
+		if !inHole {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ringContains(ring []point, p point) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.lat > p.lat) != (b.lat > p.lat) &&
+			p.lon < (b.lon-a.lon)*(p.lat-a.lat)/(b.lat-a.lat)+a.lon {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// Within reports if all positions of the first geometry are inside the polygons of the second
+func Within(g1, g2 *Geometry) bool {
+	for _, v := range g1.vertices() {
+		if !g2.contains(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equal reports if two geometries consist of the same positions in the same order
+func Equal(g1, g2 *Geometry) bool {
+	return slices.Equal(g1.vertices(), g2.vertices())
+}
+
+const earthRadius float64 = 6371000
+
+// Distance returns the approximate shortest distance in meters between two geometries, or
+// zero if they intersect. Positions are projected onto a plane around the first geometry,
+// which is accurate enough at the scale of a municipality.
+func Distance(g1, g2 *Geometry) float64 {
+	for _, v := range g1.vertices() {
+		if g2.contains(v) {
+			return 0
+		}
+	}
+
+	for _, v := range g2.vertices() {
+		if g1.contains(v) {
+			return 0
+		}
+	}
+
+	origin := g1.anyPoint()
+	scaleLon := earthRadius * math.Pi / 180 * math.Cos(origin.lat*math.Pi/180)
+	scaleLat := earthRadius * math.Pi / 180
+
+	project := func(s segment) segment {
+		return segment{
+			point{lon: s.a.lon * scaleLon, lat: s.a.lat * scaleLat},
+			point{lon: s.b.lon * scaleLon, lat: s.b.lat * scaleLat},
+		}
+	}
+
+	shortest := math.Inf(1)
+
+	for _, s1 := range g1.segments() {
+		s1 = project(s1)
+
+		for _, s2 := range g2.segments() {
+			d := segmentDistance(s1, project(s2))
+			if d == 0 {
+				return 0
+			}
+			shortest = min(shortest, d)
+		}
+	}
+
+	return shortest
+}
+
+func segmentDistance(s1, s2 segment) float64 {
+	if segmentsIntersect(s1, s2) {
+		return 0
+	}
+
+	return min(
+		pointSegmentDistance(s1.a, s2), pointSegmentDistance(s1.b, s2),
+		pointSegmentDistance(s2.a, s1), pointSegmentDistance(s2.b, s1),
+	)
+}
+
+func cross(o, a, b point) float64 {
+	return (a.lon-o.lon)*(b.lat-o.lat) - (a.lat-o.lat)*(b.lon-o.lon)
+}
+
+func segmentsIntersect(s1, s2 segment) bool {
+	d1, d2 := cross(s2.a, s2.b, s1.a), cross(s2.a, s2.b, s1.b)
+	d3, d4 := cross(s1.a, s1.b, s2.a), cross(s1.a, s1.b, s2.b)
+
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+func pointSegmentDistance(p point, s segment) float64 {
+	dx, dy := s.b.lon-s.a.lon, s.b.lat-s.a.lat
+	lengthSquared := dx*dx + dy*dy
+
+	t := 0.0
+	if lengthSquared > 0 {
+		t = max(0, min(1, ((p.lon-s.a.lon)*dx+(p.lat-s.a.lat)*dy)/lengthSquared))
+	}
+
+	return math.Hypot(p.lon-(s.a.lon+t*dx), p.lat-(s.a.lat+t*dy))
+}
@@ -0,0 +1,45 @@
+package spatial
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDistanceBetweenPointAndPolygon(t *testing.T) {
+	is := is.New(t)
+
+	area, err := NewGeometry("Polygon", sundsvall)
+	is.NoErr(err)
+
+	inside, _ := NewGeometry("Point", []float64{17.3, 62.39})
+	is.Equal(Distance(inside, area), 0.0) // a point inside the polygon should be at distance zero
+
+	north, _ := NewGeometry("Point", []float64{17.3, 62.51})
+	d := Distance(north, area)
+	is.True(d > 1000 && d < 1200) // 0.01 degrees of latitude should be roughly 1.1 km
+}
+
+func TestDistanceBetweenCrossingLineAndPolygon(t *testing.T) {
+	is := is.New(t)
+
+	area, _ := NewGeometry("Polygon", sundsvall)
+	line, err := NewGeometry("LineString", [][]float64{{17.0, 62.4}, {17.6, 62.4}})
+	is.NoErr(err)
+
+	is.Equal(Distance(line, area), 0.0) // a line that crosses the polygon should intersect it
+}
+
+func TestWithin(t *testing.T) {
+	is := is.New(t)
+
+	area, _ := NewGeometry("Polygon", sundsvall)
+	inside, _ := NewGeometry("Point", []float64{17.3, 62.39})
+	crossing, _ := NewGeometry("LineString", [][]float64{{17.0, 62.4}, {17.6, 62.4}})
+
+	is.True(Within(inside, area))
+	is.True(!Within(crossing, area)) // a line that only crosses the polygon is not within it
+	is.True(!Within(area, inside))
+}
+
+var sundsvall = [][][]float64{{{17.2, 62.3}, {17.4, 62.3}, {17.4, 62.5}, {17.2, 62.5}, {17.2, 62.3}}}
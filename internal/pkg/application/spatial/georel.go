@@ -0,0 +1,99 @@
+package spatial
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The relations of a GeoQuery. A near relation is given as either a max or a min distance.
+const (
+	GeoRelMaxDistance string = "maxDistance"
+	GeoRelMinDistance string = "minDistance"
+	GeoRelWithin      string = "within"
+	GeoRelContains    string = "contains"
+	GeoRelIntersects  string = "intersects"
+	GeoRelDisjoint    string = "disjoint"
+	GeoRelOverlaps    string = "overlaps"
+	GeoRelEquals      string = "equals"
+)
+
+// GeoQuery is a parsed NGSI-LD geo-query, i.e. the relation that it asks for between the geometry
+// of an entity and the geometry of the query
+type GeoQuery struct {
+	Relation string
+	Distance float64 // in meters, for the near relations
+	Geometry *Geometry
+}
+
+// NewGeoQuery parses the georel, geometry and coordinates of a geo-query. The coordinates may
+// also be given as a JSON string that holds the JSON encoded coordinates.
+func NewGeoQuery(georel, geometryType string, coordinates json.RawMessage) (*GeoQuery, error) {
+	relation, distance, err := ParseGeoRel(georel)
+	if err != nil {
+		return nil, err
+	}
+
+	gq := &GeoQuery{Relation: relation, Distance: distance}
+
+	var s string
+	if json.Unmarshal(coordinates, &s) == nil {
+		coordinates = json.RawMessage(s)
+	}
+
+	g, err := NewGeometry(geometryType, coordinates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geo-query: %w", err)
+	}
+
+	gq.Geometry = g
+
+	return gq, nil
+}
+
+// ParseGeoRel parses a georel into its relation, and the distance in meters of a near relation
+func ParseGeoRel(georel string) (string, float64, error) {
+	relation, modifier, _ := strings.Cut(georel, ";")
+
+	switch relation {
+	case "near":
+		name, value, ok := strings.Cut(modifier, "==")
+		if !ok || (name != GeoRelMaxDistance && name != GeoRelMinDistance) {
+			return "", 0, fmt.Errorf("near requires either a maxDistance or a minDistance")
+		}
+
+		d, err := strconv.ParseFloat(value, 64)
+		if err != nil || d < 0 {
+			return "", 0, fmt.Errorf("invalid distance %q", value)
+		}
+
+		return name, d, nil
+	case GeoRelWithin, GeoRelContains, GeoRelIntersects, GeoRelDisjoint, GeoRelOverlaps, GeoRelEquals:
+		return relation, 0, nil
+	default:
+		return "", 0, fmt.Errorf("unknown georel %q", relation)
+	}
+}
+
+// Matches reports if the geometry relates to the geometry of the query as the query asks for
+func (gq *GeoQuery) Matches(g *Geometry) bool {
+	switch gq.Relation {
+	case GeoRelMaxDistance:
+		return Distance(g, gq.Geometry) <= gq.Distance
+	case GeoRelMinDistance:
+		return Distance(g, gq.Geometry) >= gq.Distance
+	case GeoRelWithin:
+		return Within(g, gq.Geometry)
+	case GeoRelContains:
+		return Within(gq.Geometry, g)
+	case GeoRelIntersects:
+		return Distance(g, gq.Geometry) == 0
+	case GeoRelDisjoint:
+		return Distance(g, gq.Geometry) > 0
+	case GeoRelOverlaps:
+		return Distance(g, gq.Geometry) == 0 && !Within(g, gq.Geometry) && !Within(gq.Geometry, g)
+	default: // equals
+		return Equal(g, gq.Geometry)
+	}
+}
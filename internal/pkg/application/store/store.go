@@ -0,0 +1,344 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+// minRecordsBeforeCompaction keeps small stores from being compacted on almost every change
+const minRecordsBeforeCompaction int = 100
+
+// Store keeps the items of each tenant, such as registrations or subscriptions, in memory and
+// persists them to a file as a journal of the changes that are made to them. Each change is
+// appended to the journal, which is compacted into the current items once it has grown to
+// more than twice their number.
+type Store[T any] struct {
+	mu       sync.RWMutex
+	filePath string
+	name     string
+	idOf     func(T) string
+
+	// maxItemsPerTenant lets go of the oldest items of a tenant when it is exceeded, if set
+	maxItemsPerTenant int
+
+	tenants map[string][]T
+	records int // the number of records in the journal
+}
+
+// record is a line of the journal, that either puts an item or deletes the item with the id
+type record[T any] struct {
+	Tenant string `json:"tenant"`
+	ID     string `json:"id,omitempty"`
+	Item   *T     `json:"item,omitempty"`
+}
+
+// MaxItemsPerTenant bounds the number of items of each tenant, by letting go of the oldest ones
+func MaxItemsPerTenant[T any](maxItems int) func(*Store[T]) {
+	return func(s *Store[T]) {
+		s.maxItemsPerTenant = maxItems
+	}
+}
+
+// New creates a store that is persisted to the file at filePath. Any items already present in
+// the file are loaded. If filePath is empty, the store will only be kept in memory. The name
+// describes a single item in errors, and idOf returns the id of an item.
+func New[T any](filePath, name string, idOf func(T) string, options ...func(*Store[T])) (*Store[T], error) {
+	s := &Store[T]{
+		filePath: filePath,
+		name:     name,
+		idOf:     idOf,
+		tenants:  map[string][]T{},
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if filePath == "" {
+		return s, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for %ss: %w", name, err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+
+		return nil, fmt.Errorf("failed to read %ss from %s: %w", name, filePath, err)
+	}
+
+	err = s.load(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %ss from %s: %w", name, filePath, err)
+	}
+
+	// start out with a journal that holds nothing but the current items
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load replays the journal. Files that hold a single json object with the items of each tenant,
+// which is how items were stored before they were journaled, are loaded as they are.
+func (s *Store[T]) load(contents []byte) error {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return nil
+	}
+
+	if json.Unmarshal(contents, &s.tenants) == nil {
+		return nil
+	}
+
+	s.tenants = map[string][]T{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(nil, len(contents)+1)
+
+	for scanner.Scan() {
+		r := record[T]{}
+
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// a crash while appending may leave the last record partially written
+			if !scanner.Scan() {
+				break
+			}
+			return err
+		}
+
+		s.apply(r)
+	}
+
+	return scanner.Err()
+}
+
+func (s *Store[T]) apply(r record[T]) {
+	items := s.tenants[r.Tenant]
+
+	if r.Item == nil {
+		items = slices.DeleteFunc(items, func(item T) bool { return s.idOf(item) == r.ID })
+	} else if idx := s.indexIn(items, s.idOf(*r.Item)); idx != -1 {
+		items[idx] = *r.Item
+	} else {
+		items = append(items, *r.Item)
+	}
+
+	if len(items) == 0 {
+		delete(s.tenants, r.Tenant)
+	} else {
+		s.tenants[r.Tenant] = items
+	}
+}
+
+// All returns the items of every tenant
+func (s *Store[T]) All() map[string][]T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string][]T, len(s.tenants))
+	for tenant, items := range s.tenants {
+		all[tenant] = slices.Clone(items)
+	}
+
+	return all
+}
+
+func (s *Store[T]) List(tenant string) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.tenants[tenant])
+}
+
+func (s *Store[T]) Get(tenant, id string) (*T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.indexIn(s.tenants[tenant], id)
+	if idx == -1 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("no %s with id %s found", s.name, id))
+	}
+
+	item := s.tenants[tenant][idx]
+	return &item, nil
+}
+
+func (s *Store[T]) Create(tenant string, item T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexIn(s.tenants[tenant], s.idOf(item)) != -1 {
+		return errors.NewAlreadyExistsError(fmt.Sprintf("a %s with id %s already exists", s.name, s.idOf(item)))
+	}
+
+	records := []record[T]{}
+
+	if s.maxItemsPerTenant > 0 {
+		items := s.tenants[tenant]
+		for idx := 0; idx <= len(items)-s.maxItemsPerTenant; idx++ {
+			records = append(records, record[T]{Tenant: tenant, ID: s.idOf(items[idx])})
+		}
+	}
+
+	return s.write(append(records, record[T]{Tenant: tenant, Item: &item}))
+}
+
+func (s *Store[T]) Update(tenant string, item T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexIn(s.tenants[tenant], s.idOf(item)) == -1 {
+		return errors.NewNotFoundError(fmt.Sprintf("no %s with id %s found", s.name, s.idOf(item)))
+	}
+
+	return s.write([]record[T]{{Tenant: tenant, Item: &item}})
+}
+
+func (s *Store[T]) Delete(tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexIn(s.tenants[tenant], id) == -1 {
+		return errors.NewNotFoundError(fmt.Sprintf("no %s with id %s found", s.name, id))
+	}
+
+	return s.write([]record[T]{{Tenant: tenant, ID: id}})
+}
+
+func (s *Store[T]) indexIn(items []T, id string) int {
+	return slices.IndexFunc(items, func(item T) bool {
+		return s.idOf(item) == id
+	})
+}
+
+// write appends the records to the journal and applies them, so that nothing is changed in
+// memory unless it has been persisted
+func (s *Store[T]) write(records []record[T]) error {
+	err := s.append(records)
+	if err != nil {
+		// rewrite the journal from what is in memory, so that a partially appended record does
+		// not end up in the middle of it
+		s.compact()
+		return err
+	}
+
+	for _, r := range records {
+		// items are copied on write, so that slices that have been handed out are left as they were
+		s.tenants[r.Tenant] = slices.Clone(s.tenants[r.Tenant])
+		s.apply(r)
+	}
+
+	if s.records > max(minRecordsBeforeCompaction, 2*s.count()) {
+		// the changes are already in the journal, so a failure to compact it can wait until the next time
+		s.compact()
+	}
+
+	return nil
+}
+
+func (s *Store[T]) append(records []record[T]) error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	lines := []byte{}
+
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", s.name, err)
+		}
+
+		lines = append(append(lines, line...), '\n')
+	}
+
+	f, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", s.name, err)
+	}
+
+	_, err = f.Write(lines)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.name, err)
+	}
+
+	s.records += len(records)
+
+	return nil
+}
+
+// compact writes the current items to a temporary file and then renames it over the journal, so
+// that a crash while writing never leaves a partially written journal behind
+func (s *Store[T]) compact() error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	contents := &bytes.Buffer{}
+	encoder := json.NewEncoder(contents)
+
+	for tenant, items := range s.tenants {
+		for _, item := range items {
+			err := encoder.Encode(record[T]{Tenant: tenant, Item: &item})
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s: %w", s.name, err)
+			}
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filePath), filepath.Base(s.filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary %s file: %w", s.name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(contents.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %ss: %w", s.name, err)
+	}
+
+	err = os.Rename(tmp.Name(), s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace %s file: %w", s.name, err)
+	}
+
+	s.records = s.count()
+
+	return nil
+}
+
+func (s *Store[T]) count() int {
+	count := 0
+	for _, items := range s.tenants {
+		count += len(items)
+	}
+	return count
+}
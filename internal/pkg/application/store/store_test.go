@@ -0,0 +1,98 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type item struct {
+	ID    string `json:"id"`
+	Value int    `json:"value"`
+}
+
+func idOf(i item) string { return i.ID }
+
+func TestThatItemsArePersistedInADirectoryThatIsCreated(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "storage", "items.json")
+
+	s, err := New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", item{ID: "first", Value: 1}))
+	is.NoErr(s.Create("default", item{ID: "second", Value: 2}))
+	is.NoErr(s.Update("default", item{ID: "first", Value: 3}))
+	is.NoErr(s.Delete("default", "second"))
+
+	s, err = New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.Equal(s.List("default"), []item{{ID: "first", Value: 3}})
+}
+
+func TestThatTheJournalIsCompacted(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "items.json")
+
+	s, err := New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", item{ID: "first"}))
+	for value := range 2 * minRecordsBeforeCompaction {
+		is.NoErr(s.Update("default", item{ID: "first", Value: value}))
+	}
+
+	contents, err := os.ReadFile(filePath)
+	is.NoErr(err)
+	is.True(strings.Count(string(contents), "\n") <= minRecordsBeforeCompaction) // should not keep every update
+
+	s, err = New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.Equal(s.List("default"), []item{{ID: "first", Value: 2*minRecordsBeforeCompaction - 1}})
+}
+
+func TestThatAPartiallyWrittenLastRecordIsIgnored(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "items.json")
+	is.NoErr(os.WriteFile(filePath, []byte(`{"tenant":"default","item":{"id":"first","value":1}}`+"\n"+`{"tenant":"default","it`), 0o644))
+
+	s, err := New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.Equal(s.List("default"), []item{{ID: "first", Value: 1}})
+}
+
+func TestThatItemsStoredAsASingleObjectAreLoaded(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "items.json")
+	is.NoErr(os.WriteFile(filePath, []byte(`{"default": [{"id": "first", "value": 1}]}`), 0o644))
+
+	s, err := New(filePath, "item", idOf)
+	is.NoErr(err)
+
+	is.Equal(s.List("default"), []item{{ID: "first", Value: 1}})
+}
+
+func TestThatTheOldestItemsAreLetGoOfWhenTheLimitIsReached(t *testing.T) {
+	is := is.New(t)
+
+	s, err := New("", "item", idOf, MaxItemsPerTenant[item](2))
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", item{ID: "first"}))
+	is.NoErr(s.Create("default", item{ID: "second"}))
+	is.NoErr(s.Create("default", item{ID: "third"}))
+	is.NoErr(s.Create("other", item{ID: "first"}))
+
+	is.Equal(s.List("default"), []item{{ID: "second"}, {ID: "third"}})
+	is.Equal(len(s.List("other")), 1) // the limit should apply per tenant
+}
@@ -0,0 +1,80 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/store"
+)
+
+// DeadLetter is a notification that could not be delivered to its subscriber, even after
+// it had been retried, and that is kept so that it can be inspected and replayed
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Endpoint       string          `json:"endpoint"`
+	ContentType    string          `json:"contentType,omitempty"`
+	Notification   json.RawMessage `json:"notification"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError"`
+	FailedAt       time.Time       `json:"failedAt"`
+}
+
+// ReplayResult lists the ids of the dead letters that were delivered when they were replayed,
+// and of those that failed again and were kept
+type ReplayResult struct {
+	Replayed []string `json:"replayed"`
+	Failed   []string `json:"failed"`
+}
+
+// DeadLetterStore keeps track of the dead letters of each tenant
+type DeadLetterStore interface {
+	List(tenant string) []DeadLetter
+	Get(tenant, letterID string) (*DeadLetter, error)
+
+	Add(tenant string, letter DeadLetter) error
+	Update(tenant string, letter DeadLetter) error
+	Delete(tenant, letterID string) error
+}
+
+// maxDeadLettersPerTenant bounds the size of the store if a subscriber stays unreachable
+// for a long time, by letting go of the oldest dead letters first
+const maxDeadLettersPerTenant int = 1000
+
+type deadLetterStore struct {
+	letters *store.Store[DeadLetter]
+}
+
+// NewDeadLetterStore creates a dead letter store that is persisted to the file at filePath.
+// Any dead letters already present in the file are loaded. If filePath is empty, the store
+// will only be kept in memory.
+func NewDeadLetterStore(filePath string) (DeadLetterStore, error) {
+	letters, err := store.New(filePath, "dead letter", func(l DeadLetter) string {
+		return l.ID
+	}, store.MaxItemsPerTenant[DeadLetter](maxDeadLettersPerTenant))
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetterStore{letters: letters}, nil
+}
+
+func (s *deadLetterStore) List(tenant string) []DeadLetter {
+	return s.letters.List(tenant)
+}
+
+func (s *deadLetterStore) Get(tenant, letterID string) (*DeadLetter, error) {
+	return s.letters.Get(tenant, letterID)
+}
+
+func (s *deadLetterStore) Add(tenant string, letter DeadLetter) error {
+	return s.letters.Create(tenant, letter)
+}
+
+func (s *deadLetterStore) Update(tenant string, letter DeadLetter) error {
+	return s.letters.Update(tenant, letter)
+}
+
+func (s *deadLetterStore) Delete(tenant, letterID string) error {
+	return s.letters.Delete(tenant, letterID)
+}
@@ -0,0 +1,50 @@
+package subscriptions
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestThatDeadLettersArePersisted(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "deadletters.json")
+
+	store, err := NewDeadLetterStore(filePath)
+	is.NoErr(err)
+
+	is.NoErr(store.Add("default", DeadLetter{ID: "urn:ngsi-ld:Notification:1", Attempts: 8}))
+	is.NoErr(store.Add("default", DeadLetter{ID: "urn:ngsi-ld:Notification:2", Attempts: 8}))
+
+	letter, _ := store.Get("default", "urn:ngsi-ld:Notification:1")
+	letter.Attempts++
+	is.NoErr(store.Update("default", *letter))
+	is.NoErr(store.Delete("default", "urn:ngsi-ld:Notification:2"))
+
+	store, err = NewDeadLetterStore(filePath)
+	is.NoErr(err)
+
+	letters := store.List("default")
+	is.Equal(len(letters), 1)
+	is.Equal(letters[0].Attempts, 9)
+	is.Equal(len(store.List("other")), 0)
+
+	is.True(store.Delete("default", "urn:ngsi-ld:Notification:2") != nil) // should not find a deleted letter
+}
+
+func TestThatTheOldestDeadLettersAreDroppedWhenTheStoreIsFull(t *testing.T) {
+	is := is.New(t)
+
+	store, _ := NewDeadLetterStore("")
+
+	for i := range maxDeadLettersPerTenant + 1 {
+		is.NoErr(store.Add("default", DeadLetter{ID: fmt.Sprintf("urn:ngsi-ld:Notification:%d", i)}))
+	}
+
+	letters := store.List("default")
+	is.Equal(len(letters), maxDeadLettersPerTenant)
+	is.Equal(letters[0].ID, "urn:ngsi-ld:Notification:1")
+}
@@ -0,0 +1,145 @@
+package subscriptions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	defaultMaxAttempts    int           = 8
+	defaultInitialBackoff time.Duration = 500 * time.Millisecond
+	defaultMaxBackoff     time.Duration = 30 * time.Second
+
+	notificationTimeout time.Duration = 10 * time.Second
+)
+
+// retryPolicy controls how many times, and how often, the delivery of a notification is attempted.
+// With the defaults a subscriber can be unreachable for about a minute before notifications to it
+// end up as dead letters.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(cfg config.NotificationRetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+	}
+
+	if p.maxAttempts <= 0 {
+		p.maxAttempts = defaultMaxAttempts
+	}
+
+	if p.initialBackoff <= 0 {
+		p.initialBackoff = defaultInitialBackoff
+	}
+
+	if p.maxBackoff <= 0 {
+		p.maxBackoff = defaultMaxBackoff
+	}
+
+	return p
+}
+
+// backoff returns an exponentially increasing delay with jitter, in the range [d/2, d)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff << (attempt - 1)
+	if d > p.maxBackoff || d <= 0 {
+		d = p.maxBackoff
+	}
+
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+// deliver posts a notification to an endpoint until it is accepted or the attempts run out, and
+// returns the number of attempts that were made
+func (n *notifier) deliver(ctx context.Context, endpoint, contentType string, body []byte) (int, error) {
+	return n.retrying(ctx, func() error {
+		return postNotification(ctx, endpoint, contentType, body)
+	})
+}
+
+// retrying calls try until it succeeds, returns an error from stopRetrying, or the attempts run
+// out. Waiting for the next attempt is cut short if the notifier is stopped, in which case the
+// error wraps errStopped.
+func (n *notifier) retrying(ctx context.Context, try func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := try()
+
+		var permanent permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= n.retry.maxAttempts {
+			return attempt, err
+		}
+
+		select {
+		case <-time.After(n.retry.backoff(attempt)):
+		case <-n.stopping:
+			return attempt, fmt.Errorf("%w: %w", errStopped, err)
+		case <-ctx.Done():
+			return attempt, err
+		}
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// stopRetrying marks an error as one that will not go away by trying again
+func stopRetrying(err error) error {
+	return permanentError{err: err}
+}
+
+var httpClient http.Client = http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+}
+
+// postNotification posts a notification to an endpoint, as application/json unless another content
+// type is given, and fails unless the endpoint responds with a 2xx status code
+func postNotification(ctx context.Context, endpoint, contentType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("unable to create new request (%w)", err)
+	}
+
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request (%w)", err)
+	}
+
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("notification endpoint responded with status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package subscriptions
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/diwise/context-broker/internal/pkg/application/spatial"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+)
+
+// Filter decides which changes to entities that a subscription should be notified about
+type Filter struct {
+	entities []entitySelector
+	watched  []string
+	q        expression
+	geo      *geoFilter
+}
+
+type entitySelector struct {
+	subscriptions.EntityInfo
+	idPattern *regexp.Regexp
+}
+
+type geoFilter struct {
+	query       *spatial.GeoQuery
+	geoProperty string
+}
+
+// NewFilter compiles the entities, watchedAttributes, q and geoQ of a subscription into a
+// filter, or returns an error if any of them are invalid
+func NewFilter(s subscriptions.Subscription) (*Filter, error) {
+	f := &Filter{watched: s.WatchedAttributes}
+
+	for _, info := range s.Entities {
+		selector := entitySelector{EntityInfo: info}
+
+		if info.IDPattern != "" {
+			pattern, err := regexp.Compile(info.IDPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid idPattern %q", info.IDPattern)
+			}
+			selector.idPattern = pattern
+		}
+
+		f.entities = append(f.entities, selector)
+	}
+
+	if s.Q != "" {
+		q, err := parseQuery(s.Q)
+		if err != nil {
+			return nil, err
+		}
+		f.q = q
+	}
+
+	if s.GeoQ != nil {
+		geo, err := newGeoFilter(*s.GeoQ)
+		if err != nil {
+			return nil, err
+		}
+		f.geo = geo
+	}
+
+	return f, nil
+}
+
+func newGeoFilter(gq subscriptions.GeoQuery) (*geoFilter, error) {
+	gf := &geoFilter{geoProperty: gq.GeoProperty}
+	if gf.geoProperty == "" {
+		gf.geoProperty = "location"
+	}
+
+	query, err := spatial.NewGeoQuery(gq.GeoRel, gq.Geometry, gq.Coordinates)
+	if err != nil {
+		return nil, err
+	}
+
+	gf.query = query
+
+	return gf, nil
+}
+
+// Matches reports whether a change to the attributes of an entity should be notified. The
+// entity is given in its generic JSON representation, and changed is nil if it is not known
+// which attributes that were changed.
+func (f *Filter) Matches(entityID, entityType string, entity map[string]any, changed []string) bool {
+	if len(f.entities) > 0 && !slices.ContainsFunc(f.entities, func(s entitySelector) bool {
+		return s.matches(entityID, entityType)
+	}) {
+		return false
+	}
+
+	if len(f.watched) > 0 && changed != nil && !slices.ContainsFunc(changed, func(attr string) bool {
+		return slices.Contains(f.watched, attr)
+	}) {
+		return false
+	}
+
+	if f.q != nil && !f.q.eval(entity) {
+		return false
+	}
+
+	if f.geo != nil && !f.geo.matches(entity) {
+		return false
+	}
+
+	return true
+}
+
+func (s entitySelector) matches(entityID, entityType string) bool {
+	if s.Type != entityType {
+		return false
+	}
+
+	if s.ID != "" {
+		return s.ID == entityID
+	}
+
+	return s.idPattern == nil || s.idPattern.MatchString(entityID)
+}
+
+func (gf *geoFilter) matches(entity map[string]any) bool {
+	value, ok := attributePath{attributes: []string{gf.geoProperty}}.valueOf(entity)
+	if !ok {
+		return false
+	}
+
+	location, ok := value.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	geometryType, _ := location["type"].(string)
+	g, err := spatial.NewGeometry(geometryType, location["coordinates"])
+	if err != nil {
+		return false
+	}
+
+	return gf.query.Matches(g)
+}
@@ -0,0 +1,124 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+	"github.com/matryer/is"
+)
+
+func TestThatEntitiesAreMatchedOnTypeIDAndIDPattern(t *testing.T) {
+	is := is.New(t)
+
+	f, err := NewFilter(subscriptions.Subscription{
+		Entities: []subscriptions.EntityInfo{
+			{Type: "WaterConsumptionObserved", IDPattern: "^urn:ngsi-ld:WaterConsumptionObserved:se:.+"},
+			{Type: "Device", ID: "urn:ngsi-ld:Device:meter"},
+		},
+	})
+	is.NoErr(err)
+
+	is.True(f.Matches("urn:ngsi-ld:WaterConsumptionObserved:se:01", "WaterConsumptionObserved", nil, nil))
+	is.True(!f.Matches("urn:ngsi-ld:WaterConsumptionObserved:no:01", "WaterConsumptionObserved", nil, nil)) // should not match the id pattern
+	is.True(f.Matches("urn:ngsi-ld:Device:meter", "Device", nil, nil))
+	is.True(!f.Matches("urn:ngsi-ld:Device:other", "Device", nil, nil)) // should only match the subscribed device
+}
+
+func TestThatOnlyChangesToWatchedAttributesMatch(t *testing.T) {
+	is := is.New(t)
+
+	f, err := NewFilter(subscriptions.Subscription{WatchedAttributes: []string{"waterConsumption"}})
+	is.NoErr(err)
+
+	is.True(f.Matches("urn:ngsi-ld:Device:01", "Device", nil, []string{"waterConsumption", "dateObserved"}))
+	is.True(!f.Matches("urn:ngsi-ld:Device:01", "Device", nil, []string{"batteryLevel"}))
+	is.True(f.Matches("urn:ngsi-ld:Device:01", "Device", nil, nil)) // unknown changes should match
+}
+
+func TestQueryExpressions(t *testing.T) {
+	is := is.New(t)
+
+	entity := decode(is, `{
+		"id": "urn:ngsi-ld:WaterConsumptionObserved:01",
+		"type": "WaterConsumptionObserved",
+		"waterConsumption": {"type": "Property", "value": 142.5, "unitCode": "LTR"},
+		"alarm": {"type": "Property", "value": "leak"},
+		"dateObserved": {"type": "Property", "value": {"@type": "DateTime", "@value": "2024-05-01T12:00:00Z"}},
+		"address": {"type": "Property", "value": {"addressLocality": "Sundsvall"}},
+		"refDevice": {"type": "Relationship", "object": "urn:ngsi-ld:Device:01"}
+	}`)
+
+	testCases := map[string]bool{
+		`waterConsumption>100`:                            true,
+		`waterConsumption<100`:                            false,
+		`waterConsumption==100..200`:                      true,
+		`waterConsumption!=142.5`:                         false,
+		`waterConsumption.unitCode=="LTR"`:                true,
+		`alarm==leak,burst`:                               true,
+		`alarm=="leak";waterConsumption>200`:              false,
+		`alarm=="burst"|waterConsumption>=142.5`:          true,
+		`(alarm=="burst"|alarm=="leak");waterConsumption`: true,
+		`alarm~="^le"`:                                    true,
+		`address[addressLocality]=="Sundsvall"`:           true,
+		`refDevice=="urn:ngsi-ld:Device:01"`:              true,
+		`!batteryLevel`:                                   true,
+		`batteryLevel`:                                    false,
+		`dateObserved[@value]>2024-04-30T00:00:00Z`:       true,
+		`dateObserved[@value]>2024-05-01T12:00:00.001Z`:   false,
+		`waterConsumption>100;(alarm=="none"|!alarm)`:     false,
+		`waterConsumption>100;(alarm=="leak"|!alarm)`:     true,
+	}
+
+	for q, expected := range testCases {
+		t.Run(q, func(t *testing.T) {
+			is := is.New(t)
+
+			expr, err := parseQuery(q)
+			is.NoErr(err)
+			is.Equal(expr.eval(entity), expected)
+		})
+	}
+
+	for _, invalid := range []string{`(alarm=="leak"`, `alarm==`, `alarm~="("`, `==1`, `alarm==1)`} {
+		_, err := parseQuery(invalid)
+		is.True(err != nil) // should reject invalid q
+	}
+}
+
+func TestGeoQueries(t *testing.T) {
+	is := is.New(t)
+
+	inSundsvall := decode(is, `{"location": {"type": "GeoProperty", "value": {"type": "Point", "coordinates": [17.3, 62.39]}}}`)
+	inTimra := decode(is, `{"location": {"type": "GeoProperty", "value": {"type": "Point", "coordinates": [17.3, 62.6]}}}`)
+
+	within, err := NewFilter(subscriptions.Subscription{GeoQ: &subscriptions.GeoQuery{
+		Geometry:    "Polygon",
+		Coordinates: json.RawMessage(`[[[17.2,62.3],[17.4,62.3],[17.4,62.5],[17.2,62.5],[17.2,62.3]]]`),
+		GeoRel:      "within",
+	}})
+	is.NoErr(err)
+
+	is.True(within.Matches("", "", inSundsvall, nil))
+	is.True(!within.Matches("", "", inTimra, nil))
+	is.True(!within.Matches("", "", map[string]any{}, nil)) // entities without a location should not match
+
+	near, err := NewFilter(subscriptions.Subscription{GeoQ: &subscriptions.GeoQuery{
+		Geometry:    "Point",
+		Coordinates: json.RawMessage(`"[17.3,62.4]"`),
+		GeoRel:      "near;maxDistance==2000",
+	}})
+	is.NoErr(err)
+
+	is.True(near.Matches("", "", inSundsvall, nil))
+	is.True(!near.Matches("", "", inTimra, nil))
+
+	_, err = NewFilter(subscriptions.Subscription{GeoQ: &subscriptions.GeoQuery{Geometry: "Point", GeoRel: "close"}})
+	is.True(err != nil) // should reject an unknown georel
+}
+
+func decode(is *is.I, body string) map[string]any {
+	entity := map[string]any{}
+	is.NoErr(json.Unmarshal([]byte(body), &entity))
+	return entity
+}
@@ -0,0 +1,78 @@
+package subscriptions
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var meter = otel.Meter("context-broker/notifier")
+
+type notifierMetrics struct {
+	latency metric.Float64Histogram
+	dropped metric.Int64Counter
+	depth   metric.Registration
+}
+
+func newNotifierMetrics(n *notifier) *notifierMetrics {
+	m := &notifierMetrics{}
+
+	m.latency, _ = meter.Float64Histogram(
+		"notifier.delivery.latency",
+		metric.WithDescription("time from when a change to an entity was accepted until the notification about it was delivered, or given up on"),
+		metric.WithUnit("s"),
+	)
+
+	m.dropped, _ = meter.Int64Counter(
+		"notifier.queue.dropped",
+		metric.WithDescription("number of notifications that were dropped because the queue of their endpoint was full"),
+	)
+
+	depth, err := meter.Int64ObservableGauge(
+		"notifier.queue.depth",
+		metric.WithDescription("number of notifications waiting to be delivered to an endpoint, including those spilled to disk or held back until there is room in the queue"),
+	)
+	if err != nil {
+		return m
+	}
+
+	m.depth, _ = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		n.forEachQueue(func(q *endpointQueue) {
+			o.ObserveInt64(depth, int64(q.length()+len(n.heldBack[q.endpoint])), metric.WithAttributes(attribute.String("endpoint", q.endpoint)))
+		})
+		return nil
+	}, depth)
+
+	return m
+}
+
+func (m *notifierMetrics) unregister() {
+	if m != nil && m.depth != nil {
+		m.depth.Unregister()
+	}
+}
+
+func (m *notifierMetrics) recordDelivery(ctx context.Context, d delivery, outcome string) {
+	if m == nil || m.latency == nil {
+		return
+	}
+
+	m.latency.Record(ctx, time.Since(d.AcceptedAt).Seconds(), metric.WithAttributes(
+		attribute.String("endpoint", d.Endpoint),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (m *notifierMetrics) recordDropped(ctx context.Context, d delivery) {
+	if m == nil || m.dropped == nil {
+		return
+	}
+
+	m.dropped.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", d.Endpoint),
+		attribute.String("tenant", d.Tenant),
+	))
+}
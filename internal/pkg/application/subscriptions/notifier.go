@@ -1,21 +1,23 @@
 package subscriptions
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 )
 
@@ -23,36 +25,199 @@ type Notifier interface {
 	Start() error
 	Stop() error
 
-	EntityCreated(ctx context.Context, e types.Entity, tenant string)
-	EntityUpdated(ctx context.Context, e types.Entity, tenant string)
+	// HasSubscriptions reports whether anyone may be notified about changes to the entities of a tenant
+	HasSubscriptions(tenant string) bool
+
+	// EntityCreated writes an event about a new entity to the outbox before the entity is created,
+	// and returns the change that has to be committed once the entity has been created, or
+	// discarded if it could not be. An error is returned if the event could not be written to
+	// the outbox, in which case the entity should not be created.
+	EntityCreated(ctx context.Context, e types.Entity, tenant string) (Change, error)
+	// EntityUpdated does the same as EntityCreated for an update of the attributes in
+	// updatedAttributes. The entity is retrieved in its entirety before the subscribers are
+	// notified. A nil updatedAttributes means that it is not known which attributes that were
+	// updated.
+	EntityUpdated(ctx context.Context, tenant, entityID string, updatedAttributes []string) (Change, error)
+
+	DeadLetters(tenant string) []DeadLetter
+	// ReplayDeadLetters attempts to deliver the dead letters with the given ids once more, or all of
+	// the dead letters of the tenant if no ids are given. Delivered dead letters are removed.
+	ReplayDeadLetters(ctx context.Context, tenant string, letterIDs []string) (*ReplayResult, error)
+	DiscardDeadLetter(tenant, letterID string) error
 }
 
+// Change is an event in the outbox about a change to an entity that is being made. The event is
+// not dispatched to the subscribers until the change is committed, and is removed from the outbox
+// if the change is discarded. Events whose changes were neither committed nor discarded when the
+// broker stopped are dispatched after a restart, as it is not known whether the changes were made.
+type Change interface {
+	Commit()
+	Discard()
+}
+
+// NoChange is the change to use when there is nobody to notify
+var NoChange Change = noChange{}
+
+type noChange struct{}
+
+func (noChange) Commit()  {}
+func (noChange) Discard() {}
+
+// EntityResolver retrieves an entity in its entirety, so that subscribers can be notified about it
+type EntityResolver func(ctx context.Context, tenant, entityID string) (types.Entity, error)
+
 var tracer = otel.Tracer("context-broker/notifier")
 
-type action func()
+// errStopped is returned when a notification could not be delivered because the notifier was
+// stopped. The event is left in the outbox, so that it is delivered after a restart.
+var errStopped = errors.New("notifier was stopped")
+
+// maxConcurrentDispatches limits the number of events that are dispatched at the same time, which
+// mostly matters for updates where the entity has to be retrieved before it can be dispatched
+const maxConcurrentDispatches int = 8
 
 type notifier struct {
-	started       bool
-	queue         chan action
-	notifications map[string][]config.Notification
+	logger *slog.Logger
+
+	started  bool
+	wake     chan struct{}
+	stopping chan struct{}
+	stopped  chan struct{}
+
+	retry       retryPolicy
+	queuePolicy queuePolicy
+	outbox      Outbox
+	resolve     EntityResolver
+	deadLetters DeadLetterStore
+	metrics     *notifierMetrics
+
+	mu sync.Mutex
+	// queues holds the queue of each notification endpoint
+	queues map[string]*endpointQueue
+	// inflight holds the events in the outbox that are being dispatched or delivered
+	inflight map[string]*inflightEvent
+	// recovered holds the ids of the subscriptions whose notifications about an event were
+	// recovered from a spill file, and should not be queued again when the event is dispatched
+	recovered map[string][]string
+	// heldBack holds the notifications to each endpoint that are waiting for room in its queue,
+	// when the overflow policy is to block. Only their events and subscriptions are held on to,
+	// and the notifications are created once there is room for them in the queue.
+	heldBack map[string][]heldBackNotification
+	draining map[string]bool
+	// uncommitted holds the events in the outbox whose changes are still being made
+	uncommitted map[string]bool
+	// restored holds the events about new entities that were left in the outbox when the broker
+	// stopped. Their entities are retrieved before they are dispatched, as they may never have
+	// been created.
+	restored map[string]bool
+
+	dispatchers chan struct{}
+	dispatching sync.WaitGroup
+	working     sync.WaitGroup
+
+	// configured holds the subscriptions that stem from the notification endpoints in the
+	// configuration, as opposed to those that are created through the api and kept in the store
+	configured map[string][]FilteredSubscription
+	store      Store
+}
+
+// DeadLetters keeps notifications that could not be delivered in the store, so that they can
+// be replayed later on
+func DeadLetters(store DeadLetterStore) func(*notifier) {
+	return func(n *notifier) {
+		n.deadLetters = store
+	}
+}
+
+// Durable makes the notifier keep track of the events it has yet to deliver in the outbox, so
+// that they are delivered even if the broker is restarted. Events are only kept in memory by default.
+func Durable(outbox Outbox) func(*notifier) {
+	return func(n *notifier) {
+		n.outbox = outbox
+	}
+}
+
+// Spill sets the directory where notifications are spilled when the queue of their endpoint is
+// full and the overflow policy is to spill them to disk. Notifications can only be spilled if the
+// directory is set. It should not be shared with other brokers, since the notifications that are
+// spilled to it are recovered when the notifier is started again.
+func Spill(dir string) func(*notifier) {
+	return func(n *notifier) {
+		n.queuePolicy.spillDir = dir
+	}
+}
+
+// Resolver sets the function that retrieves updated entities before subscribers are notified
+func Resolver(resolve EntityResolver) func(*notifier) {
+	return func(n *notifier) {
+		n.resolve = resolve
+	}
 }
 
-func NewNotifier(ctx context.Context, cfg config.Config) (Notifier, error) {
+// NewNotifier creates a notifier that notifies the configured notification endpoints, and the
+// subscribers in the store, about changes to entities. Changes are written to an outbox before
+// they are accepted, and then delivered in the background from a separate queue per endpoint.
+// It returns nil if there is no store and no notification endpoints have been configured, as
+// nobody could be notified anyway.
+func NewNotifier(ctx context.Context, cfg config.Config, store Store, options ...func(*notifier)) (Notifier, error) {
 	n := &notifier{
-		queue:         make(chan action, 32),
-		notifications: make(map[string][]config.Notification),
+		logger:      logging.GetFromContext(ctx),
+		wake:        make(chan struct{}, 1),
+		stopping:    make(chan struct{}),
+		stopped:     make(chan struct{}),
+		retry:       newRetryPolicy(cfg.Notifier.Retry),
+		queues:      map[string]*endpointQueue{},
+		inflight:    map[string]*inflightEvent{},
+		recovered:   map[string][]string{},
+		heldBack:    map[string][]heldBackNotification{},
+		draining:    map[string]bool{},
+		uncommitted: map[string]bool{},
+		restored:    map[string]bool{},
+		dispatchers: make(chan struct{}, maxConcurrentDispatches),
+		configured:  make(map[string][]FilteredSubscription),
+		store:       store,
+	}
+
+	for _, option := range options {
+		option(n)
+	}
+
+	var err error
+
+	n.queuePolicy, err = newQueuePolicy(cfg.Notifier.Queue, n.queuePolicy.spillDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.outbox == nil {
+		n.outbox, _ = NewOutbox("")
 	}
 
 	for _, tenant := range cfg.Tenants {
-		if len(tenant.Notifications) > 0 {
-			n.notifications[tenant.ID] = tenant.Notifications
+		for idx, notification := range tenant.Notifications {
+			subscription := subscriptions.Subscription{
+				ID:   fmt.Sprintf("urn:ngsi-ld:%s:config:%s:%d", subscriptions.SubscriptionType, tenant.ID, idx),
+				Type: subscriptions.SubscriptionType,
+				Notification: subscriptions.NotificationParams{
+					Endpoint: subscriptions.Endpoint{URI: notification.Endpoint},
+				},
+			}
+
+			filter, err := NewFilter(subscription)
+			if err != nil {
+				return nil, err
+			}
+
+			n.configured[tenant.ID] = append(n.configured[tenant.ID], FilteredSubscription{Subscription: subscription, Filter: filter})
 		}
 	}
 
-	if len(n.notifications) == 0 {
+	if len(n.configured) == 0 && store == nil {
 		return nil, nil
 	}
 
+	n.metrics = newNotifierMetrics(n)
+
 	return n, nil
 }
 
@@ -61,6 +226,27 @@ func (n *notifier) Start() error {
 		return fmt.Errorf("already started")
 	}
 
+	pending := map[string]bool{}
+	for _, event := range n.outbox.Pending() {
+		pending[event.ID] = true
+
+		if event.Created && n.resolve != nil {
+			n.restored[event.ID] = true
+		}
+	}
+
+	if n.queuePolicy.overflow == spillToDisk {
+		err := recoverSpillFiles(n.queuePolicy.spillDir, func(d delivery) {
+			// notifications about events that are no longer pending have already been delivered
+			if pending[d.EventID] {
+				n.requeue(d)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to recover spilled notifications: %w", err)
+		}
+	}
+
 	n.started = true
 
 	go n.run()
@@ -68,125 +254,792 @@ func (n *notifier) Start() error {
 	return nil
 }
 
+// requeue queues a notification that was spilled to disk before a restart once more. The event
+// that it stems from is dispatched to the rest of the subscriptions that it matches as usual.
+func (n *notifier) requeue(d delivery) {
+	n.mu.Lock()
+
+	if slices.Contains(n.recovered[d.EventID], d.SubscriptionID) {
+		n.mu.Unlock()
+		return
+	}
+
+	e, ok := n.inflight[d.EventID]
+	if !ok {
+		// hold on to the event until it has been dispatched, the same way as track does
+		e = &inflightEvent{remaining: 1, undispatched: true}
+		n.inflight[d.EventID] = e
+	}
+
+	e.remaining++
+	n.recovered[d.EventID] = append(n.recovered[d.EventID], d.SubscriptionID)
+
+	n.mu.Unlock()
+
+	q, err := n.queue(d.Endpoint)
+	if err == nil {
+		_, err = q.push(d)
+	}
+
+	if err != nil {
+		n.logger.Error("failed to queue recovered notification", "subscription", d.SubscriptionID, "err", err.Error())
+
+		// let the notification be queued again when the event is dispatched
+		n.mu.Lock()
+		n.recovered[d.EventID] = slices.DeleteFunc(n.recovered[d.EventID], func(id string) bool { return id == d.SubscriptionID })
+		n.mu.Unlock()
+
+		n.release(d.EventID, false)
+	}
+}
+
+// Stop delivers the notifications that are queued without retrying them, and leaves the events
+// whose notifications could not be delivered in the outbox until the notifier is started again.
+// The outbox is closed once nothing more is written to it.
 func (n *notifier) Stop() error {
+	n.metrics.unregister()
+
 	if n.started {
-		// Create a result channel so that we can wait for completion
-		resultChan := make(chan bool)
+		close(n.stopping)
+		<-n.stopped
+		n.working.Wait()
+	}
 
-		n.queue <- func() {
-			// close the queue to signal the consumers that we are going out of business
-			close(n.queue)
-			resultChan <- true
-		}
+	return n.outbox.Close()
+}
 
-		// blocking read until our action has been processed
-		<-resultChan
+func (n *notifier) HasSubscriptions(tenant string) bool {
+	return len(n.subscriptions(tenant)) > 0
+}
+
+func (n *notifier) EntityCreated(ctx context.Context, e types.Entity, tenant string) (Change, error) {
+	if !n.HasSubscriptions(tenant) {
+		return NoChange, nil
 	}
-	return nil
+
+	entity, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity for notification: %w", err)
+	}
+
+	return n.append(OutboxEvent{
+		Tenant:   tenant,
+		EntityID: e.ID(),
+		Entity:   entity,
+		Created:  true,
+	})
 }
 
-func (n *notifier) EntityCreated(ctx context.Context, e types.Entity, tenant string) {
-	if n.started {
-		var err error
+func (n *notifier) EntityUpdated(ctx context.Context, tenant, entityID string, updatedAttributes []string) (Change, error) {
+	if !n.HasSubscriptions(tenant) {
+		return NoChange, nil
+	}
 
-		logger := logging.GetFromContext(ctx)
+	return n.append(OutboxEvent{
+		Tenant:     tenant,
+		EntityID:   entityID,
+		Attributes: updatedAttributes,
+	})
+}
+
+// append writes an event to the outbox, where it is held back from the dispatcher until its
+// change is committed
+func (n *notifier) append(event OutboxEvent) (Change, error) {
+	event.ID = uuid.NewString()
+	event.AcceptedAt = time.Now().UTC()
+
+	n.mu.Lock()
+	n.uncommitted[event.ID] = true
+	n.mu.Unlock()
+
+	err := n.outbox.Append(event)
+	if err != nil {
+		n.mu.Lock()
+		delete(n.uncommitted, event.ID)
+		n.mu.Unlock()
 
-		ctx, span := tracer.Start(context.WithoutCancel(ctx), "post")
+		return nil, fmt.Errorf("failed to write event about %s to outbox: %w", event.EntityID, err)
+	}
 
-		n.queue <- func() {
-			defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+	return &change{n: n, eventID: event.ID}, nil
+}
 
-			var wg sync.WaitGroup
-			defer wg.Wait()
+type change struct {
+	n       *notifier
+	eventID string
+	settled sync.Once
+}
 
-			for _, notification := range n.notifications[tenant] {
-				wg.Add(1)
-				go func(endpoint string) {
-					defer wg.Done()
+// Commit lets the event be dispatched, now that its change has been made
+func (c *change) Commit() {
+	c.settled.Do(func() {
+		c.n.mu.Lock()
+		delete(c.n.uncommitted, c.eventID)
+		c.n.mu.Unlock()
+
+		c.n.wakeDispatcher()
+	})
+}
 
-					ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-					defer cancel()
+// Discard removes the event from the outbox, as its change could not be made
+func (c *change) Discard() {
+	c.settled.Do(func() {
+		c.n.mu.Lock()
+		delete(c.n.uncommitted, c.eventID)
+		c.n.mu.Unlock()
+
+		err := c.n.outbox.Done(c.eventID)
+		if err != nil {
+			c.n.logger.Error("failed to remove discarded event from outbox", "err", err.Error())
+		}
+	})
+}
+
+func (n *notifier) wakeDispatcher() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// subscriptions returns the active subscriptions of a tenant
+func (n *notifier) subscriptions(tenant string) []FilteredSubscription {
+	subs := slices.Clone(n.configured[tenant])
+
+	if n.store != nil {
+		subs = append(subs, n.store.Filtered(tenant)...)
+	}
 
-					err = postNotification(ctx, e, endpoint)
-					if err != nil {
-						logger.Error("failed to post notification", "err", err.Error())
-					}
-				}(notification.Endpoint)
+	return slices.DeleteFunc(subs, func(s FilteredSubscription) bool {
+		return !s.Active()
+	})
+}
+
+// run dispatches the events in the outbox until the notifier is stopped, starting with any
+// events that were left in the outbox the last time the broker was running
+func (n *notifier) run() {
+	defer close(n.stopped)
+
+	for {
+		n.dispatchPending()
+
+		select {
+		case <-n.wake:
+		case <-n.stopping:
+			// dispatch what was appended while the last events were being dispatched, and let
+			// the workers finish once their queues are empty
+			n.dispatchPending()
+			n.dispatching.Wait()
+
+			// leave the notifications that are held back in the outbox until after a restart
+			for _, held := range n.takeHeldBack("") {
+				n.release(held.event.ID, true)
 			}
+
+			n.forEachQueue(func(q *endpointQueue) { q.close() })
+			return
 		}
 	}
 }
 
-func (n *notifier) EntityUpdated(ctx context.Context, e types.Entity, tenant string) {
-	if n.started {
-		var err error
+// dispatchPending dispatches the events in the outbox that are not already being dispatched or delivered
+func (n *notifier) dispatchPending() {
+	for _, event := range n.outbox.Pending() {
+		if !n.track(event.ID) {
+			continue
+		}
+
+		n.dispatchers <- struct{}{}
+		n.dispatching.Add(1)
+
+		go func() {
+			defer func() {
+				<-n.dispatchers
+				n.dispatching.Done()
+			}()
+
+			n.dispatch(event)
+		}()
+	}
+}
+
+// dispatch queues notifications about an event to the subscriptions whose filters it matches
+func (n *notifier) dispatch(event OutboxEvent) {
+	var err error
+
+	ctx, span := tracer.Start(context.Background(), "dispatch")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	recovered := n.takeRecovered(event.ID)
 
-		logger := logging.GetFromContext(ctx)
+	e, err := n.entity(ctx, event)
+	if err != nil {
+		if !errors.Is(err, ngsierrors.ErrNotFound) && !errors.Is(err, errStopped) {
+			n.logger.Error("failed to retrieve entity for notification", "tenant", event.Tenant, "entityID", event.EntityID, "err", err.Error())
+		}
+		// an entity that has been deleted since leaves nothing to notify about
+		n.release(event.ID, errors.Is(err, errStopped))
+		return
+	}
 
-		ctx, span := tracer.Start(context.WithoutCancel(ctx), "post")
+	entity, err := asMap(e)
+	if err != nil {
+		n.logger.Error("failed to decode entity for notification filtering", "err", err.Error())
+		n.release(event.ID, false)
+		return
+	}
 
-		n.queue <- func() {
-			defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+	changed := event.Attributes
+	if event.Created {
+		// every attribute of a new entity counts as changed
+		changed = []string{}
+		for name := range entity {
+			if name != "id" && name != "type" && name != "@context" {
+				changed = append(changed, name)
+			}
+		}
+	}
 
-			var wg sync.WaitGroup
-			defer wg.Wait()
+	subs := slices.DeleteFunc(n.subscriptions(event.Tenant), func(s FilteredSubscription) bool {
+		if slices.Contains(recovered, s.ID) {
+			return true
+		}
 
-			for _, notification := range n.notifications[tenant] {
-				wg.Add(1)
-				go func(endpoint string) {
-					defer wg.Done()
+		if s.Filter == nil {
+			n.logger.Warn("ignoring subscription with invalid filter", "subscription", s.ID)
+			return true
+		}
 
-					ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-					defer cancel()
+		return !s.Filter.Matches(e.ID(), e.Type(), entity, changed)
+	})
 
-					err = postNotification(ctx, e, endpoint)
-					if err != nil {
-						logger.Error("failed to post notification", "err", err.Error())
-					}
-				}(notification.Endpoint)
+	n.expect(event.ID, len(subs))
+
+	for _, subscription := range subs {
+		err = n.enqueue(ctx, event, e, subscription.Subscription)
+		if err != nil {
+			if !errors.Is(err, errStopped) {
+				n.logger.Error("failed to queue notification", "subscription", subscription.ID, "err", err.Error())
 			}
+			// keep the event in the outbox, so that the notification is queued again after a restart
+			n.release(event.ID, true)
 		}
 	}
+
+	n.release(event.ID, false)
 }
 
-var httpClient http.Client = http.Client{
-	Transport: otelhttp.NewTransport(http.DefaultTransport),
+// enqueue adds a notification about the entity to the queue of the endpoint of the subscription.
+// If the queue is full, and its overflow policy is to block, the notification is held back until
+// there is room in the queue. So are notifications to an endpoint that already has notifications
+// held back, so that they are delivered in order.
+func (n *notifier) enqueue(ctx context.Context, event OutboxEvent, e types.Entity, subscription subscriptions.Subscription) error {
+	q, err := n.queue(subscription.Notification.Endpoint.URI)
+	if err != nil {
+		return err
+	}
+
+	held := heldBackNotification{event: event, subscription: subscription}
+
+	if n.holdBack(q.endpoint, held, false) {
+		n.drain(ctx, q)
+		return nil
+	}
+
+	err = n.push(ctx, q, event, e, subscription)
+	if errors.Is(err, errQueueFull) {
+		n.holdBack(q.endpoint, held, true)
+		n.drain(ctx, q)
+		return nil
+	}
+
+	return err
 }
 
-func postNotification(ctx context.Context, e types.Entity, endpoint string) error {
-	notification := subscriptions.NewNotification(e)
-	body, err := json.MarshalIndent(notification, "", " ")
+// push creates a notification about the entity and pushes it to the queue
+func (n *notifier) push(ctx context.Context, q *endpointQueue, event OutboxEvent, e types.Entity, subscription subscriptions.Subscription) error {
+	if attributes := subscription.Notification.Attributes; len(attributes) > 0 {
+		e = entities.SelectAttributes(e, func(attributeName string) bool {
+			return slices.Contains(attributes, attributeName)
+		})
+	}
+
+	notification := subscriptions.NewSubscriptionNotification(subscription.ID, e)
+	body, err := notificationBody(notification, subscription.Notification.Format)
 	if err != nil {
 		return fmt.Errorf("marshalling error (%w)", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	dropped, err := q.push(delivery{
+		EventID:        event.ID,
+		Tenant:         event.Tenant,
+		SubscriptionID: subscription.ID,
+		NotificationID: notification.Id,
+		Endpoint:       q.endpoint,
+		ContentType:    subscription.Notification.Endpoint.Accept,
+		Body:           body,
+		AcceptedAt:     event.AcceptedAt,
+	})
 	if err != nil {
-		return fmt.Errorf("unable to create new request (%w)", err)
+		return err
+	}
+
+	if dropped != nil {
+		n.logger.Warn("notification queue is full, dropped the oldest notification", "endpoint", q.endpoint, "subscription", dropped.SubscriptionID)
+		n.metrics.recordDropped(ctx, *dropped)
+		n.release(dropped.EventID, false)
+	}
+
+	return nil
+}
+
+// heldBackNotification is a notification that waits for room in the queue of its endpoint
+type heldBackNotification struct {
+	event        OutboxEvent
+	subscription subscriptions.Subscription
+}
+
+// holdBack holds back a notification to an endpoint, either always or only if other notifications
+// to the endpoint already are, and reports whether it was held back
+func (n *notifier) holdBack(endpoint string, held heldBackNotification, always bool) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !always && len(n.heldBack[endpoint]) == 0 {
+		return false
+	}
+
+	n.heldBack[endpoint] = append(n.heldBack[endpoint], held)
+
+	return true
+}
+
+// takeHeldBack returns the notifications that are held back for an endpoint, or for every
+// endpoint if endpoint is empty, and forgets about them
+func (n *notifier) takeHeldBack(endpoint string) []heldBackNotification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if endpoint != "" {
+		held := n.heldBack[endpoint]
+		delete(n.heldBack, endpoint)
+		return held
+	}
+
+	held := []heldBackNotification{}
+	for ep, notifications := range n.heldBack {
+		held = append(held, notifications...)
+		delete(n.heldBack, ep)
+	}
+
+	return held
+}
+
+// drain moves the notifications that are held back for an endpoint to its queue for as long as
+// there is room in it. One caller at a time drains the notifications of an endpoint, so that they
+// are queued in the order they were held back.
+func (n *notifier) drain(ctx context.Context, q *endpointQueue) {
+	n.mu.Lock()
+
+	if n.draining[q.endpoint] {
+		n.mu.Unlock()
+		return
 	}
 
-	req.Header.Add("Content-Type", "application/json")
+	n.draining[q.endpoint] = true
 
-	resp, err := httpClient.Do(req)
+	for {
+		held := n.heldBack[q.endpoint]
+		if len(held) == 0 || !q.hasRoom() {
+			delete(n.draining, q.endpoint)
+			n.mu.Unlock()
+			return
+		}
+
+		next := held[0]
+		n.heldBack[q.endpoint] = held[1:]
+
+		n.mu.Unlock()
+		err := n.pushHeldBack(ctx, q, next)
+		n.mu.Lock()
+
+		if errors.Is(err, errQueueFull) {
+			n.heldBack[q.endpoint] = append([]heldBackNotification{next}, n.heldBack[q.endpoint]...)
+		}
+	}
+}
+
+// pushHeldBack creates a notification that was held back and pushes it to the queue. The entity
+// is retrieved once more, as it is not held on to while the notification is held back.
+func (n *notifier) pushHeldBack(ctx context.Context, q *endpointQueue, held heldBackNotification) error {
+	e, err := n.entity(ctx, held.event)
 	if err != nil {
-		return fmt.Errorf("failed to send request (%w)", err)
+		if !errors.Is(err, ngsierrors.ErrNotFound) && !errors.Is(err, errStopped) {
+			n.logger.Error("failed to retrieve entity for notification", "tenant", held.event.Tenant, "entityID", held.event.EntityID, "err", err.Error())
+		}
+		n.release(held.event.ID, errors.Is(err, errStopped))
+		return nil
+	}
+
+	err = n.push(ctx, q, held.event, e, held.subscription)
+	if errors.Is(err, errQueueFull) {
+		return err
 	}
 
-	defer func() {
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
-	}()
+	if err != nil {
+		if !errors.Is(err, errStopped) {
+			n.logger.Error("failed to queue notification", "subscription", held.subscription.ID, "err", err.Error())
+		}
+		n.release(held.event.ID, true)
+	}
 
 	return nil
 }
 
-func (n *notifier) run() {
-	// repeat until the queue is closed
-	for action := range n.queue {
-		if action == nil {
+// notificationBody marshals the notification, with its entities in the format that was asked for
+func notificationBody(notification *subscriptions.Notification, format string) ([]byte, error) {
+	if format != subscriptions.FormatKeyValues {
+		return json.MarshalIndent(notification, "", " ")
+	}
+
+	keyValues := []types.EntityKeyValueMapper{}
+	for _, e := range notification.Data {
+		keyValues = append(keyValues, e.KeyValues())
+	}
+
+	return json.MarshalIndent(struct {
+		*subscriptions.Notification
+		Data []types.EntityKeyValueMapper `json:"data"`
+	}{notification, keyValues}, "", " ")
+}
+
+// queue returns the queue of an endpoint, and creates it along with its workers if needed
+func (n *notifier) queue(endpoint string) (*endpointQueue, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if q, ok := n.queues[endpoint]; ok {
+		return q, nil
+	}
+
+	q, err := newEndpointQueue(endpoint, n.queuePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	n.queues[endpoint] = q
+
+	for range n.queuePolicy.workers {
+		n.working.Add(1)
+		go n.work(q)
+	}
+
+	return q, nil
+}
+
+func (n *notifier) forEachQueue(fn func(*endpointQueue)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, q := range n.queues {
+		fn(q)
+	}
+}
+
+// work delivers the notifications in the queue of an endpoint until the queue is closed
+func (n *notifier) work(q *endpointQueue) {
+	defer n.working.Done()
+
+	for {
+		d, ok, err := q.pop()
+		if !ok {
 			return
 		}
 
-		action()
+		if q.policy.overflow == blockWhenFull {
+			// fill the room that was just made with a notification that was held back
+			n.drain(context.Background(), q)
+		}
+
+		if err != nil {
+			n.logger.Error("failed to read spilled notifications", "endpoint", q.endpoint, "err", err.Error())
+
+			// keep the events of the notifications that were lost in the outbox, so that they
+			// are delivered after a restart
+			var spillErr *spillReadError
+			if errors.As(err, &spillErr) {
+				for _, eventID := range spillErr.eventIDs {
+					n.release(eventID, true)
+				}
+			}
+			continue
+		}
+
+		err = n.post(d)
+		if errors.Is(err, errStopped) {
+			// the endpoint is not responding and the notifier is being stopped, so leave the rest
+			// of the notifications to the endpoint until after a restart
+			n.release(d.EventID, true)
+			for _, eventID := range q.abandon() {
+				n.release(eventID, true)
+			}
+			for _, held := range n.takeHeldBack(q.endpoint) {
+				n.release(held.event.ID, true)
+			}
+			continue
+		}
+
+		if err != nil {
+			n.logger.Error("failed to post notification", "subscription", d.SubscriptionID, "err", err.Error())
+		}
+
+		n.release(d.EventID, false)
+	}
+}
+
+type inflightEvent struct {
+	remaining int
+	// keep is set when the event should be dispatched again. Such events stay in flight for a
+	// while once they are released, or until the broker is restarted if the notifier is stopping.
+	keep bool
+	// undispatched is set for events that have notifications that were recovered from a spill
+	// file, but that have not been dispatched to the rest of their subscriptions yet
+	undispatched bool
+}
+
+// track marks an event as being dispatched, and returns false if it already is or if its change
+// has not been committed yet
+func (n *notifier) track(eventID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.uncommitted[eventID] {
+		return false
+	}
+
+	if e, ok := n.inflight[eventID]; ok {
+		if !e.undispatched {
+			return false
+		}
+
+		// the event is already held on to until it has been dispatched
+		e.undispatched = false
+		return true
 	}
+
+	// hold on to the event until it has been dispatched
+	n.inflight[eventID] = &inflightEvent{remaining: 1}
+
+	return true
+}
+
+// takeRecovered returns the ids of the subscriptions whose notifications about an event were
+// recovered from a spill file, and forgets about them
+func (n *notifier) takeRecovered(eventID string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	recovered := n.recovered[eventID]
+	delete(n.recovered, eventID)
+
+	return recovered
+}
+
+// expect adds to the number of notifications about an event that remain to be delivered
+func (n *notifier) expect(eventID string, deliveries int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if e, ok := n.inflight[eventID]; ok {
+		e.remaining += deliveries
+	}
+}
+
+// release marks one of the notifications about an event as done. The event is removed from the
+// outbox once all of them are, unless any of them should be delivered again. Such events are
+// dispatched again after the longest backoff of the retry policy, or after a restart if the
+// notifier is stopping.
+func (n *notifier) release(eventID string, keep bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	e, ok := n.inflight[eventID]
+	if !ok {
+		return
+	}
+
+	e.remaining--
+	e.keep = e.keep || keep
+
+	if e.remaining > 0 {
+		return
+	}
+
+	if e.keep {
+		select {
+		case <-n.stopping:
+		default:
+			time.AfterFunc(n.retry.maxBackoff, func() { n.redispatch(eventID, e) })
+		}
+		return
+	}
+
+	delete(n.inflight, eventID)
+
+	err := n.outbox.Done(eventID)
+	if err != nil {
+		n.logger.Error("failed to remove delivered event from outbox", "err", err.Error())
+	}
+}
+
+// redispatch lets an event that was kept be dispatched once more
+func (n *notifier) redispatch(eventID string, e *inflightEvent) {
+	n.mu.Lock()
+	if n.inflight[eventID] == e {
+		delete(n.inflight, eventID)
+	}
+	n.mu.Unlock()
+
+	n.wakeDispatcher()
+}
+
+// entity returns the entity of an event, and retrieves it if it is not part of the event or if
+// the event was restored from before a restart
+func (n *notifier) entity(ctx context.Context, event OutboxEvent) (types.Entity, error) {
+	n.mu.Lock()
+	restored := n.restored[event.ID]
+	delete(n.restored, event.ID)
+	n.mu.Unlock()
+
+	if event.Entity != nil && !restored {
+		return entities.NewFromJSON(event.Entity)
+	}
+
+	if n.resolve == nil {
+		return nil, fmt.Errorf("unable to retrieve entity %s", event.EntityID)
+	}
+
+	var e types.Entity
+
+	_, err := n.retrying(ctx, func() (err error) {
+		e, err = n.resolve(ctx, event.Tenant, event.EntityID)
+		if errors.Is(err, ngsierrors.ErrNotFound) {
+			return stopRetrying(err)
+		}
+		return err
+	})
+
+	return e, err
+}
+
+// post delivers a notification to its endpoint, and keeps it as a dead letter if it could not be delivered
+func (n *notifier) post(d delivery) (err error) {
+	ctx, span := tracer.Start(context.Background(), "post")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	attempts, err := n.deliver(ctx, d.Endpoint, d.ContentType, d.Body)
+	if err == nil {
+		n.metrics.recordDelivery(ctx, d, "delivered")
+		return nil
+	}
+
+	if errors.Is(err, errStopped) {
+		return err
+	}
+
+	n.metrics.recordDelivery(ctx, d, "failed")
+
+	if n.deadLetters == nil {
+		return err
+	}
+
+	dlerr := n.deadLetters.Add(d.Tenant, DeadLetter{
+		ID:             d.NotificationID,
+		SubscriptionID: d.SubscriptionID,
+		Endpoint:       d.Endpoint,
+		ContentType:    d.ContentType,
+		Notification:   d.Body,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+		FailedAt:       time.Now().UTC(),
+	})
+	if dlerr != nil {
+		return fmt.Errorf("%w, and it could not be kept as a dead letter: %w", err, dlerr)
+	}
+
+	return fmt.Errorf("%w, kept as dead letter %s after %d attempts", err, d.NotificationID, attempts)
+}
+
+func (n *notifier) DeadLetters(tenant string) []DeadLetter {
+	if n.deadLetters == nil {
+		return []DeadLetter{}
+	}
+
+	return n.deadLetters.List(tenant)
+}
+
+func (n *notifier) ReplayDeadLetters(ctx context.Context, tenant string, letterIDs []string) (*ReplayResult, error) {
+	letters := n.DeadLetters(tenant)
+
+	if len(letterIDs) > 0 {
+		letters = []DeadLetter{}
+
+		for _, id := range letterIDs {
+			letter, err := n.deadLetterStore().Get(tenant, id)
+			if err != nil {
+				return nil, err
+			}
+			letters = append(letters, *letter)
+		}
+	}
+
+	result := &ReplayResult{Replayed: []string{}, Failed: []string{}}
+
+	for _, letter := range letters {
+		err := postNotification(ctx, letter.Endpoint, letter.ContentType, letter.Notification)
+		if err == nil {
+			result.Replayed = append(result.Replayed, letter.ID)
+			err = n.deadLetters.Delete(tenant, letter.ID)
+		} else {
+			result.Failed = append(result.Failed, letter.ID)
+
+			letter.Attempts++
+			letter.LastError = err.Error()
+			letter.FailedAt = time.Now().UTC()
+			err = n.deadLetters.Update(tenant, letter)
+		}
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (n *notifier) DiscardDeadLetter(tenant, letterID string) error {
+	return n.deadLetterStore().Delete(tenant, letterID)
+}
+
+// deadLetterStore returns the dead letter store, or an empty store if the notifier does not have one
+func (n *notifier) deadLetterStore() DeadLetterStore {
+	if n.deadLetters == nil {
+		empty, _ := NewDeadLetterStore("")
+		return empty
+	}
+
+	return n.deadLetters
+}
+
+// asMap returns the generic JSON representation of an entity that filters are evaluated against
+func asMap(e types.Entity) (map[string]any, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := map[string]any{}
+	err = json.Unmarshal(b, &entity)
+
+	return entity, err
 }
@@ -2,12 +2,24 @@ package subscriptions
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	. "github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
 	testutils "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
 	"github.com/diwise/service-chassis/pkg/test/http/response"
@@ -49,14 +61,14 @@ func TestSingleNotificationOnCreate(t *testing.T) {
 			},
 		},
 	}
-	n, _ := NewNotifier(ctx, cfg)
+	n, _ := NewNotifier(ctx, cfg, nil)
 
 	n.Start()
 
 	e, err := entities.New(entityID, "Lifebuoy", Status("off"))
 	is.NoErr(err)
 
-	n.EntityCreated(ctx, e, "default")
+	committed(n.EntityCreated(ctx, e, "default"))
 
 	n.Stop()
 
@@ -76,7 +88,7 @@ func TestNotifierShouldBeNilIfNoNotifyEndpoints(t *testing.T) {
 			},
 		},
 	}
-	n, _ := NewNotifier(ctx, cfg)
+	n, _ := NewNotifier(ctx, cfg, nil)
 	is.True(n == nil)
 }
 
@@ -98,7 +110,7 @@ func TestNotifierShouldBeNotNilWhenConfigured(t *testing.T) {
 			},
 		},
 	}
-	n, _ := NewNotifier(ctx, cfg)
+	n, _ := NewNotifier(ctx, cfg, nil)
 	is.True(n != nil)
 }
 
@@ -131,16 +143,578 @@ func TestNotificationShouldNotBeSentForOtherTenant(t *testing.T) {
 			},
 		},
 	}
-	n, _ := NewNotifier(ctx, cfg)
+	n, _ := NewNotifier(ctx, cfg, nil)
 
 	n.Start()
 
 	e, err := entities.New(entityID, "Lifebuoy", Status("off"))
 	is.NoErr(err)
 
-	n.EntityCreated(ctx, e, "some other tenant")
+	committed(n.EntityCreated(ctx, e, "some other tenant"))
 
 	n.Stop()
 
 	is.Equal(s.RequestCount(), 0)
 }
+
+func TestThatSubscribersAreNotifiedWithTheSubscriptionID(t *testing.T) {
+	is := is.New(t)
+	const entityID string = "urn:ngsi-ld:Lifebuoy:mybuoy"
+
+	s := testutils.NewMockServiceThat(
+		Expects(
+			is,
+			method(http.MethodPost),
+			bodyContaining(`"subscriptionId": "urn:ngsi-ld:Subscription:buoys"`),
+		),
+		Returns(
+			response.Code(http.StatusOK),
+		),
+	)
+	defer s.Close()
+
+	store, _ := NewStore("")
+	store.Create("default", subscription("urn:ngsi-ld:Subscription:buoys", s.URL()))
+
+	others := subscription("urn:ngsi-ld:Subscription:devices", s.URL())
+	others.Entities = []subscriptions.EntityInfo{{Type: "Device"}}
+	store.Create("default", others)
+
+	e, err := entities.New(entityID, "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	resolver := func(ctx context.Context, tenant, entityID string) (types.Entity, error) {
+		return e, nil
+	}
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, config.Config{Tenants: []config.Tenant{{ID: "default"}}}, store, Resolver(resolver))
+	is.True(n.HasSubscriptions("default"))
+	is.True(!n.HasSubscriptions("other"))
+
+	n.Start()
+
+	committed(n.EntityUpdated(ctx, "default", entityID, nil))
+
+	n.Stop()
+
+	is.Equal(s.RequestCount(), 1) // should not notify the subscriber of devices
+}
+
+func TestThatNotificationsAreSentWithTheAttributesAndInTheFormatThatWasAskedFor(t *testing.T) {
+	is := is.New(t)
+	const entityID string = "urn:ngsi-ld:Lifebuoy:mybuoy"
+
+	received := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- string(body)
+	}))
+	defer s.Close()
+
+	sub := subscription("urn:ngsi-ld:Subscription:buoys", s.URL)
+	sub.Notification.Attributes = []string{"status"}
+	sub.Notification.Format = subscriptions.FormatKeyValues
+	sub.Notification.Endpoint.Accept = "application/ld+json"
+
+	store, _ := NewStore("")
+	store.Create("default", sub)
+
+	e, err := entities.New(entityID, "Lifebuoy", Status("off"), DateObserved("2024-01-01T00:00:00Z"))
+	is.NoErr(err)
+
+	resolver := func(ctx context.Context, tenant, entityID string) (types.Entity, error) {
+		return e, nil
+	}
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, config.Config{Tenants: []config.Tenant{{ID: "default"}}}, store, Resolver(resolver))
+
+	n.Start()
+	defer n.Stop()
+
+	committed(n.EntityUpdated(ctx, "default", entityID, nil))
+
+	r, body := <-received, <-bodies
+	is.Equal(r.Header.Get("Content-Type"), "application/ld+json")
+	is.True(strings.Contains(body, `"status": "off"`)) // should be in the keyValues format
+	is.True(!strings.Contains(body, "dateObserved"))   // should only hold the attributes that were asked for
+}
+
+func TestThatFailedNotificationsAreRetried(t *testing.T) {
+	is := is.New(t)
+
+	var requestCount atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestCount.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	deadLetters, _ := NewDeadLetterStore("")
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, retryConfig(s.URL, 3), nil, DeadLetters(deadLetters))
+
+	n.Start()
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	committed(n.EntityCreated(ctx, e, "default"))
+
+	// stopping the notifier cuts retries short, so wait for the notification to be delivered first
+	waitFor(is, func() bool { return requestCount.Load() == 3 })
+
+	n.Stop()
+
+	is.Equal(requestCount.Load(), int32(3))
+	is.Equal(len(deadLetters.List("default")), 0)
+}
+
+func TestThatUndeliverableNotificationsCanBeReplayed(t *testing.T) {
+	is := is.New(t)
+
+	var available atomic.Bool
+	var requestCount atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	deadLetters, _ := NewDeadLetterStore("")
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, retryConfig(s.URL, 2), nil, DeadLetters(deadLetters))
+
+	n.Start()
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	committed(n.EntityCreated(ctx, e, "default"))
+
+	waitFor(is, func() bool { return len(n.DeadLetters("default")) == 1 })
+
+	n.Stop()
+
+	is.Equal(requestCount.Load(), int32(2))
+
+	letters := n.DeadLetters("default")
+	is.Equal(len(letters), 1)
+	is.Equal(letters[0].Attempts, 2)
+	is.Equal(letters[0].Endpoint, s.URL)
+
+	result, err := n.ReplayDeadLetters(ctx, "default", nil)
+	is.NoErr(err)
+	is.Equal(result.Failed, []string{letters[0].ID}) // should fail while the endpoint is unavailable
+	is.Equal(n.DeadLetters("default")[0].Attempts, 3)
+
+	available.Store(true)
+
+	result, err = n.ReplayDeadLetters(ctx, "default", []string{letters[0].ID})
+	is.NoErr(err)
+	is.Equal(result.Replayed, []string{letters[0].ID})
+	is.Equal(len(n.DeadLetters("default")), 0)
+
+	_, err = n.ReplayDeadLetters(ctx, "default", []string{letters[0].ID})
+	is.True(err != nil) // should not find a dead letter that has been delivered
+}
+
+func TestThatPendingNotificationsAreDeliveredAfterARestart(t *testing.T) {
+	is := is.New(t)
+
+	var available atomic.Bool
+	var requestCount atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	outboxFile := filepath.Join(t.TempDir(), "outbox.jsonl")
+	outbox, err := NewOutbox(outboxFile)
+	is.NoErr(err)
+
+	// with a long backoff, the first failed attempt is all there is time for before the notifier is stopped
+	cfg := retryConfig(s.URL, 5)
+	cfg.Notifier.Retry.InitialBackoff = time.Minute
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, cfg, nil, Durable(outbox))
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	// the notifier is stopped before it has been able to deliver the notification
+	n.Start()
+	committed(n.EntityCreated(ctx, e, "default"))
+	n.Stop()
+
+	is.Equal(len(outbox.Pending()), 1)
+
+	available.Store(true)
+
+	outbox, err = NewOutbox(outboxFile)
+	is.NoErr(err)
+	is.Equal(len(outbox.Pending()), 1) // should have been kept in the outbox file
+
+	n, _ = NewNotifier(ctx, retryConfig(s.URL, 5), nil, Durable(outbox))
+	n.Start()
+
+	waitFor(is, func() bool { return len(outbox.Pending()) == 0 })
+
+	n.Stop()
+
+	is.Equal(requestCount.Load(), int32(1))
+}
+
+func TestThatChangesThatCouldNotBeWrittenToTheOutboxAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	outbox, err := NewOutbox(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	is.NoErr(err)
+	is.NoErr(outbox.Close())
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, retryConfig("http://localhost:1/notify", 1), nil, Durable(outbox))
+	defer n.Stop()
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	_, err = n.EntityCreated(ctx, e, "default")
+	is.True(err != nil) // should fail when the event could not be written
+
+	_, err = n.EntityUpdated(ctx, "default", "urn:ngsi-ld:Lifebuoy:mybuoy", nil)
+	is.True(err != nil) // should fail when the event could not be written
+}
+
+func TestThatKeptEventsAreDispatchedAgainAfterABackoff(t *testing.T) {
+	is := is.New(t)
+
+	cfg := retryConfig("http://localhost:1/notify", 1)
+	cfg.Notifier.Retry.MaxBackoff = 50 * time.Millisecond
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, cfg, nil)
+	defer n.Stop()
+
+	impl := n.(*notifier)
+
+	is.True(impl.track("event"))
+	impl.expect("event", 1)
+	impl.release("event", true)
+	impl.release("event", false)
+
+	is.True(!impl.track("event"))                           // should stay in flight for a while
+	waitFor(is, func() bool { return impl.track("event") }) // should be dispatched again once the backoff has passed
+}
+
+func TestThatChangesAreNotDispatchedUntilTheyAreCommitted(t *testing.T) {
+	is := is.New(t)
+
+	var requestCount atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	outbox, err := NewOutbox(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	is.NoErr(err)
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, retryConfig(s.URL, 1), nil, Durable(outbox))
+	n.Start()
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	created, err := n.EntityCreated(ctx, e, "default")
+	is.NoErr(err)
+	updated, err := n.EntityUpdated(ctx, "default", e.ID(), []string{"status"})
+	is.NoErr(err)
+
+	is.Equal(len(outbox.Pending()), 2) // should be written to the outbox before the changes are made
+
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(requestCount.Load(), int32(0)) // should not be dispatched before the changes are made
+
+	updated.Discard()
+	is.Equal(len(outbox.Pending()), 1) // should be removed from the outbox when the change could not be made
+
+	created.Commit()
+	waitFor(is, func() bool { return len(outbox.Pending()) == 0 })
+
+	n.Stop()
+
+	is.Equal(requestCount.Load(), int32(1))
+}
+
+func TestThatNewEntitiesAreRetrievedAfterARestart(t *testing.T) {
+	is := is.New(t)
+
+	var requestCount atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	outboxFile := filepath.Join(t.TempDir(), "outbox.jsonl")
+	outbox, err := NewOutbox(outboxFile)
+	is.NoErr(err)
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, retryConfig(s.URL, 1), nil, Durable(outbox))
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+
+	// the broker stops while the entity is being created
+	_, err = n.EntityCreated(ctx, e, "default")
+	is.NoErr(err)
+	n.Stop()
+
+	outbox, err = NewOutbox(outboxFile)
+	is.NoErr(err)
+
+	notFound := func(ctx context.Context, tenant, entityID string) (types.Entity, error) {
+		return nil, ngsierrors.NewNotFoundError("no such entity")
+	}
+
+	n, _ = NewNotifier(ctx, retryConfig(s.URL, 1), nil, Durable(outbox), Resolver(notFound))
+	n.Start()
+
+	waitFor(is, func() bool { return len(outbox.Pending()) == 0 })
+	n.Stop()
+
+	is.Equal(requestCount.Load(), int32(0)) // should not notify about an entity that was never created
+}
+
+func TestThatSpilledNotificationsAreRecoveredAfterARestart(t *testing.T) {
+	is := is.New(t)
+
+	var recovered, dispatched, other atomic.Int32
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "recovered") {
+			recovered.Add(1)
+		} else {
+			dispatched.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer a.Close()
+
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		other.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer b.Close()
+
+	dir := t.TempDir()
+	spillDir := filepath.Join(dir, "spill")
+
+	e, err := entities.New("urn:ngsi-ld:Lifebuoy:mybuoy", "Lifebuoy", Status("off"))
+	is.NoErr(err)
+	entity, err := json.Marshal(e)
+	is.NoErr(err)
+
+	outbox, err := NewOutbox(filepath.Join(dir, "outbox.jsonl"))
+	is.NoErr(err)
+	is.NoErr(outbox.Append(OutboxEvent{ID: "pending", Tenant: "default", EntityID: e.ID(), Entity: entity, Created: true}))
+
+	// the notification to the first endpoint was spilled to disk before the broker was restarted,
+	// along with a notification about an event that has been delivered since
+	is.NoErr(os.MkdirAll(spillDir, 0o755))
+	spilled := ""
+	for _, eventID := range []string{"pending", "done"} {
+		line, _ := json.Marshal(delivery{
+			EventID:        eventID,
+			Tenant:         "default",
+			SubscriptionID: "urn:ngsi-ld:Subscription:config:default:0",
+			Endpoint:       a.URL,
+			Body:           json.RawMessage(`{"id":"recovered"}`),
+		})
+		spilled += string(line) + "\n"
+	}
+	is.NoErr(os.WriteFile(filepath.Join(spillDir, "0123456789abcdef.jsonl"), []byte(spilled), 0o644))
+
+	cfg := config.Config{
+		Tenants: []config.Tenant{
+			{ID: "default", Notifications: []config.Notification{{Endpoint: a.URL}, {Endpoint: b.URL}}},
+		},
+	}
+
+	ctx := context.Background()
+	n, err := NewNotifier(ctx, cfg, nil, Durable(outbox), Spill(spillDir))
+	is.NoErr(err)
+	is.NoErr(n.Start())
+
+	waitFor(is, func() bool { return len(outbox.Pending()) == 0 })
+
+	n.Stop()
+
+	is.Equal(recovered.Load(), int32(1))  // should deliver the recovered notification about the pending event
+	is.Equal(dispatched.Load(), int32(0)) // should not notify the first endpoint about the event again
+	is.Equal(other.Load(), int32(1))      // should notify the other endpoint about the event
+
+	leftovers, _ := filepath.Glob(filepath.Join(spillDir, "*"+recoverySuffix))
+	is.Equal(len(leftovers), 0) // should remove recovered spill files
+}
+
+func TestThatASlowEndpointDoesNotHoldUpOtherEndpoints(t *testing.T) {
+	is := is.New(t)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	var requestCount atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	cfg := config.Config{
+		Tenants: []config.Tenant{
+			{ID: "slow", Notifications: []config.Notification{{Endpoint: slow.URL}}},
+			{ID: "fast", Notifications: []config.Notification{{Endpoint: fast.URL}}},
+		},
+		Notifier: config.NotifierConfig{
+			Queue: config.NotificationQueueConfig{Workers: 1},
+		},
+	}
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, cfg, nil)
+	n.Start()
+
+	for i := range 3 {
+		e, err := entities.New(fmt.Sprintf("urn:ngsi-ld:Lifebuoy:%d", i), "Lifebuoy", Status("off"))
+		is.NoErr(err)
+
+		committed(n.EntityCreated(ctx, e, "slow"))
+		committed(n.EntityCreated(ctx, e, "fast"))
+	}
+
+	waitFor(is, func() bool { return requestCount.Load() == 3 })
+
+	close(release)
+	n.Stop()
+}
+
+func TestThatNotificationsAreHeldBackWhileABlockingQueueIsFull(t *testing.T) {
+	is := is.New(t)
+
+	release := make(chan struct{})
+	var requestCount atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+
+	cfg := config.Config{
+		Tenants: []config.Tenant{
+			{ID: "default", Notifications: []config.Notification{{Endpoint: slow.URL}}},
+		},
+		Notifier: config.NotifierConfig{
+			Queue: config.NotificationQueueConfig{Size: 2, Workers: 1, Overflow: "block"},
+		},
+	}
+
+	ctx := context.Background()
+	n, _ := NewNotifier(ctx, cfg, nil)
+	n.Start()
+
+	const count = 200
+
+	for i := range count {
+		e, err := entities.New(fmt.Sprintf("urn:ngsi-ld:Lifebuoy:%d", i), "Lifebuoy", Status("off"))
+		is.NoErr(err)
+		is.NoErr(committed(n.EntityCreated(ctx, e, "default")))
+	}
+
+	impl := n.(*notifier)
+
+	heldBack := func() int {
+		impl.mu.Lock()
+		defer impl.mu.Unlock()
+		return len(impl.heldBack[slow.URL])
+	}
+
+	// one notification is being delivered and two are queued, the rest should be held back
+	waitFor(is, func() bool { return heldBack() == count-3 })
+
+	q, err := impl.queue(slow.URL)
+	is.NoErr(err)
+	is.Equal(q.length(), 2) // should not queue more notifications than there is room for
+
+	close(release)
+
+	waitFor(is, func() bool { return requestCount.Load() == count })
+	is.Equal(heldBack(), 0)
+
+	n.Stop()
+}
+
+func retryConfig(endpoint string, maxAttempts int) config.Config {
+	return config.Config{
+		Tenants: []config.Tenant{
+			{
+				ID:            "default",
+				Notifications: []config.Notification{{Endpoint: endpoint}},
+			},
+		},
+		Notifier: config.NotifierConfig{
+			Retry: config.NotificationRetryConfig{
+				MaxAttempts:    maxAttempts,
+				InitialBackoff: time.Millisecond,
+			},
+		},
+	}
+}
+
+// committed commits a change as soon as it has been written to the outbox
+func committed(change Change, err error) error {
+	if err == nil {
+		change.Commit()
+	}
+
+	return err
+}
+
+// waitFor waits a little while for a condition to become true
+func waitFor(is *is.I, condition func() bool) {
+	for range 100 {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	is.Fail() // condition was never met
+}
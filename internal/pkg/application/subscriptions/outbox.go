@@ -0,0 +1,370 @@
+package subscriptions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OutboxEvent is a change to an entity that the subscribers have yet to be notified about
+type OutboxEvent struct {
+	ID       string `json:"id"`
+	Tenant   string `json:"tenant"`
+	EntityID string `json:"entityId"`
+	// Entity is the entity after the change, or nil if it has to be retrieved before the
+	// subscribers can be notified
+	Entity json.RawMessage `json:"entity,omitempty"`
+	// Attributes are the names of the attributes that were changed, where nil means that it is
+	// not known which attributes that were changed
+	Attributes []string  `json:"attributes"`
+	Created    bool      `json:"created,omitempty"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// Outbox keeps track of the events that the subscribers have yet to be notified about, so that
+// no event is lost if the broker is stopped, or crashes, before the notifications are delivered
+type Outbox interface {
+	// Append does not return until the event has been flushed to disk, along with any other
+	// events that were appended at the same time
+	Append(event OutboxEvent) error
+	// Pending returns the events that have not been marked as done, in the order they were appended
+	Pending() []OutboxEvent
+	// Done marks an event as done. It is not flushed to disk on its own, as the worst that can
+	// happen if it is lost in a crash is that the event is delivered once more after a restart.
+	Done(eventID string) error
+	Close() error
+}
+
+// compactOutboxAfter is the number of events that are marked as done before the outbox file is
+// rewritten without them
+const compactOutboxAfter int = 256
+
+type outboxRecord struct {
+	Event *OutboxEvent `json:"event,omitempty"`
+	Done  string       `json:"done,omitempty"`
+}
+
+type outbox struct {
+	mu sync.Mutex
+	// flushed is signalled whenever the outbox file has been flushed to disk, or failed to be
+	flushed  *sync.Cond
+	filePath string
+	file     *os.File
+
+	pending []OutboxEvent
+	done    int
+
+	// written is the number of records that have been written to the file, and synced the number
+	// of them that are known to have been flushed to disk. Records that are written while the file
+	// is being flushed are flushed together once it is done, so that appends share one fsync.
+	written  uint64
+	synced   uint64
+	flushing bool
+
+	// broken is set when a record could not be written, or the file could not be flushed, and
+	// means that the file has to be rewritten from the pending events before it is appended to
+	broken     bool
+	failedUpTo uint64
+	failure    error
+}
+
+// NewOutbox creates an outbox that is backed by an append-only file at filePath. Any events that
+// are still pending in the file are loaded, so that they can be delivered after a restart. If
+// filePath is empty, the outbox will only be kept in memory.
+func NewOutbox(filePath string) (Outbox, error) {
+	o := &outbox{
+		filePath: filePath,
+		pending:  []OutboxEvent{},
+	}
+	o.flushed = sync.NewCond(&o.mu)
+
+	if filePath == "" {
+		return o, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for outbox: %w", err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read outbox from %s: %w", filePath, err)
+	}
+
+	err = o.load(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox from %s: %w", filePath, err)
+	}
+
+	// start over with a file that only contains the pending events
+	err = o.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// load replays the records in the outbox file. A crash while a record was being appended may
+// have left an incomplete last line behind, which is ignored since that event was never
+// acknowledged.
+func (o *outbox) load(contents []byte) error {
+	reader := bufio.NewReader(bytes.NewReader(contents))
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		complete := err == nil
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			record := outboxRecord{}
+			jsonErr := json.Unmarshal(line, &record)
+
+			if jsonErr != nil && complete {
+				return jsonErr
+			}
+
+			if jsonErr == nil {
+				o.apply(record)
+			}
+		}
+
+		if !complete {
+			return nil
+		}
+	}
+}
+
+func (o *outbox) apply(record outboxRecord) {
+	if record.Event != nil {
+		o.pending = append(o.pending, *record.Event)
+	} else if record.Done != "" {
+		o.pending = slices.DeleteFunc(o.pending, func(e OutboxEvent) bool {
+			return e.ID == record.Done
+		})
+	}
+}
+
+func (o *outbox) Append(event OutboxEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// the event is pending before it is written, so that it is part of the file if it is
+	// rewritten while the event is being flushed
+	o.apply(outboxRecord{Event: &event})
+
+	seq, err := o.write(outboxRecord{Event: &event})
+	if err == nil {
+		err = o.flush(seq)
+	}
+
+	if err != nil {
+		// the event was not acknowledged, so it is left out when the file is rewritten
+		o.apply(outboxRecord{Done: event.ID})
+		return err
+	}
+
+	return nil
+}
+
+func (o *outbox) Pending() []OutboxEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return slices.Clone(o.pending)
+}
+
+func (o *outbox) Done(eventID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !slices.ContainsFunc(o.pending, func(e OutboxEvent) bool { return e.ID == eventID }) {
+		return nil
+	}
+
+	o.apply(outboxRecord{Done: eventID})
+
+	_, err := o.write(outboxRecord{Done: eventID})
+	if err != nil {
+		return err
+	}
+
+	o.done++
+
+	if o.done >= compactOutboxAfter {
+		return o.compact()
+	}
+
+	return nil
+}
+
+func (o *outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for o.flushing {
+		o.flushed.Wait()
+	}
+
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.file.Sync()
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	o.file = nil
+
+	return err
+}
+
+// write appends a record to the outbox file without flushing it, and returns the sequence number
+// that has to be flushed for the record to be on disk
+func (o *outbox) write(record outboxRecord) (uint64, error) {
+	if o.filePath == "" {
+		return 0, nil
+	}
+
+	if o.file == nil {
+		return 0, fmt.Errorf("outbox is closed")
+	}
+
+	if !o.broken {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal outbox record: %w", err)
+		}
+
+		_, err = o.file.Write(append(line, '\n'))
+		if err == nil {
+			o.written++
+			return o.written, nil
+		}
+
+		o.broken = true
+	}
+
+	// rewrite the file from the pending events, so that a partially written record does not end
+	// up in the middle of it. The rewritten file is already flushed.
+	err := o.compact()
+	if err != nil {
+		return 0, err
+	}
+
+	return o.synced, nil
+}
+
+// flush waits until the records up to seq have been flushed to disk. A single flush is made at a
+// time, and it covers every record that was written before it started.
+func (o *outbox) flush(seq uint64) error {
+	for o.synced < seq {
+		if o.failedUpTo >= seq {
+			return o.failure
+		}
+
+		if o.flushing {
+			o.flushed.Wait()
+			continue
+		}
+
+		o.flushing = true
+		target := o.written
+		f := o.file
+
+		o.mu.Unlock()
+		err := f.Sync()
+		o.mu.Lock()
+
+		o.flushing = false
+
+		if err != nil {
+			// a failed fsync may have dropped any of the records written so far, so the file is
+			// rewritten before anything more is appended to it
+			o.broken = true
+			o.failedUpTo = o.written
+			o.failure = fmt.Errorf("failed to flush outbox: %w", err)
+		} else {
+			o.synced = max(o.synced, target)
+		}
+
+		o.flushed.Broadcast()
+	}
+
+	return nil
+}
+
+// compact replaces the outbox file with one that only contains the pending events. The new file
+// is written to a temporary file and then renamed, so that a crash while writing never leaves
+// a partially written outbox behind.
+func (o *outbox) compact() error {
+	if o.filePath == "" {
+		return nil
+	}
+
+	// the file can not be replaced while it is being flushed
+	for o.flushing {
+		o.flushed.Wait()
+	}
+
+	contents := bytes.Buffer{}
+	for _, event := range o.pending {
+		line, err := json.Marshal(outboxRecord{Event: &event})
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox record: %w", err)
+		}
+		contents.Write(append(line, '\n'))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.filePath), filepath.Base(o.filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary outbox file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(contents.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), o.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace outbox: %w", err)
+	}
+
+	f, err := os.OpenFile(o.filePath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		o.broken = true
+		return fmt.Errorf("failed to open outbox: %w", err)
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+
+	o.file = f
+	o.done = 0
+	o.broken = false
+	// everything that has been written so far is part of the new file
+	o.synced = o.written
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestThatPendingEventsAreLoadedFromTheOutbox(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := NewOutbox(filePath)
+	is.NoErr(err)
+
+	is.NoErr(outbox.Append(OutboxEvent{ID: "1", Tenant: "default", EntityID: "urn:ngsi-ld:Device:01"}))
+	is.NoErr(outbox.Append(OutboxEvent{ID: "2", Tenant: "default", EntityID: "urn:ngsi-ld:Device:02", Entity: json.RawMessage(`{"id":"urn:ngsi-ld:Device:02"}`)}))
+	is.NoErr(outbox.Append(OutboxEvent{ID: "3", Tenant: "default", EntityID: "urn:ngsi-ld:Device:03", Attributes: []string{}}))
+	is.NoErr(outbox.Done("1"))
+
+	// simulate a crash while an event was being appended
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0o644)
+	is.NoErr(err)
+	f.WriteString(`{"event":{"id":"4","ten`)
+	f.Close()
+
+	outbox, err = NewOutbox(filePath)
+	is.NoErr(err)
+
+	pending := outbox.Pending()
+	is.Equal(len(pending), 2)
+	is.Equal(pending[0].ID, "2")
+	is.Equal(string(pending[0].Entity), `{"id":"urn:ngsi-ld:Device:02"}`)
+	is.True(pending[0].Attributes == nil) // unknown attributes should remain unknown
+	is.Equal(pending[1].Attributes, []string{})
+}
+
+func TestThatTheOutboxIsCompacted(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := NewOutbox(filePath)
+	is.NoErr(err)
+
+	for i := range compactOutboxAfter + 1 {
+		id := fmt.Sprintf("%d", i)
+		is.NoErr(outbox.Append(OutboxEvent{ID: id, Tenant: "default"}))
+		is.NoErr(outbox.Done(id))
+	}
+
+	is.NoErr(outbox.Append(OutboxEvent{ID: "pending", Tenant: "default"}))
+
+	contents, err := os.ReadFile(filePath)
+	is.NoErr(err)
+	is.True(len(contents) < 500) // should only contain the records since the last compaction
+
+	outbox, err = NewOutbox(filePath)
+	is.NoErr(err)
+	is.Equal(len(outbox.Pending()), 1)
+}
+
+func TestThatACorruptOutboxIsRejected(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "outbox.jsonl")
+	is.NoErr(os.WriteFile(filePath, []byte("garbage\n{\"done\":\"1\"}\n"), 0o644))
+
+	_, err := NewOutbox(filePath)
+	is.True(err != nil)
+}
+
+func TestThatConcurrentAppendsAreAllFlushedToTheOutbox(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := NewOutbox(filePath)
+	is.NoErr(err)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			is.NoErr(outbox.Append(OutboxEvent{ID: fmt.Sprintf("%d", i), Tenant: "default"}))
+		}()
+	}
+	wg.Wait()
+
+	is.NoErr(outbox.Close())
+	is.True(outbox.Append(OutboxEvent{ID: "closed", Tenant: "default"}) != nil) // should not append to a closed outbox
+	is.Equal(len(outbox.Pending()), 50)
+
+	outbox, err = NewOutbox(filePath)
+	is.NoErr(err)
+	is.Equal(len(outbox.Pending()), 50)
+}
@@ -0,0 +1,448 @@
+package subscriptions
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expression is a parsed NGSI-LD q expression that can be evaluated against an entity
+// that has been decoded into its generic JSON representation
+type expression interface {
+	eval(entity map[string]any) bool
+}
+
+type and []expression
+type or []expression
+
+func (a and) eval(entity map[string]any) bool {
+	for _, e := range a {
+		if !e.eval(entity) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o or) eval(entity map[string]any) bool {
+	for _, e := range o {
+		if e.eval(entity) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributePath points out a value within an entity, such as temperature, for the value of
+// an attribute, temperature.observedBy for a sub-attribute or address[city] for a member of
+// a compound value
+type attributePath struct {
+	attributes []string
+	members    []string
+}
+
+type existence struct {
+	path   attributePath
+	exists bool
+}
+
+func (e existence) eval(entity map[string]any) bool {
+	_, ok := e.path.valueOf(entity)
+	return ok == e.exists
+}
+
+type comparison struct {
+	path     attributePath
+	operator string
+
+	values     []any // one or more values, where a match with any of them is enough
+	min, max   any   // the bounds of a range, if the comparison is against a range
+	isRange    bool
+	expression *regexp.Regexp
+}
+
+func (c comparison) eval(entity map[string]any) bool {
+	value, ok := c.path.valueOf(entity)
+	if !ok {
+		return false
+	}
+
+	if list, ok := value.([]any); ok {
+		return slices.ContainsFunc(list, c.matches)
+	}
+
+	return c.matches(value)
+}
+
+func (c comparison) matches(value any) bool {
+	switch c.operator {
+	case "~=", "!~=":
+		s, ok := value.(string)
+		return ok && c.expression.MatchString(s) == (c.operator == "~=")
+	case "==", "!=":
+		equal := false
+		if c.isRange {
+			low, lok := compare(value, c.min)
+			high, hok := compare(value, c.max)
+			equal = lok && hok && low >= 0 && high <= 0
+		} else {
+			equal = slices.ContainsFunc(c.values, func(v any) bool {
+				result, ok := compare(value, v)
+				return ok && result == 0
+			})
+		}
+		return equal == (c.operator == "==")
+	}
+
+	result, ok := compare(value, c.values[0])
+	if !ok {
+		return false
+	}
+
+	switch c.operator {
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	default:
+		return result <= 0
+	}
+}
+
+// compare returns -1, 0 or 1 depending on how a compares to b, or false if they are of
+// types that can not be compared. Strings that are both timestamps are compared in time.
+func compare(a, b any) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			return cmp.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			return 1, true
+		}
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		at, aerr := time.Parse(time.RFC3339Nano, av)
+		bt, berr := time.Parse(time.RFC3339Nano, bv)
+		if aerr == nil && berr == nil {
+			return at.Compare(bt), true
+		}
+
+		return strings.Compare(av, bv), true
+	}
+
+	return 0, false
+}
+
+// valueOf returns the value that the path points to in the entity. Attributes may be either
+// normalized, with their value in a value or object member, or given as key values.
+func (p attributePath) valueOf(entity map[string]any) (any, bool) {
+	var value any = entity
+
+	for _, name := range p.attributes {
+		parent, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = parent[name]; !ok {
+			return nil, false
+		}
+	}
+
+	if attr, ok := value.(map[string]any); ok {
+		if v, ok := attr["value"]; ok {
+			value = v
+		} else if o, ok := attr["object"]; ok {
+			value = o
+		}
+	}
+
+	for _, member := range p.members {
+		compound, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = compound[member]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+var operators = []string{"==", "!=", ">=", "<=", "!~=", "~=", ">", "<"}
+
+// parseQuery parses a q expression, in which terms are combined with ; (and) and | (or),
+// and where ; binds harder than |
+func parseQuery(q string) (expression, error) {
+	p := &queryParser{q: q}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.q) {
+		return nil, fmt.Errorf("unexpected %q at position %d in q", p.q[p.pos], p.pos)
+	}
+
+	return expr, nil
+}
+
+type queryParser struct {
+	q   string
+	pos int
+}
+
+func (p *queryParser) parseOr() (expression, error) {
+	terms := or{}
+
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, term)
+
+		if !p.consume('|') {
+			break
+		}
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (expression, error) {
+	terms := and{}
+
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		terms = append(terms, term)
+
+		if !p.consume(';') {
+			break
+		}
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+
+	return terms, nil
+}
+
+func (p *queryParser) parseTerm() (expression, error) {
+	if p.consume('(') {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(')') {
+			return nil, fmt.Errorf("missing closing parenthesis in q")
+		}
+
+		return expr, nil
+	}
+
+	if p.consume('!') {
+		path, err := parseAttributePath(p.until(";|)"))
+		if err != nil {
+			return nil, err
+		}
+
+		return existence{path: path, exists: false}, nil
+	}
+
+	start := p.pos
+	end := p.pos
+	for end < len(p.q) && !strings.ContainsRune("=!<>~;|)", rune(p.q[end])) {
+		end++
+	}
+
+	path, err := parseAttributePath(p.q[start:end])
+	if err != nil {
+		return nil, err
+	}
+
+	p.pos = end
+
+	operator := ""
+	for _, op := range operators {
+		if strings.HasPrefix(p.q[p.pos:], op) {
+			operator = op
+			break
+		}
+	}
+
+	if operator == "" {
+		return existence{path: path, exists: true}, nil
+	}
+
+	p.pos += len(operator)
+
+	return newComparison(path, operator, p.value())
+}
+
+// value returns the raw value of a comparison, which ends where the term does unless
+// the delimiter is within a quoted string
+func (p *queryParser) value() string {
+	start := p.pos
+	quoted := false
+
+	for ; p.pos < len(p.q); p.pos++ {
+		c := p.q[p.pos]
+
+		if c == '"' {
+			quoted = !quoted
+		} else if !quoted && strings.ContainsRune(";|)", rune(c)) {
+			break
+		}
+	}
+
+	return p.q[start:p.pos]
+}
+
+func (p *queryParser) until(delimiters string) string {
+	start := p.pos
+	for p.pos < len(p.q) && !strings.ContainsRune(delimiters, rune(p.q[p.pos])) {
+		p.pos++
+	}
+	return p.q[start:p.pos]
+}
+
+func (p *queryParser) consume(c byte) bool {
+	if p.pos < len(p.q) && p.q[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func parseAttributePath(s string) (attributePath, error) {
+	path := attributePath{}
+
+	attributes, members, hasMembers := strings.Cut(s, "[")
+	if attributes == "" {
+		return path, fmt.Errorf("missing attribute name in q")
+	}
+
+	path.attributes = strings.Split(attributes, ".")
+
+	if hasMembers {
+		members, ok := strings.CutSuffix(members, "]")
+		if !ok {
+			return path, fmt.Errorf("missing closing bracket in q attribute %q", s)
+		}
+
+		path.members = strings.Split(strings.ReplaceAll(members, "][", "."), ".")
+	}
+
+	for _, name := range slices.Concat(path.attributes, path.members) {
+		if name == "" {
+			return path, fmt.Errorf("invalid q attribute %q", s)
+		}
+	}
+
+	return path, nil
+}
+
+func newComparison(path attributePath, operator, raw string) (expression, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("missing value after %s in q", operator)
+	}
+
+	c := comparison{path: path, operator: operator}
+
+	if operator == "~=" || operator == "!~=" {
+		pattern, err := strconv.Unquote(raw)
+		if err != nil {
+			pattern = raw
+		}
+
+		c.expression, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in q", pattern)
+		}
+
+		return c, nil
+	}
+
+	if operator == "==" || operator == "!=" {
+		if low, high, ok := strings.Cut(raw, ".."); ok && !strings.HasPrefix(raw, `"`) {
+			c.isRange = true
+			c.min, c.max = literal(low), literal(high)
+			return c, nil
+		}
+
+		for _, v := range splitList(raw) {
+			c.values = append(c.values, literal(v))
+		}
+
+		return c, nil
+	}
+
+	c.values = []any{literal(raw)}
+
+	return c, nil
+}
+
+// splitList splits a comma separated list of values, leaving commas within quotes alone
+func splitList(raw string) []string {
+	values := []string{}
+	start, quoted := 0, false
+
+	for i, c := range raw {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ',' && !quoted {
+			values = append(values, raw[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(values, raw[start:])
+}
+
+// literal converts a value in a q expression into the type it would have in JSON. Values
+// that are neither quoted, numbers nor booleans, such as timestamps, are kept as strings.
+func literal(raw string) any {
+	if s, err := strconv.Unquote(raw); err == nil {
+		return s
+	}
+
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+
+	if b, err := strconv.ParseBool(raw); err == nil && (raw == "true" || raw == "false") {
+		return b
+	}
+
+	return raw
+}
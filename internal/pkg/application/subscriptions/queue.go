@@ -0,0 +1,452 @@
+package subscriptions
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+)
+
+const (
+	dropOldest    string = "dropOldest"
+	blockWhenFull string = "block"
+	spillToDisk   string = "spill"
+)
+
+const (
+	defaultQueueSize    int = 1000
+	defaultQueueWorkers int = 2
+)
+
+// errQueueFull is returned when a notification is pushed to a full queue whose overflow policy
+// is to block, so that the notification can be held back until there is room for it
+var errQueueFull = errors.New("notification queue is full")
+
+// queuePolicy controls the size of the queue of each notification endpoint, the number of workers
+// that deliver notifications from it, and what happens when it overflows
+type queuePolicy struct {
+	size     int
+	workers  int
+	overflow string
+	spillDir string
+}
+
+// newQueuePolicy creates the policy of the notification queues. Notifications are spilled to
+// spillDir by default, or held back until there is room in the queue if there is no directory
+// to spill them to.
+func newQueuePolicy(cfg config.NotificationQueueConfig, spillDir string) (queuePolicy, error) {
+	p := queuePolicy{
+		size:     cfg.Size,
+		workers:  cfg.Workers,
+		overflow: cfg.Overflow,
+		spillDir: spillDir,
+	}
+
+	if p.size <= 0 {
+		p.size = defaultQueueSize
+	}
+
+	if p.workers <= 0 {
+		p.workers = defaultQueueWorkers
+	}
+
+	if p.overflow == "" {
+		p.overflow = blockWhenFull
+		if spillDir != "" {
+			p.overflow = spillToDisk
+		}
+	}
+
+	if !slices.Contains([]string{dropOldest, blockWhenFull, spillToDisk}, p.overflow) {
+		return p, fmt.Errorf("unknown notification queue overflow policy %q", p.overflow)
+	}
+
+	if p.overflow == spillToDisk && spillDir == "" {
+		return p, fmt.Errorf("notifications can not be spilled to disk without a storage path")
+	}
+
+	return p, nil
+}
+
+// delivery is a notification that is queued for delivery to an endpoint
+type delivery struct {
+	EventID        string          `json:"eventId"`
+	Tenant         string          `json:"tenant"`
+	SubscriptionID string          `json:"subscriptionId"`
+	NotificationID string          `json:"notificationId"`
+	Endpoint       string          `json:"endpoint"`
+	ContentType    string          `json:"contentType,omitempty"`
+	Body           json.RawMessage `json:"body"`
+	AcceptedAt     time.Time       `json:"acceptedAt"`
+}
+
+// endpointQueue holds the notifications that are waiting to be delivered to a single endpoint, so
+// that a slow or unreachable endpoint does not hold up the notifications to any other endpoint
+type endpointQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+
+	endpoint string
+	policy   queuePolicy
+	items    []delivery
+	spill    *spillFile
+
+	// closed queues accept no more deliveries, but the ones already queued are still delivered.
+	// The deliveries of abandoned queues are discarded.
+	closed    bool
+	abandoned bool
+}
+
+func newEndpointQueue(endpoint string, policy queuePolicy) (*endpointQueue, error) {
+	q := &endpointQueue{
+		endpoint: endpoint,
+		policy:   policy,
+		items:    []delivery{},
+	}
+
+	q.notEmpty = sync.NewCond(&q.mu)
+
+	if policy.overflow == spillToDisk {
+		var err error
+		q.spill, err = newSpillFile(policy.spillDir, endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// push adds a delivery to the end of the queue, and returns any delivery that had to be dropped
+// to make room for it. A full queue whose overflow policy is to block returns errQueueFull rather
+// than wait for room, since whoever pushed the delivery may have deliveries to other endpoints to
+// push as well.
+func (q *endpointQueue) push(d delivery) (*delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || q.abandoned {
+		return nil, errStopped
+	}
+
+	full := len(q.items) >= q.policy.size
+
+	var dropped *delivery
+
+	switch {
+	case q.spill != nil && (full || q.spill.length() > 0):
+		// keep spilling until the spilled deliveries have been read back, so that they are
+		// delivered in the order they were queued
+		err := q.spill.append(d)
+		if err != nil {
+			return nil, err
+		}
+	case full && q.policy.overflow == blockWhenFull:
+		return nil, errQueueFull
+	case full:
+		oldest := q.items[0]
+		dropped = &oldest
+		q.items = append(q.items[1:], d)
+	default:
+		q.items = append(q.items, d)
+	}
+
+	q.notEmpty.Signal()
+
+	return dropped, nil
+}
+
+// pop removes the delivery at the front of the queue, and waits for one to be pushed if the queue
+// is empty. It returns false once the queue has been closed and emptied, or abandoned. A
+// *spillReadError is returned if spilled deliveries could not be read back.
+func (q *endpointQueue) pop() (delivery, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.depth() == 0 && !q.closed && !q.abandoned {
+		q.notEmpty.Wait()
+	}
+
+	if q.abandoned || q.depth() == 0 {
+		return delivery{}, false, nil
+	}
+
+	if len(q.items) == 0 && q.spill != nil {
+		var err error
+		q.items, err = q.spill.read(q.policy.size)
+		if err != nil {
+			return delivery{}, true, err
+		}
+	}
+
+	d := q.items[0]
+	q.items = q.items[1:]
+
+	return d, true, nil
+}
+
+// close stops the queue from accepting deliveries, and lets the workers finish once it is empty
+func (q *endpointQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+}
+
+// abandon discards the deliveries that are left in the queue, and returns the ids of the events
+// that they stem from
+func (q *endpointQueue) abandon() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	discarded := []string{}
+	for _, d := range q.items {
+		discarded = append(discarded, d.EventID)
+	}
+
+	q.items = []delivery{}
+
+	if q.spill != nil {
+		discarded = append(discarded, q.spill.discard()...)
+	}
+
+	q.abandoned = true
+	q.notEmpty.Broadcast()
+
+	return discarded
+}
+
+func (q *endpointQueue) length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.depth()
+}
+
+// hasRoom reports whether a delivery can be pushed to the queue without it overflowing
+func (q *endpointQueue) hasRoom() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.depth() < q.policy.size
+}
+
+func (q *endpointQueue) depth() int {
+	depth := len(q.items)
+	if q.spill != nil {
+		depth += q.spill.length()
+	}
+	return depth
+}
+
+// spillReadError reports that spilled deliveries could not be read back, along with the ids of
+// the events that the lost deliveries stem from
+type spillReadError struct {
+	err      error
+	eventIDs []string
+}
+
+func (e *spillReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *spillReadError) Unwrap() error {
+	return e.err
+}
+
+// spillFile holds the deliveries that did not fit in the queue of an endpoint. The ids of the
+// events that they stem from are kept in memory, so that the events can be released if the
+// deliveries can not be read back. Spill files that are left behind by a restart are recovered
+// when the notifier is started again.
+type spillFile struct {
+	path     string
+	eventIDs []string
+	offset   int64
+}
+
+// spillFileSuffix is the suffix of spill files, and recoverySuffix that of spill files that are
+// being recovered after a restart
+const (
+	spillFileSuffix string = ".jsonl"
+	recoverySuffix  string = ".recovering"
+)
+
+func newSpillFile(dir, endpoint string) (*spillFile, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no directory to spill notifications to")
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	hash := sha256.Sum256([]byte(endpoint))
+	path := filepath.Join(dir, hex.EncodeToString(hash[:8])+spillFileSuffix)
+
+	// any spill file that was left behind by a restart has been moved aside and recovered before
+	// the queues are created, so an existing file can only hold deliveries that have been read
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	return &spillFile{path: path}, f.Close()
+}
+
+func (s *spillFile) length() int {
+	return len(s.eventIDs)
+}
+
+func (s *spillFile) append(d delivery) error {
+	line, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spilled notification: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to spill notification: %w", err)
+	}
+
+	s.eventIDs = append(s.eventIDs, d.EventID)
+
+	return nil
+}
+
+// read returns up to max of the oldest spilled deliveries, and empties the file once all of
+// them have been read. If the file can not be read there is no telling where the next delivery
+// starts, so the rest of the spilled deliveries are let go of and a *spillReadError is returned.
+func (s *spillFile) read(max int) (deliveries []delivery, err error) {
+	deliveries = []delivery{}
+
+	if len(s.eventIDs) == 0 {
+		return deliveries, nil
+	}
+
+	defer func() {
+		if err != nil {
+			err = &spillReadError{err: err, eventIDs: s.discard()}
+		} else if len(s.eventIDs) == 0 {
+			s.discard()
+		}
+	}()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return deliveries, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Seek(s.offset, io.SeekStart)
+	if err != nil {
+		return deliveries, fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	reader := bufio.NewReader(f)
+
+	for len(deliveries) < max && len(s.eventIDs) > 0 {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return deliveries, fmt.Errorf("failed to read spill file: %w", err)
+		}
+
+		d := delivery{}
+		err = json.Unmarshal(line, &d)
+		if err != nil {
+			return deliveries, fmt.Errorf("failed to unmarshal spilled notification: %w", err)
+		}
+
+		s.offset += int64(len(line))
+		s.eventIDs = s.eventIDs[1:]
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// discard empties the file, and returns the ids of the events that the deliveries in it stem from
+func (s *spillFile) discard() []string {
+	discarded := s.eventIDs
+
+	s.eventIDs, s.offset = nil, 0
+	os.Truncate(s.path, 0)
+
+	return discarded
+}
+
+// recoverSpillFiles moves the spill files in dir aside, and calls requeue with the deliveries in
+// each of them before it is removed. Files that were moved aside by an earlier recovery that
+// did not finish are recovered as well. Reading a file stops at the first delivery that can not
+// be read, since it is not known where the next one starts.
+func recoverSpillFiles(dir string, requeue func(delivery)) error {
+	spilled, err := filepath.Glob(filepath.Join(dir, "*"+spillFileSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range spilled {
+		// a unique name keeps a file that is already being recovered from being overwritten
+		err = os.Rename(path, fmt.Sprintf("%s.%d%s", path, time.Now().UnixNano(), recoverySuffix))
+		if err != nil {
+			return fmt.Errorf("failed to move spill file aside: %w", err)
+		}
+	}
+
+	recovering, err := filepath.Glob(filepath.Join(dir, "*"+recoverySuffix))
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(recovering)
+
+	for _, path := range recovering {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open spill file: %w", err)
+		}
+
+		reader := bufio.NewReader(f)
+
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+
+			d := delivery{}
+			if json.Unmarshal(line, &d) != nil {
+				break
+			}
+
+			requeue(d)
+		}
+
+		f.Close()
+
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove recovered spill file: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/matryer/is"
+)
+
+func TestThatTheOldestNotificationIsDroppedWhenTheQueueIsFull(t *testing.T) {
+	is := is.New(t)
+
+	q := newTestQueue(is, config.NotificationQueueConfig{Size: 2, Overflow: "dropOldest"}, "")
+
+	for i := range 3 {
+		dropped, err := q.push(delivery{EventID: fmt.Sprintf("%d", i)})
+		is.NoErr(err)
+
+		if i < 2 {
+			is.True(dropped == nil)
+		} else {
+			is.Equal(dropped.EventID, "0") // should drop the oldest notification
+		}
+	}
+
+	is.Equal(popEventIDs(is, q, 2), []string{"1", "2"})
+}
+
+func TestThatNotificationsAreSpilledToDiskWhenTheQueueIsFull(t *testing.T) {
+	is := is.New(t)
+
+	q := newTestQueue(is, config.NotificationQueueConfig{Size: 2, Overflow: "spill"}, t.TempDir())
+
+	for i := range 5 {
+		dropped, err := q.push(delivery{EventID: fmt.Sprintf("%d", i), Body: []byte(`{"id":"urn:ngsi-ld:Notification:01"}`)})
+		is.NoErr(err)
+		is.True(dropped == nil)
+	}
+
+	is.Equal(q.length(), 5)
+	is.Equal(popEventIDs(is, q, 3), []string{"0", "1", "2"})
+
+	// should keep the order when more notifications are queued while some are spilled
+	q.push(delivery{EventID: "5"})
+
+	is.Equal(popEventIDs(is, q, 3), []string{"3", "4", "5"})
+	is.Equal(q.length(), 0)
+}
+
+func TestThatABlockingQueueDoesNotGrowPastItsSize(t *testing.T) {
+	is := is.New(t)
+
+	q := newTestQueue(is, config.NotificationQueueConfig{Size: 2, Overflow: "block"}, "")
+
+	for i := range 1000 {
+		dropped, err := q.push(delivery{EventID: fmt.Sprintf("%d", i)})
+		is.True(dropped == nil)
+
+		if i < 2 {
+			is.NoErr(err)
+		} else {
+			is.True(errors.Is(err, errQueueFull)) // should refuse notifications rather than hold on to them
+		}
+	}
+
+	is.Equal(q.length(), 2)
+	is.True(!q.hasRoom())
+	is.Equal(popEventIDs(is, q, 1), []string{"0"})
+	is.True(q.hasRoom()) // should make room when a notification is popped
+
+	_, err := q.push(delivery{EventID: "1000"})
+	is.NoErr(err)
+
+	q.close()
+
+	_, err = q.push(delivery{EventID: "1001"})
+	is.True(err != nil) // should not accept notifications once closed
+
+	is.Equal(popEventIDs(is, q, 2), []string{"1", "1000"})
+
+	_, ok, _ := q.pop()
+	is.True(!ok) // should be done once closed and emptied
+}
+
+func TestThatTheEventsOfSpilledNotificationsThatCanNotBeReadAreReturned(t *testing.T) {
+	is := is.New(t)
+
+	q := newTestQueue(is, config.NotificationQueueConfig{Size: 1, Overflow: "spill"}, t.TempDir())
+
+	for i := range 3 {
+		_, err := q.push(delivery{EventID: fmt.Sprintf("%d", i)})
+		is.NoErr(err)
+	}
+
+	is.Equal(popEventIDs(is, q, 1), []string{"0"})
+	is.NoErr(os.WriteFile(q.spill.path, []byte("garbage\n"), 0o644))
+
+	_, ok, err := q.pop()
+	is.True(ok)
+
+	var spillErr *spillReadError
+	is.True(errors.As(err, &spillErr))
+	is.Equal(spillErr.eventIDs, []string{"1", "2"}) // should return the events of the lost notifications
+	is.Equal(q.length(), 0)
+}
+
+func TestThatSpillingRequiresADirectory(t *testing.T) {
+	is := is.New(t)
+
+	_, err := newQueuePolicy(config.NotificationQueueConfig{Overflow: "spill"}, "")
+	is.True(err != nil)
+
+	policy, err := newQueuePolicy(config.NotificationQueueConfig{}, "")
+	is.NoErr(err)
+	is.Equal(policy.overflow, blockWhenFull) // should not spill by default without a directory
+}
+
+func TestThatAnUnknownOverflowPolicyIsRejected(t *testing.T) {
+	is := is.New(t)
+
+	_, err := newQueuePolicy(config.NotificationQueueConfig{Overflow: "ignore"}, "")
+	is.True(err != nil)
+}
+
+func newTestQueue(is *is.I, cfg config.NotificationQueueConfig, spillDir string) *endpointQueue {
+	policy, err := newQueuePolicy(cfg, spillDir)
+	is.NoErr(err)
+
+	q, err := newEndpointQueue("http://receiver:8080", policy)
+	is.NoErr(err)
+
+	return q
+}
+
+func popEventIDs(is *is.I, q *endpointQueue, count int) []string {
+	ids := []string{}
+
+	for range count {
+		d, ok, err := q.pop()
+		is.NoErr(err)
+		is.True(ok)
+		ids = append(ids, d.EventID)
+	}
+
+	return ids
+}
@@ -0,0 +1,137 @@
+package subscriptions
+
+import (
+	"sync"
+
+	"github.com/diwise/context-broker/internal/pkg/application/store"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+)
+
+// Store keeps track of the subscriptions of each tenant
+type Store interface {
+	List(tenant string) []subscriptions.Subscription
+	Get(tenant, subscriptionID string) (*subscriptions.Subscription, error)
+
+	// Filtered returns the subscriptions of a tenant along with the filters that they were
+	// compiled into when they were stored
+	Filtered(tenant string) []FilteredSubscription
+
+	Create(tenant string, subscription subscriptions.Subscription) error
+	Update(tenant string, subscription subscriptions.Subscription) error
+	Delete(tenant, subscriptionID string) error
+}
+
+// FilteredSubscription is a subscription along with its compiled filter
+type FilteredSubscription struct {
+	subscriptions.Subscription
+	Filter *Filter
+}
+
+type subscriptionStore struct {
+	// mu keeps the filters in step with the subscriptions they were compiled from
+	mu            sync.RWMutex
+	subscriptions *store.Store[subscriptions.Subscription]
+	filters       map[string]map[string]*Filter
+}
+
+// NewStore creates a subscription store that is persisted to the file at filePath. Any
+// subscriptions already present in the file are loaded. If filePath is empty, the store
+// will only be kept in memory.
+func NewStore(filePath string) (Store, error) {
+	stored, err := store.New(filePath, "subscription", func(s subscriptions.Subscription) string {
+		return s.ID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subscriptionStore{
+		subscriptions: stored,
+		filters:       map[string]map[string]*Filter{},
+	}
+
+	for tenant, subs := range stored.All() {
+		for _, subscription := range subs {
+			// subscriptions whose filters no longer compile are left without a filter, and ignored
+			filter, _ := NewFilter(subscription)
+			s.setFilter(tenant, subscription.ID, filter)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *subscriptionStore) List(tenant string) []subscriptions.Subscription {
+	return s.subscriptions.List(tenant)
+}
+
+func (s *subscriptionStore) Get(tenant, subscriptionID string) (*subscriptions.Subscription, error) {
+	return s.subscriptions.Get(tenant, subscriptionID)
+}
+
+func (s *subscriptionStore) Filtered(tenant string) []FilteredSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subs := s.subscriptions.List(tenant)
+	filtered := make([]FilteredSubscription, 0, len(subs))
+
+	for _, subscription := range subs {
+		filtered = append(filtered, FilteredSubscription{
+			Subscription: subscription,
+			Filter:       s.filters[tenant][subscription.ID],
+		})
+	}
+
+	return filtered
+}
+
+func (s *subscriptionStore) Create(tenant string, subscription subscriptions.Subscription) error {
+	return s.put(tenant, subscription, s.subscriptions.Create)
+}
+
+func (s *subscriptionStore) Update(tenant string, subscription subscriptions.Subscription) error {
+	return s.put(tenant, subscription, s.subscriptions.Update)
+}
+
+func (s *subscriptionStore) put(tenant string, subscription subscriptions.Subscription, write func(string, subscriptions.Subscription) error) error {
+	filter, err := NewFilter(subscription)
+	if err != nil {
+		return errors.NewBadRequestDataError(err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = write(tenant, subscription)
+	if err != nil {
+		return err
+	}
+
+	s.setFilter(tenant, subscription.ID, filter)
+
+	return nil
+}
+
+func (s *subscriptionStore) Delete(tenant, subscriptionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.subscriptions.Delete(tenant, subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	delete(s.filters[tenant], subscriptionID)
+
+	return nil
+}
+
+func (s *subscriptionStore) setFilter(tenant, subscriptionID string, filter *Filter) {
+	if _, ok := s.filters[tenant]; !ok {
+		s.filters[tenant] = map[string]*Filter{}
+	}
+
+	s.filters[tenant][subscriptionID] = filter
+}
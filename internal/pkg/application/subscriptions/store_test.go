@@ -0,0 +1,73 @@
+package subscriptions
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+	"github.com/matryer/is"
+)
+
+func TestThatSubscriptionsArePersisted(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "subscriptions.json")
+
+	s, err := NewStore(filePath)
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", subscription("first", "http://first")))
+	is.NoErr(s.Create("default", subscription("second", "http://second")))
+	is.NoErr(s.Update("default", subscription("first", "http://updated")))
+	is.NoErr(s.Delete("default", "second"))
+
+	s, err = NewStore(filePath)
+	is.NoErr(err)
+
+	subs := s.List("default")
+	is.Equal(len(subs), 1)
+	is.Equal(subs[0].Notification.Endpoint.URI, "http://updated")
+}
+
+func TestThatDuplicateSubscriptionsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	s, err := NewStore("")
+	is.NoErr(err)
+
+	is.NoErr(s.Create("default", subscription("first", "http://first")))
+	is.True(s.Create("default", subscription("first", "http://first")) != nil)
+
+	_, err = s.Get("other", "first")
+	is.True(err != nil) // subscriptions should not leak between tenants
+}
+
+func TestThatSubscriptionsAreStoredWithTheirCompiledFilters(t *testing.T) {
+	is := is.New(t)
+
+	s, err := NewStore("")
+	is.NoErr(err)
+
+	sub := subscription("first", "http://first")
+	sub.Q = "status==\"on\""
+	is.NoErr(s.Create("default", sub))
+
+	filtered := s.Filtered("default")
+	is.Equal(len(filtered), 1)
+	is.True(filtered[0].Filter.Matches("urn:ngsi-ld:Lifebuoy:01", "Lifebuoy", map[string]any{"status": map[string]any{"value": "on"}}, nil))
+	is.True(!filtered[0].Filter.Matches("urn:ngsi-ld:Lifebuoy:01", "Lifebuoy", map[string]any{"status": map[string]any{"value": "off"}}, nil))
+
+	sub.Q = "status=="
+	is.True(s.Update("default", sub) != nil) // should reject a filter that does not compile
+	is.Equal(s.Filtered("default")[0].Q, "status==\"on\"")
+}
+
+func subscription(id, endpoint string) subscriptions.Subscription {
+	return subscriptions.Subscription{
+		ID:   id,
+		Type: subscriptions.SubscriptionType,
+		Notification: subscriptions.NotificationParams{
+			Endpoint: subscriptions.Endpoint{URI: endpoint},
+		},
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	"go.opentelemetry.io/otel"
 )
@@ -17,31 +20,82 @@ var tracer = otel.Tracer("context-broker/ngsi-ld/authz")
 
 type Enticator interface {
 	CheckAccess(ctx context.Context, r *http.Request, tenant string, entityTypes []string) error
+	// CheckAdminAccess checks access to the administrative endpoints, against the admin rule
+	// of the policies. Access is denied if the policies have no such rule.
+	CheckAdminAccess(ctx context.Context, r *http.Request, tenant string) error
+	// Reload replaces the policies that access is checked against. The current policies
+	// are kept if the new ones can not be read or compiled.
+	Reload(ctx context.Context, policies io.Reader) error
 }
 
 type enticatorImpl struct {
-	preparedQuery rego.PreparedEvalQuery
+	preparedQueries atomic.Pointer[preparedQueries]
+}
+
+// preparedQueries are the queries for the allow and the admin rule, that are prepared
+// from the same policies and replaced together
+type preparedQueries struct {
+	allow rego.PreparedEvalQuery
+	admin rego.PreparedEvalQuery
 }
 
 func NewAuthenticator(ctx context.Context, policies io.Reader) (Enticator, error) {
+	impl := &enticatorImpl{}
+
+	err := impl.Reload(ctx, policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return impl, nil
+}
 
+func (e *enticatorImpl) Reload(ctx context.Context, policies io.Reader) error {
 	module, err := io.ReadAll(policies)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read authz policies: %s", err.Error())
+		return fmt.Errorf("unable to read authz policies: %s", err.Error())
 	}
 
-	impl := &enticatorImpl{}
+	env := runtimeEnvironment()
 
-	impl.preparedQuery, err = rego.New(
+	allow, err := rego.New(
 		rego.Query("x = data.example.authz.allow"),
 		rego.Module("example.rego", string(module)),
+		rego.Runtime(env),
 	).PrepareForEval(ctx)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return impl, nil
+	admin, err := rego.New(
+		rego.Query("x = data.example.authz.admin"),
+		rego.Module("example.rego", string(module)),
+		rego.Runtime(env),
+	).PrepareForEval(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	e.preparedQueries.Store(&preparedQueries{allow: allow, admin: admin})
+
+	return nil
+}
+
+// runtimeEnvironment makes the environment variables of the broker available to the policies
+// as opa.runtime().env, so that settings such as the issuer of admin tokens can be configured
+// without editing the policies. The environment is read when the policies are (re)loaded.
+func runtimeEnvironment() *ast.Term {
+	env := ast.NewObject()
+
+	for _, variable := range os.Environ() {
+		if name, value, ok := strings.Cut(variable, "="); ok {
+			env.Insert(ast.StringTerm(name), ast.StringTerm(value))
+		}
+	}
+
+	return ast.ObjectTerm(ast.Item(ast.StringTerm("env"), ast.NewTerm(env)))
 }
 
 func (e *enticatorImpl) CheckAccess(ctx context.Context, r *http.Request, tenant string, entityTypes []string) error {
@@ -50,6 +104,21 @@ func (e *enticatorImpl) CheckAccess(ctx context.Context, r *http.Request, tenant
 	_, span := tracer.Start(ctx, "check-auth")
 	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
+	err = eval(ctx, e.preparedQueries.Load().allow, newInput(r, tenant, entityTypes))
+	return err
+}
+
+func (e *enticatorImpl) CheckAdminAccess(ctx context.Context, r *http.Request, tenant string) error {
+	var err error
+
+	_, span := tracer.Start(ctx, "check-admin-auth")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	err = eval(ctx, e.preparedQueries.Load().admin, newInput(r, tenant, []string{}))
+	return err
+}
+
+func newInput(r *http.Request, tenant string, entityTypes []string) map[string]any {
 	token := r.Header.Get("Authorization")
 
 	if len(token) > 7 {
@@ -66,33 +135,32 @@ func (e *enticatorImpl) CheckAccess(ctx context.Context, r *http.Request, tenant
 		"types":  entityTypes,
 	}
 
-	results, err := e.preparedQuery.Eval(ctx, rego.EvalInput(input))
+	return input
+}
+
+func eval(ctx context.Context, query rego.PreparedEvalQuery, input map[string]any) error {
+	results, err := query.Eval(ctx, rego.EvalInput(input))
 	if err != nil {
-		err = fmt.Errorf("opa eval failed: %w", err)
-		return err
+		return fmt.Errorf("opa eval failed: %w", err)
 	}
 
 	if len(results) == 0 {
-		err = fmt.Errorf("auth failed: opa query could not be satisfied")
-		return err
-	} else {
+		return fmt.Errorf("auth failed: opa query could not be satisfied")
+	}
 
-		binding := results[0].Bindings["x"]
+	binding := results[0].Bindings["x"]
 
-		// If authz fails we will get back a single bool. Check for that first.
-		allowed, ok := binding.(bool)
-		if ok && !allowed {
-			err = errors.New("authorization failed")
-			return err
-		}
+	// If authz fails we will get back a single bool. Check for that first.
+	allowed, ok := binding.(bool)
+	if ok && !allowed {
+		return errors.New("authorization failed")
+	}
 
-		// If authz succeeds we should expect a result object here
-		_, ok = binding.(map[string]any)
+	// If authz succeeds we should expect a result object here
+	_, ok = binding.(map[string]any)
 
-		if !ok {
-			err = errors.New("opa error: unexpected result type")
-			return err
-		}
+	if !ok {
+		return errors.New("opa error: unexpected result type")
 	}
 
 	return nil
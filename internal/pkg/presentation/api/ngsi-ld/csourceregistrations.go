@@ -0,0 +1,288 @@
+package ngsild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TraceAttributeRegistrationID string = "registration-id"
+
+// NewRegisterContextSourceHandler handles POST requests for new context source registrations
+func NewRegisterContextSourceHandler(
+	contextInformationManager cim.ContextSourceRegistrar,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "register-context-source",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		registration := registrations.ContextSourceRegistration{}
+
+		body, _ := io.ReadAll(r.Body)
+		err = json.Unmarshal(body, &registration)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, registration.EntityTypes())
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		result, err := contextInformationManager.RegisterContextSource(ctx, tenant, registration)
+		if err != nil {
+			log.Error("register context source failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("context source registered", "endpoint", registration.Endpoint, "location", result.Location())
+
+		w.Header().Add("Location", result.Location())
+		w.WriteHeader(http.StatusCreated)
+	})
+}
+
+// NewQueryContextSourceRegistrationsHandler handles GET requests for context source registrations
+func NewQueryContextSourceRegistrationsHandler(
+	contextInformationManager cim.ContextSourceRegistrationQuerier,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "query-csource-registrations",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		entityTypes := []string{}
+		if typeNames := r.URL.Query().Get("type"); typeNames != "" {
+			entityTypes = strings.Split(typeNames, ",")
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, entityTypes)
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		result, err := contextInformationManager.QueryContextSourceRegistrations(ctx, tenant, entityTypes)
+		if err != nil {
+			log.Error("query context source registrations failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		writeResourceResponse(w, r, result)
+	})
+}
+
+// NewRetrieveContextSourceRegistrationHandler handles GET requests for a single context source registration
+func NewRetrieveContextSourceRegistrationHandler(
+	contextInformationManager cim.ContextSourceRegistrationRetriever,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		registrationID, _ := url.QueryUnescape(chi.URLParam(r, "registrationId"))
+
+		ctx, span := tracer.Start(ctx, "retrieve-csource-registration",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeRegistrationID, registrationID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("registrationID", registrationID), slog.String("tenant", tenant)),
+			ctx)
+
+		registration, err := contextInformationManager.RetrieveContextSourceRegistration(ctx, tenant, registrationID)
+
+		if err == nil {
+			autherr := authenticator.CheckAccess(ctx, r, tenant, registration.EntityTypes())
+			if autherr != nil {
+				err = autherr
+				log.Warn("access not granted", "err", err.Error())
+				ngsierrors.ReportNotFoundError(w, "not found", traceID)
+				return
+			}
+		}
+
+		if err != nil {
+			log.Error("retrieve context source registration failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		writeResourceResponse(w, r, registration)
+	})
+}
+
+// NewUpdateContextSourceRegistrationHandler handles PATCH requests for context source registrations
+func NewUpdateContextSourceRegistrationHandler(
+	contextInformationManager cim.ContextSourceRegistrationUpdater,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		registrationID, _ := url.QueryUnescape(chi.URLParam(r, "registrationId"))
+
+		ctx, span := tracer.Start(ctx, "update-csource-registration",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeRegistrationID, registrationID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("registrationID", registrationID), slog.String("tenant", tenant)),
+			ctx)
+
+		fragment := registrations.ContextSourceRegistration{}
+
+		body, _ := io.ReadAll(r.Body)
+		err = json.Unmarshal(body, &fragment)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, fragment.EntityTypes())
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		err = contextInformationManager.UpdateContextSourceRegistration(ctx, tenant, registrationID, fragment)
+		if err != nil {
+			log.Error("update context source registration failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("context source registration updated")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// NewDeleteContextSourceRegistrationHandler handles DELETE requests for context source registrations
+func NewDeleteContextSourceRegistrationHandler(
+	contextInformationManager cim.ContextSourceRegistrationDeleter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		registrationID, _ := url.QueryUnescape(chi.URLParam(r, "registrationId"))
+
+		ctx, span := tracer.Start(ctx, "delete-csource-registration",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeRegistrationID, registrationID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("registrationID", registrationID), slog.String("tenant", tenant)),
+			ctx)
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		err = contextInformationManager.DeleteContextSourceRegistration(ctx, tenant, registrationID)
+		if err != nil {
+			log.Error("failed to delete context source registration", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("context source registration deleted")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func writeResourceResponse(w http.ResponseWriter, r *http.Request, body any) {
+	contentType := r.Header.Get("Accept")
+	if contentType != "application/json" {
+		contentType = "application/ld+json"
+	}
+
+	responseBody, _ := json.Marshal(body)
+
+	w.Header().Add("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
@@ -0,0 +1,103 @@
+package ngsild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/registrations"
+)
+
+func TestRegisterContextSource(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.RegisterContextSourceFunc = func(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error) {
+		return ngsild.NewRegisterContextSourceResult("/ngsi-ld/v1/csourceRegistrations/" + registration.ID), nil
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/csourceRegistrations", bytes.NewBufferString(registrationJSON))
+
+	is.Equal(resp.StatusCode, http.StatusCreated) // Check status code
+	is.Equal(resp.Header.Get("Location"), "/ngsi-ld/v1/csourceRegistrations/urn:ngsi-ld:ContextSourceRegistration:devices")
+
+	is.Equal(len(app.RegisterContextSourceCalls()), 1)
+	registration := app.RegisterContextSourceCalls()[0].Registration
+	is.Equal(registration.Endpoint, "http://devices:8080")
+	is.Equal(registration.EntityTypes(), []string{"Device"})
+}
+
+func TestRegisterContextSourceWithBadDataReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.RegisterContextSourceFunc = func(ctx context.Context, tenant string, registration registrations.ContextSourceRegistration) (*ngsild.RegisterContextSourceResult, error) {
+		return nil, errors.NewBadRequestDataError("invalid endpoint")
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/csourceRegistrations", bytes.NewBufferString(registrationJSON))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest) // Check status code
+}
+
+func TestQueryContextSourceRegistrationsForwardsTypes(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.QueryContextSourceRegistrationsFunc = func(ctx context.Context, tenant string, entityTypes []string) ([]registrations.ContextSourceRegistration, error) {
+		return []registrations.ContextSourceRegistration{}, nil
+	}
+
+	resp, responseBody := testRequest(is, ts, http.MethodGet, acceptJSON, "/ngsi-ld/v1/csourceRegistrations?type=Device,Sensor", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+	is.Equal(responseBody, "[]")
+	is.Equal(app.QueryContextSourceRegistrationsCalls()[0].EntityTypes, []string{"Device", "Sensor"})
+}
+
+func TestRetrieveUnknownContextSourceRegistrationReturnsNotFound(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.RetrieveContextSourceRegistrationFunc = func(ctx context.Context, tenant, registrationID string) (*registrations.ContextSourceRegistration, error) {
+		return nil, errors.NewNotFoundError("no such registration")
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodGet, acceptJSON, "/ngsi-ld/v1/csourceRegistrations/urn:ngsi-ld:ContextSourceRegistration:nope", nil)
+
+	is.Equal(resp.StatusCode, http.StatusNotFound) // Check status code
+	is.Equal(app.RetrieveContextSourceRegistrationCalls()[0].RegistrationID, "urn:ngsi-ld:ContextSourceRegistration:nope")
+}
+
+func TestRetrieveContextSourceRegistration(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.RetrieveContextSourceRegistrationFunc = func(ctx context.Context, tenant, registrationID string) (*registrations.ContextSourceRegistration, error) {
+		csr := registrations.ContextSourceRegistration{}
+		json.Unmarshal([]byte(registrationJSON), &csr)
+		return &csr, nil
+	}
+
+	resp, responseBody := testRequest(is, ts, http.MethodGet, acceptJSON, "/ngsi-ld/v1/csourceRegistrations/urn:ngsi-ld:ContextSourceRegistration:devices", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+	is.Equal(resp.Header.Get("Content-Type"), "application/json")
+
+	csr := registrations.ContextSourceRegistration{}
+	is.NoErr(json.Unmarshal([]byte(responseBody), &csr))
+	is.Equal(csr.ID, "urn:ngsi-ld:ContextSourceRegistration:devices")
+}
+
+const registrationJSON string = `{
+	"id": "urn:ngsi-ld:ContextSourceRegistration:devices",
+	"type": "ContextSourceRegistration",
+	"information": [{
+		"entities": [{"idPattern": "^urn:ngsi-ld:Device:.+", "type": "Device"}]
+	}],
+	"endpoint": "http://devices:8080"
+}`
@@ -0,0 +1,165 @@
+package ngsild
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TraceAttributeDeadLetterID string = "dead-letter-id"
+
+// NewQueryDeadLettersHandler handles GET requests for the notifications that could not be delivered
+func NewQueryDeadLettersHandler(
+	contextInformationManager cim.DeadLetterQuerier,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "query-dead-letters",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		err = authenticator.CheckAdminAccess(ctx, r, tenant)
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			reportAdminAccessDenied(w, r, traceID)
+			return
+		}
+
+		letters, err := contextInformationManager.QueryDeadLetters(ctx, tenant)
+		if err != nil {
+			log.Error("query dead letters failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		writeResourceResponse(w, r, letters)
+	})
+}
+
+// NewReplayDeadLettersHandler handles POST requests to deliver dead letters once more. Only the
+// dead letter in the path is replayed if there is one, or else all of the dead letters of the tenant.
+func NewReplayDeadLettersHandler(
+	contextInformationManager cim.DeadLetterReplayer,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		letterID, _ := url.QueryUnescape(chi.URLParam(r, "letterId"))
+
+		ctx, span := tracer.Start(ctx, "replay-dead-letters",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeDeadLetterID, letterID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		err = authenticator.CheckAdminAccess(ctx, r, tenant)
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			reportAdminAccessDenied(w, r, traceID)
+			return
+		}
+
+		letterIDs := []string{}
+		if letterID != "" {
+			letterIDs = append(letterIDs, letterID)
+		}
+
+		result, err := contextInformationManager.ReplayDeadLetters(ctx, tenant, letterIDs)
+		if err != nil {
+			log.Error("replay dead letters failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("dead letters replayed", "replayed", len(result.Replayed), "failed", len(result.Failed))
+
+		writeResourceResponse(w, r, result)
+	})
+}
+
+// NewDeleteDeadLetterHandler handles DELETE requests for dead letters that should not be replayed
+func NewDeleteDeadLetterHandler(
+	contextInformationManager cim.DeadLetterDeleter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		letterID, _ := url.QueryUnescape(chi.URLParam(r, "letterId"))
+
+		ctx, span := tracer.Start(ctx, "delete-dead-letter",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeDeadLetterID, letterID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("letterID", letterID), slog.String("tenant", tenant)),
+			ctx)
+
+		err = authenticator.CheckAdminAccess(ctx, r, tenant)
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			reportAdminAccessDenied(w, r, traceID)
+			return
+		}
+
+		err = contextInformationManager.DeleteDeadLetter(ctx, tenant, letterID)
+		if err != nil {
+			log.Error("failed to delete dead letter", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("dead letter deleted")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// reportAdminAccessDenied reports a request without a token as unauthorized, and a request
+// whose token does not grant access to the administrative endpoints as forbidden
+func reportAdminAccessDenied(w http.ResponseWriter, r *http.Request, traceID string) {
+	if r.Header.Get("Authorization") == "" {
+		ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+		return
+	}
+
+	ngsierrors.ReportForbiddenError(w, "access to the administrative endpoints is not granted", traceID)
+}
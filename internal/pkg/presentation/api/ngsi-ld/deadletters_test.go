@@ -0,0 +1,176 @@
+package ngsild
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	subs "github.com/diwise/context-broker/internal/pkg/application/subscriptions"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+func TestQueryDeadLetters(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, adminPolicies)
+	defer ts.Close()
+
+	app.QueryDeadLettersFunc = func(ctx context.Context, tenant string) ([]subs.DeadLetter, error) {
+		return []subs.DeadLetter{{ID: "urn:ngsi-ld:Notification:01", Attempts: 8}}, nil
+	}
+
+	resp, responseBody := testRequest(is, ts, http.MethodGet, acceptJSON, "/admin/notifications/deadletters", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+
+	letters := []subs.DeadLetter{}
+	is.NoErr(json.Unmarshal([]byte(responseBody), &letters))
+	is.Equal(len(letters), 1)
+	is.Equal(letters[0].Attempts, 8)
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, adminPolicies)
+	defer ts.Close()
+
+	app.ReplayDeadLettersFunc = func(ctx context.Context, tenant string, letterIDs []string) (*subs.ReplayResult, error) {
+		return &subs.ReplayResult{Replayed: letterIDs, Failed: []string{}}, nil
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, acceptJSON, "/admin/notifications/deadletters/replay", nil)
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+	is.Equal(len(app.ReplayDeadLettersCalls()[0].LetterIDs), 0)
+
+	resp, responseBody := testRequest(is, ts, http.MethodPost, acceptJSON, "/admin/notifications/deadletters/urn:ngsi-ld:Notification:01/replay", nil)
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+	is.Equal(app.ReplayDeadLettersCalls()[1].LetterIDs, []string{"urn:ngsi-ld:Notification:01"})
+
+	result := subs.ReplayResult{}
+	is.NoErr(json.Unmarshal([]byte(responseBody), &result))
+	is.Equal(result.Replayed, []string{"urn:ngsi-ld:Notification:01"})
+}
+
+func TestDeleteUnknownDeadLetterReturnsNotFound(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, adminPolicies)
+	defer ts.Close()
+
+	app.DeleteDeadLetterFunc = func(ctx context.Context, tenant, letterID string) error {
+		return errors.NewNotFoundError("no such dead letter")
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodDelete, acceptJSON, "/admin/notifications/deadletters/urn:ngsi-ld:Notification:nope", nil)
+
+	is.Equal(resp.StatusCode, http.StatusNotFound) // Check status code
+	is.Equal(app.DeleteDeadLetterCalls()[0].LetterID, "urn:ngsi-ld:Notification:nope")
+}
+
+func TestQueryDeadLettersWithoutAnAdminRuleIsNotAuthorized(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, allowAllPolicies)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodGet, acceptJSON, "/admin/notifications/deadletters", nil)
+
+	is.Equal(resp.StatusCode, http.StatusUnauthorized) // Check status code
+	is.Equal(len(app.QueryDeadLettersCalls()), 0)
+}
+
+func TestThatForgedAdminTokensAreForbidden(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newTestTokenIssuer(&key.PublicKey)
+	defer issuer.Close()
+
+	t.Setenv("ADMIN_TOKEN_ISSUER", issuer.URL)
+
+	policies, err := os.ReadFile("../../../../../assets/config/authz.rego")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	is, ts, app := setupTestWithPolicies(t, string(policies))
+	defer ts.Close()
+
+	app.QueryDeadLettersFunc = func(ctx context.Context, tenant string) ([]subs.DeadLetter, error) {
+		return []subs.DeadLetter{}, nil
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+
+	claims := func(iss string, expires time.Time) string {
+		return fmt.Sprintf(`{"iss":%q,"exp":%d,"realm_access":{"roles":["context-broker-admin"]}}`, iss, expires.Unix())
+	}
+
+	valid := claims(issuer.URL, time.Now().Add(time.Hour))
+
+	request := func(method, path, token string) int {
+		headers := append([][]string{{"Authorization", "Bearer " + token}}, acceptJSON...)
+		resp, _ := testRequest(is, ts, method, headers, path, nil)
+		return resp.StatusCode
+	}
+
+	forged := []string{
+		testToken(valid),
+		signTestToken(otherKey, valid),
+		signTestToken(key, claims("https://issuer.example.com", time.Now().Add(time.Hour))),
+		signTestToken(key, claims(issuer.URL, time.Now().Add(-time.Hour))),
+	}
+
+	is.Equal(request(http.MethodGet, "/admin/notifications/deadletters", forged[0]), http.StatusForbidden)         // should not accept an unsigned token
+	is.Equal(request(http.MethodPost, "/admin/notifications/deadletters/replay", forged[0]), http.StatusForbidden) // should not accept an unsigned token
+	is.Equal(request(http.MethodGet, "/admin/notifications/deadletters", forged[1]), http.StatusForbidden)         // should not accept a token signed by someone else
+	is.Equal(request(http.MethodGet, "/admin/notifications/deadletters", forged[2]), http.StatusForbidden)         // should not accept a token from another issuer
+	is.Equal(request(http.MethodGet, "/admin/notifications/deadletters", forged[3]), http.StatusForbidden)         // should not accept an expired token
+
+	is.Equal(len(app.QueryDeadLettersCalls()), 0)
+	is.Equal(len(app.ReplayDeadLettersCalls()), 0)
+
+	is.Equal(request(http.MethodGet, "/admin/notifications/deadletters", signTestToken(key, valid)), http.StatusOK) // should grant access to a token signed by the issuer
+}
+
+// newTestTokenIssuer serves the OpenID configuration and the keys of an issuer of tokens
+func newTestTokenIssuer(key *rsa.PublicKey) *httptest.Server {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, ts.URL, ts.URL+"/certs")
+	})
+
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"test","use":"sig","alg":"RS256","n":%q,"e":%q}]}`,
+			encode(key.N.Bytes()), encode(big.NewInt(int64(key.E)).Bytes()))
+	})
+
+	return ts
+}
+
+func signTestToken(key *rsa.PrivateKey, claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	unsigned := encode([]byte(`{"alg":"RS256","typ":"JWT","kid":"test"}`)) + "." + encode([]byte(claims))
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return unsigned + "." + encode(signature)
+}
@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/diwise/context-broker/internal/pkg/application/cim"
@@ -31,6 +34,8 @@ import (
 
 var tracer = otel.Tracer("context-broker/ngsi-ld/entities")
 
+const entitiesPath string = "/ngsi-ld/v1/entities"
+
 const (
 	TraceAttributeEntityID     string = "entity-id"
 	TraceAttributeNGSILDTenant string = "ngsild-tenant"
@@ -128,143 +133,223 @@ func NewQueryEntitiesHandler(
 
 		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logger, ctx)
 
-		attributeNames := r.URL.Query().Get("attrs")
-		entityTypeNames := r.URL.Query().Get("type")
-		georel := r.URL.Query().Get("georel")
-		q := r.URL.Query().Get("q")
-		//TODO: Parse and validate the query
+		err = queryEntities(ctx, w, r, r.URL.Query(), entitiesPath, r.URL.RawQuery, propagatedHeaders, contextInformationManager, authenticator, log, traceID)
+	})
+}
+
+// typeAuthorizer returns a function that reports if access is granted to an entity type, checking
+// each type against the authorization policies only once
+func typeAuthorizer(ctx context.Context, r *http.Request, tenant string, authenticator auth.Enticator) func(string) bool {
+	granted := map[string]bool{}
 
-		if entityTypeNames == "" && attributeNames == "" && q == "" && georel == "" {
-			err = errors.New("at least one among type, attrs, q, or georel must be present in a request for entities")
-			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
-			return
+	return func(entityType string) bool {
+		allowed, ok := granted[entityType]
+		if !ok {
+			allowed = authenticator.CheckAccess(ctx, r, tenant, []string{entityType}) == nil
+			granted[entityType] = allowed
 		}
 
-		options := r.URL.Query().Get("options")
-		keyValueFormatRequested := false
+		return allowed
+	}
+}
 
-		if options != "" && strings.Contains(options, "keyValues") {
-			opts := strings.Split(options, ",")
-			numOptions := len(opts)
-			if numOptions == 1 {
-				q := r.URL.Query()
-				q.Del("options")
-				r.URL.RawQuery = q.Encode()
+// queryEntities queries for entities that match the parameters, and writes them in the format that
+// the client asked for. The raw query is forwarded as is, unless options have to be removed from it.
+// Links to other pages of a partial result point back at the request, so that a query that was sent
+// in the body of the request is expected to be sent again along with the parameters of the link.
+func queryEntities(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	params url.Values,
+	path, rawQuery string,
+	propagatedHeaders map[string][]string,
+	contextInformationManager cim.EntityQuerier,
+	authenticator auth.Enticator,
+	log *slog.Logger,
+	traceID string) error {
 
-				keyValueFormatRequested = true
-			} else {
-				err = errors.New("no options besides keyValues are supported")
-				ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
-				return
-			}
-		}
+	var err error
 
-		entityTypes := strings.Split(entityTypeNames, ",")
-		attributes := strings.Split(attributeNames, ",")
+	tenant := GetTenantFromContext(ctx)
 
-		err = authenticator.CheckAccess(ctx, r, tenant, entityTypes)
-		if err != nil {
-			log.Warn("access not granted", "err", err.Error())
-			messageToSendToNonAuthenticatedClients := "not found"
-			ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
-			return
-		}
+	attributeNames := params.Get("attrs")
+	entityTypeNames := params.Get("type")
+	georel := params.Get("georel")
+	q := params.Get("q")
+	entityIDs := params.Get("id")
+	idPattern := params.Get("idPattern")
+	//TODO: Parse and validate the query
 
-		result, err := contextInformationManager.QueryEntities(ctx, tenant, entityTypes, attributes, r.URL.Path+"?"+r.URL.RawQuery, propagatedHeaders)
-		if err != nil {
-			log.Error("query entities failed", "err", err.Error())
-			mapCIMToNGSILDError(w, err, traceID)
-			return
-		}
+	if entityTypeNames == "" && attributeNames == "" && q == "" && georel == "" && entityIDs == "" && idPattern == "" {
+		err = errors.New("at least one among type, id, idPattern, attrs, q, or georel must be present in a request for entities")
+		ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+		return err
+	}
 
-		contentType := r.Header.Get("Accept")
-		if contentType == "" {
-			contentType = "application/ld+json"
+	if idPattern != "" {
+		// the pattern is validated with the same dialect that queries are routed with
+		_, err = regexp.CompilePOSIX(idPattern)
+		if err != nil {
+			err = fmt.Errorf("invalid idPattern: %w", err)
+			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+			return err
 		}
+	}
 
-		var entityConverter func(ngsitypes.Entity) ngsitypes.Entity
+	options := params.Get("options")
+	keyValueFormatRequested := false
+	linkQuery := r.URL.Query()
 
-		var geoJsonCollection *geojson.GeoJSONFeatureCollection
-		var entityCollection []ngsitypes.Entity
-		var entityKeyValues []ngsitypes.EntityKeyValueMapper
+	if options != "" && strings.Contains(options, "keyValues") {
+		opts := strings.Split(options, ",")
+		numOptions := len(opts)
+		if numOptions == 1 {
+			params = maps.Clone(params)
+			params.Del("options")
+			rawQuery = params.Encode()
+			linkQuery.Del("options")
 
-		if contentType == "application/geo+json" {
-			geoJsonCollection = geojson.NewFeatureCollection()
-			entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
-				gje, err := geojson.ConvertEntity(e)
-				if err == nil {
-					geoJsonCollection.Features = append(geoJsonCollection.Features, *gje)
-				}
-				return e
-			}
-		} else if !keyValueFormatRequested {
-			entityCollection = []ngsitypes.Entity{}
-			entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
-				entityCollection = append(entityCollection, e)
-				return e
-			}
+			keyValueFormatRequested = true
 		} else {
-			entityKeyValues = []ngsitypes.EntityKeyValueMapper{}
-			entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
-				entityKeyValues = append(entityKeyValues, e.KeyValues())
-				return e
-			}
+			err = errors.New("no options besides keyValues are supported")
+			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+			return err
 		}
+	}
 
-		for e := range result.Found {
-			if e == nil {
-				break
-			}
+	entityTypes := []string{}
+	if entityTypeNames != "" {
+		entityTypes = strings.Split(entityTypeNames, ",")
+	}
+
+	attributes := strings.Split(attributeNames, ",")
+
+	err = authenticator.CheckAccess(ctx, r, tenant, entityTypes)
+	if err != nil {
+		log.Warn("access not granted", "err", err.Error())
+		messageToSendToNonAuthenticatedClients := "not found"
+		ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
+		return err
+	}
+
+	result, err := contextInformationManager.QueryEntities(ctx, tenant, entityTypes, attributes, path+"?"+rawQuery, propagatedHeaders)
+	if err != nil {
+		log.Error("query entities failed", "err", err.Error())
+		mapCIMToNGSILDError(w, err, traceID)
+		return err
+	}
+
+	contentType := r.Header.Get("Accept")
+	if contentType == "" {
+		contentType = "application/ld+json"
+	}
 
-			entityConverter(e)
+	var entityConverter func(ngsitypes.Entity) ngsitypes.Entity
+
+	var geoJsonCollection *geojson.GeoJSONFeatureCollection
+	var entityCollection []ngsitypes.Entity
+	var entityKeyValues []ngsitypes.EntityKeyValueMapper
+
+	if contentType == "application/geo+json" {
+		geoJsonCollection = geojson.NewFeatureCollection()
+		entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
+			gje, err := geojson.ConvertEntity(e)
+			if err == nil {
+				geoJsonCollection.Features = append(geoJsonCollection.Features, *gje)
+			}
+			return e
+		}
+	} else if !keyValueFormatRequested {
+		entityCollection = []ngsitypes.Entity{}
+		entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
+			entityCollection = append(entityCollection, e)
+			return e
+		}
+	} else {
+		entityKeyValues = []ngsitypes.EntityKeyValueMapper{}
+		entityConverter = func(e ngsitypes.Entity) ngsitypes.Entity {
+			entityKeyValues = append(entityKeyValues, e.KeyValues())
+			return e
 		}
+	}
 
-		var responseBody []byte
+	// entities that are queried for by id, rather than by type, are only returned if access is
+	// granted to their types, since access to them could not be checked before the query was made
+	var authorizedType func(string) bool
+	if len(entityTypes) == 0 {
+		authorizedType = typeAuthorizer(ctx, r, tenant, authenticator)
+	}
 
-		if geoJsonCollection != nil {
-			responseBody, err = json.Marshal(geoJsonCollection)
-		} else if entityCollection != nil {
-			responseBody, err = json.Marshal(entityCollection)
-		} else {
-			responseBody, err = json.Marshal(entityKeyValues)
+	withheld := 0
+
+	for e := range result.Found {
+		if e == nil {
+			break
 		}
 
-		if err != nil {
-			log.Error("query entities: failed to marshal entity collection to json", "err", err.Error())
-			mapCIMToNGSILDError(w, err, traceID)
-			return
+		if authorizedType != nil && !authorizedType(e.Type()) {
+			withheld++
+			continue
 		}
 
-		w.Header().Add("Content-Type", contentType)
-		if result.TotalCount >= 0 {
-			w.Header().Add("NGSILD-Results-Count", fmt.Sprintf("%d", result.TotalCount))
+		entityConverter(e)
+	}
+
+	if withheld > 0 {
+		log.Info("withheld entities of types that access was not granted to", "count", withheld)
+		if result.TotalCount >= int64(withheld) {
+			result.TotalCount -= int64(withheld)
 		}
+	}
 
-		if result.PartialResult {
-			reqUrl := r.URL.Path
-			query, _ := url.ParseQuery(r.URL.RawQuery)
-			query.Set("limit", fmt.Sprintf("%d", result.Limit))
+	var responseBody []byte
 
-			offset := result.Offset - result.Limit
+	if geoJsonCollection != nil {
+		responseBody, err = json.Marshal(geoJsonCollection)
+	} else if entityCollection != nil {
+		responseBody, err = json.Marshal(entityCollection)
+	} else {
+		responseBody, err = json.Marshal(entityKeyValues)
+	}
 
-			if result.Offset > 0 {
-				if offset < 0 {
-					offset = 0
-				}
-				query.Set("offset", fmt.Sprintf("%d", offset))
-				w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="prev"; type="%s"`, reqUrl, query.Encode(), contentType))
-			}
+	if err != nil {
+		log.Error("query entities: failed to marshal entity collection to json", "err", err.Error())
+		mapCIMToNGSILDError(w, err, traceID)
+		return err
+	}
+
+	w.Header().Add("Content-Type", contentType)
+	if result.TotalCount >= 0 {
+		w.Header().Add("NGSILD-Results-Count", fmt.Sprintf("%d", result.TotalCount))
+	}
 
-			offset = result.Offset + result.Limit
-			if result.Count == result.Limit {
-				query.Set("offset", fmt.Sprintf("%d", offset))
-				w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"; type="%s"`, reqUrl, query.Encode(), contentType))
+	if result.PartialResult {
+		reqUrl := r.URL.Path
+		query := linkQuery
+		query.Set("limit", fmt.Sprintf("%d", result.Limit))
+
+		offset := result.Offset - result.Limit
+
+		if result.Offset > 0 {
+			if offset < 0 {
+				offset = 0
 			}
+			query.Set("offset", fmt.Sprintf("%d", offset))
+			w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="prev"; type="%s"`, reqUrl, query.Encode(), contentType))
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write(responseBody)
-	})
+		offset = result.Offset + result.Limit
+		if result.Count == result.Limit {
+			query.Set("offset", fmt.Sprintf("%d", offset))
+			w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"; type="%s"`, reqUrl, query.Encode(), contentType))
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+
+	return nil
 }
 
 // NewRetrieveEntityHandler retrieves entity by ID.
@@ -425,6 +510,174 @@ func NewMergeEntityHandler(
 	})
 }
 
+// NewReplaceEntityHandler handles PUT requests that replace an NGSI entity in its entirety
+func NewReplaceEntityHandler(
+	contextInformationManager cim.EntityReplacer,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entityId"))
+
+		propagatedHeaders := extractHeaders(r, "Content-Type", "Link")
+
+		ctx, span := tracer.Start(ctx, "replace-entity",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeEntityID, entityID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("entityID", entityID), slog.String("tenant", tenant)),
+			ctx)
+
+		body, _ := io.ReadAll(r.Body)
+
+		// the id may be left out of the body, but must match the path if it is not
+		header := struct {
+			ID string `json:"id"`
+		}{}
+		json.Unmarshal(body, &header)
+
+		if header.ID != "" && header.ID != entityID {
+			err = fmt.Errorf("entity id %s in body does not match %s", header.ID, entityID)
+			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+			return
+		}
+
+		var entity ngsitypes.EntityFragment
+		entity, err = entities.NewFragmentFromJSON(body)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(w, fmt.Sprintf("unable to decode request payload: %s", err.Error()), traceID)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			messageToSendToNonAuthenticatedClients := "not found"
+			ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
+			return
+		}
+
+		_, err = contextInformationManager.ReplaceEntity(ctx, tenant, entityID, entity, propagatedHeaders)
+		if err != nil {
+			log.Error("failed to replace entity", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("entity replaced")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// NewReplaceAttributeHandler handles PUT requests that replace a single attribute of an NGSI entity
+func NewReplaceAttributeHandler(
+	contextInformationManager cim.EntityAttributeReplacer,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entityId"))
+		attributeName, _ := url.PathUnescape(chi.URLParam(r, "attrId"))
+
+		propagatedHeaders := extractHeaders(r, "Content-Type", "Link")
+
+		ctx, span := tracer.Start(ctx, "replace-attribute",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeEntityID, entityID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("entityID", entityID), slog.String("attribute", attributeName), slog.String("tenant", tenant)),
+			ctx)
+
+		body, _ := io.ReadAll(r.Body)
+
+		var fragment ngsitypes.EntityFragment
+		fragment, err = attributeFragmentFromJSON(attributeName, body)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(w, fmt.Sprintf("unable to decode request payload: %s", err.Error()), traceID)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			messageToSendToNonAuthenticatedClients := "not found"
+			ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
+			return
+		}
+
+		_, err = contextInformationManager.ReplaceAttribute(ctx, tenant, entityID, attributeName, fragment, propagatedHeaders)
+		if err != nil {
+			log.Error("failed to replace attribute", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("attribute replaced")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// attributeFragmentFromJSON wraps an attribute, as sent in the body of a request for a
+// single attribute, in a fragment of the entity that it belongs to
+func attributeFragmentFromJSON(attributeName string, body []byte) (ngsitypes.EntityFragment, error) {
+	contents := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &contents); err != nil {
+		return nil, err
+	}
+
+	jsonldContext, ok := contents["@context"]
+	if !ok {
+		jsonldContext, _ = json.Marshal([]string{entities.DefaultContextURL})
+	}
+	delete(contents, "@context")
+
+	b, err := json.Marshal(map[string]any{
+		"@context":    jsonldContext,
+		attributeName: contents,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fragment, err := entities.NewFragmentFromJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	fragment.ForEachAttribute(func(attributeType, name string, contents any) {
+		found = found || name == attributeName
+	})
+
+	if !found {
+		return nil, fmt.Errorf("attribute %s is not a supported property or relationship", attributeName)
+	}
+
+	return fragment, nil
+}
+
 // NewUpdateEntityAttributesHandler handles PATCH requests for NGSI entitity attributes
 func NewUpdateEntityAttributesHandler(
 	contextInformationManager cim.EntityAttributesUpdater,
@@ -489,6 +742,194 @@ func NewUpdateEntityAttributesHandler(
 	})
 }
 
+// NewAppendEntityAttributesHandler handles POST requests that append attributes to an NGSI entity
+func NewAppendEntityAttributesHandler(
+	contextInformationManager cim.EntityAttributesAppender,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entityId"))
+
+		propagatedHeaders := extractHeaders(r, "Content-Type", "Link")
+
+		ctx, span := tracer.Start(ctx, "append-entity-attributes",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeEntityID, entityID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("entityID", entityID), slog.String("tenant", tenant)),
+			ctx)
+
+		var fragment ngsitypes.EntityFragment
+		body, _ := io.ReadAll(r.Body)
+		fragment, err = entities.NewFragmentFromJSON(body)
+
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(w, fmt.Sprintf("unable to decode request payload: %s", err.Error()), traceID)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			messageToSendToNonAuthenticatedClients := "not found"
+			ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
+			return
+		}
+
+		appendResult, err := contextInformationManager.AppendEntityAttributes(ctx, tenant, entityID, fragment, propagatedHeaders)
+
+		if err != nil {
+			log.Error("failed to append entity attributes", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("entity attributes appended")
+
+		if !appendResult.IsMultiStatus() {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write(appendResult.Bytes())
+		}
+	})
+}
+
+// NewPatchAttributeHandler handles PATCH requests that update a single attribute of an NGSI entity
+func NewPatchAttributeHandler(
+	contextInformationManager cim.EntityAttributePatcher,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entityId"))
+		attributeName, _ := url.PathUnescape(chi.URLParam(r, "attrId"))
+
+		propagatedHeaders := extractHeaders(r, "Content-Type", "Link")
+
+		ctx, span := tracer.Start(ctx, "patch-attribute",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeEntityID, entityID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("entityID", entityID), slog.String("attribute", attributeName), slog.String("tenant", tenant)),
+			ctx)
+
+		body, _ := io.ReadAll(r.Body)
+
+		var fragment ngsitypes.EntityFragment
+		fragment, err = attributeFragmentFromJSON(attributeName, body)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(w, fmt.Sprintf("unable to decode request payload: %s", err.Error()), traceID)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			messageToSendToNonAuthenticatedClients := "not found"
+			ngsierrors.ReportNotFoundError(w, messageToSendToNonAuthenticatedClients, traceID)
+			return
+		}
+
+		_, err = contextInformationManager.PatchAttribute(ctx, tenant, entityID, attributeName, fragment, propagatedHeaders)
+		if err != nil {
+			log.Error("failed to patch attribute", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("attribute patched")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// NewDeleteAttributeHandler handles DELETE requests for a single attribute of an NGSI entity
+func NewDeleteAttributeHandler(
+	contextInformationManager cim.EntityAttributeDeleter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entityId"))
+		attributeName, _ := url.PathUnescape(chi.URLParam(r, "attrId"))
+
+		ctx, span := tracer.Start(ctx, "delete-attribute",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeEntityID, entityID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("entityID", entityID), slog.String("attribute", attributeName), slog.String("tenant", tenant)),
+			ctx)
+
+		datasetID := r.URL.Query().Get("datasetId")
+		deleteAll := false
+
+		if value := r.URL.Query().Get("deleteAll"); value != "" {
+			deleteAll, err = strconv.ParseBool(value)
+			if err != nil {
+				err = fmt.Errorf("invalid value for deleteAll: %s", value)
+				ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+				return
+			}
+		}
+
+		if deleteAll && datasetID != "" {
+			err = errors.New("deleteAll and datasetId can not be combined")
+			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		_, err = contextInformationManager.DeleteAttribute(ctx, tenant, entityID, attributeName, datasetID, deleteAll)
+		if err != nil {
+			log.Error("failed to delete attribute", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("attribute deleted")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
 func NewDeleteEntityHandler(
 	contextInformationManager cim.EntityDeleter,
 	authenticator auth.Enticator,
@@ -552,19 +993,5 @@ func extractHeaders(r *http.Request, headers ...string) map[string][]string {
 }
 
 func mapCIMToNGSILDError(w http.ResponseWriter, err error, traceID string) {
-
-	switch {
-	case errors.Is(err, ngsierrors.ErrAlreadyExists):
-		ngsierrors.ReportNewAlreadyExistsError(w, err.Error(), traceID)
-	case errors.Is(err, ngsierrors.ErrBadRequest):
-		ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
-	case errors.Is(err, ngsierrors.ErrInvalidRequest):
-		ngsierrors.ReportNewInvalidRequest(w, err.Error(), traceID)
-	case errors.Is(err, ngsierrors.ErrNotFound):
-		ngsierrors.ReportNotFoundError(w, err.Error(), traceID)
-	case errors.Is(err, ngsierrors.ErrUnknownTenant):
-		ngsierrors.ReportUnknownTenantError(w, err.Error(), traceID)
-	default:
-		ngsierrors.ReportNewInternalError(w, err.Error(), traceID)
-	}
+	ngsierrors.NewProblemDetailsFromError(err, traceID).WriteResponse(w)
 }
@@ -0,0 +1,467 @@
+package ngsild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	ngsitypes "github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBatchSize is the largest number of entities, or entity ids, that a batch operation may hold
+const maxBatchSize int = 1000
+
+// maxOperationBodySize is the largest body, in bytes, that is read for an entity operation
+const maxOperationBodySize int64 = 16 << 20
+
+var errBatchTooLarge = fmt.Errorf("batch holds more than %d entities", maxBatchSize)
+
+type entityBatchOperation func(ctx context.Context, tenant string, entities []ngsitypes.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
+// NewCreateEntitiesHandler handles incoming POST requests to create a batch of NGSI entities
+func NewCreateEntitiesHandler(
+	contextInformationManager cim.EntityBatchCreator,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return newEntityBatchHandler("create", contextInformationManager.CreateEntities, authenticator, logger)
+}
+
+// NewUpsertEntitiesHandler handles incoming POST requests to create, or update, a batch of NGSI entities
+func NewUpsertEntitiesHandler(
+	contextInformationManager cim.EntityBatchUpserter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return newEntityBatchHandler("upsert", contextInformationManager.UpsertEntities, authenticator, logger)
+}
+
+// NewUpdateEntitiesHandler handles incoming POST requests to update the attributes of a batch of NGSI entities
+func NewUpdateEntitiesHandler(
+	contextInformationManager cim.EntityBatchUpdater,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return newEntityBatchHandler("update", contextInformationManager.UpdateEntities, authenticator, logger)
+}
+
+func newEntityBatchHandler(operation string, run entityBatchOperation, authenticator auth.Enticator, logger *slog.Logger) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		propagatedHeaders := extractHeaders(r, "Content-Type", "Link")
+
+		ctx, span := tracer.Start(ctx, operation+"-entities",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("tenant", tenant)),
+			ctx)
+
+		var body []byte
+		body, err = readOperationBody(w, r, traceID)
+		if err != nil {
+			return
+		}
+
+		var batch []ngsitypes.Entity
+		batch, err = entitiesFromJSON(body)
+		if errors.Is(err, errBatchTooLarge) {
+			ngsierrors.ReportRequestEntityTooLargeError(w, err.Error(), traceID)
+			return
+		} else if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		span.SetAttributes(attribute.Int(client.TraceAttributeBatchSize, len(batch)))
+
+		entityTypes := []string{}
+		for _, e := range batch {
+			if !slices.Contains(entityTypes, e.Type()) {
+				entityTypes = append(entityTypes, e.Type())
+			}
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, entityTypes)
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		var result *ngsild.BatchOperationResult
+
+		result, err = run(ctx, tenant, batch, propagatedHeaders)
+		if err != nil {
+			log.Error("batch "+operation+" failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("batch "+operation+" completed", "succeeded", len(result.Success), "failed", len(result.Errors))
+
+		writeBatchOperationResult(w, operation, result)
+	})
+}
+
+// NewDeleteEntitiesHandler handles incoming POST requests to delete a batch of NGSI entities
+func NewDeleteEntitiesHandler(
+	contextInformationManager cim.EntityBatchDeleter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "delete-entities",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("tenant", tenant)),
+			ctx)
+
+		var body []byte
+		body, err = readOperationBody(w, r, traceID)
+		if err != nil {
+			return
+		}
+
+		entityIDs := []string{}
+		err = json.Unmarshal(body, &entityIDs)
+		if err == nil && len(entityIDs) == 0 {
+			err = fmt.Errorf("no entity ids in batch")
+		}
+
+		if len(entityIDs) > maxBatchSize {
+			err = errBatchTooLarge
+			ngsierrors.ReportRequestEntityTooLargeError(w, err.Error(), traceID)
+			return
+		}
+
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		span.SetAttributes(attribute.Int(client.TraceAttributeBatchSize, len(entityIDs)))
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		var result *ngsild.BatchOperationResult
+
+		result, err = contextInformationManager.DeleteEntities(ctx, tenant, entityIDs)
+		if err != nil {
+			log.Error("batch delete failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("batch delete completed", "succeeded", len(result.Success), "failed", len(result.Errors))
+
+		writeBatchOperationResult(w, "delete", result)
+	})
+}
+
+// readOperationBody reads the body of an entity operation, and reports the request as too large
+// if the body is larger than maxOperationBodySize, or as invalid if it can not be read
+func readOperationBody(w http.ResponseWriter, r *http.Request, traceID string) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOperationBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ngsierrors.ReportRequestEntityTooLargeError(w, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit), traceID)
+		} else {
+			ngsierrors.ReportNewInvalidRequest(w, fmt.Sprintf("unable to read request body: %s", err.Error()), traceID)
+		}
+
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// entitiesFromJSON decodes the entities of a batch, which must not be empty nor hold more
+// than maxBatchSize entities
+func entitiesFromJSON(body []byte) ([]ngsitypes.Entity, error) {
+	elements := []json.RawMessage{}
+
+	if err := json.Unmarshal(body, &elements); err != nil {
+		return nil, err
+	}
+
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("no entities in batch")
+	}
+
+	if len(elements) > maxBatchSize {
+		return nil, errBatchTooLarge
+	}
+
+	batch := make([]ngsitypes.Entity, 0, len(elements))
+
+	for idx, element := range elements {
+		e, err := entities.NewFromJSON(element)
+		if err != nil {
+			return nil, fmt.Errorf("entity %d: %w", idx, err)
+		}
+
+		batch = append(batch, e)
+	}
+
+	return batch, nil
+}
+
+// writeBatchOperationResult responds with 207 Multi-Status and the result if the operation
+// failed for any of the entities. Otherwise a create responds with the ids of the created
+// entities, and the other operations without a body.
+func writeBatchOperationResult(w http.ResponseWriter, operation string, result *ngsild.BatchOperationResult) {
+	if result.IsMultiStatus() {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(result.Bytes())
+		return
+	}
+
+	if operation == "create" {
+		b, _ := json.Marshal(result.Success)
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewQueryEntitiesByPostHandler handles POST requests that query for NGSI entities with a Query
+// document in the body, for queries that would not fit in the parameters of a GET request
+func NewQueryEntitiesByPostHandler(
+	contextInformationManager cim.EntityQuerier,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		propagatedHeaders := extractHeaders(r, "Accept", "Link")
+
+		ctx, span := tracer.Start(ctx, "query-entities",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(span, logger, ctx)
+
+		var body []byte
+		body, err = readOperationBody(w, r, traceID)
+		if err != nil {
+			return
+		}
+
+		var query *queryDocument
+		query, err = newQueryDocument(body)
+		if err != nil {
+			ngsierrors.ReportNewBadRequestData(
+				w,
+				fmt.Sprintf("unable to decode query: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		// the parameters of the url, such as limit, offset and options, apply to the query as well
+		params := r.URL.Query()
+		err = query.addTo(params)
+		if err != nil {
+			ngsierrors.ReportNewBadRequestData(w, err.Error(), traceID)
+			return
+		}
+
+		if link, ok := query.linkHeader(); ok && len(propagatedHeaders["Link"]) == 0 {
+			propagatedHeaders["Link"] = []string{link}
+		}
+
+		// the query is forwarded to the context sources with the path that it was posted to, so
+		// that it is posted to them as well
+		err = queryEntities(ctx, w, r, params, client.QueryOperationPath, params.Encode(), propagatedHeaders, contextInformationManager, authenticator, log, traceID)
+	})
+}
+
+// queryDocument is an NGSI-LD Query, as sent in the body of a POST to /entityOperations/query
+type queryDocument struct {
+	Context  any              `json:"@context,omitempty"`
+	Type     string           `json:"type"`
+	Entities []entitySelector `json:"entities,omitempty"`
+	Attrs    []string         `json:"attrs,omitempty"`
+	Q        string           `json:"q,omitempty"`
+	GeoQ     *geoQuery        `json:"geoQ,omitempty"`
+}
+
+type entitySelector struct {
+	ID        string `json:"id,omitempty"`
+	IDPattern string `json:"idPattern,omitempty"`
+	Type      string `json:"type,omitempty"`
+}
+
+type geoQuery struct {
+	Geometry    string          `json:"geometry"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	GeoRel      string          `json:"georel"`
+	GeoProperty string          `json:"geoproperty,omitempty"`
+}
+
+func newQueryDocument(body []byte) (*queryDocument, error) {
+	query := &queryDocument{}
+
+	// members that are not supported, such as temporalQ or scopeQ, are rejected
+	// rather than ignored, as ignoring them would widen the query
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(query); err != nil {
+		return nil, err
+	}
+
+	if query.Type != "Query" {
+		return nil, fmt.Errorf("type must be Query, not %q", query.Type)
+	}
+
+	return query, nil
+}
+
+// addTo adds the query to the parameters, in the same form as the query parameters of a GET
+// request. Entity selectors are combined into lists of ids and types, which match every
+// combination of the ids and types in them. Selectors are therefore only combined if they
+// differ in their ids or in their types, but not in both, and are rejected otherwise.
+func (qd *queryDocument) addTo(params url.Values) error {
+	ids, types, idPatterns := []string{}, []string{}, []string{}
+
+	for _, es := range qd.Entities {
+		if !slices.Contains(ids, es.ID) {
+			ids = append(ids, es.ID)
+		}
+
+		if !slices.Contains(types, es.Type) {
+			types = append(types, es.Type)
+		}
+
+		if !slices.Contains(idPatterns, es.IDPattern) {
+			idPatterns = append(idPatterns, es.IDPattern)
+		}
+	}
+
+	if len(ids) > 1 && slices.Contains(ids, "") {
+		return errors.New("entity selectors with and without ids can not be combined in the same query")
+	}
+
+	if len(types) > 1 && slices.Contains(types, "") {
+		return errors.New("entity selectors with and without types can not be combined in the same query")
+	}
+
+	if len(idPatterns) > 1 {
+		return errors.New("entity selectors with different id patterns can not be combined in the same query")
+	}
+
+	if len(ids) > 1 && len(types) > 1 {
+		return errors.New("entity selectors with different ids and different types can not be combined in the same query")
+	}
+
+	setIfNotEmpty := func(key, value string) {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	setIfNotEmpty("id", strings.Join(ids, ","))
+	setIfNotEmpty("type", strings.Join(types, ","))
+	setIfNotEmpty("idPattern", strings.Join(idPatterns, ""))
+	setIfNotEmpty("attrs", strings.Join(qd.Attrs, ","))
+	setIfNotEmpty("q", qd.Q)
+
+	if qd.GeoQ != nil {
+		// coordinates may be given as a json array, or as a string that holds one
+		var coordinates string
+		if json.Unmarshal(qd.GeoQ.Coordinates, &coordinates) != nil {
+			compacted := &bytes.Buffer{}
+			if err := json.Compact(compacted, qd.GeoQ.Coordinates); err != nil {
+				return fmt.Errorf("invalid coordinates: %w", err)
+			}
+			coordinates = compacted.String()
+		}
+
+		setIfNotEmpty("georel", qd.GeoQ.GeoRel)
+		setIfNotEmpty("geometry", qd.GeoQ.Geometry)
+		setIfNotEmpty("coordinates", coordinates)
+		setIfNotEmpty("geoproperty", qd.GeoQ.GeoProperty)
+	}
+
+	return nil
+}
+
+// linkHeader returns a Link header for the @context of the query, if it has a single context
+func (qd *queryDocument) linkHeader() (string, bool) {
+	var contextURL string
+
+	switch ctx := qd.Context.(type) {
+	case string:
+		contextURL = ctx
+	case []any:
+		if len(ctx) == 1 {
+			contextURL, _ = ctx[0].(string)
+		}
+	}
+
+	if contextURL == "" {
+		return "", false
+	}
+
+	return fmt.Sprintf(`<%s>; rel="http://www.w3.org/ns/json-ld#context"; type="application/ld+json"`, contextURL), true
+}
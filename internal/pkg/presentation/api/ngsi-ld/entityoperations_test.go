@@ -0,0 +1,172 @@
+package ngsild
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	ngsitypes "github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/matryer/is"
+)
+
+func TestCreateEntitiesRespondsWithTheCreatedIDs(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.CreateEntitiesFunc = func(ctx context.Context, tenant string, entities []ngsitypes.Entity, h map[string][]string) (*ngsild.BatchOperationResult, error) {
+		result := ngsild.NewBatchOperationResult()
+		for _, e := range entities {
+			result.Succeeded(e.ID())
+		}
+		return result, nil
+	}
+
+	resp, body := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/create", bytes.NewBufferString("["+entityJSON+"]"))
+
+	is.Equal(resp.StatusCode, http.StatusCreated)
+	is.Equal(body, `["urn:ngsi-ld:Device:testdevice"]`)
+	is.Equal(len(app.CreateEntitiesCalls()[0].Entities), 1)
+}
+
+func TestUpsertEntitiesRespondsWithMultiStatusIfAnyEntityFailed(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.UpsertEntitiesFunc = func(ctx context.Context, tenant string, entities []ngsitypes.Entity, h map[string][]string) (*ngsild.BatchOperationResult, error) {
+		result := ngsild.NewBatchOperationResult()
+		result.Failed(errors.NewNotFoundError("no context source found"), entities[0].ID())
+		return result, nil
+	}
+
+	resp, body := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/upsert", bytes.NewBufferString("["+entityJSON+"]"))
+
+	is.Equal(resp.StatusCode, http.StatusMultiStatus)
+	is.True(strings.Contains(body, `"entityId":"urn:ngsi-ld:Device:testdevice"`))
+	is.True(strings.Contains(body, `"type":"https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound"`))
+}
+
+func TestDeleteEntitiesWithAnEmptyBatchReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/delete", bytes.NewBufferString("[]"))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	is.Equal(len(app.DeleteEntitiesCalls()), 0)
+}
+
+func TestDeleteEntitiesWithTooLargeABatchReturnsRequestEntityTooLarge(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	ids := make([]string, maxBatchSize+1)
+	for idx := range ids {
+		ids[idx] = fmt.Sprintf(`"urn:ngsi-ld:Device:%d"`, idx)
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/delete", bytes.NewBufferString("["+strings.Join(ids, ",")+"]"))
+
+	is.Equal(resp.StatusCode, http.StatusRequestEntityTooLarge)
+	is.Equal(len(app.DeleteEntitiesCalls()), 0)
+}
+
+func TestUpsertEntitiesWithTooLargeABodyReturnsRequestEntityTooLarge(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	body := "[" + entityJSON + strings.Repeat(" ", int(maxOperationBodySize)) + "]"
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/upsert", bytes.NewBufferString(body))
+
+	is.Equal(resp.StatusCode, http.StatusRequestEntityTooLarge)
+	is.Equal(len(app.UpsertEntitiesCalls()), 0)
+}
+
+func TestDeleteEntitiesWithABodyThatCannotBeReadReturnsBadRequest(t *testing.T) {
+	is := is.New(t)
+	app := &cim.ContextInformationManagerMock{}
+
+	authenticator, err := auth.NewAuthenticator(context.Background(), bytes.NewBufferString(allowAllPolicies))
+	is.NoErr(err)
+
+	handler := NewDeleteEntitiesHandler(app, authenticator, slog.Default())
+
+	req := httptest.NewRequest(http.MethodPost, "/ngsi-ld/v1/entityOperations/delete", iotest.ErrReader(io.ErrUnexpectedEOF))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest)
+	is.Equal(len(app.DeleteEntitiesCalls()), 0)
+}
+
+func TestQueryEntitiesByPostForwardsTheQueryWithThePathItWasPostedTo(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	query := `{
+		"type": "Query",
+		"entities": [{"type": "Beach"}, {"type": "Lake"}],
+		"attrs": ["temperature"],
+		"q": "temperature>20",
+		"geoQ": {"geometry": "Point", "coordinates": [17.3, 62.4], "georel": "near;maxDistance==2000"}
+	}`
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/query?limit=10", bytes.NewBufferString(query))
+	is.Equal(resp.StatusCode, http.StatusOK)
+
+	call := app.QueryEntitiesCalls()[0]
+	is.Equal(call.EntityTypes, []string{"Beach", "Lake"})
+	is.Equal(call.EntityAttributes, []string{"temperature"})
+	is.Equal(call.Query, "/ngsi-ld/v1/entityOperations/query?attrs=temperature&coordinates=%5B17.3%2C62.4%5D&geometry=Point&georel=near%3BmaxDistance%3D%3D2000&limit=10&q=temperature%3E20&type=Beach%2CLake")
+}
+
+func TestQueryEntitiesByPostLinksToTheNextPageOfThePostedQuery(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.QueryEntitiesFunc = func(ctx context.Context, tenant string, types []string, attrs []string, q string, h map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+		qer := ngsild.NewQueryEntitiesResult()
+		qer.PartialResult, qer.Count, qer.Limit = true, 1, 1
+		go func() { qer.Found <- nil }()
+		return qer, nil
+	}
+
+	query := `{"type": "Query", "entities": [{"id": "urn:ngsi-ld:Beach:01"}, {"id": "urn:ngsi-ld:Beach:02"}]}`
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/query?limit=1", bytes.NewBufferString(query))
+
+	is.Equal(resp.Header.Get("Link"), `</ngsi-ld/v1/entityOperations/query?limit=1&offset=1>; rel="next"; type="application/ld+json"`)
+}
+
+func TestQueryEntitiesByPostWithSelectorsThatCannotBeCombinedReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	query := `{"type": "Query", "entities": [{"id": "urn:ngsi-ld:Beach:01"}, {"type": "Lake"}]}`
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/query", bytes.NewBufferString(query))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	is.Equal(len(app.QueryEntitiesCalls()), 0)
+}
+
+func TestQueryEntitiesByPostWithSelectorsThatDifferInBothIDAndTypeReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	// combining these into lists of ids and types would match a Lake with the id of the Beach
+	query := `{"type": "Query", "entities": [{"id": "urn:ngsi-ld:Beach:01", "type": "Beach"}, {"id": "urn:ngsi-ld:Lake:01", "type": "Lake"}]}`
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entityOperations/query", bytes.NewBufferString(query))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	is.Equal(len(app.QueryEntitiesCalls()), 0)
+}
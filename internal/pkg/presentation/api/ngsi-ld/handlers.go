@@ -14,7 +14,10 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app cim.ContextInformationManager) error {
+// RegisterHandlers registers the NGSI-LD API handlers with the router, and returns the authenticator
+// that checks requests against the policies so that the policies can be reloaded later on. Requests
+// are not rate limited if the limiter is nil.
+func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app cim.ContextInformationManager, limiter *RateLimiter) (auth.Enticator, error) {
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -22,13 +25,14 @@ func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app
 
 	authenticator, err := auth.NewAuthenticator(ctx, policies)
 	if err != nil {
-		return fmt.Errorf("failed to create api authenticator: %w", err)
+		return nil, fmt.Errorf("failed to create api authenticator: %w", err)
 	}
 
 	r.Route("/ngsi-ld/v1", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.AllowContentType("application/json", "application/ld+json"))
 			r.Use(NGSIMiddleware())
+			r.Use(RateLimitMiddleware(limiter))
 
 			log := logging.GetFromContext(ctx)
 
@@ -47,6 +51,36 @@ func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app
 				NewMergeEntityHandler(app, authenticator, log),
 			)
 
+			r.Put(
+				"/entities/{entityId}",
+				NewReplaceEntityHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entities/{entityId}/attrs",
+				NewAppendEntityAttributesHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entities/{entityId}/attrs/",
+				NewAppendEntityAttributesHandler(app, authenticator, log),
+			)
+
+			r.Put(
+				"/entities/{entityId}/attrs/{attrId}",
+				NewReplaceAttributeHandler(app, authenticator, log),
+			)
+
+			r.Patch(
+				"/entities/{entityId}/attrs/{attrId}",
+				NewPatchAttributeHandler(app, authenticator, log),
+			)
+
+			r.Delete(
+				"/entities/{entityId}/attrs/{attrId}",
+				NewDeleteAttributeHandler(app, authenticator, log),
+			)
+
 			r.Patch(
 				"/entities/{entityId}/attrs/",
 				NewUpdateEntityAttributesHandler(app, authenticator, log),
@@ -65,6 +99,31 @@ func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app
 				NewDeleteEntityHandler(app, authenticator, log),
 			)
 
+			r.Post(
+				"/entityOperations/create",
+				NewCreateEntitiesHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entityOperations/upsert",
+				NewUpsertEntitiesHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entityOperations/update",
+				NewUpdateEntitiesHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entityOperations/delete",
+				NewDeleteEntitiesHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/entityOperations/query",
+				NewQueryEntitiesByPostHandler(app, authenticator, log),
+			)
+
 			r.Get(
 				"/temporal/entities",
 				NewQueryTemporalEvolutionOfEntitiesHandler(app, authenticator, log),
@@ -80,6 +139,56 @@ func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app
 				NewRetrieveAvailableEntityTypesHandler(app, authenticator, log),
 			)
 
+			r.Post(
+				"/csourceRegistrations",
+				NewRegisterContextSourceHandler(app, authenticator, log),
+			)
+
+			r.Get(
+				"/csourceRegistrations",
+				NewQueryContextSourceRegistrationsHandler(app, authenticator, log),
+			)
+
+			r.Get(
+				"/csourceRegistrations/{registrationId}",
+				NewRetrieveContextSourceRegistrationHandler(app, authenticator, log),
+			)
+
+			r.Patch(
+				"/csourceRegistrations/{registrationId}",
+				NewUpdateContextSourceRegistrationHandler(app, authenticator, log),
+			)
+
+			r.Delete(
+				"/csourceRegistrations/{registrationId}",
+				NewDeleteContextSourceRegistrationHandler(app, authenticator, log),
+			)
+
+			r.Post(
+				"/subscriptions",
+				NewCreateSubscriptionHandler(app, authenticator, log),
+			)
+
+			r.Get(
+				"/subscriptions",
+				NewQuerySubscriptionsHandler(app, authenticator, log),
+			)
+
+			r.Get(
+				"/subscriptions/{subscriptionId}",
+				NewRetrieveSubscriptionHandler(app, authenticator, log),
+			)
+
+			r.Patch(
+				"/subscriptions/{subscriptionId}",
+				NewUpdateSubscriptionHandler(app, authenticator, log),
+			)
+
+			r.Delete(
+				"/subscriptions/{subscriptionId}",
+				NewDeleteSubscriptionHandler(app, authenticator, log),
+			)
+
 			r.Get(
 				"/jsonldContexts/{contextId}",
 				NewServeContextHandler(log),
@@ -87,7 +196,20 @@ func RegisterHandlers(ctx context.Context, r chi.Router, policies io.Reader, app
 		})
 	})
 
-	return nil
+	// notifications that could not be delivered, even after being retried, can be inspected
+	// and replayed or discarded by an administrator
+	r.Route("/admin/notifications/deadletters", func(r chi.Router) {
+		r.Use(NGSIMiddleware())
+
+		log := logging.GetFromContext(ctx)
+
+		r.Get("/", NewQueryDeadLettersHandler(app, authenticator, log))
+		r.Post("/replay", NewReplayDeadLettersHandler(app, authenticator, log))
+		r.Post("/{letterId}/replay", NewReplayDeadLettersHandler(app, authenticator, log))
+		r.Delete("/{letterId}", NewDeleteDeadLetterHandler(app, authenticator, log))
+	})
+
+	return authenticator, nil
 }
 
 type tenantContextKey struct {
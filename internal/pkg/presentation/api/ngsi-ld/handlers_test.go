@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/diwise/context-broker/internal/pkg/application/cim"
@@ -127,6 +128,61 @@ func TestQueryEntitiesForwardsMultipleTypes(t *testing.T) {
 	is.Equal(app.QueryEntitiesCalls()[0].EntityTypes[2], "C")
 }
 
+func TestQueryEntitiesByIDWithoutType(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	pathAndQuery := "/ngsi-ld/v1/entities?id=urn:ngsi-ld:A:1,urn:ngsi-ld:B:2"
+	resp, _ := testRequest(is, ts, http.MethodGet, acceptJSONLD, pathAndQuery, nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(len(app.QueryEntitiesCalls()), 1)
+	is.Equal(len(app.QueryEntitiesCalls()[0].EntityTypes), 0) // should not pass an empty type
+	is.Equal(app.QueryEntitiesCalls()[0].Query, pathAndQuery)
+}
+
+func TestQueryEntitiesWithInvalidIDPatternReturnsBadRequest(t *testing.T) {
+	is, ts, _ := setupTest(t)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodGet, acceptJSONLD, "/ngsi-ld/v1/entities?idPattern=%5Eurn:(", nil)
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+}
+
+func TestQueryEntitiesWithPerlOnlyIDPatternReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodGet, acceptJSONLD, "/ngsi-ld/v1/entities?idPattern=%5Eurn:ngsi-ld:Device:%5Cd%2B", nil)
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest) // should be validated with the same dialect that queries are routed with
+	is.Equal(len(app.QueryEntitiesCalls()), 0)
+}
+
+func TestQueryEntitiesByIDOnlyReturnsEntitiesOfAuthorizedTypes(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, onlyDevicesPolicies)
+	defer ts.Close()
+
+	app.QueryEntitiesFunc = func(ctx context.Context, tenant string, types []string, attrs []string, q string, h map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+		qer := ngsild.NewQueryEntitiesResult()
+		go func() {
+			device, _ := entities.New("urn:ngsi-ld:Device:01", "Device")
+			beach, _ := entities.New("urn:ngsi-ld:Beach:01", "Beach")
+			qer.Found <- device
+			qer.Found <- beach
+			qer.Found <- nil
+		}()
+		return qer, nil
+	}
+
+	resp, body := testRequest(is, ts, http.MethodGet, acceptJSONLD, "/ngsi-ld/v1/entities?id=urn:ngsi-ld:Device:01,urn:ngsi-ld:Beach:01", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.True(strings.Contains(body, "urn:ngsi-ld:Device:01"))
+	is.True(!strings.Contains(body, "urn:ngsi-ld:Beach:01")) // should withhold entities of types that access is not granted to
+}
+
 func TestQueryEntitiesForwardsCorrectPathAndQuery(t *testing.T) {
 	is, ts, app := setupTest(t)
 	defer ts.Close()
@@ -246,6 +302,107 @@ func TestUpdateEntityAttributesWithPropertyMetadata(t *testing.T) {
 	is.Equal(resp.StatusCode, http.StatusNoContent) // should return 204 No Content
 }
 
+func TestReplaceEntityWithMismatchingIDReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodPut, jsonLDContent, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:other", bytes.NewBuffer([]byte(entityJSON)))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	is.Equal(len(app.ReplaceEntityCalls()), 0)
+}
+
+func TestReplaceAttribute(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.ReplaceAttributeFunc = func(ctx context.Context, tenant, entityID, attributeName string, fragment ngsitypes.EntityFragment, h map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+		return ngsild.NewReplaceAttributeResult(), nil
+	}
+
+	body := bytes.NewBufferString(`{"type":"Property","value":"off"}`)
+	resp, _ := testRequest(is, ts, http.MethodPut, jsonLDContent, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs/status", body)
+
+	is.Equal(resp.StatusCode, http.StatusNoContent)
+
+	call := app.ReplaceAttributeCalls()[0]
+	is.Equal(call.EntityID, "urn:ngsi-ld:Device:01")
+	is.Equal(call.AttributeName, "status")
+
+	fragmentJSON, _ := json.Marshal(call.Fragment)
+	is.Equal(string(fragmentJSON), `{"@context":["https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonld"],"status":{"type":"Property","value":"off"}}`)
+}
+
+func TestAppendEntityAttributesReportsAttributesThatWereNotAppended(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.AppendEntityAttributesFunc = func(ctx context.Context, tenant, entityID string, fragment ngsitypes.EntityFragment, h map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+		return ngsild.NewAppendEntityAttributesResult([]byte(`{"updated":[],"notUpdated":[{"attributeName":"status","reason":"not allowed"}]}`))
+	}
+
+	fragment, _ := entities.NewFragment(Status("off"))
+	body, _ := fragment.MarshalJSON()
+
+	resp, responseBody := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs", bytes.NewBuffer(body))
+
+	is.Equal(resp.StatusCode, http.StatusMultiStatus)
+	is.Equal(responseBody, `{"updated":[],"notUpdated":[{"attributeName":"status","reason":"not allowed"}]}`)
+	is.Equal(app.AppendEntityAttributesCalls()[0].EntityID, "urn:ngsi-ld:Device:01")
+}
+
+func TestPatchAttribute(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.PatchAttributeFunc = func(ctx context.Context, tenant, entityID, attributeName string, fragment ngsitypes.EntityFragment, h map[string][]string) (*ngsild.PatchAttributeResult, error) {
+		return ngsild.NewPatchAttributeResult(), nil
+	}
+
+	body := bytes.NewBufferString(`{"type":"Property","value":"on"}`)
+	resp, _ := testRequest(is, ts, http.MethodPatch, jsonLDContent, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs/status", body)
+
+	is.Equal(resp.StatusCode, http.StatusNoContent)
+	is.Equal(app.PatchAttributeCalls()[0].AttributeName, "status")
+}
+
+func TestDeleteAttributeWithoutTokenReturns401(t *testing.T) {
+	is, ts, _ := setupTest(t)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodDelete, acceptJSON, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs/status", nil)
+
+	is.Equal(resp.StatusCode, http.StatusUnauthorized)
+}
+
+func TestDeleteAttributeForwardsDatasetID(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, allowAllPolicies)
+	defer ts.Close()
+
+	app.DeleteAttributeFunc = func(ctx context.Context, tenant, entityID, attributeName, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+		return ngsild.NewDeleteAttributeResult(), nil
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodDelete, acceptJSON, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs/status?datasetId=urn:ngsi-ld:Dataset:01", nil)
+
+	is.Equal(resp.StatusCode, http.StatusNoContent)
+
+	call := app.DeleteAttributeCalls()[0]
+	is.Equal(call.AttributeName, "status")
+	is.Equal(call.DatasetID, "urn:ngsi-ld:Dataset:01")
+	is.True(!call.DeleteAll)
+}
+
+func TestDeleteAttributeWithDatasetIDAndDeleteAllReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, allowAllPolicies)
+	defer ts.Close()
+
+	resp, _ := testRequest(is, ts, http.MethodDelete, acceptJSON, "/ngsi-ld/v1/entities/urn:ngsi-ld:Device:01/attrs/status?datasetId=urn:ngsi-ld:Dataset:01&deleteAll=true", nil)
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest)
+	is.Equal(len(app.DeleteAttributeCalls()), 0)
+}
+
 func TestRequestDefaultContext(t *testing.T) {
 	is, ts, _ := setupTest(t)
 	defer ts.Close()
@@ -283,6 +440,10 @@ func testRequest(is *is.I, ts *httptest.Server, method string, headers [][]strin
 }
 
 func setupTest(t *testing.T) (*is.I, *httptest.Server, *cim.ContextInformationManagerMock) {
+	return setupTestWithPolicies(t, opaModule)
+}
+
+func setupTestWithPolicies(t *testing.T, opaPolicies string) (*is.I, *httptest.Server, *cim.ContextInformationManagerMock) {
 	is := is.New(t)
 	r := chi.NewRouter()
 	ts := httptest.NewServer(r)
@@ -298,8 +459,8 @@ func setupTest(t *testing.T) (*is.I, *httptest.Server, *cim.ContextInformationMa
 		},
 	}
 
-	policies := bytes.NewBufferString(opaModule)
-	RegisterHandlers(context.Background(), r, policies, app)
+	policies := bytes.NewBufferString(opaPolicies)
+	RegisterHandlers(context.Background(), r, policies, app, nil)
 
 	return is, ts, app
 }
@@ -331,3 +492,53 @@ allow = response {
     }
 }
 `
+
+const allowAllPolicies string = `
+package example.authz
+
+default allow := false
+
+allow = response {
+    response := {
+    }
+}
+`
+
+const adminPolicies string = `
+package example.authz
+
+default allow := false
+default admin := false
+
+allow = response {
+    response := {
+    }
+}
+
+admin = response {
+    input.path[0] == "admin"
+
+    response := {
+    }
+}
+`
+
+const onlyDevicesPolicies string = `
+package example.authz
+
+default allow := false
+
+allow = response {
+    count(input.types) == 0
+
+    response := {
+    }
+}
+
+allow = response {
+    input.types == ["Device"]
+
+    response := {
+    }
+}
+`
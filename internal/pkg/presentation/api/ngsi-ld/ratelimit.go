@@ -0,0 +1,413 @@
+package ngsild
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	bucketSweepInterval time.Duration = time.Minute
+	anonymousClient     string        = ""
+
+	// maxBuckets caps the number of buckets that are kept between sweeps. Clients that show up
+	// once the cap has been reached share a single bucket per tenant until the next sweep.
+	maxBuckets     int    = 10000
+	overflowClient string = "\x00overflow"
+)
+
+// RateLimiter limits the rate of requests to each tenant, and from each client of a tenant,
+// using token buckets with separate budgets for reads and writes. A request is only let
+// through if both the tenant and the client have a token to spare.
+//
+// Clients are told apart by the azp, or client_id, claim of their tokens, and by their address
+// if they send no token. Requests are limited before they are authorized, so the claims are
+// read without verifying the token. Requests with forged tokens are still rejected when they
+// are authorized, and count against the budget of the tenant.
+type RateLimiter struct {
+	limits  atomic.Pointer[map[string]config.RateLimitConfig]
+	proxies atomic.Pointer[[]*net.IPNet]
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	tenant string
+	client string // empty for the bucket of the tenant as a whole
+	write  bool
+}
+
+// NewRateLimiter creates a rate limiter with the limits of the configured tenants
+func NewRateLimiter(cfg config.Config) *RateLimiter {
+	rl := &RateLimiter{
+		now:     time.Now,
+		buckets: map[bucketKey]*tokenBucket{},
+	}
+
+	rl.Reload(context.Background(), cfg)
+
+	return rl
+}
+
+// Validate reports whether the rate limits of the tenants, and the trusted proxies, in cfg
+// are valid
+func (rl *RateLimiter) Validate(ctx context.Context, cfg config.Config) error {
+	if _, err := parseTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	for _, tenant := range cfg.Tenants {
+		budgets := map[string]config.RateLimit{
+			"tenant.read":  tenant.RateLimits.Tenant.Read,
+			"tenant.write": tenant.RateLimits.Tenant.Write,
+			"client.read":  tenant.RateLimits.Client.Read,
+			"client.write": tenant.RateLimits.Client.Write,
+		}
+
+		for name, limit := range budgets {
+			if limit.Rate < 0 || limit.Burst < 0 {
+				return fmt.Errorf("invalid rate limit %s of tenant %s: rate and burst must not be negative", name, tenant.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reload replaces the limits of the tenants and the trusted proxies. Buckets whose limits have
+// changed are refilled according to the new limits on their next use.
+func (rl *RateLimiter) Reload(ctx context.Context, cfg config.Config) error {
+	err := rl.Validate(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	proxies, _ := parseTrustedProxies(cfg.Server.TrustedProxies)
+
+	limits := map[string]config.RateLimitConfig{}
+
+	for _, tenant := range cfg.Tenants {
+		limits[tenant.ID] = tenant.RateLimits
+	}
+
+	rl.limits.Store(&limits)
+	rl.proxies.Store(&proxies)
+
+	return nil
+}
+
+// allow takes a token from the buckets of the tenant and the client, or reports how long the
+// caller should wait before a token is available in both of them
+func (rl *RateLimiter) allow(tenant string, r *http.Request) (bool, time.Duration) {
+	cfg, ok := (*rl.limits.Load())[tenant]
+	if !ok {
+		return true, 0
+	}
+
+	write := !isRead(r)
+
+	tenantLimit, clientLimit := cfg.Tenant.Read, cfg.Client.Read
+	if write {
+		tenantLimit, clientLimit = cfg.Tenant.Write, cfg.Client.Write
+	}
+
+	client := anonymousClient
+	if clientLimit.Rate > 0 {
+		client = rl.client(r)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now, false)
+
+	buckets := make([]*tokenBucket, 0, 2)
+
+	if tenantLimit.Rate > 0 {
+		buckets = append(buckets, rl.bucket(bucketKey{tenant: tenant, write: write}, tenantLimit, now))
+	}
+
+	if clientLimit.Rate > 0 && client != anonymousClient {
+		key := bucketKey{tenant: tenant, client: client, write: write}
+
+		if _, ok := rl.buckets[key]; !ok && len(rl.buckets) >= maxBuckets {
+			rl.sweep(now, true)
+			if len(rl.buckets) >= maxBuckets {
+				key.client = overflowClient
+			}
+		}
+
+		buckets = append(buckets, rl.bucket(key, clientLimit, now))
+	}
+
+	var wait time.Duration
+
+	for _, b := range buckets {
+		wait = max(wait, b.wait())
+	}
+
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	return true, 0
+}
+
+// isRead reports whether the request only reads, which includes queries that are posted
+// to /entityOperations/query because they are too long to fit in the url
+func isRead(r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return strings.HasSuffix(r.URL.Path, "/entityOperations/query")
+	}
+
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// bucket returns the refilled bucket with the key, replacing it if its limit has changed
+func (rl *RateLimiter) bucket(key bucketKey, limit config.RateLimit, now time.Time) *tokenBucket {
+	b, ok := rl.buckets[key]
+	if !ok || b.limit != limit {
+		b = newTokenBucket(limit, now)
+		rl.buckets[key] = b
+	}
+
+	b.refill(now)
+
+	return b
+}
+
+// sweep lets go of the buckets that have been idle long enough to be full again, as they
+// would be recreated in the same state if they are needed again. Sweeps are made at most once
+// per interval unless forced, and forced sweeps at most once per second.
+func (rl *RateLimiter) sweep(now time.Time, force bool) {
+	interval := bucketSweepInterval
+	if force {
+		interval = time.Second
+	}
+
+	if now.Sub(rl.lastSweep) < interval {
+		return
+	}
+
+	rl.lastSweep = now
+
+	for key, b := range rl.buckets {
+		b.refill(now)
+		if b.tokens >= b.capacity() {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+type tokenBucket struct {
+	limit   config.RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+func newTokenBucket(limit config.RateLimit, now time.Time) *tokenBucket {
+	b := &tokenBucket{limit: limit, updated: now}
+	b.tokens = b.capacity()
+	return b
+}
+
+func (b *tokenBucket) capacity() float64 {
+	if b.limit.Burst > 0 {
+		return float64(b.limit.Burst)
+	}
+
+	return max(1, math.Ceil(b.limit.Rate))
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = min(b.capacity(), b.tokens+elapsed*b.limit.Rate)
+	b.updated = now
+}
+
+// wait returns how long it takes until there is a token in the bucket
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// client returns the name of the bucket of the client that sent the request. Clients with
+// and without tokens get names with different prefixes, so that a claim can not be used to
+// take the bucket of an address or the other way around.
+func (rl *RateLimiter) client(r *http.Request) string {
+	if id := tokenClient(r); id != "" {
+		return "token:" + id
+	}
+
+	return "address:" + clientAddress(r, *rl.proxies.Load())
+}
+
+// tokenClient returns the azp claim, or the client_id claim, of the bearer token of the
+// request without verifying the token, or an empty string if there is no such claim
+func tokenClient(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	claims := struct {
+		AuthorizedParty string `json:"azp"`
+		ClientID        string `json:"client_id"`
+	}{}
+
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+
+	if claims.AuthorizedParty != "" {
+		return claims.AuthorizedParty
+	}
+
+	return claims.ClientID
+}
+
+// clientAddress returns the address that the request was sent from, without its port. The
+// X-Forwarded-For header is only used if the request comes from a trusted proxy, and is read
+// from the right so that the address is the one that the outermost trusted proxy was sent
+// the request from.
+func clientAddress(r *http.Request, proxies []*net.IPNet) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	if !isTrustedProxy(addr, proxies) {
+		return addr
+	}
+
+	hops := []string{}
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		addr = hop
+
+		if !isTrustedProxy(hop, proxies) {
+			break
+		}
+	}
+
+	return addr
+}
+
+func isTrustedProxy(addr string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTrustedProxies parses addresses and CIDR ranges into networks, where a single address
+// is a network of its own
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: expected an address or a CIDR range", proxy)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// RateLimitMiddleware rejects requests that exceed the rate limits of their tenant or client
+// with 429 Too Many Requests. It has to be used after NGSIMiddleware, which finds out the
+// tenant of the request. Requests are not limited if the limiter is nil.
+func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := GetTenantFromContext(r.Context())
+
+			allowed, wait := limiter.allow(tenant, r)
+			if !allowed {
+				retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+				traceID := ""
+				if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+					traceID = sc.TraceID().String()
+				}
+
+				ngsierrors.ReportTooManyRequestsError(w, fmt.Sprintf("rate limit exceeded for tenant %s, retry after %d seconds", tenant, retryAfter), traceID)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
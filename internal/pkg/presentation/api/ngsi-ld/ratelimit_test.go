@@ -0,0 +1,182 @@
+package ngsild
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/internal/pkg/application/config"
+	"github.com/matryer/is"
+)
+
+func TestThatRequestsOverTheTenantLimitAreRejected(t *testing.T) {
+	is := is.New(t)
+	handler, _ := setupRateLimitTest(config.RateLimitConfig{
+		Tenant: config.RateLimitBudgets{Read: config.RateLimit{Rate: 0.5, Burst: 2}},
+	})
+
+	is.Equal(serve(handler, http.MethodGet, "", "").Code, http.StatusOK)
+	is.Equal(serve(handler, http.MethodGet, "", "").Code, http.StatusOK)
+
+	w := serve(handler, http.MethodGet, "", "")
+	is.Equal(w.Code, http.StatusTooManyRequests)
+	is.Equal(w.Header().Get("Retry-After"), "2") // should wait for the bucket to refill
+	is.Equal(w.Header().Get("Content-Type"), "application/problem+json")
+	is.True(strings.Contains(w.Body.String(), "Too Many Requests"))
+}
+
+func TestThatReadsAndWritesHaveSeparateBudgets(t *testing.T) {
+	is := is.New(t)
+	handler, _ := setupRateLimitTest(config.RateLimitConfig{
+		Tenant: config.RateLimitBudgets{
+			Read:  config.RateLimit{Rate: 1},
+			Write: config.RateLimit{Rate: 1},
+		},
+	})
+
+	is.Equal(serve(handler, http.MethodGet, "", "").Code, http.StatusOK)
+	is.Equal(serve(handler, http.MethodGet, "", "").Code, http.StatusTooManyRequests)
+	is.Equal(serve(handler, http.MethodPatch, "", "").Code, http.StatusOK) // should not be affected by the reads
+	is.Equal(serve(handler, http.MethodPost, "", "").Code, http.StatusTooManyRequests)
+}
+
+func TestThatPostedQueriesCountAsReads(t *testing.T) {
+	is := is.New(t)
+
+	query := httptest.NewRequest(http.MethodPost, "/ngsi-ld/v1/entityOperations/query", nil)
+	upsert := httptest.NewRequest(http.MethodPost, "/ngsi-ld/v1/entityOperations/upsert", nil)
+
+	is.True(isRead(query))
+	is.True(!isRead(upsert))
+}
+
+func TestThatEachClientHasABudgetOfItsOwn(t *testing.T) {
+	is := is.New(t)
+	handler, clock := setupRateLimitTest(config.RateLimitConfig{
+		Client: config.RateLimitBudgets{Write: config.RateLimit{Rate: 1}},
+	})
+
+	integration, dashboard := "10.0.0.1:41000", "10.0.0.2:41000"
+
+	is.Equal(serve(handler, http.MethodPatch, integration, "").Code, http.StatusOK)
+	is.Equal(serve(handler, http.MethodPatch, integration, "").Code, http.StatusTooManyRequests)
+	is.Equal(serve(handler, http.MethodPatch, dashboard, "").Code, http.StatusOK)
+
+	*clock = clock.Add(time.Second)
+
+	is.Equal(serve(handler, http.MethodPatch, integration, "").Code, http.StatusOK) // should have been refilled
+}
+
+func TestThatClientsWithTokensAreToldApartByTheirClaims(t *testing.T) {
+	is := is.New(t)
+	handler, _ := setupRateLimitTest(config.RateLimitConfig{
+		Client: config.RateLimitBudgets{Write: config.RateLimit{Rate: 1}},
+	})
+
+	integration, dashboard := testToken(`{"azp":"integration"}`), testToken(`{"client_id":"dashboard"}`)
+
+	is.Equal(serve(handler, http.MethodPatch, "10.0.0.1:41000", integration).Code, http.StatusOK)
+	is.Equal(serve(handler, http.MethodPatch, "10.0.0.2:41000", integration).Code, http.StatusTooManyRequests) // should share a bucket across addresses
+	is.Equal(serve(handler, http.MethodPatch, "10.0.0.1:41001", dashboard).Code, http.StatusOK)                // should not share the bucket of the address
+	is.Equal(serve(handler, http.MethodPatch, "10.0.0.1:41002", "").Code, http.StatusOK)
+}
+
+func TestThatForwardedAddressesAreOnlyUsedFromTrustedProxies(t *testing.T) {
+	is := is.New(t)
+	handler, _ := setupRateLimitTest(config.RateLimitConfig{
+		Client: config.RateLimitBudgets{Write: config.RateLimit{Rate: 1}},
+	}, "10.0.0.0/24")
+
+	forwarded := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/ngsi-ld/v1/entities", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	is.Equal(forwarded("10.0.0.1:41000", "203.0.113.1"), http.StatusOK)
+	is.Equal(forwarded("10.0.0.2:41000", "203.0.113.2, 10.0.0.1"), http.StatusOK) // should skip the trusted hop
+	is.Equal(forwarded("10.0.0.1:41000", "203.0.113.2, 203.0.113.1"), http.StatusTooManyRequests)
+
+	is.Equal(forwarded("192.0.2.1:41000", "203.0.113.3"), http.StatusOK)
+	is.Equal(forwarded("192.0.2.1:41000", "203.0.113.4"), http.StatusTooManyRequests) // should not trust the header of an untrusted client
+}
+
+func TestThatInvalidTrustedProxiesAreRejected(t *testing.T) {
+	is := is.New(t)
+	limiter := NewRateLimiter(config.Config{})
+
+	err := limiter.Reload(context.Background(), config.Config{Server: config.ServerConfig{TrustedProxies: []string{"10.0.0.0/33"}}})
+	is.True(err != nil)
+}
+
+func TestThatClientsShareABucketOnceTheCapIsReached(t *testing.T) {
+	is := is.New(t)
+
+	limiter := NewRateLimiter(config.Config{Tenants: []config.Tenant{{
+		ID:         "default",
+		RateLimits: config.RateLimitConfig{Client: config.RateLimitBudgets{Write: config.RateLimit{Rate: 1}}},
+	}}})
+
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	for i := range maxBuckets {
+		limiter.buckets[bucketKey{tenant: "default", client: fmt.Sprintf("client-%d", i), write: true}] = &tokenBucket{limit: config.RateLimit{Rate: 1}, updated: now}
+	}
+
+	request := func(addr string) bool {
+		r := httptest.NewRequest(http.MethodPatch, "/ngsi-ld/v1/entities", nil)
+		r.RemoteAddr = addr
+		allowed, _ := limiter.allow("default", r)
+		return allowed
+	}
+
+	is.True(request("10.0.0.1:41000"))
+	is.True(!request("10.0.0.2:41000")) // should share the overflow bucket with the first client
+	is.Equal(len(limiter.buckets), maxBuckets+1)
+}
+
+func setupRateLimitTest(limits config.RateLimitConfig, trustedProxies ...string) (http.Handler, *time.Time) {
+	clock := time.Now()
+
+	limiter := NewRateLimiter(config.Config{
+		Tenants: []config.Tenant{{ID: "default", RateLimits: limits}},
+		Server:  config.ServerConfig{TrustedProxies: trustedProxies},
+	})
+	limiter.now = func() time.Time { return clock }
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return NGSIMiddleware()(RateLimitMiddleware(limiter)(ok)), &clock
+}
+
+func serve(handler http.Handler, method, remoteAddr, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/ngsi-ld/v1/entities", nil)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func testToken(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(claims)) + "." + encode([]byte("signature"))
+}
@@ -0,0 +1,269 @@
+package ngsild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/diwise/context-broker/internal/pkg/application/cim"
+	"github.com/diwise/context-broker/internal/pkg/presentation/api/ngsi-ld/auth"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TraceAttributeSubscriptionID string = "subscription-id"
+
+// NewCreateSubscriptionHandler handles POST requests for new subscriptions
+func NewCreateSubscriptionHandler(
+	contextInformationManager cim.SubscriptionCreator,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "create-subscription",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		subscription := subscriptions.Subscription{}
+
+		body, _ := io.ReadAll(r.Body)
+		err = json.Unmarshal(body, &subscription)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, subscription.EntityTypes())
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		result, err := contextInformationManager.CreateSubscription(ctx, tenant, subscription)
+		if err != nil {
+			log.Error("create subscription failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("subscription created", "endpoint", subscription.Notification.Endpoint.URI, "location", result.Location())
+
+		w.Header().Add("Location", result.Location())
+		w.WriteHeader(http.StatusCreated)
+	})
+}
+
+// NewQuerySubscriptionsHandler handles GET requests for subscriptions
+func NewQuerySubscriptionsHandler(
+	contextInformationManager cim.SubscriptionQuerier,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+
+		ctx, span := tracer.Start(ctx, "query-subscriptions",
+			trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, tenant)),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span, logger.With(slog.String("tenant", tenant)), ctx,
+		)
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		result, err := contextInformationManager.QuerySubscriptions(ctx, tenant)
+		if err != nil {
+			log.Error("query subscriptions failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		writeResourceResponse(w, r, result)
+	})
+}
+
+// NewRetrieveSubscriptionHandler handles GET requests for a single subscription
+func NewRetrieveSubscriptionHandler(
+	contextInformationManager cim.SubscriptionRetriever,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		subscriptionID, _ := url.QueryUnescape(chi.URLParam(r, "subscriptionId"))
+
+		ctx, span := tracer.Start(ctx, "retrieve-subscription",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeSubscriptionID, subscriptionID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("subscriptionID", subscriptionID), slog.String("tenant", tenant)),
+			ctx)
+
+		subscription, err := contextInformationManager.RetrieveSubscription(ctx, tenant, subscriptionID)
+
+		if err == nil {
+			autherr := authenticator.CheckAccess(ctx, r, tenant, subscription.EntityTypes())
+			if autherr != nil {
+				err = autherr
+				log.Warn("access not granted", "err", err.Error())
+				ngsierrors.ReportNotFoundError(w, "not found", traceID)
+				return
+			}
+		}
+
+		if err != nil {
+			log.Error("retrieve subscription failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		writeResourceResponse(w, r, subscription)
+	})
+}
+
+// NewUpdateSubscriptionHandler handles PATCH requests for subscriptions
+func NewUpdateSubscriptionHandler(
+	contextInformationManager cim.SubscriptionUpdater,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		subscriptionID, _ := url.QueryUnescape(chi.URLParam(r, "subscriptionId"))
+
+		ctx, span := tracer.Start(ctx, "update-subscription",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeSubscriptionID, subscriptionID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("subscriptionID", subscriptionID), slog.String("tenant", tenant)),
+			ctx)
+
+		fragment := subscriptions.Subscription{}
+
+		body, _ := io.ReadAll(r.Body)
+		err = json.Unmarshal(body, &fragment)
+		if err != nil {
+			ngsierrors.ReportNewInvalidRequest(
+				w,
+				fmt.Sprintf("unable to decode request payload: %s", err.Error()),
+				traceID,
+			)
+			return
+		}
+
+		err = authenticator.CheckAccess(ctx, r, tenant, fragment.EntityTypes())
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		err = contextInformationManager.UpdateSubscription(ctx, tenant, subscriptionID, fragment)
+		if err != nil {
+			log.Error("update subscription failed", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("subscription updated")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// NewDeleteSubscriptionHandler handles DELETE requests for subscriptions
+func NewDeleteSubscriptionHandler(
+	contextInformationManager cim.SubscriptionDeleter,
+	authenticator auth.Enticator,
+	logger *slog.Logger) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx := r.Context()
+		tenant := GetTenantFromContext(ctx)
+		subscriptionID, _ := url.QueryUnescape(chi.URLParam(r, "subscriptionId"))
+
+		ctx, span := tracer.Start(ctx, "delete-subscription",
+			trace.WithAttributes(
+				attribute.String(TraceAttributeNGSILDTenant, tenant),
+				attribute.String(TraceAttributeSubscriptionID, subscriptionID),
+			),
+		)
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+		traceID, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+			span,
+			logger.With(slog.String("subscriptionID", subscriptionID), slog.String("tenant", tenant)),
+			ctx)
+
+		err = authenticator.CheckAccess(ctx, r, tenant, []string{})
+		if err != nil {
+			log.Warn("access not granted", "err", err.Error())
+			ngsierrors.ReportUnauthorizedRequest(w, "not authorized", traceID)
+			return
+		}
+
+		err = contextInformationManager.DeleteSubscription(ctx, tenant, subscriptionID)
+		if err != nil {
+			log.Error("failed to delete subscription", "err", err.Error())
+			mapCIMToNGSILDError(w, err, traceID)
+			return
+		}
+
+		log.Info("subscription deleted")
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
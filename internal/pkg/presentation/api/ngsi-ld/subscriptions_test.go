@@ -0,0 +1,89 @@
+package ngsild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/subscriptions"
+)
+
+func TestCreateSubscription(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.CreateSubscriptionFunc = func(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error) {
+		return ngsild.NewCreateSubscriptionResult("/ngsi-ld/v1/subscriptions/" + subscription.ID), nil
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/subscriptions", bytes.NewBufferString(subscriptionJSON))
+
+	is.Equal(resp.StatusCode, http.StatusCreated) // Check status code
+	is.Equal(resp.Header.Get("Location"), "/ngsi-ld/v1/subscriptions/urn:ngsi-ld:Subscription:water")
+
+	is.Equal(len(app.CreateSubscriptionCalls()), 1)
+	subscription := app.CreateSubscriptionCalls()[0].Subscription
+	is.Equal(subscription.Notification.Endpoint.URI, "http://receiver:8080/notify")
+	is.Equal(subscription.EntityTypes(), []string{"WaterConsumptionObserved"})
+}
+
+func TestCreateSubscriptionWithBadDataReturnsBadRequest(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.CreateSubscriptionFunc = func(ctx context.Context, tenant string, subscription subscriptions.Subscription) (*ngsild.CreateSubscriptionResult, error) {
+		return nil, errors.NewBadRequestDataError("invalid notification endpoint")
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodPost, jsonLDContent, "/ngsi-ld/v1/subscriptions", bytes.NewBufferString(subscriptionJSON))
+
+	is.Equal(resp.StatusCode, http.StatusBadRequest) // Check status code
+}
+
+func TestRetrieveSubscription(t *testing.T) {
+	is, ts, app := setupTest(t)
+	defer ts.Close()
+
+	app.RetrieveSubscriptionFunc = func(ctx context.Context, tenant, subscriptionID string) (*subscriptions.Subscription, error) {
+		s := subscriptions.Subscription{}
+		json.Unmarshal([]byte(subscriptionJSON), &s)
+		return &s, nil
+	}
+
+	resp, responseBody := testRequest(is, ts, http.MethodGet, acceptJSON, "/ngsi-ld/v1/subscriptions/urn:ngsi-ld:Subscription:water", nil)
+
+	is.Equal(resp.StatusCode, http.StatusOK) // Check status code
+	is.Equal(resp.Header.Get("Content-Type"), "application/json")
+	is.Equal(app.RetrieveSubscriptionCalls()[0].SubscriptionID, "urn:ngsi-ld:Subscription:water")
+
+	s := subscriptions.Subscription{}
+	is.NoErr(json.Unmarshal([]byte(responseBody), &s))
+	is.Equal(s.ID, "urn:ngsi-ld:Subscription:water")
+}
+
+func TestDeleteUnknownSubscriptionReturnsNotFound(t *testing.T) {
+	is, ts, app := setupTestWithPolicies(t, allowAllPolicies)
+	defer ts.Close()
+
+	app.DeleteSubscriptionFunc = func(ctx context.Context, tenant, subscriptionID string) error {
+		return errors.NewNotFoundError("no such subscription")
+	}
+
+	resp, _ := testRequest(is, ts, http.MethodDelete, acceptJSON, "/ngsi-ld/v1/subscriptions/urn:ngsi-ld:Subscription:nope", nil)
+
+	is.Equal(resp.StatusCode, http.StatusNotFound) // Check status code
+	is.Equal(app.DeleteSubscriptionCalls()[0].SubscriptionID, "urn:ngsi-ld:Subscription:nope")
+}
+
+const subscriptionJSON string = `{
+	"id": "urn:ngsi-ld:Subscription:water",
+	"type": "Subscription",
+	"entities": [{"type": "WaterConsumptionObserved"}],
+	"notification": {
+		"endpoint": {"uri": "http://receiver:8080/notify", "accept": "application/json"}
+	}
+}`
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -34,8 +35,18 @@ type ContextBrokerClient interface {
 	QueryTemporalEvolutionOfEntities(ctx context.Context, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.QueryTemporalEntitiesResult, error)
 	RetrieveTemporalEvolutionOfEntity(ctx context.Context, entityID string, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error)
 	MergeEntity(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error)
+	ReplaceEntity(ctx context.Context, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error)
+	ReplaceAttribute(ctx context.Context, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error)
 	UpdateEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error)
+	AppendEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error)
+	PatchAttribute(ctx context.Context, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error)
+	DeleteAttribute(ctx context.Context, entityID, attributeName, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error)
 	DeleteEntity(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error)
+
+	CreateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+	UpsertEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+	UpdateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+	DeleteEntities(ctx context.Context, entityIDs []string) (*ngsild.BatchOperationResult, error)
 }
 
 type RequestDecoratorFunc func([]string) []string
@@ -62,6 +73,21 @@ func UserAgent(useragent string) func(*cbClient) {
 	return RequestHeader("user-agent", []string{useragent})
 }
 
+// Transport sets the http.RoundTripper that requests are sent through, wrapped by the
+// client's own tracing. Defaults to http.DefaultTransport.
+func Transport(rt http.RoundTripper) func(*cbClient) {
+	return func(c *cbClient) {
+		c.httpClient.Transport = otelhttp.NewTransport(rt)
+	}
+}
+
+// Timeout limits the time a single request, including reading the response, may take
+func Timeout(timeout time.Duration) func(*cbClient) {
+	return func(c *cbClient) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
 func NewContextBrokerClient(broker string, options ...func(*cbClient)) ContextBrokerClient {
 
 	c := &cbClient{
@@ -82,8 +108,11 @@ func NewContextBrokerClient(broker string, options ...func(*cbClient)) ContextBr
 }
 
 const (
-	TraceAttributeEntityID     string = "entity-id"
-	TraceAttributeNGSILDTenant string = "ngsild-tenant"
+	TraceAttributeEntityID      string = "entity-id"
+	TraceAttributeNGSILDTenant  string = "ngsild-tenant"
+	TraceAttributeAttempts      string = "attempts"
+	TraceAttributeBatchSize     string = "batch-size"
+	TraceAttributeAttributeName string = "attribute-name"
 )
 
 var tracer = otel.Tracer("context-broker-client")
@@ -95,6 +124,8 @@ type cbClient struct {
 
 	httpClient     http.Client
 	requestHeaders map[string][]string
+	retryPolicy    *RetryPolicy
+	credentials    CredentialsProvider
 }
 
 func (c cbClient) CreateEntity(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
@@ -387,6 +418,108 @@ func (c cbClient) MergeEntity(ctx context.Context, entityID string, fragment typ
 	return ngsild.NewMergeEntityResult(responseBody)
 }
 
+func (c cbClient) ReplaceEntity(ctx context.Context, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "replace-entity",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.String(TraceAttributeEntityID, entityID)),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	json, err := entity.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.NewBuffer(json)
+
+	response, responseBody, err := c.callContextSource(
+		ctx, http.MethodPut, c.baseURL+"/ngsi-ld/v1/entities/"+url.QueryEscape(entityID), body, headers,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		err = errorFromResponse(response, responseBody)
+		return nil, err
+	}
+
+	return ngsild.NewReplaceEntityResult(), nil
+}
+
+// ReplaceAttribute replaces an attribute of an entity with the attribute of the same name in the fragment
+func (c cbClient) ReplaceAttribute(ctx context.Context, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "replace-attribute",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.String(TraceAttributeEntityID, entityID)),
+		trace.WithAttributes(attribute.String(TraceAttributeAttributeName, attributeName)),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	b, err := attributeJSON(fragment, attributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	response, responseBody, err := c.callContextSource(
+		ctx, http.MethodPut, c.attributeURL(entityID, attributeName), bytes.NewBuffer(b), headers,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		err = errorFromResponse(response, responseBody)
+		return nil, err
+	}
+
+	return ngsild.NewReplaceAttributeResult(), nil
+}
+
+// attributeJSON returns the attribute of the fragment on its own, along with the @context of the fragment
+func attributeJSON(fragment types.EntityFragment, attributeName string) ([]byte, error) {
+	b, err := fragment.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string]json.RawMessage{}
+	if err = json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+
+	attr, ok := members[attributeName]
+	if !ok {
+		return nil, errors.NewBadRequestDataError(fmt.Sprintf("fragment does not contain attribute %s", attributeName))
+	}
+
+	contents := map[string]json.RawMessage{}
+	if err = json.Unmarshal(attr, &contents); err != nil {
+		return nil, err
+	}
+
+	if ctx, ok := members["@context"]; ok {
+		contents["@context"] = ctx
+	}
+
+	return json.Marshal(contents)
+}
+
+// errorFromResponse returns the error that a context source responded with
+func errorFromResponse(response *http.Response, responseBody []byte) error {
+	contentType := response.Header.Get("Content-Type")
+	if response.StatusCode >= http.StatusBadRequest && response.StatusCode <= http.StatusInternalServerError {
+		return errors.NewErrorFromProblemReport(response.StatusCode, contentType, responseBody)
+	}
+
+	return fmt.Errorf("context source returned status code %d (content-type: %s, body: %s)", response.StatusCode, contentType, string(responseBody))
+}
+
 func (c cbClient) UpdateEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
 	var err error
 
@@ -422,6 +555,110 @@ func (c cbClient) UpdateEntityAttributes(ctx context.Context, entityID string, f
 	return ngsild.NewUpdateEntityAttributesResult(responseBody)
 }
 
+func (c cbClient) AppendEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "append-entity-attributes",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.String(TraceAttributeEntityID, entityID)),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	json, err := fragment.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.NewBuffer(json)
+
+	response, responseBody, err := c.callContextSource(
+		ctx, http.MethodPost, c.baseURL+"/ngsi-ld/v1/entities/"+url.QueryEscape(entityID)+"/attrs/", body, headers,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusMultiStatus {
+		err = errorFromResponse(response, responseBody)
+		return nil, err
+	}
+
+	return ngsild.NewAppendEntityAttributesResult(responseBody)
+}
+
+// PatchAttribute updates an attribute of an entity with the attribute of the same name in the fragment
+func (c cbClient) PatchAttribute(ctx context.Context, entityID, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "patch-attribute",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.String(TraceAttributeEntityID, entityID)),
+		trace.WithAttributes(attribute.String(TraceAttributeAttributeName, attributeName)),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	b, err := attributeJSON(fragment, attributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	response, responseBody, err := c.callContextSource(
+		ctx, http.MethodPatch, c.attributeURL(entityID, attributeName), bytes.NewBuffer(b), headers,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		err = errorFromResponse(response, responseBody)
+		return nil, err
+	}
+
+	return ngsild.NewPatchAttributeResult(), nil
+}
+
+func (c cbClient) DeleteAttribute(ctx context.Context, entityID, attributeName, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "delete-attribute",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.String(TraceAttributeEntityID, entityID)),
+		trace.WithAttributes(attribute.String(TraceAttributeAttributeName, attributeName)),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	params := url.Values{}
+	if datasetID != "" {
+		params.Set("datasetId", datasetID)
+	}
+	if deleteAll {
+		params.Set("deleteAll", "true")
+	}
+
+	endpoint := c.attributeURL(entityID, attributeName)
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	response, responseBody, err := c.callContextSource(ctx, http.MethodDelete, endpoint, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		err = errorFromResponse(response, responseBody)
+		return nil, err
+	}
+
+	return ngsild.NewDeleteAttributeResult(), nil
+}
+
+func (c cbClient) attributeURL(entityID, attributeName string) string {
+	return c.baseURL + "/ngsi-ld/v1/entities/" + url.QueryEscape(entityID) + "/attrs/" + url.PathEscape(attributeName)
+}
+
 func (c cbClient) QueryEntities(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
 	var err error
 
@@ -435,10 +672,24 @@ func (c cbClient) QueryEntities(ctx context.Context, entityTypes, entityAttribut
 		return nil, fmt.Errorf("invalid query parameter")
 	}
 
-	endpoint := fmt.Sprintf("%s/ngsi-ld/v1/entities?%s", c.baseURL, queryValues.Encode())
-	response, responseBody, err := c.callContextSource(ctx, http.MethodGet, endpoint, nil, headers)
-	if err != nil {
-		return nil, err
+	var response *http.Response
+	var responseBody []byte
+
+	// queries that were posted are posted on to the context source as well, since they may
+	// be too long to fit in an url, unless the source does not support posted queries
+	if path, _, _ := strings.Cut(query, "?"); path == QueryOperationPath {
+		response, responseBody, err = c.postQuery(ctx, queryValues, headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response == nil || isMissingEndpoint(response) {
+		endpoint := fmt.Sprintf("%s/ngsi-ld/v1/entities?%s", c.baseURL, queryValues.Encode())
+		response, responseBody, err = c.callContextSource(ctx, http.MethodGet, endpoint, nil, headers)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if response.StatusCode != http.StatusOK {
@@ -491,6 +742,114 @@ func (c cbClient) QueryEntities(ctx context.Context, entityTypes, entityAttribut
 	return qer, nil
 }
 
+// QueryOperationPath is the path that queries are posted to. Queries that are passed to QueryEntities
+// with this path are posted to the context source as a Query, rather than sent as the parameters of a GET.
+const QueryOperationPath string = "/ngsi-ld/v1/entityOperations/query"
+
+// postQuery posts the query to the query endpoint of the context source. The parameters that
+// select entities are sent as a Query in the body, and the rest, such as limit, offset and
+// options, as parameters of the url.
+func (c cbClient) postQuery(ctx context.Context, queryValues url.Values, headers map[string][]string) (*http.Response, []byte, error) {
+	params := maps.Clone(queryValues)
+	query := map[string]any{"type": "Query"}
+
+	take := func(name string) string {
+		value := params.Get(name)
+		params.Del(name)
+		return value
+	}
+
+	splitIfNotEmpty := func(value string) []string {
+		if value == "" {
+			return []string{""}
+		}
+		return strings.Split(value, ",")
+	}
+
+	ids, types, idPattern := take("id"), take("type"), take("idPattern")
+
+	if ids != "" || types != "" || idPattern != "" {
+		// the parameters match entities with any of the ids and any of the types, which is
+		// every combination of them as entity selectors
+		selectors := []map[string]string{}
+
+		for _, id := range splitIfNotEmpty(ids) {
+			for _, entityType := range splitIfNotEmpty(types) {
+				selector := map[string]string{}
+				setIfNotEmpty(selector, "id", id)
+				setIfNotEmpty(selector, "type", entityType)
+				setIfNotEmpty(selector, "idPattern", idPattern)
+				selectors = append(selectors, selector)
+			}
+		}
+
+		query["entities"] = selectors
+	}
+
+	if attrs := take("attrs"); attrs != "" {
+		query["attrs"] = strings.Split(attrs, ",")
+	}
+
+	if q := take("q"); q != "" {
+		query["q"] = q
+	}
+
+	if georel := take("georel"); georel != "" {
+		geoQ := map[string]any{"georel": georel, "geometry": take("geometry")}
+
+		// coordinates are sent as json if they are, and as a string that holds them otherwise
+		coordinates := take("coordinates")
+		if json.Valid([]byte(coordinates)) {
+			geoQ["coordinates"] = json.RawMessage(coordinates)
+		} else {
+			geoQ["coordinates"] = coordinates
+		}
+
+		if geoproperty := take("geoproperty"); geoproperty != "" {
+			geoQ["geoproperty"] = geoproperty
+		}
+
+		query["geoQ"] = geoQ
+	}
+
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	postHeaders := maps.Clone(headers)
+	if postHeaders == nil {
+		postHeaders = map[string][]string{}
+	}
+	postHeaders["Content-Type"] = []string{"application/json"}
+
+	endpoint := c.baseURL + QueryOperationPath
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	return c.callContextSource(ctx, http.MethodPost, endpoint, bytes.NewReader(body), postHeaders)
+}
+
+func setIfNotEmpty(m map[string]string, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// isMissingEndpoint reports if the response is from a context source that does not implement the
+// endpoint that the request was sent to, as opposed to one that did not find what was asked for
+func isMissingEndpoint(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		return !strings.HasPrefix(response.Header.Get("Content-Type"), errors.ProblemReportContentType)
+	default:
+		return false
+	}
+}
+
 func (c cbClient) DeleteEntity(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
 	var err error
 
@@ -520,9 +879,168 @@ func (c cbClient) DeleteEntity(ctx context.Context, entityID string) (*ngsild.De
 	return ngsild.NewDeleteEntityResult(), nil
 }
 
+func (c cbClient) CreateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	return c.entityBatchOperation(ctx, "create", entities, headers)
+}
+
+func (c cbClient) UpsertEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	return c.entityBatchOperation(ctx, "upsert", entities, headers)
+}
+
+func (c cbClient) UpdateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	return c.entityBatchOperation(ctx, "update", entities, headers)
+}
+
+func (c cbClient) DeleteEntities(ctx context.Context, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+	body, err := json.Marshal(entityIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.batchOperation(ctx, "delete", entityIDs, body, nil)
+}
+
+func (c cbClient) entityBatchOperation(ctx context.Context, operation string, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	entityIDs := make([]string, 0, len(entities))
+	body := make([]json.RawMessage, 0, len(entities))
+
+	for _, e := range entities {
+		b, err := e.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		entityIDs = append(entityIDs, e.ID())
+		body = append(body, b)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.batchOperation(ctx, operation, entityIDs, b, headers)
+}
+
+// ErrBatchNotSupported is wrapped by the errors of batch operations that were sent to a context
+// source that does not implement the endpoint of the operation at all
+var ErrBatchNotSupported = fmt.Errorf("batch operation not supported")
+
+// batchOperation sends a batch of entities to one of the entityOperations endpoints. Context sources
+// that do not implement the endpoint result in an error that wraps ErrBatchNotSupported, as well as
+// errors.ErrOperationNotSupported, so that the caller can fall back to operating on one entity at a time.
+func (c cbClient) batchOperation(ctx context.Context, operation string, entityIDs []string, body []byte, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, operation+"-entities",
+		trace.WithAttributes(attribute.String(TraceAttributeNGSILDTenant, c.tenant)),
+		trace.WithAttributes(attribute.Int(TraceAttributeBatchSize, len(entityIDs))),
+	)
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	response, responseBody, err := c.callContextSource(
+		ctx, http.MethodPost, c.baseURL+"/ngsi-ld/v1/entityOperations/"+operation, bytes.NewBuffer(body), headers,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := ngsild.NewBatchOperationResult()
+	contentType := response.Header.Get("Content-Type")
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		// a successful create responds with the ids of the created entities, while
+		// the other operations respond without a body if they succeeded for all
+		result.Succeeded(entityIDs...)
+	case http.StatusMultiStatus:
+		err = json.Unmarshal(responseBody, result)
+		if err != nil {
+			err = fmt.Errorf("failed to unmarshal batch operation result: %s (%w)", err.Error(), errors.ErrBadResponse)
+			return nil, err
+		}
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// a not found that comes with a problem report is about what is in the batch, rather
+		// than about the batch endpoint not being there
+		if !isMissingEndpoint(response) {
+			err = errors.NewErrorFromProblemReport(response.StatusCode, contentType, responseBody)
+			return nil, err
+		}
+
+		err = fmt.Errorf("%w: %w", ErrBatchNotSupported, errors.NewOperationNotSupportedError(fmt.Sprintf("context source does not support batch %s", operation)))
+		return nil, err
+	default:
+		if response.StatusCode >= http.StatusBadRequest && response.StatusCode <= http.StatusInternalServerError {
+			err = errors.NewErrorFromProblemReport(response.StatusCode, contentType, responseBody)
+			return nil, err
+		}
+
+		err = fmt.Errorf("context source returned status code %d (content-type: %s, body: %s)", response.StatusCode, contentType, string(responseBody))
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (c cbClient) callContextSource(ctx context.Context, method, endpoint string, body io.Reader, headers map[string][]string) (*http.Response, []byte, error) {
 
-	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	var requestBody []byte
+
+	if body != nil {
+		var err error
+		requestBody, err = io.ReadAll(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read request body: %s (%w)", err.Error(), errors.ErrInternal)
+		}
+	}
+
+	attempt := 0
+	defer func() {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int(TraceAttributeAttempts, attempt))
+	}()
+
+	reauthenticated := false
+
+	for {
+		attempt++
+
+		resp, respBody, err := c.sendRequest(ctx, method, endpoint, requestBody, headers)
+
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && c.credentials != nil {
+			// the credentials may have been revoked or expired early, so let the provider
+			// know that it should renew them and try once more before giving up
+			c.credentials.Invalidate()
+
+			if !reauthenticated {
+				reauthenticated = true
+				continue
+			}
+		}
+
+		delay, retry := c.retryPolicy.shouldRetry(ctx, method, attempt, resp, err)
+		if !retry {
+			return resp, respBody, err
+		}
+
+		logging.GetFromContext(ctx).Debug("retrying request to context source", "method", method, "endpoint", endpoint, "attempt", attempt, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return resp, respBody, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c cbClient) sendRequest(ctx context.Context, method, endpoint string, body []byte, headers map[string][]string) (*http.Response, []byte, error) {
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bodyReader)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create request: %s (%w)", err.Error(), errors.ErrInternal)
 	}
@@ -543,9 +1061,16 @@ func (c cbClient) callContextSource(ctx context.Context, method, endpoint string
 		}
 	}
 
+	if c.credentials != nil {
+		err = c.credentials.Apply(ctx, req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to apply credentials: %s (%w)", err.Error(), errors.ErrRequest)
+		}
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to send request: %s (%w)", err.Error(), errors.ErrRequest)
+		return nil, nil, fmt.Errorf("failed to send request: %w (%w)", err, errors.ErrRequest)
 	}
 
 	defer resp.Body.Close()
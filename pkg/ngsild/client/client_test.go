@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -139,6 +141,28 @@ func TestMergeEntity(t *testing.T) {
 	is.Equal(s.RequestCount(), 1)
 }
 
+func TestReplaceAttributeSendsTheAttributeOnItsOwn(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(
+			is,
+			method(http.MethodPut),
+			path("/ngsi-ld/v1/entities/id/attrs/temperature"),
+			body(`{"@context":["https://raw.githubusercontent.com/diwise/context-broker/main/assets/jsonldcontexts/default-context.jsonld"],"type":"Property","value":17.2}`),
+		),
+		Returns(response.Code(http.StatusNoContent)),
+	)
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL())
+
+	fragment, _ := entities.NewFragment(entities.P("temperature", properties.NewNumberProperty(17.2)))
+	_, err := c.ReplaceAttribute(context.Background(), "id", "temperature", fragment, nil)
+
+	is.NoErr(err)
+}
+
 func TestUpdateEntityAttributesWithMetaData(t *testing.T) {
 	is := is.New(t)
 
@@ -215,6 +239,234 @@ func TestDeleteEntityNotFound(t *testing.T) {
 	is.True(errors.Is(err, ngsierrors.ErrNotFound))
 }
 
+func TestUpdateEntitiesReportsTheEntitiesThatFailed(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(
+			is,
+			method(http.MethodPost),
+			path("/ngsi-ld/v1/entityOperations/update"),
+		),
+		Returns(
+			response.ContentType("application/json"),
+			response.Code(http.StatusMultiStatus),
+			response.Body([]byte(`{"success":["id1"],"errors":[{"entityId":"id2","error":{"type":"https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound"}}]}`)),
+		),
+	)
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL())
+
+	result, err := c.UpdateEntities(context.Background(), []types.Entity{testEntity("Road", "id1"), testEntity("Road", "id2")}, nil)
+
+	is.NoErr(err)
+	is.Equal(result.Success, []string{"id1"})
+	is.Equal(result.Errors[0].EntityID, "id2")
+}
+
+func TestDeleteEntitiesIsNotSupportedBySourcesWithoutBatchEndpoints(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is, method(http.MethodPost), path("/ngsi-ld/v1/entityOperations/delete"), body(`["id1","id2"]`)),
+		Returns(response.Code(http.StatusNotFound)),
+	)
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL())
+
+	_, err := c.DeleteEntities(context.Background(), []string{"id1", "id2"})
+
+	is.True(errors.Is(err, ngsierrors.ErrOperationNotSupported))
+}
+
+func TestPostedQueriesArePostedToTheContextSource(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(is,
+			method(http.MethodPost),
+			path("/ngsi-ld/v1/entityOperations/query"),
+			QueryParamEquals("limit", "10"),
+			body(`{"attrs":["temperature"],"entities":[{"type":"Beach"},{"type":"Lake"}],"geoQ":{"coordinates":[17.3,62.4],"geometry":"Point","georel":"near;maxDistance==2000"},"q":"temperature\u003e20","type":"Query"}`),
+		),
+		Returns(response.Code(http.StatusOK), response.Body([]byte("[]"))),
+	)
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL())
+
+	query := QueryOperationPath + "?attrs=temperature&coordinates=%5B17.3%2C62.4%5D&geometry=Point&georel=near%3BmaxDistance%3D%3D2000&limit=10&q=temperature%3E20&type=Beach%2CLake"
+	result, err := c.QueryEntities(context.Background(), []string{"Beach", "Lake"}, []string{"temperature"}, query, nil)
+
+	is.NoErr(err)
+	is.Equal(result.Limit, 10)
+}
+
+func TestPostedQueriesFallBackToGetForSourcesWithoutTheQueryEndpoint(t *testing.T) {
+	is := is.New(t)
+
+	var requests []string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL)
+
+	_, err := c.QueryEntities(context.Background(), []string{"Beach"}, nil, QueryOperationPath+"?type=Beach", nil)
+
+	is.NoErr(err)
+	is.Equal(requests, []string{"POST /ngsi-ld/v1/entityOperations/query", "GET /ngsi-ld/v1/entities"})
+}
+
+func TestDeleteAttributeOfAllDatasets(t *testing.T) {
+	is := is.New(t)
+
+	s := testutils.NewMockServiceThat(
+		Expects(
+			is,
+			method(http.MethodDelete),
+			path("/ngsi-ld/v1/entities/id/attrs/temperature"),
+			expects.QueryParamEquals("deleteAll", "true"),
+		),
+		Returns(response.Code(http.StatusNoContent)),
+	)
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL())
+
+	_, err := c.DeleteAttribute(context.Background(), "id", "temperature", "", true)
+
+	is.NoErr(err)
+}
+
+func TestDeleteEntityIsRetriedOnServiceUnavailable(t *testing.T) {
+	is := is.New(t)
+
+	requestCount := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if requestCount < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL, Retry(RetryPolicy{
+		MaxAttempts: 3, InitialBackoff: time.Millisecond, Methods: []string{http.MethodDelete},
+	}))
+
+	_, err := c.DeleteEntity(context.Background(), "id")
+
+	is.NoErr(err)
+	is.Equal(requestCount, 3)
+}
+
+func TestMergeEntityIsNotRetriedUnlessConfigured(t *testing.T) {
+	is := is.New(t)
+
+	requestCount := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL, Retry(RetryPolicy{
+		MaxAttempts: 3, InitialBackoff: time.Millisecond, Methods: []string{http.MethodGet, http.MethodDelete},
+	}))
+
+	_, err := c.MergeEntity(context.Background(), "id", testEntity("Road", "id"), nil)
+
+	is.True(err != nil)
+	is.Equal(requestCount, 1)
+}
+
+func TestThatRetryAfterLongerThanMaxBackoffIsNotWaitedFor(t *testing.T) {
+	is := is.New(t)
+
+	policy := &RetryPolicy{MaxAttempts: 3, MaxBackoff: time.Second, Methods: []string{http.MethodGet}}
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"120"}}}
+
+	_, retry := policy.shouldRetry(context.Background(), http.MethodGet, 1, resp, nil)
+	is.True(!retry)
+
+	resp.Header.Set("Retry-After", "1")
+	delay, retry := policy.shouldRetry(context.Background(), http.MethodGet, 1, resp, nil)
+	is.True(retry)
+	is.Equal(delay, time.Second)
+}
+
+func TestThatAPIKeyIsAddedToRequests(t *testing.T) {
+	is := is.New(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("X-API-Key"), "s3cr3t")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL, Credentials(APIKey("X-API-Key", "s3cr3t")))
+
+	_, err := c.DeleteEntity(context.Background(), "id")
+	is.NoErr(err)
+}
+
+func TestThatAccessTokenIsCachedAndRenewedWhenRejected(t *testing.T) {
+	is := is.New(t)
+
+	tokensIssued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		is.True(ok)
+		is.Equal(clientID, "broker")
+		is.Equal(clientSecret, "s3cr3t")
+		is.NoErr(r.ParseForm())
+		is.Equal(r.PostForm.Get("grant_type"), "client_credentials")
+
+		tokensIssued++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":300}`, tokensIssued)
+	}))
+	defer tokenServer.Close()
+
+	validToken := "Bearer token-1"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := NewContextBrokerClient(s.URL, Credentials(OAuth2ClientCredentials(tokenServer.URL, "broker", "s3cr3t", "")))
+
+	for range 2 {
+		_, err := c.DeleteEntity(context.Background(), "id")
+		is.NoErr(err)
+	}
+	is.Equal(tokensIssued, 1) // the token should be reused between requests
+
+	validToken = "Bearer token-2"
+
+	_, err := c.DeleteEntity(context.Background(), "id")
+	is.NoErr(err)
+	is.Equal(tokensIssued, 2) // a new token should be requested when the old one is rejected
+}
+
 func TestRetrieveTemporalEvolutionOfAnEntity(t *testing.T) {
 	is := is.New(t)
 
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// CredentialsProvider adds credentials to the requests that are sent to a context source
+type CredentialsProvider interface {
+	Apply(ctx context.Context, req *http.Request) error
+	// Invalidate is called when the context source has rejected the credentials, so that
+	// providers that cache credentials can fetch new ones for the next request
+	Invalidate()
+}
+
+// Credentials makes the client add credentials from the provider to every request
+func Credentials(provider CredentialsProvider) func(*cbClient) {
+	return func(c *cbClient) {
+		c.credentials = provider
+	}
+}
+
+type headerCredentials struct {
+	header string
+	value  string
+}
+
+// BearerToken returns a provider that authenticates requests with a static bearer token
+func BearerToken(token string) CredentialsProvider {
+	return &headerCredentials{header: "Authorization", value: "Bearer " + token}
+}
+
+// APIKey returns a provider that authenticates requests with a static key in the given header
+func APIKey(header, key string) CredentialsProvider {
+	return &headerCredentials{header: header, value: key}
+}
+
+func (h *headerCredentials) Apply(ctx context.Context, req *http.Request) error {
+	req.Header.Set(h.header, h.value)
+	return nil
+}
+
+func (h *headerCredentials) Invalidate() {}
+
+// tokenExpiryMargin is subtracted from the lifetime of an access token, so that a token
+// is never sent when it is about to expire
+const tokenExpiryMargin time.Duration = 30 * time.Second
+
+type clientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+
+	httpClient http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// OAuth2ClientCredentials returns a provider that authenticates requests with an access token
+// that is fetched from the token endpoint using the OAuth2 client credentials grant. The token
+// is cached and reused until it is about to expire or is rejected by the context source.
+func OAuth2ClientCredentials(tokenURL, clientID, clientSecret, scope string) CredentialsProvider {
+	return &clientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		httpClient: http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   10 * time.Second,
+		},
+		now: time.Now,
+	}
+}
+
+func (cc *clientCredentials) Apply(ctx context.Context, req *http.Request) error {
+	token, err := cc.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (cc *clientCredentials) Invalidate() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.token = ""
+}
+
+func (cc *clientCredentials) accessToken(ctx context.Context) (string, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.token != "" && (cc.expiresAt.IsZero() || cc.now().Before(cc.expiresAt)) {
+		return cc.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if cc.scope != "" {
+		form.Set("scope", cc.scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cc.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cc.clientID), url.QueryEscape(cc.clientSecret))
+
+	resp, err := cc.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with status code %d", resp.StatusCode)
+	}
+
+	tokenResponse := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+
+	err = json.Unmarshal(body, &tokenResponse)
+	if err != nil || tokenResponse.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint did not respond with an access token")
+	}
+
+	cc.token = tokenResponse.AccessToken
+	cc.expiresAt = time.Time{}
+
+	if tokenResponse.ExpiresIn > 0 {
+		cc.expiresAt = cc.now().Add(time.Duration(tokenResponse.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+
+	return cc.token, nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+// RetryPolicy controls how failed requests to a context source are retried. Only requests
+// using one of the listed methods are retried, since retrying a non idempotent request
+// could apply it more than once.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Methods        []string
+}
+
+const (
+	defaultInitialBackoff time.Duration = 100 * time.Millisecond
+	defaultMaxBackoff     time.Duration = 5 * time.Second
+)
+
+// Retry makes the client retry failed requests according to the policy
+func Retry(policy RetryPolicy) func(*cbClient) {
+	return func(c *cbClient) {
+		if policy.InitialBackoff <= 0 {
+			policy.InitialBackoff = defaultInitialBackoff
+		}
+
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = defaultMaxBackoff
+		}
+
+		c.retryPolicy = &policy
+	}
+}
+
+func (p *RetryPolicy) retries(method string) bool {
+	return p != nil && p.MaxAttempts > 1 && slices.Contains(p.Methods, method)
+}
+
+// shouldRetry reports if a request that has been attempted the given number of times should be sent
+// again, and for how long to wait before doing so. Requests are retried on connection errors, on 429
+// Too Many Requests and on 502, 503 and 504 responses. A Retry-After header on a 429 or 503 response
+// is honored as long as it does not ask for a longer wait than MaxBackoff.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if !p.retries(method) || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	if err != nil {
+		// requests that are rejected by a circuit breaker, or given up by the caller, should not be retried
+		if errors.Is(err, ngsierrors.ErrServiceUnavailable) || errors.Is(err, context.Canceled) {
+			return 0, false
+		}
+
+		return p.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= p.MaxBackoff
+		}
+		return p.backoff(attempt), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return p.backoff(attempt), true
+	}
+
+	return 0, false
+}
+
+// backoff returns an exponentially increasing delay with jitter, in the range [d/2, d)
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << (attempt - 1)
+	if d > p.MaxBackoff || d <= 0 {
+		d = p.MaxBackoff
+	}
+
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+
+	return 0, false
+}
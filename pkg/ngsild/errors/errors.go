@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -14,6 +15,8 @@ var ErrBadRequest = fmt.Errorf("bad request")
 var ErrBadResponse = fmt.Errorf("bad response")
 var ErrInvalidRequest = fmt.Errorf("invalid request")
 var ErrUnknownTenant = fmt.Errorf("unknown tenant")
+var ErrServiceUnavailable = fmt.Errorf("service unavailable")
+var ErrOperationNotSupported = fmt.Errorf("operation not supported")
 
 type myError struct {
 	msg    string
@@ -58,6 +61,14 @@ func NewUnknownTenantError(tenant string) error {
 	return newMyError(fmt.Sprintf("unknown tenant: %s", tenant), ErrUnknownTenant)
 }
 
+func NewServiceUnavailableError(msg string) error {
+	return newMyError(msg, ErrServiceUnavailable)
+}
+
+func NewOperationNotSupportedError(msg string) error {
+	return newMyError(msg, ErrOperationNotSupported)
+}
+
 // TODO: Move problem report handling to a single place (presentation layer)
 
 func NewErrorFromProblemReport(code int, contentType string, body []byte) error {
@@ -92,6 +103,14 @@ func NewErrorFromProblemReport(code int, contentType string, body []byte) error
 		return NewAlreadyExistsError(report.Detail)
 	}
 
+	if code == http.StatusServiceUnavailable || report.Type == "https://uri.etsi.org/ngsi-ld/errors/ServiceUnavailable" {
+		return NewServiceUnavailableError(report.Detail)
+	}
+
+	if report.Type == "https://uri.etsi.org/ngsi-ld/errors/OperationNotSupported" {
+		return NewOperationNotSupportedError(report.Detail)
+	}
+
 	return NewInternalError(
 		fmt.Sprintf("[code: %d] unknown problem report of type \"%s\" with detail \"%s\" received",
 			code, report.Type, report.Detail,
@@ -271,6 +290,142 @@ func ReportUnauthorizedRequest(w http.ResponseWriter, detail, traceID string) {
 	ur.WriteResponse(w)
 }
 
+// Forbidden reports that the credentials of the request do not grant access to the requested resource
+type Forbidden struct {
+	ProblemDetailsImpl
+}
+
+// NewForbidden creates and returns a new instance of a Forbidden with the supplied problem detail
+func NewForbidden(detail, traceID string) *Forbidden {
+	return &Forbidden{
+		ProblemDetailsImpl: ProblemDetailsImpl{
+			typ:     "about:blank",
+			title:   "Forbidden",
+			detail:  detail,
+			code:    http.StatusForbidden,
+			traceID: traceID,
+		},
+	}
+}
+
+// ReportForbiddenError creates a Forbidden instance and sends it to the supplied http.ResponseWriter
+func ReportForbiddenError(w http.ResponseWriter, detail, traceID string) {
+	f := NewForbidden(detail, traceID)
+	f.WriteResponse(w)
+}
+
+// ServiceUnavailable reports that a context source needed to serve the request is currently unavailable
+type ServiceUnavailable struct {
+	ProblemDetailsImpl
+}
+
+// NewServiceUnavailable creates and returns a new instance of a ServiceUnavailable with the supplied problem detail
+func NewServiceUnavailable(detail, traceID string) *ServiceUnavailable {
+	return &ServiceUnavailable{
+		ProblemDetailsImpl: ProblemDetailsImpl{
+			typ:     "https://uri.etsi.org/ngsi-ld/errors/ServiceUnavailable",
+			title:   "Service Unavailable",
+			detail:  detail,
+			code:    http.StatusServiceUnavailable,
+			traceID: traceID,
+		},
+	}
+}
+
+// ReportServiceUnavailableError creates a ServiceUnavailable instance and sends it to the supplied http.ResponseWriter
+func ReportServiceUnavailableError(w http.ResponseWriter, detail, traceID string) {
+	su := NewServiceUnavailable(detail, traceID)
+	su.WriteResponse(w)
+}
+
+// TooManyRequests reports that the client has exceeded its rate limit and should retry later
+type TooManyRequests struct {
+	ProblemDetailsImpl
+}
+
+// NewTooManyRequests creates and returns a new instance of a TooManyRequests with the supplied problem detail
+func NewTooManyRequests(detail, traceID string) *TooManyRequests {
+	return &TooManyRequests{
+		ProblemDetailsImpl: ProblemDetailsImpl{
+			typ:     "about:blank",
+			title:   "Too Many Requests",
+			detail:  detail,
+			code:    http.StatusTooManyRequests,
+			traceID: traceID,
+		},
+	}
+}
+
+// ReportTooManyRequestsError creates a TooManyRequests instance and sends it to the supplied http.ResponseWriter
+func ReportTooManyRequestsError(w http.ResponseWriter, detail, traceID string) {
+	tmr := NewTooManyRequests(detail, traceID)
+	tmr.WriteResponse(w)
+}
+
+// RequestEntityTooLarge reports that the request holds more than the broker is willing to process at once
+type RequestEntityTooLarge struct {
+	ProblemDetailsImpl
+}
+
+// NewRequestEntityTooLarge creates and returns a new instance of a RequestEntityTooLarge with the supplied problem detail
+func NewRequestEntityTooLarge(detail, traceID string) *RequestEntityTooLarge {
+	return &RequestEntityTooLarge{
+		ProblemDetailsImpl: ProblemDetailsImpl{
+			typ:     "about:blank",
+			title:   "Request Entity Too Large",
+			detail:  detail,
+			code:    http.StatusRequestEntityTooLarge,
+			traceID: traceID,
+		},
+	}
+}
+
+// ReportRequestEntityTooLargeError creates a RequestEntityTooLarge instance and sends it to the supplied http.ResponseWriter
+func ReportRequestEntityTooLargeError(w http.ResponseWriter, detail, traceID string) {
+	tl := NewRequestEntityTooLarge(detail, traceID)
+	tl.WriteResponse(w)
+}
+
+// OperationNotSupported reports that the operation is not supported by the broker or by a context source
+type OperationNotSupported struct {
+	ProblemDetailsImpl
+}
+
+// NewOperationNotSupported creates and returns a new instance of an OperationNotSupported with the supplied problem detail
+func NewOperationNotSupported(detail, traceID string) *OperationNotSupported {
+	return &OperationNotSupported{
+		ProblemDetailsImpl: ProblemDetailsImpl{
+			typ:     "https://uri.etsi.org/ngsi-ld/errors/OperationNotSupported",
+			title:   "Operation Not Supported",
+			detail:  detail,
+			code:    http.StatusUnprocessableEntity,
+			traceID: traceID,
+		},
+	}
+}
+
+// NewProblemDetailsFromError creates the problem details that best describe an error
+func NewProblemDetailsFromError(err error, traceID string) ProblemDetails {
+	switch {
+	case errors.Is(err, ErrAlreadyExists):
+		return NewAlreadyExists(err.Error(), traceID)
+	case errors.Is(err, ErrBadRequest):
+		return NewBadRequestData(err.Error(), traceID)
+	case errors.Is(err, ErrInvalidRequest):
+		return NewInvalidRequest(err.Error(), traceID)
+	case errors.Is(err, ErrNotFound):
+		return NewNotFound(err.Error(), traceID)
+	case errors.Is(err, ErrUnknownTenant):
+		return NewUnknownTenant(err.Error(), traceID)
+	case errors.Is(err, ErrServiceUnavailable):
+		return NewServiceUnavailable(err.Error(), traceID)
+	case errors.Is(err, ErrOperationNotSupported):
+		return NewOperationNotSupported(err.Error(), traceID)
+	default:
+		return NewInternalError(err.Error(), traceID)
+	}
+}
+
 // UnknownTenant reports that the request tries to interact with an unknown tenant
 type UnknownTenant struct {
 	ProblemDetailsImpl
@@ -300,6 +455,21 @@ func (p *ProblemDetailsImpl) ContentType() string {
 	return ProblemReportContentType
 }
 
+// Type returns the URI that identifies the type of problem
+func (p *ProblemDetailsImpl) Type() string {
+	return p.typ
+}
+
+// Title returns a short summary of the type of problem
+func (p *ProblemDetailsImpl) Title() string {
+	return p.title
+}
+
+// Detail returns an explanation that is specific to this occurrence of the problem
+func (p *ProblemDetailsImpl) Detail() string {
+	return p.detail
+}
+
 // MarshalJSON is called when a ProblemDetailsImpl instance should be serialized to JSON
 func (p *ProblemDetailsImpl) MarshalJSON() ([]byte, error) {
 	var traceID *string
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/diwise/context-broker/pkg/ngsild/errors"
 	"github.com/diwise/context-broker/pkg/ngsild/types"
 )
 
@@ -21,6 +22,34 @@ func (r CreateEntityResult) Location() string {
 	return r.location
 }
 
+type RegisterContextSourceResult struct {
+	location string
+}
+
+func NewRegisterContextSourceResult(location string) *RegisterContextSourceResult {
+	return &RegisterContextSourceResult{
+		location: location,
+	}
+}
+
+func (r RegisterContextSourceResult) Location() string {
+	return r.location
+}
+
+type CreateSubscriptionResult struct {
+	location string
+}
+
+func NewCreateSubscriptionResult(location string) *CreateSubscriptionResult {
+	return &CreateSubscriptionResult{
+		location: location,
+	}
+}
+
+func (r CreateSubscriptionResult) Location() string {
+	return r.location
+}
+
 type RetrieveTemporalEvolutionOfEntityResult struct {
 	Found         types.EntityTemporal
 	ContentRange  *ContentRange
@@ -81,6 +110,20 @@ func NewMergeEntityResult(body []byte) (*MergeEntityResult, error) {
 	return mer, nil
 }
 
+type ReplaceEntityResult struct {
+}
+
+func NewReplaceEntityResult() *ReplaceEntityResult {
+	return &ReplaceEntityResult{}
+}
+
+type ReplaceAttributeResult struct {
+}
+
+func NewReplaceAttributeResult() *ReplaceAttributeResult {
+	return &ReplaceAttributeResult{}
+}
+
 type UpdateEntityAttributesResult struct {
 	Updated    []string `json:"updated"`
 	NotUpdated []struct {
@@ -109,6 +152,43 @@ func NewUpdateEntityAttributesResult(body []byte) (*UpdateEntityAttributesResult
 	return uear, nil
 }
 
+// AppendEntityAttributesResult lists the attributes that were appended, and those that were not
+type AppendEntityAttributesResult UpdateEntityAttributesResult
+
+func (aear *AppendEntityAttributesResult) Bytes() []byte {
+	b, _ := json.Marshal(aear)
+	return b
+}
+
+func (aear *AppendEntityAttributesResult) IsMultiStatus() bool {
+	return len(aear.NotUpdated) > 0
+}
+
+func NewAppendEntityAttributesResult(body []byte) (*AppendEntityAttributesResult, error) {
+	aear := &AppendEntityAttributesResult{}
+	if len(body) > 0 {
+		err := json.Unmarshal(body, aear)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aear, nil
+}
+
+type PatchAttributeResult struct {
+}
+
+func NewPatchAttributeResult() *PatchAttributeResult {
+	return &PatchAttributeResult{}
+}
+
+type DeleteAttributeResult struct {
+}
+
+func NewDeleteAttributeResult() *DeleteAttributeResult {
+	return &DeleteAttributeResult{}
+}
+
 type DeleteEntityResult struct {
 }
 
@@ -116,3 +196,60 @@ func NewDeleteEntityResult() *DeleteEntityResult {
 	del := &DeleteEntityResult{}
 	return del
 }
+
+// BatchOperationResult reports the entities of a batch operation that succeeded, and why
+// the operation failed for the others
+type BatchOperationResult struct {
+	Success []string           `json:"success"`
+	Errors  []BatchEntityError `json:"errors"`
+}
+
+type BatchEntityError struct {
+	EntityID string         `json:"entityId"`
+	Error    ProblemDetails `json:"error"`
+}
+
+type ProblemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func NewBatchOperationResult() *BatchOperationResult {
+	return &BatchOperationResult{
+		Success: []string{},
+		Errors:  []BatchEntityError{},
+	}
+}
+
+// Succeeded adds entities that the operation succeeded for
+func (bor *BatchOperationResult) Succeeded(entityIDs ...string) {
+	bor.Success = append(bor.Success, entityIDs...)
+}
+
+// Failed adds entities that the operation failed for, described by the problem details of the error
+func (bor *BatchOperationResult) Failed(err error, entityIDs ...string) {
+	pd := errors.NewProblemDetailsFromError(err, "")
+
+	for _, id := range entityIDs {
+		bor.Errors = append(bor.Errors, BatchEntityError{
+			EntityID: id,
+			Error:    ProblemDetails{Type: pd.Type(), Title: pd.Title(), Detail: pd.Detail()},
+		})
+	}
+}
+
+// Append adds the outcome of another batch operation to this one
+func (bor *BatchOperationResult) Append(other *BatchOperationResult) {
+	bor.Success = append(bor.Success, other.Success...)
+	bor.Errors = append(bor.Errors, other.Errors...)
+}
+
+func (bor *BatchOperationResult) Bytes() []byte {
+	b, _ := json.Marshal(bor)
+	return b
+}
+
+func (bor *BatchOperationResult) IsMultiStatus() bool {
+	return len(bor.Errors) > 0
+}
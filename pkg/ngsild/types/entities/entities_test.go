@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+	"github.com/diwise/context-broker/pkg/ngsild/types/relationships"
 	"github.com/matryer/is"
 )
 
@@ -64,6 +66,46 @@ func TestRemoveAttribute(t *testing.T) {
 	is.Equal(1, len(impl.properties))
 }
 
+func TestMergeKeepsTheFirstOccurrenceOfAnAttribute(t *testing.T) {
+	is := is.New(t)
+
+	static, err := New("urn:ngsi-ld:Beach:01", "Beach",
+		P("name", properties.NewTextProperty("Hartungviken")),
+		P("temperature", properties.NewNumberProperty(12.0)),
+	)
+	is.NoErr(err)
+
+	observed, err := New("urn:ngsi-ld:Beach:01", "Beach",
+		P("temperature", properties.NewNumberProperty(17.2)),
+		R("refDevice", relationships.NewSingleObjectRelationship("urn:ngsi-ld:Device:01")),
+	)
+	is.NoErr(err)
+
+	merged := Merge(observed, static)
+	is.Equal(merged.ID(), "urn:ngsi-ld:Beach:01")
+
+	b, err := json.Marshal(merged)
+	is.NoErr(err)
+	is.Equal(string(b), `{"@context":["`+DefaultContextURL+`"],"id":"urn:ngsi-ld:Beach:01","name":{"type":"Property","value":"Hartungviken"},"refDevice":{"type":"Relationship","object":"urn:ngsi-ld:Device:01"},"temperature":{"type":"Property","value":17.2},"type":"Beach"}`)
+}
+
+func TestSelectFragmentAttributes(t *testing.T) {
+	is := is.New(t)
+
+	fragment, err := NewFragmentFromJSON([]byte(entityJSON))
+	is.NoErr(err)
+
+	selected := SelectFragmentAttributes(fragment, func(attributeName string) bool {
+		return attributeName == "refDevice"
+	})
+
+	names := []string{}
+	selected.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		names = append(names, attributeName)
+	})
+	is.Equal(names, []string{"refDevice"})
+}
+
 var entityJSON string = `{
     "id": "urn:ngsi-ld:WeatherObserved:observationid",
     "type": "WeatherObserved",
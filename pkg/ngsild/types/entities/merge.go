@@ -0,0 +1,108 @@
+package entities
+
+import (
+	"slices"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+)
+
+// Merge combines entities with the same id, for instance as provided by different context
+// sources, into a single entity. If more than one of the entities contain an attribute with
+// the same name, the attribute of the entity that comes first is kept.
+func Merge(entity types.Entity, others ...types.Entity) types.Entity {
+	entityID, entityType := entity.ID(), entity.Type()
+
+	merged := &EntityImpl{
+		entityID:      &entityID,
+		entityType:    &entityType,
+		context:       []string{},
+		properties:    map[string]types.Property{},
+		relationships: map[string]types.Relationship{},
+	}
+
+	for _, e := range append([]types.Entity{entity}, others...) {
+		for _, ctx := range contextOf(e) {
+			if !slices.Contains(merged.context, ctx) {
+				merged.context = append(merged.context, ctx)
+			}
+		}
+
+		e.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+			merged.addAttribute(attributeName, contents)
+		})
+	}
+
+	if len(merged.context) == 0 {
+		merged.context = []string{DefaultContextURL}
+	}
+
+	return merged
+}
+
+// SelectAttributes returns a copy of the entity that only contains the attributes for
+// which the predicate returns true
+func SelectAttributes(entity types.Entity, predicate func(attributeName string) bool) types.Entity {
+	entityID, entityType := entity.ID(), entity.Type()
+
+	selected := selectAttributes(entity, predicate)
+	selected.entityID = &entityID
+	selected.entityType = &entityType
+
+	return selected
+}
+
+// SelectFragmentAttributes returns a copy of the fragment that only contains the attributes
+// for which the predicate returns true
+func SelectFragmentAttributes(fragment types.EntityFragment, predicate func(attributeName string) bool) types.EntityFragment {
+	return selectAttributes(fragment, predicate)
+}
+
+func selectAttributes(fragment types.EntityFragment, predicate func(attributeName string) bool) *EntityImpl {
+	selected := &EntityImpl{
+		context:       contextOf(fragment),
+		properties:    map[string]types.Property{},
+		relationships: map[string]types.Relationship{},
+	}
+
+	if selected.context == nil {
+		selected.context = []string{DefaultContextURL}
+	}
+
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		if predicate(attributeName) {
+			selected.addAttribute(attributeName, contents)
+		}
+	})
+
+	return selected
+}
+
+// addAttribute adds a property or relationship to the entity, unless the entity already
+// contains an attribute with the same name
+func (e *EntityImpl) addAttribute(name string, contents any) {
+	if _, ok := e.properties[name]; ok {
+		return
+	}
+
+	if _, ok := e.relationships[name]; ok {
+		return
+	}
+
+	switch attr := contents.(type) {
+	case types.Relationship:
+		e.relationships[name] = attr
+	case types.Property:
+		e.properties[name] = attr
+	}
+}
+
+func contextOf(fragment types.EntityFragment) []string {
+	switch e := fragment.(type) {
+	case *EntityImpl:
+		return slices.Clone(e.context)
+	case EntityImpl:
+		return slices.Clone(e.context)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package registrations
+
+import (
+	"encoding/json"
+)
+
+type EntityInfo struct {
+	ID        string `json:"id,omitempty"`
+	IDPattern string `json:"idPattern,omitempty"`
+	Type      string `json:"type"`
+}
+
+type RegistrationInfo struct {
+	Entities          []EntityInfo `json:"entities"`
+	PropertyNames     []string     `json:"propertyNames,omitempty"`
+	RelationshipNames []string     `json:"relationshipNames,omitempty"`
+}
+
+// ContextSourceRegistration is a NGSI-LD registration of a context source that
+// is able to provide information about the described entities
+type ContextSourceRegistration struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type"`
+	Information []RegistrationInfo `json:"information"`
+	Endpoint    string             `json:"endpoint"`
+	Tenant      string             `json:"tenant,omitempty"`
+	Location    *Geometry          `json:"location,omitempty"`
+	Context     json.RawMessage    `json:"@context,omitempty"`
+}
+
+// Geometry is the GeoJSON geometry of the area that a context source covers
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+const RegistrationType string = "ContextSourceRegistration"
+
+// EntityTypes returns the distinct entity types that are covered by a registration
+func (csr *ContextSourceRegistration) EntityTypes() []string {
+	entityTypes := []string{}
+	seen := map[string]struct{}{}
+
+	for _, info := range csr.Information {
+		for _, e := range info.Entities {
+			if _, ok := seen[e.Type]; !ok {
+				seen[e.Type] = struct{}{}
+				entityTypes = append(entityTypes, e.Type)
+			}
+		}
+	}
+
+	return entityTypes
+}
@@ -42,10 +42,15 @@ func (n *Notification) UnmarshalJSON(data []byte) error {
 }
 
 func NewNotification(e types.Entity) *Notification {
+	return NewSubscriptionNotification("notimplemented", e)
+}
+
+// NewSubscriptionNotification creates a notification about an entity on behalf of the subscription with the given id
+func NewSubscriptionNotification(subscriptionID string, e types.Entity) *Notification {
 	n := &Notification{
 		Id:             fmt.Sprintf("urn:ngsi-ld:Notification:%s", uuid.New().String()),
 		Type:           "Notification",
-		SubscriptionId: "notimplemented",
+		SubscriptionId: subscriptionID,
 		NotifiedAt:     time.Now().UTC().Format(time.RFC3339Nano),
 		Data:           []types.Entity{e},
 	}
@@ -0,0 +1,75 @@
+package subscriptions
+
+import (
+	"encoding/json"
+)
+
+type EntityInfo struct {
+	ID        string `json:"id,omitempty"`
+	IDPattern string `json:"idPattern,omitempty"`
+	Type      string `json:"type"`
+}
+
+// GeoQuery restricts a subscription to entities whose location matches a geospatial relationship
+type GeoQuery struct {
+	Geometry    string          `json:"geometry"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	GeoRel      string          `json:"georel"`
+	GeoProperty string          `json:"geoproperty,omitempty"`
+}
+
+// Endpoint describes where, and in what format, notifications are sent
+type Endpoint struct {
+	URI    string `json:"uri"`
+	Accept string `json:"accept,omitempty"`
+}
+
+type NotificationParams struct {
+	Attributes []string `json:"attributes,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	Endpoint   Endpoint `json:"endpoint"`
+}
+
+// Subscription is a NGSI-LD subscription to notifications about changes to the
+// described entities
+type Subscription struct {
+	ID                string             `json:"id"`
+	Type              string             `json:"type"`
+	Description       string             `json:"description,omitempty"`
+	Entities          []EntityInfo       `json:"entities,omitempty"`
+	WatchedAttributes []string           `json:"watchedAttributes,omitempty"`
+	Q                 string             `json:"q,omitempty"`
+	GeoQ              *GeoQuery          `json:"geoQ,omitempty"`
+	Notification      NotificationParams `json:"notification"`
+	IsActive          *bool              `json:"isActive,omitempty"`
+	Context           json.RawMessage    `json:"@context,omitempty"`
+}
+
+const SubscriptionType string = "Subscription"
+
+// The formats that the entities of a notification can be sent in
+const (
+	FormatNormalized string = "normalized"
+	FormatKeyValues  string = "keyValues"
+)
+
+// Active reports whether notifications should be sent for the subscription, which they
+// are unless it has been explicitly deactivated
+func (s *Subscription) Active() bool {
+	return s.IsActive == nil || *s.IsActive
+}
+
+// EntityTypes returns the distinct entity types that a subscription is about
+func (s *Subscription) EntityTypes() []string {
+	entityTypes := []string{}
+	seen := map[string]struct{}{}
+
+	for _, e := range s.Entities {
+		if _, ok := seen[e.Type]; !ok {
+			seen[e.Type] = struct{}{}
+			entityTypes = append(entityTypes, e.Type)
+		}
+	}
+
+	return entityTypes
+}
@@ -22,30 +22,57 @@ var _ ContextBrokerClient = &ContextBrokerClientMock{}
 //
 // 		// make and configure a mocked ContextBrokerClient
 // 		mockedContextBrokerClient := &ContextBrokerClientMock{
+// 			AppendEntityAttributesFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+// 				panic("mock out the AppendEntityAttributes method")
+// 			},
+// 			CreateEntitiesFunc: func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the CreateEntities method")
+// 			},
 // 			CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
 // 				panic("mock out the CreateEntity method")
 // 			},
+// 			DeleteAttributeFunc: func(ctx context.Context, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+// 				panic("mock out the DeleteAttribute method")
+// 			},
+// 			DeleteEntitiesFunc: func(ctx context.Context, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the DeleteEntities method")
+// 			},
 // 			DeleteEntityFunc: func(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
 // 				panic("mock out the DeleteEntity method")
 // 			},
 // 			MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
 // 				panic("mock out the MergeEntity method")
 // 			},
+// 			PatchAttributeFunc: func(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+// 				panic("mock out the PatchAttribute method")
+// 			},
 // 			QueryEntitiesFunc: func(ctx context.Context, entityTypes []string, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
 // 				panic("mock out the QueryEntities method")
 // 			},
 // 			QueryTemporalEvolutionOfEntitiesFunc: func(ctx context.Context, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.QueryTemporalEntitiesResult, error) {
 // 				panic("mock out the QueryTemporalEvolutionOfEntities method")
 // 			},
+// 			ReplaceAttributeFunc: func(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+// 				panic("mock out the ReplaceAttribute method")
+// 			},
+// 			ReplaceEntityFunc: func(ctx context.Context, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+// 				panic("mock out the ReplaceEntity method")
+// 			},
 // 			RetrieveEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
 // 				panic("mock out the RetrieveEntity method")
 // 			},
 // 			RetrieveTemporalEvolutionOfEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error) {
 // 				panic("mock out the RetrieveTemporalEvolutionOfEntity method")
 // 			},
+// 			UpdateEntitiesFunc: func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the UpdateEntities method")
+// 			},
 // 			UpdateEntityAttributesFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
 // 				panic("mock out the UpdateEntityAttributes method")
 // 			},
+// 			UpsertEntitiesFunc: func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+// 				panic("mock out the UpsertEntities method")
+// 			},
 // 		}
 //
 // 		// use mockedContextBrokerClient in code that requires ContextBrokerClient
@@ -53,32 +80,79 @@ var _ ContextBrokerClient = &ContextBrokerClientMock{}
 //
 // 	}
 type ContextBrokerClientMock struct {
+	// AppendEntityAttributesFunc mocks the AppendEntityAttributes method.
+	AppendEntityAttributesFunc func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error)
+
+	// CreateEntitiesFunc mocks the CreateEntities method.
+	CreateEntitiesFunc func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
 	// CreateEntityFunc mocks the CreateEntity method.
 	CreateEntityFunc func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error)
 
+	// DeleteAttributeFunc mocks the DeleteAttribute method.
+	DeleteAttributeFunc func(ctx context.Context, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error)
+
+	// DeleteEntitiesFunc mocks the DeleteEntities method.
+	DeleteEntitiesFunc func(ctx context.Context, entityIDs []string) (*ngsild.BatchOperationResult, error)
+
 	// DeleteEntityFunc mocks the DeleteEntity method.
 	DeleteEntityFunc func(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error)
 
 	// MergeEntityFunc mocks the MergeEntity method.
 	MergeEntityFunc func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error)
 
+	// PatchAttributeFunc mocks the PatchAttribute method.
+	PatchAttributeFunc func(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error)
+
 	// QueryEntitiesFunc mocks the QueryEntities method.
 	QueryEntitiesFunc func(ctx context.Context, entityTypes []string, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error)
 
 	// QueryTemporalEvolutionOfEntitiesFunc mocks the QueryTemporalEvolutionOfEntities method.
 	QueryTemporalEvolutionOfEntitiesFunc func(ctx context.Context, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.QueryTemporalEntitiesResult, error)
 
+	// ReplaceAttributeFunc mocks the ReplaceAttribute method.
+	ReplaceAttributeFunc func(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error)
+
+	// ReplaceEntityFunc mocks the ReplaceEntity method.
+	ReplaceEntityFunc func(ctx context.Context, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error)
+
 	// RetrieveEntityFunc mocks the RetrieveEntity method.
 	RetrieveEntityFunc func(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error)
 
 	// RetrieveTemporalEvolutionOfEntityFunc mocks the RetrieveTemporalEvolutionOfEntity method.
 	RetrieveTemporalEvolutionOfEntityFunc func(ctx context.Context, entityID string, headers map[string][]string, parameters ...RequestDecoratorFunc) (*ngsild.RetrieveTemporalEvolutionOfEntityResult, error)
 
+	// UpdateEntitiesFunc mocks the UpdateEntities method.
+	UpdateEntitiesFunc func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
 	// UpdateEntityAttributesFunc mocks the UpdateEntityAttributes method.
 	UpdateEntityAttributesFunc func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error)
 
+	// UpsertEntitiesFunc mocks the UpsertEntities method.
+	UpsertEntitiesFunc func(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// AppendEntityAttributes holds details about calls to the AppendEntityAttributes method.
+		AppendEntityAttributes []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityID is the entityID argument value.
+			EntityID string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// CreateEntities holds details about calls to the CreateEntities method.
+		CreateEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// CreateEntity holds details about calls to the CreateEntity method.
 		CreateEntity []struct {
 			// Ctx is the ctx argument value.
@@ -88,6 +162,26 @@ type ContextBrokerClientMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// DeleteAttribute holds details about calls to the DeleteAttribute method.
+		DeleteAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// DatasetID is the datasetID argument value.
+			DatasetID string
+			// DeleteAll is the deleteAll argument value.
+			DeleteAll bool
+		}
+		// DeleteEntities holds details about calls to the DeleteEntities method.
+		DeleteEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityIDs is the entityIDs argument value.
+			EntityIDs []string
+		}
 		// DeleteEntity holds details about calls to the DeleteEntity method.
 		DeleteEntity []struct {
 			// Ctx is the ctx argument value.
@@ -106,6 +200,19 @@ type ContextBrokerClientMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// PatchAttribute holds details about calls to the PatchAttribute method.
+		PatchAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// QueryEntities holds details about calls to the QueryEntities method.
 		QueryEntities []struct {
 			// Ctx is the ctx argument value.
@@ -128,6 +235,30 @@ type ContextBrokerClientMock struct {
 			// Parameters is the parameters argument value.
 			Parameters []RequestDecoratorFunc
 		}
+		// ReplaceAttribute holds details about calls to the ReplaceAttribute method.
+		ReplaceAttribute []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityID is the entityID argument value.
+			EntityID string
+			// AttributeName is the attributeName argument value.
+			AttributeName string
+			// Fragment is the fragment argument value.
+			Fragment types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
+		// ReplaceEntity holds details about calls to the ReplaceEntity method.
+		ReplaceEntity []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EntityID is the entityID argument value.
+			EntityID string
+			// Entity is the entity argument value.
+			Entity types.EntityFragment
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// RetrieveEntity holds details about calls to the RetrieveEntity method.
 		RetrieveEntity []struct {
 			// Ctx is the ctx argument value.
@@ -148,6 +279,15 @@ type ContextBrokerClientMock struct {
 			// Parameters is the parameters argument value.
 			Parameters []RequestDecoratorFunc
 		}
+		// UpdateEntities holds details about calls to the UpdateEntities method.
+		UpdateEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 		// UpdateEntityAttributes holds details about calls to the UpdateEntityAttributes method.
 		UpdateEntityAttributes []struct {
 			// Ctx is the ctx argument value.
@@ -159,15 +299,115 @@ type ContextBrokerClientMock struct {
 			// Headers is the headers argument value.
 			Headers map[string][]string
 		}
+		// UpsertEntities holds details about calls to the UpsertEntities method.
+		UpsertEntities []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Entities is the entities argument value.
+			Entities []types.Entity
+			// Headers is the headers argument value.
+			Headers map[string][]string
+		}
 	}
+	lockAppendEntityAttributes            sync.RWMutex
+	lockCreateEntities                    sync.RWMutex
 	lockCreateEntity                      sync.RWMutex
+	lockDeleteAttribute                   sync.RWMutex
+	lockDeleteEntities                    sync.RWMutex
 	lockDeleteEntity                      sync.RWMutex
 	lockMergeEntity                       sync.RWMutex
+	lockPatchAttribute                    sync.RWMutex
 	lockQueryEntities                     sync.RWMutex
 	lockQueryTemporalEvolutionOfEntities  sync.RWMutex
+	lockReplaceAttribute                  sync.RWMutex
+	lockReplaceEntity                     sync.RWMutex
 	lockRetrieveEntity                    sync.RWMutex
 	lockRetrieveTemporalEvolutionOfEntity sync.RWMutex
+	lockUpdateEntities                    sync.RWMutex
 	lockUpdateEntityAttributes            sync.RWMutex
+	lockUpsertEntities                    sync.RWMutex
+}
+
+// AppendEntityAttributes calls AppendEntityAttributesFunc.
+func (mock *ContextBrokerClientMock) AppendEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.AppendEntityAttributesResult, error) {
+	if mock.AppendEntityAttributesFunc == nil {
+		panic("ContextBrokerClientMock.AppendEntityAttributesFunc: method is nil but ContextBrokerClient.AppendEntityAttributes was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		EntityID: entityID,
+		Fragment: fragment,
+		Headers:  headers,
+	}
+	mock.lockAppendEntityAttributes.Lock()
+	mock.calls.AppendEntityAttributes = append(mock.calls.AppendEntityAttributes, callInfo)
+	mock.lockAppendEntityAttributes.Unlock()
+	return mock.AppendEntityAttributesFunc(ctx, entityID, fragment, headers)
+}
+
+// AppendEntityAttributesCalls gets all the calls that were made to AppendEntityAttributes.
+// Check the length with:
+//     len(mockedContextBrokerClient.AppendEntityAttributesCalls())
+func (mock *ContextBrokerClientMock) AppendEntityAttributesCalls() []struct {
+	Ctx      context.Context
+	EntityID string
+	Fragment types.EntityFragment
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		EntityID string
+		Fragment types.EntityFragment
+		Headers  map[string][]string
+	}
+	mock.lockAppendEntityAttributes.RLock()
+	calls = mock.calls.AppendEntityAttributes
+	mock.lockAppendEntityAttributes.RUnlock()
+	return calls
+}
+
+// CreateEntities calls CreateEntitiesFunc.
+func (mock *ContextBrokerClientMock) CreateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.CreateEntitiesFunc == nil {
+		panic("ContextBrokerClientMock.CreateEntitiesFunc: method is nil but ContextBrokerClient.CreateEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockCreateEntities.Lock()
+	mock.calls.CreateEntities = append(mock.calls.CreateEntities, callInfo)
+	mock.lockCreateEntities.Unlock()
+	return mock.CreateEntitiesFunc(ctx, entities, headers)
+}
+
+// CreateEntitiesCalls gets all the calls that were made to CreateEntities.
+// Check the length with:
+//     len(mockedContextBrokerClient.CreateEntitiesCalls())
+func (mock *ContextBrokerClientMock) CreateEntitiesCalls() []struct {
+	Ctx      context.Context
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockCreateEntities.RLock()
+	calls = mock.calls.CreateEntities
+	mock.lockCreateEntities.RUnlock()
+	return calls
 }
 
 // CreateEntity calls CreateEntityFunc.
@@ -209,6 +449,88 @@ func (mock *ContextBrokerClientMock) CreateEntityCalls() []struct {
 	return calls
 }
 
+// DeleteAttribute calls DeleteAttributeFunc.
+func (mock *ContextBrokerClientMock) DeleteAttribute(ctx context.Context, entityID string, attributeName string, datasetID string, deleteAll bool) (*ngsild.DeleteAttributeResult, error) {
+	if mock.DeleteAttributeFunc == nil {
+		panic("ContextBrokerClientMock.DeleteAttributeFunc: method is nil but ContextBrokerClient.DeleteAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		DatasetID     string
+		DeleteAll     bool
+	}{
+		Ctx:           ctx,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		DatasetID:     datasetID,
+		DeleteAll:     deleteAll,
+	}
+	mock.lockDeleteAttribute.Lock()
+	mock.calls.DeleteAttribute = append(mock.calls.DeleteAttribute, callInfo)
+	mock.lockDeleteAttribute.Unlock()
+	return mock.DeleteAttributeFunc(ctx, entityID, attributeName, datasetID, deleteAll)
+}
+
+// DeleteAttributeCalls gets all the calls that were made to DeleteAttribute.
+// Check the length with:
+//     len(mockedContextBrokerClient.DeleteAttributeCalls())
+func (mock *ContextBrokerClientMock) DeleteAttributeCalls() []struct {
+	Ctx           context.Context
+	EntityID      string
+	AttributeName string
+	DatasetID     string
+	DeleteAll     bool
+} {
+	var calls []struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		DatasetID     string
+		DeleteAll     bool
+	}
+	mock.lockDeleteAttribute.RLock()
+	calls = mock.calls.DeleteAttribute
+	mock.lockDeleteAttribute.RUnlock()
+	return calls
+}
+
+// DeleteEntities calls DeleteEntitiesFunc.
+func (mock *ContextBrokerClientMock) DeleteEntities(ctx context.Context, entityIDs []string) (*ngsild.BatchOperationResult, error) {
+	if mock.DeleteEntitiesFunc == nil {
+		panic("ContextBrokerClientMock.DeleteEntitiesFunc: method is nil but ContextBrokerClient.DeleteEntities was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		EntityIDs []string
+	}{
+		Ctx:       ctx,
+		EntityIDs: entityIDs,
+	}
+	mock.lockDeleteEntities.Lock()
+	mock.calls.DeleteEntities = append(mock.calls.DeleteEntities, callInfo)
+	mock.lockDeleteEntities.Unlock()
+	return mock.DeleteEntitiesFunc(ctx, entityIDs)
+}
+
+// DeleteEntitiesCalls gets all the calls that were made to DeleteEntities.
+// Check the length with:
+//     len(mockedContextBrokerClient.DeleteEntitiesCalls())
+func (mock *ContextBrokerClientMock) DeleteEntitiesCalls() []struct {
+	Ctx       context.Context
+	EntityIDs []string
+} {
+	var calls []struct {
+		Ctx       context.Context
+		EntityIDs []string
+	}
+	mock.lockDeleteEntities.RLock()
+	calls = mock.calls.DeleteEntities
+	mock.lockDeleteEntities.RUnlock()
+	return calls
+}
+
 // DeleteEntity calls DeleteEntityFunc.
 func (mock *ContextBrokerClientMock) DeleteEntity(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
 	if mock.DeleteEntityFunc == nil {
@@ -287,6 +609,53 @@ func (mock *ContextBrokerClientMock) MergeEntityCalls() []struct {
 	return calls
 }
 
+// PatchAttribute calls PatchAttributeFunc.
+func (mock *ContextBrokerClientMock) PatchAttribute(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.PatchAttributeResult, error) {
+	if mock.PatchAttributeFunc == nil {
+		panic("ContextBrokerClientMock.PatchAttributeFunc: method is nil but ContextBrokerClient.PatchAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}{
+		Ctx:           ctx,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		Fragment:      fragment,
+		Headers:       headers,
+	}
+	mock.lockPatchAttribute.Lock()
+	mock.calls.PatchAttribute = append(mock.calls.PatchAttribute, callInfo)
+	mock.lockPatchAttribute.Unlock()
+	return mock.PatchAttributeFunc(ctx, entityID, attributeName, fragment, headers)
+}
+
+// PatchAttributeCalls gets all the calls that were made to PatchAttribute.
+// Check the length with:
+//     len(mockedContextBrokerClient.PatchAttributeCalls())
+func (mock *ContextBrokerClientMock) PatchAttributeCalls() []struct {
+	Ctx           context.Context
+	EntityID      string
+	AttributeName string
+	Fragment      types.EntityFragment
+	Headers       map[string][]string
+} {
+	var calls []struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}
+	mock.lockPatchAttribute.RLock()
+	calls = mock.calls.PatchAttribute
+	mock.lockPatchAttribute.RUnlock()
+	return calls
+}
+
 // QueryEntities calls QueryEntitiesFunc.
 func (mock *ContextBrokerClientMock) QueryEntities(ctx context.Context, entityTypes []string, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
 	if mock.QueryEntitiesFunc == nil {
@@ -373,6 +742,96 @@ func (mock *ContextBrokerClientMock) QueryTemporalEvolutionOfEntitiesCalls() []s
 	return calls
 }
 
+// ReplaceAttribute calls ReplaceAttributeFunc.
+func (mock *ContextBrokerClientMock) ReplaceAttribute(ctx context.Context, entityID string, attributeName string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceAttributeResult, error) {
+	if mock.ReplaceAttributeFunc == nil {
+		panic("ContextBrokerClientMock.ReplaceAttributeFunc: method is nil but ContextBrokerClient.ReplaceAttribute was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}{
+		Ctx:           ctx,
+		EntityID:      entityID,
+		AttributeName: attributeName,
+		Fragment:      fragment,
+		Headers:       headers,
+	}
+	mock.lockReplaceAttribute.Lock()
+	mock.calls.ReplaceAttribute = append(mock.calls.ReplaceAttribute, callInfo)
+	mock.lockReplaceAttribute.Unlock()
+	return mock.ReplaceAttributeFunc(ctx, entityID, attributeName, fragment, headers)
+}
+
+// ReplaceAttributeCalls gets all the calls that were made to ReplaceAttribute.
+// Check the length with:
+//     len(mockedContextBrokerClient.ReplaceAttributeCalls())
+func (mock *ContextBrokerClientMock) ReplaceAttributeCalls() []struct {
+	Ctx           context.Context
+	EntityID      string
+	AttributeName string
+	Fragment      types.EntityFragment
+	Headers       map[string][]string
+} {
+	var calls []struct {
+		Ctx           context.Context
+		EntityID      string
+		AttributeName string
+		Fragment      types.EntityFragment
+		Headers       map[string][]string
+	}
+	mock.lockReplaceAttribute.RLock()
+	calls = mock.calls.ReplaceAttribute
+	mock.lockReplaceAttribute.RUnlock()
+	return calls
+}
+
+// ReplaceEntity calls ReplaceEntityFunc.
+func (mock *ContextBrokerClientMock) ReplaceEntity(ctx context.Context, entityID string, entity types.EntityFragment, headers map[string][]string) (*ngsild.ReplaceEntityResult, error) {
+	if mock.ReplaceEntityFunc == nil {
+		panic("ContextBrokerClientMock.ReplaceEntityFunc: method is nil but ContextBrokerClient.ReplaceEntity was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		EntityID string
+		Entity   types.EntityFragment
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		EntityID: entityID,
+		Entity:   entity,
+		Headers:  headers,
+	}
+	mock.lockReplaceEntity.Lock()
+	mock.calls.ReplaceEntity = append(mock.calls.ReplaceEntity, callInfo)
+	mock.lockReplaceEntity.Unlock()
+	return mock.ReplaceEntityFunc(ctx, entityID, entity, headers)
+}
+
+// ReplaceEntityCalls gets all the calls that were made to ReplaceEntity.
+// Check the length with:
+//     len(mockedContextBrokerClient.ReplaceEntityCalls())
+func (mock *ContextBrokerClientMock) ReplaceEntityCalls() []struct {
+	Ctx      context.Context
+	EntityID string
+	Entity   types.EntityFragment
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		EntityID string
+		Entity   types.EntityFragment
+		Headers  map[string][]string
+	}
+	mock.lockReplaceEntity.RLock()
+	calls = mock.calls.ReplaceEntity
+	mock.lockReplaceEntity.RUnlock()
+	return calls
+}
+
 // RetrieveEntity calls RetrieveEntityFunc.
 func (mock *ContextBrokerClientMock) RetrieveEntity(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
 	if mock.RetrieveEntityFunc == nil {
@@ -455,6 +914,45 @@ func (mock *ContextBrokerClientMock) RetrieveTemporalEvolutionOfEntityCalls() []
 	return calls
 }
 
+// UpdateEntities calls UpdateEntitiesFunc.
+func (mock *ContextBrokerClientMock) UpdateEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.UpdateEntitiesFunc == nil {
+		panic("ContextBrokerClientMock.UpdateEntitiesFunc: method is nil but ContextBrokerClient.UpdateEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockUpdateEntities.Lock()
+	mock.calls.UpdateEntities = append(mock.calls.UpdateEntities, callInfo)
+	mock.lockUpdateEntities.Unlock()
+	return mock.UpdateEntitiesFunc(ctx, entities, headers)
+}
+
+// UpdateEntitiesCalls gets all the calls that were made to UpdateEntities.
+// Check the length with:
+//     len(mockedContextBrokerClient.UpdateEntitiesCalls())
+func (mock *ContextBrokerClientMock) UpdateEntitiesCalls() []struct {
+	Ctx      context.Context
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockUpdateEntities.RLock()
+	calls = mock.calls.UpdateEntities
+	mock.lockUpdateEntities.RUnlock()
+	return calls
+}
+
 // UpdateEntityAttributes calls UpdateEntityAttributesFunc.
 func (mock *ContextBrokerClientMock) UpdateEntityAttributes(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.UpdateEntityAttributesResult, error) {
 	if mock.UpdateEntityAttributesFunc == nil {
@@ -497,3 +995,42 @@ func (mock *ContextBrokerClientMock) UpdateEntityAttributesCalls() []struct {
 	mock.lockUpdateEntityAttributes.RUnlock()
 	return calls
 }
+
+// UpsertEntities calls UpsertEntitiesFunc.
+func (mock *ContextBrokerClientMock) UpsertEntities(ctx context.Context, entities []types.Entity, headers map[string][]string) (*ngsild.BatchOperationResult, error) {
+	if mock.UpsertEntitiesFunc == nil {
+		panic("ContextBrokerClientMock.UpsertEntitiesFunc: method is nil but ContextBrokerClient.UpsertEntities was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}{
+		Ctx:      ctx,
+		Entities: entities,
+		Headers:  headers,
+	}
+	mock.lockUpsertEntities.Lock()
+	mock.calls.UpsertEntities = append(mock.calls.UpsertEntities, callInfo)
+	mock.lockUpsertEntities.Unlock()
+	return mock.UpsertEntitiesFunc(ctx, entities, headers)
+}
+
+// UpsertEntitiesCalls gets all the calls that were made to UpsertEntities.
+// Check the length with:
+//     len(mockedContextBrokerClient.UpsertEntitiesCalls())
+func (mock *ContextBrokerClientMock) UpsertEntitiesCalls() []struct {
+	Ctx      context.Context
+	Entities []types.Entity
+	Headers  map[string][]string
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Entities []types.Entity
+		Headers  map[string][]string
+	}
+	mock.lockUpsertEntities.RLock()
+	calls = mock.calls.UpsertEntities
+	mock.lockUpsertEntities.RUnlock()
+	return calls
+}